@@ -0,0 +1,165 @@
+// Package api serves the clade.v1 CladeService: the graph kept by a daemon
+// and the builds it runs, over gRPC and an HTTP/JSON gateway.
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/lesomnus/clade/filter"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements CladeService over a daemon's graph.
+type Server struct {
+	cladev1.UnimplementedCladeServiceServer
+
+	// Graph returns the daemon's graph, computing it anew when refresh is set
+	// or no cycle computed one yet. The graph returned must not be modified.
+	Graph func(ctx context.Context, refresh bool) (*cladev1.Graph, error)
+	// Build queues a build of nodes, ids of the graph's nodes in its order.
+	Build func(nodes []string)
+	// Events carries the daemon's build events to WatchBuilds.
+	Events *Events
+}
+
+func (s *Server) graph(ctx context.Context, refresh bool) (*cladev1.Graph, error) {
+	g, err := s.Graph(ctx, refresh)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "compute graph: %v", err)
+	}
+	return g, nil
+}
+
+func (s *Server) GetGraph(ctx context.Context, req *cladev1.GetGraphRequest) (*cladev1.GetGraphResponse, error) {
+	g, err := s.graph(ctx, req.Refresh)
+	if err != nil {
+		return nil, err
+	}
+	return &cladev1.GetGraphResponse{Graph: g}, nil
+}
+
+func (s *Server) ListOutdated(ctx context.Context, req *cladev1.ListOutdatedRequest) (*cladev1.ListOutdatedResponse, error) {
+	f, err := filter.New(req.Ports, req.Repos, req.Select)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	g, err := s.graph(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &cladev1.ListOutdatedResponse{Nodes: []*cladev1.Node{}}
+	for _, n := range f.Nodes(g.Nodes) {
+		if n.Outdated {
+			res.Nodes = append(res.Nodes, n)
+		}
+	}
+	if g.Metadata != nil {
+		res.GeneratedAt = g.Metadata.GeneratedAt
+	}
+	return res, nil
+}
+
+func (s *Server) Explain(ctx context.Context, req *cladev1.ExplainRequest) (*cladev1.ExplainResponse, error) {
+	g, err := s.graph(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	n := find(g, req.Node)
+	if n == nil {
+		return nil, status.Errorf(codes.NotFound, "no node %q", req.Node)
+	}
+	return Explain(g, n), nil
+}
+
+func (s *Server) TriggerBuild(ctx context.Context, req *cladev1.TriggerBuildRequest) (*cladev1.TriggerBuildResponse, error) {
+	if s.Build == nil {
+		return nil, status.Error(codes.Unimplemented, "this server does not build")
+	}
+	g, err := s.graph(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	want := map[string]bool{}
+	for _, ref := range req.Nodes {
+		n := find(g, ref)
+		if n == nil {
+			return nil, status.Errorf(codes.NotFound, "no node %q", ref)
+		}
+		want[n.Id] = true
+	}
+	ids := []string{}
+	for _, n := range g.Nodes {
+		if want[n.Id] || (len(want) == 0 && n.Outdated) {
+			ids = append(ids, n.Id)
+		}
+	}
+	if len(ids) > 0 {
+		s.Build(ids)
+	}
+	return &cladev1.TriggerBuildResponse{Nodes: ids}, nil
+}
+
+func (s *Server) WatchBuilds(req *cladev1.WatchBuildsRequest, stream grpc.ServerStreamingServer[cladev1.WatchBuildsResponse]) error {
+	if s.Events == nil {
+		return status.Error(codes.Unimplemented, "this server does not build")
+	}
+	want := map[string]bool{}
+	for _, id := range req.Nodes {
+		want[id] = true
+	}
+
+	events, cancel := s.Events.Subscribe()
+	defer cancel()
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "fell behind the build events")
+			}
+			if len(want) > 0 && !want[e.Node] {
+				continue
+			}
+			if err := stream.Send(&cladev1.WatchBuildsResponse{Event: e}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// find returns the node of g whose id or one of whose tags is ref.
+func find(g *cladev1.Graph, ref string) *cladev1.Node {
+	for _, n := range g.Nodes {
+		if n.Id == ref {
+			return n
+		}
+	}
+	for _, n := range g.Nodes {
+		for _, t := range n.Tags {
+			if t == ref {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// Gateway serves CladeService as HTTP/JSON by calling it over conn, e.g.
+// GET /v1/outdated. Its routes are in proto/clade/v1/service.yaml.
+func Gateway(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux()
+	if err := cladev1.RegisterCladeServiceHandler(ctx, mux, conn); err != nil {
+		return nil, fmt.Errorf("register gateway: %w", err)
+	}
+	return mux, nil
+}
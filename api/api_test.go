@@ -0,0 +1,369 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/api"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testGraph is golang, built on an upstream that changed, and dev-golang on
+// it; python, up to date; and node, never built.
+func testGraph() *cladev1.Graph {
+	image := func(repo, tag string) *cladev1.Image {
+		return &cladev1.Image{Repo: repo, Tag: tag, Digest: "sha256:00"}
+	}
+	return &cladev1.Graph{Nodes: []*cladev1.Node{
+		{Id: "ghcr.io/me/golang:1.22.3", Tags: []string{"ghcr.io/me/golang:1.22.3", "ghcr.io/me/golang:1.22"}, Port: "ports/golang",
+			Base: "docker.io/library/golang:1.22.3", Outdated: true, Image: image("ghcr.io/me/golang", "1.22.3")},
+		{Id: "ghcr.io/me/dev-golang:1.22.3", Port: "ports/dev-golang", Base: "ghcr.io/me/golang:1.22.3",
+			Parents: []string{"ghcr.io/me/golang:1.22.3"}, Outdated: true, Image: image("ghcr.io/me/dev-golang", "1.22.3")},
+		{Id: "ghcr.io/me/python:3.12", Port: "ports/python", Base: "docker.io/library/python:3.12",
+			Image: image("ghcr.io/me/python", "3.12")},
+		{Id: "ghcr.io/me/node:22", Port: "ports/node", Base: "docker.io/library/node:22", Outdated: true,
+			Image: &cladev1.Image{Repo: "ghcr.io/me/node", Tag: "22"}},
+	}}
+}
+
+type fixture struct {
+	client  cladev1.CladeServiceClient
+	conn    *grpc.ClientConn
+	events  *api.Events
+	built   [][]string
+	refresh int
+}
+
+const testToken = "t0ken"
+
+// bearer sends a bearer token with every call.
+type bearer string
+
+func (b bearer) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(b)}, nil
+}
+
+func (bearer) RequireTransportSecurity() bool { return false }
+
+// serve serves a Server requiring token over an in-process connection, and a
+// client sending sent.
+func serve(t *testing.T, token string, sent string) *fixture {
+	t.Helper()
+	f := &fixture{events: &api.Events{}}
+	g := testGraph()
+	srv := &api.Server{
+		Graph: func(ctx context.Context, refresh bool) (*cladev1.Graph, error) {
+			if refresh {
+				f.refresh++
+			}
+			return g, nil
+		},
+		Build:  func(nodes []string) { f.built = append(f.built, nodes) },
+		Events: f.events,
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(api.Authenticate(token)...)
+	cladev1.RegisterCladeServiceServer(s, srv)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+
+	opts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if sent != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearer(sent)))
+	}
+	conn, err := grpc.NewClient("passthrough:///bufconn", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	f.conn = conn
+	f.client = cladev1.NewCladeServiceClient(conn)
+	return f
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	f := serve(t, testToken, testToken)
+
+	g, err := f.client.GetGraph(ctx, &cladev1.GetGraphRequest{Refresh: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Graph.Nodes) != 4 || f.refresh != 1 {
+		t.Errorf("graph of %d nodes, %d refreshes", len(g.Graph.Nodes), f.refresh)
+	}
+
+	outdated, err := f.client.ListOutdated(ctx, &cladev1.ListOutdatedRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nodeIDs(outdated.Nodes); !slices.Equal(got, []string{"ghcr.io/me/golang:1.22.3", "ghcr.io/me/dev-golang:1.22.3", "ghcr.io/me/node:22"}) {
+		t.Errorf("outdated = %v", got)
+	}
+	outdated, err = f.client.ListOutdated(ctx, &cladev1.ListOutdatedRequest{Ports: []string{"*golang"}, Repos: []string{"ghcr.io/me/dev-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nodeIDs(outdated.Nodes); !slices.Equal(got, []string{"ghcr.io/me/dev-golang:1.22.3"}) {
+		t.Errorf("outdated of dev-* = %v", got)
+	}
+	if _, err := f.client.ListOutdated(ctx, &cladev1.ListOutdatedRequest{Select: "port=("}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad select: %v", err)
+	}
+
+	_, err = f.client.TriggerBuild(ctx, &cladev1.TriggerBuildRequest{Nodes: []string{"ghcr.io/me/python:3.12", "ghcr.io/me/golang:1.22"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.client.TriggerBuild(ctx, &cladev1.TriggerBuildRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"ghcr.io/me/golang:1.22.3", "ghcr.io/me/python:3.12"},
+		{"ghcr.io/me/golang:1.22.3", "ghcr.io/me/dev-golang:1.22.3", "ghcr.io/me/node:22"},
+	}
+	if !slices.EqualFunc(f.built, want, slices.Equal) {
+		t.Errorf("builds = %v, want %v", f.built, want)
+	}
+	if _, err := f.client.TriggerBuild(ctx, &cladev1.TriggerBuildRequest{Nodes: []string{"ghcr.io/me/rust:1"}}); status.Code(err) != codes.NotFound {
+		t.Errorf("build of an unknown node: %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+	f := serve(t, testToken, testToken)
+
+	tcs := []struct {
+		node   string
+		reason cladev1.Reason
+		detail string
+	}{
+		{"ghcr.io/me/golang:1.22", cladev1.Reason_REASON_BASE_CHANGED, "the base docker.io/library/golang:1.22.3 changed since ghcr.io/me/golang:1.22.3 was built"},
+		{"ghcr.io/me/dev-golang:1.22.3", cladev1.Reason_REASON_PARENT_OUTDATED, "the base ghcr.io/me/golang:1.22.3 is outdated"},
+		{"ghcr.io/me/python:3.12", cladev1.Reason_REASON_UP_TO_DATE, ""},
+		{"ghcr.io/me/node:22", cladev1.Reason_REASON_MISSING, "ghcr.io/me/node:22 does not exist"},
+	}
+	for _, tc := range tcs {
+		res, err := f.client.Explain(ctx, &cladev1.ExplainRequest{Node: tc.node})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Reason != tc.reason || (tc.detail != "" && res.Detail != tc.detail) {
+			t.Errorf("%s: %s %q", tc.node, res.Reason, res.Detail)
+		}
+	}
+
+	res, err := f.client.Explain(ctx, &cladev1.ExplainRequest{Node: "ghcr.io/me/golang:1.22.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res.Descendants, []string{"ghcr.io/me/dev-golang:1.22.3"}) {
+		t.Errorf("descendants = %v", res.Descendants)
+	}
+	if _, err := f.client.Explain(ctx, &cladev1.ExplainRequest{Node: "ghcr.io/me/rust:1"}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown node: %v", err)
+	}
+}
+
+func TestWatchBuilds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := serve(t, testToken, testToken)
+
+	stream, err := f.client.WatchBuilds(ctx, &cladev1.WatchBuildsRequest{Nodes: []string{"ghcr.io/me/node:22"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream subscribes asynchronously; publish until it is seen.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			f.events.Publish(&cladev1.BuildEvent{Node: "ghcr.io/me/python:3.12", State: cladev1.BuildEvent_STATE_STARTED})
+			f.events.Publish(&cladev1.BuildEvent{Node: "ghcr.io/me/node:22", State: cladev1.BuildEvent_STATE_FAILED, Error: "boom"})
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := res.Event; e.Node != "ghcr.io/me/node:22" || e.State != cladev1.BuildEvent_STATE_FAILED || e.Error != "boom" || e.Time == nil {
+		t.Errorf("event = %v", e)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, sent := range []string{"", "wrong"} {
+		f := serve(t, testToken, sent)
+		if _, err := f.client.ListOutdated(ctx, &cladev1.ListOutdatedRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("token %q: ListOutdated: %v", sent, err)
+		}
+		stream, err := f.client.WatchBuilds(ctx, &cladev1.WatchBuildsRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("token %q: WatchBuilds: %v", sent, err)
+		}
+	}
+
+	// Without a token, only what does not make the daemon work is served.
+	f := serve(t, "", "")
+	if _, err := f.client.ListOutdated(ctx, &cladev1.ListOutdatedRequest{}); err != nil {
+		t.Errorf("ListOutdated: %v", err)
+	}
+	if _, err := f.client.GetGraph(ctx, &cladev1.GetGraphRequest{}); err != nil {
+		t.Errorf("GetGraph: %v", err)
+	}
+	if _, err := f.client.GetGraph(ctx, &cladev1.GetGraphRequest{Refresh: true}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetGraph refresh: %v", err)
+	}
+	if _, err := f.client.TriggerBuild(ctx, &cladev1.TriggerBuildRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("TriggerBuild: %v", err)
+	}
+	if f.refresh != 0 || len(f.built) != 0 {
+		t.Errorf("%d refreshes, builds %v", f.refresh, f.built)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := serve(t, testToken, "")
+	gw, err := api.Gateway(ctx, f.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	var outdated struct {
+		Nodes []struct {
+			ID string `json:"id"`
+		} `json:"nodes"`
+	}
+	get(t, srv.URL+"/v1/outdated?ports=ports/node", &outdated)
+	if len(outdated.Nodes) != 1 || outdated.Nodes[0].ID != "ghcr.io/me/node:22" {
+		t.Errorf("outdated = %+v", outdated)
+	}
+
+	var explained struct {
+		Reason string `json:"reason"`
+	}
+	get(t, srv.URL+"/v1/explain?node=ghcr.io/me/node:22", &explained)
+	if explained.Reason != "REASON_MISSING" {
+		t.Errorf("reason = %q", explained.Reason)
+	}
+
+	res, err := http.Get(srv.URL + "/v1/outdated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /v1/outdated without a token = %d", res.StatusCode)
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1/builds", strings.NewReader(`{"nodes": ["ghcr.io/me/node:22"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(f.built) != 1 || !slices.Equal(f.built[0], []string{"ghcr.io/me/node:22"}) {
+		t.Errorf("POST /v1/builds = %d; builds %v", res.StatusCode, f.built)
+	}
+
+	// Streamed as a JSON object per line. The headers come with the first.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			f.events.Publish(&cladev1.BuildEvent{Node: "ghcr.io/me/node:22", State: cladev1.BuildEvent_STATE_SUCCEEDED})
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/builds:watch", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Result struct {
+			Event struct {
+				Node  string `json:"node"`
+				State string `json:"state"`
+			} `json:"event"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatalf("%v: %s", err, line)
+	}
+	if e := msg.Result.Event; e.Node != "ghcr.io/me/node:22" || e.State != "STATE_SUCCEEDED" {
+		t.Errorf("event = %s", line)
+	}
+}
+
+func get(t *testing.T, url string, v any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", url, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nodeIDs(nodes []*cladev1.Node) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Id
+	}
+	return out
+}
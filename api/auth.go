@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticate returns the options of a gRPC server requiring token as a
+// bearer token, the "authorization: Bearer <token>" metadata, on every call;
+// the gateway forwards the Authorization header as it. Without a token, calls
+// are not authenticated, but those that make the daemon work are refused:
+// TriggerBuild, and GetGraph with refresh.
+func Authenticate(token string) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := authorize(ctx, token, req); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authorize(ss.Context(), token, nil); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func authorize(ctx context.Context, token string, req any) error {
+	if token == "" {
+		switch req := req.(type) {
+		case *cladev1.TriggerBuildRequest:
+			return status.Error(codes.PermissionDenied, "no API token is configured; builds cannot be triggered")
+		case *cladev1.GetGraphRequest:
+			if req.Refresh {
+				return status.Error(codes.PermissionDenied, "no API token is configured; the graph cannot be refreshed")
+			}
+		}
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		got, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventBuffer is how many events a subscriber may fall behind by.
+const eventBuffer = 256
+
+// Events fans build events out to the WatchBuilds streams. The zero value is
+// ready to use.
+type Events struct {
+	mu   sync.Mutex
+	subs map[chan *cladev1.BuildEvent]struct{}
+}
+
+// Publish sends e to every subscriber. A subscriber too far behind is
+// dropped, its channel closed, rather than stall the builds.
+func (es *Events) Publish(e *cladev1.BuildEvent) {
+	if e.Time == nil {
+		e.Time = timestamppb.New(time.Now())
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for c := range es.subs {
+		select {
+		case c <- e:
+		default:
+			delete(es.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on, and a
+// function ending the subscription.
+func (es *Events) Subscribe() (<-chan *cladev1.BuildEvent, func()) {
+	c := make(chan *cladev1.BuildEvent, eventBuffer)
+	es.mu.Lock()
+	if es.subs == nil {
+		es.subs = map[chan *cladev1.BuildEvent]struct{}{}
+	}
+	es.subs[c] = struct{}{}
+	es.mu.Unlock()
+
+	return c, func() {
+		es.mu.Lock()
+		defer es.mu.Unlock()
+		if _, ok := es.subs[c]; ok {
+			delete(es.subs, c)
+			close(c)
+		}
+	}
+}
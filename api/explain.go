@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+// Explain tells why n, a node of g, is outdated or up to date. It reads the
+// flags the graph was marked with and fetches nothing.
+func Explain(g *cladev1.Graph, n *cladev1.Node) *cladev1.ExplainResponse {
+	by_id := make(map[string]*cladev1.Node, len(g.Nodes))
+	for _, m := range g.Nodes {
+		by_id[m.Id] = m
+	}
+	res := &cladev1.ExplainResponse{
+		Node:              n,
+		OutdatedAncestors: outdatedAncestors(n, by_id),
+		Descendants:       descendants(g, n),
+	}
+
+	switch {
+	case !n.Outdated:
+		res.Reason = cladev1.Reason_REASON_UP_TO_DATE
+		res.Detail = fmt.Sprintf("%s is present and its base has not changed since it was built", n.Id)
+	case len(res.OutdatedAncestors) > 0:
+		res.Reason = cladev1.Reason_REASON_PARENT_OUTDATED
+		res.Detail = fmt.Sprintf("the base %s is outdated", res.OutdatedAncestors[0])
+	case n.Image == nil || n.Image.Digest == "":
+		res.Reason = cladev1.Reason_REASON_MISSING
+		res.Detail = fmt.Sprintf("%s does not exist", n.Id)
+	default:
+		res.Reason = cladev1.Reason_REASON_BASE_CHANGED
+		res.Detail = fmt.Sprintf("the base %s changed since %s was built", n.Base, n.Id)
+	}
+	return res
+}
+
+// outdatedAncestors returns the outdated internal ancestors of n, nearest
+// first.
+func outdatedAncestors(n *cladev1.Node, by_id map[string]*cladev1.Node) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	queue := n.Parents
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		p, ok := by_id[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if p.Outdated {
+			out = append(out, id)
+		}
+		queue = append(queue, p.Parents...)
+	}
+	return out
+}
+
+// descendants returns the nodes built on n, transitively, in the order of g.
+func descendants(g *cladev1.Graph, n *cladev1.Node) []string {
+	out := []string{}
+	below := map[string]bool{n.Id: true}
+	for _, m := range g.Nodes {
+		for _, pid := range m.Parents {
+			if below[pid] {
+				below[m.Id] = true
+				out = append(out, m.Id)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -9,6 +9,7 @@ import (
 
 func init() {
 	Register("bake", newBake)
+	RegisterSchema("bake", optionsSchema)
 }
 
 // bake builds via `docker buildx bake`, synthesizing a single-target bake
@@ -56,10 +57,10 @@ func (b *bake) file() bakeFile {
 	o, spec := b.opts, b.spec
 	t := bakeTarget{
 		Context:     o.contextDir(spec.Dir),
-		Dockerfile:  o.dockerfilePath(spec.Dir),
+		Dockerfile:  o.dockerfileOf(spec),
 		Tags:        spec.Tags,
 		Target:      o.Target,
-		Platforms:   o.Platforms,
+		Platforms:   o.platformsOf(spec),
 		Args:        o.buildArgs(spec),
 		Labels:      o.imageLabels(spec),
 		Annotations: o.Annotations,
@@ -110,7 +111,7 @@ func (b *bake) Build(ctx context.Context) error {
 	o := b.spec.execOpts()
 	if o.dryRun {
 		fmt.Fprintf(o.stdout, "%s\n", def)
-		fmt.Fprintln(o.stdout, shellCommand(o.bin, b.args("clade-bake.json")))
+		fmt.Fprintln(o.stdout, ShellCommand(o.bin, b.args("clade-bake.json")))
 		return nil
 	}
 
@@ -6,39 +6,52 @@ package builder
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 )
 
 // Spec is the runtime description of a single build: what image to produce and
 // from what base. It is independent of the build strategy; strategy-specific
-// options come from the port's raw build config instead.
+// options come from the port's raw build config instead. Its JSON form (the
+// execution settings excluded) is what `clade build --log-dir` records.
 type Spec struct {
 	// Dir is the port directory; relative paths resolve against it.
-	Dir string
+	Dir string `json:"dir"`
 	// Tags are the full references to tag the image with, e.g. "repo:1.2.3".
-	Tags []string
+	Tags []string `json:"tags"`
 	// Base is the upstream image reference, injected as the BASE build arg.
 	// Empty for sources without a base image (e.g. http), which inject no BASE.
-	Base string
+	Base string `json:"base,omitempty"`
 	// BaseTag is the selected upstream tag, injected as the BASE_TAG build arg
 	// for every source kind (e.g. "1.22.3-alpine" or "1.2.3").
-	BaseTag string
+	BaseTag string `json:"base_tag,omitempty"`
+	// Dockerfile, when set, is built instead of the configured Dockerfile,
+	// e.g. one rendered from the port's Dockerfile.tmpl. The context is still
+	// resolved against Dir.
+	Dockerfile string `json:"dockerfile,omitempty"`
+	// Args are build args to inject over the configured ones (e.g. the node's
+	// matrix values).
+	Args map[string]string `json:"args,omitempty"`
 	// Labels are labels to inject (e.g. the base name and digest).
-	Labels map[string]string
+	Labels map[string]string `json:"labels,omitempty"`
+	// Platforms, when set, are built for instead of the configured ones, e.g.
+	// only the host's for an image loaded to be tested.
+	Platforms []string `json:"platforms,omitempty"`
 
 	// Push pushes the result to the registry; Load loads it into the local
 	// image store. They are mutually exclusive.
-	Push bool
-	Load bool
+	Push bool `json:"push"`
+	Load bool `json:"load"`
 
 	// DryRun prints the command instead of executing it.
-	DryRun bool
-	// Bin is the binary to invoke (default "docker").
-	Bin string
+	DryRun bool `json:"-"`
+	// Bin is the docker binary the buildx-family strategies invoke (default
+	// "docker"). The podman, buildah and exec strategies run their own binary.
+	Bin string `json:"-"`
 	// Stdout and Stderr receive command output (default os.Stdout/os.Stderr).
-	Stdout io.Writer
-	Stderr io.Writer
+	Stdout io.Writer `json:"-"`
+	Stderr io.Writer `json:"-"`
 }
 
 // Builder performs a single, fully-configured build.
@@ -60,6 +73,37 @@ func Register(kind string, f Factory) {
 	factories[kind] = f
 }
 
+var schemas = map[string]json.RawMessage{}
+
+// RegisterSchema declares the JSON Schema of the mapping kind is configured
+// with, which `clade lint` validates ports against and exports for editors. It
+// describes the kind's own fields; the linter adds kind itself. It panics on a
+// duplicate or malformed schema and is intended to be called from init, next
+// to Register.
+func RegisterSchema(kind string, schema string) {
+	if _, dup := schemas[kind]; dup {
+		panic(fmt.Sprintf("builder: schema of kind %q already registered", kind))
+	}
+	if !json.Valid([]byte(schema)) {
+		panic(fmt.Sprintf("builder: schema of kind %q is not valid JSON", kind))
+	}
+	schemas[kind] = json.RawMessage(schema)
+}
+
+// Schemas returns the JSON Schema of every registered kind. A kind that
+// registered none accepts any field.
+func Schemas() map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(factories))
+	for kind := range factories {
+		s, ok := schemas[kind]
+		if !ok {
+			s = json.RawMessage(`{"type":"object"}`)
+		}
+		out[kind] = s
+	}
+	return out
+}
+
 // New constructs the Builder registered under kind (empty means "build").
 func New(kind string, params []byte, spec Spec) (Builder, error) {
 	if kind == "" {
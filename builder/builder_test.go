@@ -108,6 +108,38 @@ func TestNoBaseInjectsBaseTagOnly(t *testing.T) {
 	}
 }
 
+func TestSpecArgs(t *testing.T) {
+	// The spec's args (a node's matrix values) are added to the configured
+	// ones and win on conflict.
+	spec := builder.Spec{Dir: "ports/x", Tags: []string{"repo:1"}, Args: map[string]string{"VARIANT": "alpine", "FOO": "baz"}}
+	out := buildAndCapture(t, "build", "args:\n  FOO: bar\n", spec)
+
+	for _, want := range []string{"--build-arg VARIANT=alpine", "--build-arg FOO=baz"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("argv missing %q in: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "FOO=bar") {
+		t.Errorf("spec args should override configured ones: %s", out)
+	}
+}
+
+func TestSpecDockerfile(t *testing.T) {
+	// A rendered Dockerfile replaces the configured one; the context is still
+	// the port directory.
+	spec := sampleSpec()
+	spec.Dockerfile = "/tmp/rendered/Dockerfile"
+	for kind, params := range map[string]string{"build": sampleParams, "podman": podmanParams} {
+		out := buildAndCapture(t, kind, params, spec)
+		if !strings.Contains(out, "--file /tmp/rendered/Dockerfile") {
+			t.Errorf("%s: argv should build the rendered Dockerfile: %s", kind, out)
+		}
+		if !strings.Contains(out, " ports/x\n") {
+			t.Errorf("%s: context should stay the port directory: %s", kind, out)
+		}
+	}
+}
+
 func TestKindDefaultsToBuild(t *testing.T) {
 	out := buildAndCapture(t, "", "", builder.Spec{Dir: ".", Tags: []string{"x:1"}, Base: "b:1"})
 	if !strings.Contains(out, "docker buildx build") {
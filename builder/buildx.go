@@ -7,6 +7,7 @@ import (
 
 func init() {
 	Register("build", newBuildx)
+	RegisterSchema("build", optionsSchema)
 }
 
 // buildx builds via `docker buildx build`.
@@ -34,11 +35,11 @@ func (b *buildx) Build(ctx context.Context) error {
 func (b *buildx) argv() []string {
 	o, spec := b.opts, b.spec
 
-	args := []string{"buildx", "build", "--file", o.dockerfilePath(spec.Dir)}
+	args := []string{"buildx", "build", "--file", o.dockerfileOf(spec)}
 	if o.Target != "" {
 		args = append(args, "--target", o.Target)
 	}
-	for _, p := range o.Platforms {
+	for _, p := range o.platformsOf(spec) {
 		args = append(args, "--platform", p)
 	}
 
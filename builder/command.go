@@ -0,0 +1,141 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/goccy/go-yaml"
+)
+
+func init() {
+	Register("exec", newCommand)
+	RegisterSchema("exec", `{
+		"properties": {
+			"command": {"type": "array", "items": {"type": "string"}, "minItems": 1, "description": "argv to run; each element is a template of the build"},
+			"env": {"type": "object", "additionalProperties": {"type": "string"}, "description": "environment; each value is a template of the build"},
+			"dir": {"type": "string", "description": "working directory, relative to the port"}
+		},
+		"required": ["command"]
+	}`)
+}
+
+// commandConfig is the config for the exec strategy. Every element of command
+// and every env value is a Go text/template rendered with the Spec, so a port
+// can hand the build to any tool (ko, nix, apko, make, ...):
+//
+//	build:
+//	  kind: exec
+//	  repo: ghcr.io/me/app
+//	  tags: ["{{.Major}}.{{.Minor}}"]
+//	  command: [make, image, "TAGS={{join .Tags \" \"}}", "{{if .Push}}PUSH=1{{end}}"]
+//	  env:
+//	    BASE_IMAGE: "{{.Base}}"
+//	  dir: src
+type commandConfig struct {
+	Command []string          `yaml:"command"`
+	Env     map[string]string `yaml:"env"`
+	Dir     string            `yaml:"dir"`
+}
+
+// command builds by running a user-declared command.
+type command struct {
+	cfg  commandConfig
+	argv []*template.Template
+	env  map[string]*template.Template
+	spec Spec
+}
+
+// commandFuncs are the helpers available to the exec templates.
+var commandFuncs = template.FuncMap{
+	"join": strings.Join,
+	// tagOf returns the tag portion of a "repo:tag" reference.
+	"tagOf": func(ref string) string {
+		if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+			return ref[i+1:]
+		}
+		return ""
+	},
+}
+
+func newCommand(params []byte, spec Spec) (Builder, error) {
+	var cfg commandConfig
+	if len(params) > 0 {
+		if err := yaml.Unmarshal(params, &cfg); err != nil {
+			return nil, fmt.Errorf("decode exec options: %w", err)
+		}
+	}
+	if len(cfg.Command) == 0 {
+		return nil, fmt.Errorf("exec builder: command is required")
+	}
+
+	c := &command{cfg: cfg, spec: spec, env: map[string]*template.Template{}}
+	for i, a := range cfg.Command {
+		t, err := template.New("command").Funcs(commandFuncs).Option("missingkey=error").Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("parse command[%d]: %w", i, err)
+		}
+		c.argv = append(c.argv, t)
+	}
+	for k, v := range cfg.Env {
+		t, err := template.New(k).Funcs(commandFuncs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse env %s: %w", k, err)
+		}
+		c.env[k] = t
+	}
+	return c, nil
+}
+
+// render expands the command and env templates. Arguments that render to an
+// empty string are dropped, so a flag can be made conditional with
+// "{{if .Push}}--push{{end}}".
+func (c *command) render() (argv []string, env []string, err error) {
+	for i, t := range c.argv {
+		var sb strings.Builder
+		if err := t.Execute(&sb, c.spec); err != nil {
+			return nil, nil, fmt.Errorf("render command[%d]: %w", i, err)
+		}
+		if sb.Len() > 0 {
+			argv = append(argv, sb.String())
+		}
+	}
+	if len(argv) == 0 {
+		return nil, nil, fmt.Errorf("command renders to nothing")
+	}
+
+	keys := make([]string, 0, len(c.env))
+	for k := range c.env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var sb strings.Builder
+		if err := c.env[k].Execute(&sb, c.spec); err != nil {
+			return nil, nil, fmt.Errorf("render env %s: %w", k, err)
+		}
+		env = append(env, k+"="+sb.String())
+	}
+	return argv, env, nil
+}
+
+// Build implements Builder.
+func (c *command) Build(ctx context.Context) error {
+	if c.spec.Push && c.spec.Load {
+		return fmt.Errorf("push and load are mutually exclusive")
+	}
+
+	argv, env, err := c.render()
+	if err != nil {
+		return err
+	}
+
+	o := c.spec.execOpts()
+	o.bin = argv[0]
+	o.dir = filepath.Join(c.spec.Dir, c.cfg.Dir)
+	o.env = env
+	return o.run(ctx, argv[1:])
+}
@@ -0,0 +1,89 @@
+package builder_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/builder"
+)
+
+const execParams = `
+command:
+  - ko
+  - build
+  - "--tags={{join .Tags \",\"}}"
+  - "{{if .Push}}--push{{end}}"
+  - "{{if .Load}}--local{{end}}"
+  - "--base={{.Base}}"
+env:
+  BASE_TAG: "{{.BaseTag}}"
+  REVISION: "{{index .Labels \"base\"}}"
+dir: src
+`
+
+func TestExecDryRun(t *testing.T) {
+	out := buildAndCapture(t, "exec", execParams, sampleSpec())
+
+	want := "cd ports/x/src && BASE_TAG=1 REVISION=x ko build --tags=repo:1,repo:latest --push --base=up:1\n"
+	if out != want {
+		t.Errorf("dry run\n got: %q\nwant: %q", out, want)
+	}
+}
+
+func TestExecRunsCommand(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "argv")
+
+	// The fake binary records its argv, the templated env and its working
+	// directory, one per line.
+	bin := filepath.Join(dir, "fake-build")
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done > " + log + "\necho \"env=$BASE_TAG\" >> " + log + "\necho \"pwd=$(pwd)\" >> " + log + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	params := "command: [" + bin + ", \"--tag={{index .Tags 0}}\", \"{{if .Push}}--push{{end}}\", \"{{.Base}}\"]\nenv:\n  BASE_TAG: \"{{.BaseTag}}\"\n"
+	spec := builder.Spec{Dir: dir, Tags: []string{"repo:1.2.3"}, BaseTag: "1.2.3", Load: true}
+
+	var buf bytes.Buffer
+	spec.Stdout = &buf
+	spec.Stderr = &buf
+	b, err := builder.New("exec", []byte(params), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Build(context.Background()); err != nil {
+		t.Fatalf("build: %v (%s)", err, buf.String())
+	}
+
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The empty --push and base arguments are dropped.
+	want := "--tag=repo:1.2.3\nenv=1.2.3\npwd=" + dir + "\n"
+	if string(got) != want {
+		t.Errorf("recorded\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestExecRequiresCommand(t *testing.T) {
+	if _, err := builder.New("exec", []byte("repo: x\n"), builder.Spec{}); err == nil {
+		t.Fatal("expected error when command is missing")
+	}
+}
+
+func TestExecTemplateError(t *testing.T) {
+	b, err := builder.New("exec", []byte("command: [make, \"{{.Nope}}\"]\n"), builder.Spec{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Build(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "command[1]") {
+		t.Errorf("expected render error for command[1], got %v", err)
+	}
+}
@@ -15,6 +15,11 @@ type execOpts struct {
 	dryRun bool
 	stdout io.Writer
 	stderr io.Writer
+
+	// dir is the working directory of the command (default: inherited).
+	dir string
+	// env holds extra "KEY=value" entries added to the inherited environment.
+	env []string
 }
 
 func (s Spec) execOpts() execOpts {
@@ -34,11 +39,19 @@ func (s Spec) execOpts() execOpts {
 // run executes the binary with args, or prints the command when dryRun is set.
 func (o execOpts) run(ctx context.Context, args []string) error {
 	if o.dryRun {
-		fmt.Fprintln(o.stdout, shellCommand(o.bin, args))
+		line := envPrefix(o.env) + ShellCommand(o.bin, args)
+		if o.dir != "" {
+			line = "cd " + shellQuote(o.dir) + " && " + line
+		}
+		fmt.Fprintln(o.stdout, line)
 		return nil
 	}
 
 	cmd := exec.CommandContext(ctx, o.bin, args...)
+	cmd.Dir = o.dir
+	if len(o.env) > 0 {
+		cmd.Env = append(os.Environ(), o.env...)
+	}
 	cmd.Stdout = o.stdout
 	cmd.Stderr = o.stderr
 	if err := cmd.Run(); err != nil {
@@ -47,9 +60,9 @@ func (o execOpts) run(ctx context.Context, args []string) error {
 	return nil
 }
 
-// shellCommand renders a copy-pasteable command line, quoting arguments that
+// ShellCommand renders a copy-pasteable command line, quoting arguments that
 // contain shell-significant characters.
-func shellCommand(bin string, args []string) string {
+func ShellCommand(bin string, args []string) string {
 	parts := make([]string, 0, len(args)+1)
 	parts = append(parts, shellQuote(bin))
 	for _, a := range args {
@@ -58,6 +71,17 @@ func shellCommand(bin string, args []string) string {
 	return strings.Join(parts, " ")
 }
 
+// envPrefix renders "KEY=value" entries as a shell assignment prefix, e.g.
+// "A=1 B='x y' ". It is empty when there are no entries.
+func envPrefix(env []string) string {
+	var sb strings.Builder
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		sb.WriteString(k + "=" + shellQuote(v) + " ")
+	}
+	return sb.String()
+}
+
 func shellQuote(s string) string {
 	if s == "" {
 		return "''"
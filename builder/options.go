@@ -8,9 +8,9 @@ import (
 	"github.com/goccy/go-yaml"
 )
 
-// options are the buildx-family build options shared by the "build" and "bake"
-// strategies, decoded from a port's raw build config. Fields irrelevant to the
-// decode (repo, tag, kind) are simply ignored.
+// options are the buildx-family build options shared by the "build", "bake",
+// "podman" and "buildah" strategies, decoded from a port's raw build config.
+// Fields irrelevant to the decode (repo, tag, kind) are simply ignored.
 type options struct {
 	Dockerfile  string            `yaml:"dockerfile"`
 	Context     string            `yaml:"context"`
@@ -33,6 +33,51 @@ type options struct {
 	ExtraArgs   []string          `yaml:"extra-args"`
 }
 
+// optionsSchema is the JSON Schema of options, registered for each strategy
+// that decodes them.
+const optionsSchema = `{
+	"$defs": {
+		"strings": {"type": "array", "items": {"type": "string"}},
+		"scalars": {"type": "object", "additionalProperties": {"type": ["string", "number", "boolean"]}}
+	},
+	"properties": {
+		"dockerfile": {"type": "string", "description": "Dockerfile, relative to the port (default \"Dockerfile\")"},
+		"context": {"type": "string", "description": "build context, relative to the port (default \".\")"},
+		"target": {"type": "string", "description": "Dockerfile stage to build"},
+		"platforms": {"$ref": "#/$defs/strings", "description": "platforms to build for, e.g. linux/amd64"},
+		"args": {"$ref": "#/$defs/scalars", "description": "build args"},
+		"labels": {"$ref": "#/$defs/scalars", "description": "image labels"},
+		"annotations": {"$ref": "#/$defs/strings"},
+		"cache-from": {"$ref": "#/$defs/strings"},
+		"cache-to": {"$ref": "#/$defs/strings"},
+		"secrets": {"$ref": "#/$defs/strings"},
+		"ssh": {"$ref": "#/$defs/strings"},
+		"no-cache": {"type": "boolean"},
+		"pull": {"type": "boolean"},
+		"provenance": {"type": "string"},
+		"sbom": {"type": "string"},
+		"network": {"type": "string"},
+		"add-hosts": {"$ref": "#/$defs/strings"},
+		"allow": {"$ref": "#/$defs/strings"},
+		"extra-args": {"$ref": "#/$defs/strings", "description": "arguments appended verbatim to the build command"}
+	}
+}`
+
+// Dockerfile returns the path of the Dockerfile a build of the given kind
+// reads, resolved against dir, or "" when kind does not build from one (exec).
+func Dockerfile(kind string, params []byte, dir string) (string, error) {
+	switch kind {
+	case "", "build", "bake", "podman", "buildah":
+	default:
+		return "", nil
+	}
+	o, err := parseOptions(params)
+	if err != nil {
+		return "", err
+	}
+	return o.dockerfilePath(dir), nil
+}
+
 func parseOptions(params []byte) (options, error) {
 	var o options
 	if len(params) > 0 {
@@ -52,6 +97,24 @@ func (o options) contextDir(dir string) string {
 	return filepath.Join(dir, c)
 }
 
+// dockerfileOf returns the Dockerfile to build spec from: spec.Dockerfile when
+// set, otherwise the configured one.
+func (o options) dockerfileOf(spec Spec) string {
+	if spec.Dockerfile != "" {
+		return spec.Dockerfile
+	}
+	return o.dockerfilePath(spec.Dir)
+}
+
+// platformsOf returns the platforms to build spec for: spec.Platforms when
+// set, otherwise the configured ones.
+func (o options) platformsOf(spec Spec) []string {
+	if len(spec.Platforms) > 0 {
+		return spec.Platforms
+	}
+	return o.Platforms
+}
+
 // dockerfilePath resolves the Dockerfile against the port directory.
 func (o options) dockerfilePath(dir string) string {
 	f := o.Dockerfile
@@ -64,16 +127,20 @@ func (o options) dockerfilePath(dir string) string {
 	return filepath.Join(dir, f)
 }
 
-// buildArgs merges the configured build args with the injected BASE and
-// BASE_TAG. BASE (the full base image reference) is injected only when the spec
-// carries one: a container source provides it, while sources without an upstream
-// image (e.g. http) do not, so their Dockerfile sets its own FROM. BASE_TAG (the
-// selected upstream tag) is injected for every source kind.
+// buildArgs merges the configured build args with the spec's args and the
+// injected BASE and BASE_TAG. BASE (the full base image reference) is
+// injected only when the spec carries one: a container source provides it,
+// while sources without an upstream image (e.g. http) do not, so their
+// Dockerfile sets its own FROM. BASE_TAG (the selected upstream tag) is
+// injected for every source kind.
 func (o options) buildArgs(spec Spec) map[string]string {
-	m := make(map[string]string, len(o.Args)+2)
+	m := make(map[string]string, len(o.Args)+len(spec.Args)+2)
 	for k, v := range o.Args {
 		m[k] = v
 	}
+	for k, v := range spec.Args {
+		m[k] = v
+	}
 	if spec.Base != "" {
 		m["BASE"] = spec.Base
 	}
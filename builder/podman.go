@@ -0,0 +1,225 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register("podman", newPodman)
+	Register("buildah", newBuildah)
+	RegisterSchema("podman", optionsSchema)
+	RegisterSchema("buildah", optionsSchema)
+}
+
+// podman builds via `podman build` or `buildah bud`, which share their flags
+// and run without a Docker daemon. Images land in the local containers storage,
+// so Load needs no extra step. A multi-platform build is collected into a
+// manifest list named after the first tag, which is then pushed under every
+// tag; a single-platform build is tagged and pushed image by image.
+type podman struct {
+	opts options
+	spec Spec
+
+	// bin is the binary to invoke ("podman" or "buildah"); Spec.Bin names the
+	// docker binary and does not apply.
+	bin string
+	// build is the build subcommand of bin.
+	build string
+	// cacheFrom and cacheTo are the cache repositories, translated from the
+	// buildx cache specs of the options (see containersCache).
+	cacheFrom []string
+	cacheTo   []string
+}
+
+func newPodman(params []byte, spec Spec) (Builder, error) {
+	return newContainersBuilder("podman", "build", params, spec)
+}
+
+func newBuildah(params []byte, spec Spec) (Builder, error) {
+	return newContainersBuilder("buildah", "bud", params, spec)
+}
+
+func newContainersBuilder(bin, build string, params []byte, spec Spec) (Builder, error) {
+	o, err := parseOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Options that only buildx understands are rejected rather than dropped,
+	// so a port does not silently lose its attestations or entitlements.
+	switch {
+	case o.Provenance != "":
+		return nil, fmt.Errorf("%s builder: provenance is not supported", bin)
+	case o.SBOM != "":
+		return nil, fmt.Errorf("%s builder: sbom is not supported", bin)
+	case len(o.Allow) > 0:
+		return nil, fmt.Errorf("%s builder: allow is not supported", bin)
+	}
+	b := &podman{opts: o, spec: spec, bin: bin, build: build}
+	for _, c := range o.CacheFrom {
+		repo, err := containersCache(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s builder: cache-from: %w", bin, err)
+		}
+		b.cacheFrom = append(b.cacheFrom, repo)
+	}
+	for _, c := range o.CacheTo {
+		repo, err := containersCache(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s builder: cache-to: %w", bin, err)
+		}
+		b.cacheTo = append(b.cacheTo, repo)
+	}
+	return b, nil
+}
+
+// containersCache translates a buildx cache spec into the repository podman
+// and buildah take as --cache-from and --cache-to. A bare repository is taken
+// as is, and "type=registry,ref=X" is X; its other attributes, such as
+// mode=max, have no equivalent and are dropped. Other cache types are
+// rejected.
+func containersCache(spec string) (string, error) {
+	if !strings.Contains(spec, "=") {
+		return spec, nil
+	}
+	attrs := map[string]string{}
+	for _, field := range strings.Split(spec, ",") {
+		k, v, _ := strings.Cut(field, "=")
+		attrs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if t := attrs["type"]; t != "registry" {
+		return "", fmt.Errorf("%q: cache type %q is not supported; only registry is", spec, t)
+	}
+	if attrs["ref"] == "" {
+		return "", fmt.Errorf("%q: ref is required", spec)
+	}
+	return attrs["ref"], nil
+}
+
+// podmanStep is one invocation of the binary. A step that may fail is allowed
+// to exit non-zero (its output is discarded), e.g. removing a manifest list
+// that does not exist yet.
+type podmanStep struct {
+	args    []string
+	mayFail bool
+}
+
+// manifest reports whether the build produces a manifest list.
+func (b *podman) manifest() bool {
+	return len(b.opts.platformsOf(b.spec)) > 1
+}
+
+func (b *podman) steps() []podmanStep {
+	spec := b.spec
+
+	steps := []podmanStep{}
+	if b.manifest() {
+		// --manifest appends to an existing list, so start from a clean one.
+		steps = append(steps, podmanStep{args: []string{"manifest", "rm", spec.Tags[0]}, mayFail: true})
+	}
+	steps = append(steps, podmanStep{args: b.buildArgv()})
+
+	if !spec.Push {
+		return steps
+	}
+	for _, t := range spec.Tags {
+		if b.manifest() {
+			steps = append(steps, podmanStep{args: []string{"manifest", "push", "--all", spec.Tags[0], "docker://" + t}})
+		} else {
+			steps = append(steps, podmanStep{args: []string{"push", t, "docker://" + t}})
+		}
+	}
+	return steps
+}
+
+func (b *podman) buildArgv() []string {
+	o, spec := b.opts, b.spec
+
+	args := []string{b.build, "--file", o.dockerfileOf(spec)}
+	if o.Target != "" {
+		args = append(args, "--target", o.Target)
+	}
+	if platforms := o.platformsOf(spec); len(platforms) > 0 {
+		args = append(args, "--platform", strings.Join(platforms, ","))
+	}
+
+	build_args := o.buildArgs(spec)
+	for _, k := range sortedKeys(build_args) {
+		args = append(args, "--build-arg", k+"="+build_args[k])
+	}
+	labels := o.imageLabels(spec)
+	for _, k := range sortedKeys(labels) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+
+	for _, a := range o.Annotations {
+		args = append(args, "--annotation", a)
+	}
+	for _, c := range b.cacheFrom {
+		args = append(args, "--cache-from", c)
+	}
+	for _, c := range b.cacheTo {
+		args = append(args, "--cache-to", c)
+	}
+	for _, s := range o.Secrets {
+		args = append(args, "--secret", s)
+	}
+	for _, s := range o.SSH {
+		args = append(args, "--ssh", s)
+	}
+	if o.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if o.Pull {
+		args = append(args, "--pull")
+	}
+	if o.Network != "" {
+		args = append(args, "--network", o.Network)
+	}
+	for _, h := range o.AddHosts {
+		args = append(args, "--add-host", h)
+	}
+	if b.manifest() {
+		args = append(args, "--manifest", spec.Tags[0])
+	} else {
+		for _, t := range spec.Tags {
+			args = append(args, "--tag", t)
+		}
+	}
+	args = append(args, o.ExtraArgs...)
+
+	return append(args, o.contextDir(spec.Dir))
+}
+
+// Build implements Builder.
+func (b *podman) Build(ctx context.Context) error {
+	if b.spec.Push && b.spec.Load {
+		return fmt.Errorf("push and load are mutually exclusive")
+	}
+	if len(b.spec.Tags) == 0 {
+		return fmt.Errorf("%s builder: no tags to build", b.bin)
+	}
+
+	o := b.spec.execOpts()
+	o.bin = b.bin
+	for _, s := range b.steps() {
+		if !s.mayFail {
+			if err := o.run(ctx, s.args); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if o.dryRun {
+			fmt.Fprintln(o.stdout, ShellCommand(o.bin, s.args)+" || true")
+			continue
+		}
+		quiet := o
+		quiet.stdout, quiet.stderr = io.Discard, io.Discard
+		_ = quiet.run(ctx, s.args)
+	}
+	return nil
+}
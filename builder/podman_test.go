@@ -0,0 +1,111 @@
+package builder_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/builder"
+)
+
+const podmanParams = `
+dockerfile: Dockerfile
+target: final
+platforms: [linux/amd64, linux/arm64]
+args:
+  FOO: bar
+labels:
+  a: b
+secrets: ["id=npm,src=.npmrc"]
+cache-from: [ghcr.io/me/cache]
+no-cache: true
+extra-args: ["--quiet"]
+`
+
+func TestPodmanMultiPlatform(t *testing.T) {
+	out := buildAndCapture(t, "podman", podmanParams, sampleSpec())
+
+	want := strings.Join([]string{
+		"podman manifest rm repo:1 || true",
+		"podman build --file ports/x/Dockerfile --target final --platform linux/amd64,linux/arm64" +
+			" --build-arg BASE=up:1 --build-arg BASE_TAG=1 --build-arg FOO=bar" +
+			" --label a=b --label base=x --cache-from ghcr.io/me/cache --secret id=npm,src=.npmrc" +
+			" --no-cache --manifest repo:1 --quiet ports/x",
+		"podman manifest push --all repo:1 docker://repo:1",
+		"podman manifest push --all repo:1 docker://repo:latest",
+		"",
+	}, "\n")
+	if out != want {
+		t.Errorf("dry run\n got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestBuildahSinglePlatform(t *testing.T) {
+	out := buildAndCapture(t, "buildah", "platforms: [linux/amd64]\n", sampleSpec())
+
+	want := strings.Join([]string{
+		"buildah bud --file ports/x/Dockerfile --platform linux/amd64" +
+			" --build-arg BASE=up:1 --build-arg BASE_TAG=1 --label base=x" +
+			" --tag repo:1 --tag repo:latest ports/x",
+		"buildah push repo:1 docker://repo:1",
+		"buildah push repo:latest docker://repo:latest",
+		"",
+	}, "\n")
+	if out != want {
+		t.Errorf("dry run\n got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestPodmanLoadDoesNotPush(t *testing.T) {
+	spec := builder.Spec{Dir: ".", Tags: []string{"x:1"}, Base: "b:1", Load: true}
+	out := buildAndCapture(t, "podman", "", spec)
+
+	want := "podman build --file Dockerfile --build-arg BASE=b:1 --tag x:1 .\n"
+	if out != want {
+		t.Errorf("dry run\n got: %q\nwant: %q", out, want)
+	}
+}
+
+func TestPodmanCache(t *testing.T) {
+	spec := builder.Spec{Dir: ".", Tags: []string{"x:1"}, Base: "b:1", Load: true}
+	params := "cache-from: [ghcr.io/me/cache, 'type=registry,ref=ghcr.io/me/cache:x']\n" +
+		"cache-to: ['type=registry,ref=ghcr.io/me/cache:x,mode=max']\n"
+	out := buildAndCapture(t, "buildah", params, spec)
+
+	want := "buildah bud --file Dockerfile --build-arg BASE=b:1" +
+		" --cache-from ghcr.io/me/cache --cache-from ghcr.io/me/cache:x --cache-to ghcr.io/me/cache:x" +
+		" --tag x:1 .\n"
+	if out != want {
+		t.Errorf("dry run\n got: %q\nwant: %q", out, want)
+	}
+
+	for _, params := range []string{
+		"cache-from: ['type=gha']\n",
+		"cache-to: ['type=local,dest=/tmp/cache']\n",
+		"cache-from: ['type=registry']\n",
+	} {
+		if _, err := builder.New("podman", []byte(params), builder.Spec{}); err == nil {
+			t.Errorf("expected error for %q", params)
+		}
+	}
+}
+
+func TestPodmanRejectsBuildxOnlyOptions(t *testing.T) {
+	for _, params := range []string{"provenance: mode=max\n", "sbom: \"true\"\n", "allow: [network.host]\n"} {
+		if _, err := builder.New("podman", []byte(params), builder.Spec{}); err == nil {
+			t.Errorf("expected error for %q", params)
+		}
+	}
+}
+
+func TestPodmanPushLoadConflict(t *testing.T) {
+	for _, kind := range []string{"podman", "buildah"} {
+		b, err := builder.New(kind, nil, builder.Spec{Tags: []string{"x:1"}, Push: true, Load: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Build(context.Background()); err == nil {
+			t.Errorf("%s: expected push+load error", kind)
+		}
+	}
+}
@@ -2,18 +2,28 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/goccy/go-yaml"
 	"github.com/lesomnus/clade/builder"
 	"github.com/lesomnus/clade/cmd/config"
 	"github.com/lesomnus/clade/compare"
+	"github.com/lesomnus/clade/dockerfile"
+	"github.com/lesomnus/clade/filter"
 	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/history"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
 	"github.com/lesomnus/clade/port"
 	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/clade/sign"
+	"github.com/lesomnus/clade/smoke"
 	"github.com/lesomnus/xli"
 	"github.com/lesomnus/xli/arg"
 	"github.com/lesomnus/xli/flg"
@@ -34,24 +44,42 @@ func NewCmdBuild() *xli.Command {
 			&arg.RestStrings{Name: "node", Brief: "node ids to build (default: all outdated)"},
 		},
 		Flags: flg.Flags{
-			&flg.String{Name: "ports", Brief: "path to the ports directory"},
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
 			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
 			&flg.Switch{Name: "all", Brief: "build every node in the graph, not only outdated ones"},
 			&flg.Switch{Name: "no-push", Brief: "do not push built images"},
 			&flg.Switch{Name: "load", Brief: "load built images into the local docker store (implies no push)"},
 			&flg.Switch{Name: "dry-run", Brief: "print build commands without executing them"},
+			&flg.Switch{Name: "no-verify", Brief: "do not re-check pushed tags after each build"},
+			&flg.Switch{Name: "no-test", Brief: "do not run the ports' smoke tests before pushing"},
+			&flg.Switch{Name: "no-sign", Brief: "do not sign pushed images even if signing is configured"},
 			&flg.String{Name: "docker", Brief: "docker binary to invoke (default docker)"},
-		},
+			&flg.String{Name: "log-dir", Brief: "write each node's output, command, spec and result under this directory"},
+			&flg.Switch{Name: "stage", Brief: "push under staging tags and promote them only once every node succeeded"},
+			&flg.String{Name: "run-id", Brief: "run id of a staged build (default: the current UTC time)"},
+			&flg.Switch{Name: "allow-stale", Brief: "only warn when --graph was computed before a port changed"},
+		}.WithCategory("filter", filterFlags()...),
 
 		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
 			c := use_config.Must(ctx)
-			flg.VisitP(cmd, "ports", &c.Ports)
+			readPortsFlag(cmd, c)
 			flg.VisitP(cmd, "docker", &c.Build.Docker)
 
-			g, err := obtainGraph(ctx, c, cmd)
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
+			g, err := obtainGraph(ctx, c, cmd, f)
 			if err != nil {
 				return z.Err(err, "obtain graph")
 			}
+			if p, ok := flg.Get[string](cmd, "graph"); ok && p != "" {
+				allow_stale := false
+				flg.VisitP(cmd, "allow-stale", &allow_stale)
+				if err := checkGraph(c, g, allow_stale, cmd); err != nil {
+					return z.Err(err, "check graph")
+				}
+			}
 
 			all := false
 			flg.VisitP(cmd, "all", &all)
@@ -72,17 +100,65 @@ func NewCmdBuild() *xli.Command {
 			flg.VisitP(cmd, "load", &load)
 			dry_run := false
 			flg.VisitP(cmd, "dry-run", &dry_run)
+			no_verify := false
+			flg.VisitP(cmd, "no-verify", &no_verify)
+			log_dir := ""
+			flg.VisitP(cmd, "log-dir", &log_dir)
+			no_test := false
+			flg.VisitP(cmd, "no-test", &no_test)
+			no_sign := false
+			flg.VisitP(cmd, "no-sign", &no_sign)
+			stage := false
+			flg.VisitP(cmd, "stage", &stage)
+			run_id := ""
+			flg.VisitP(cmd, "run-id", &run_id)
 
+			reg := registry.NewRemote() // fresh: a just-pushed base must resolve
+			renderer, err := newRenderer(c)
+			if err != nil {
+				return err
+			}
 			runner := &buildRunner{
-				reg:        registry.NewRemote(), // fresh: a just-pushed base must resolve
-				loadPort:   port.Load,
+				reg:        reg,
+				loadPort:   portLoader(c).LoadID,
 				newBuilder: builder.New,
+				renderer:   renderer,
 				push:       !no_push && !load,
 				load:       load,
 				dryRun:     dry_run,
+				verify:     !no_verify,
+				logDir:     log_dir,
 				bin:        c.Build.Docker,
 				stdout:     cmd,
 				stderr:     os.Stderr,
+				history:    openHistory(c),
+			}
+			if !no_test {
+				runner.smoke = smokeRunners(c.Build.Docker, dry_run, cmd)
+			}
+			if c.Sign.Kind != "" && !no_sign && runner.push {
+				runner.signer, err = sign.New(c.Sign.Kind, sign.Options{
+					Key:    c.Sign.Key,
+					Bin:    c.Sign.Bin,
+					Args:   c.Sign.Args,
+					DryRun: dry_run,
+					Stdout: cmd,
+					Stderr: os.Stderr,
+				})
+				if err != nil {
+					return z.Err(err, "signer")
+				}
+			}
+			if stage {
+				if !runner.push {
+					return fmt.Errorf("--stage pushes; it cannot be combined with --no-push or --load")
+				}
+				if run_id == "" {
+					run_id = newRunID()
+				}
+				cmd.Printf("staged run %s\n", run_id)
+				runner.writer = reg
+				runner.runID = run_id
 			}
 			return runner.run(ctx, targets)
 		}),
@@ -90,23 +166,40 @@ func NewCmdBuild() *xli.Command {
 }
 
 // obtainGraph reads a serialized graph when --graph is set, otherwise recomputes
-// it from the ports (the same pipeline as `outdated`).
-func obtainGraph(ctx context.Context, c *config.Config, cmd *xli.Command) (*cladev1.Graph, error) {
+// it from the ports (the same pipeline as `outdated`). The graph is narrowed to
+// the nodes f selects; when recomputing, ports that cannot contribute are
+// skipped before anything is fetched. A nil f selects every node.
+func obtainGraph(ctx context.Context, c *config.Config, cmd *xli.Command, f *filter.Filter) (*cladev1.Graph, error) {
 	if p, ok := flg.Get[string](cmd, "graph"); ok && p != "" {
-		return readGraphFile(p)
+		g, err := readGraphFile(p)
+		if err != nil {
+			return nil, err
+		}
+		g.Nodes = f.Nodes(g.Nodes)
+		return g, nil
 	}
 
 	reg, err := buildRegistry(c)
 	if err != nil {
 		return nil, z.Err(err, "build registry")
 	}
-	ports, err := port.LoadAll(c.Ports)
+	ports, err := loadPorts(c)
 	if err != nil {
 		return nil, z.Err(err, "load ports")
 	}
+	meta, err := graphMetadata(c, ports)
+	if err != nil {
+		return nil, err
+	}
 
 	b := &graph.Builder{Registry: reg}
-	return b.Build(ctx, ports)
+	g, err := b.Build(ctx, f.Ports(ports))
+	if err != nil {
+		return nil, err
+	}
+	g.Nodes = f.Nodes(g.Nodes)
+	g.Metadata = meta
+	return g, nil
 }
 
 func readGraphFile(path string) (*cladev1.Graph, error) {
@@ -166,59 +259,436 @@ func selectBuildTargets(g *cladev1.Graph, ids []string, all bool) ([]*cladev1.No
 // builder per node from its port's build config.
 type buildRunner struct {
 	reg        registry.Registry
-	loadPort   func(dir string) (*port.Port, error)
+	loadPort   func(id string) (*port.Port, error)
 	newBuilder func(kind string, params []byte, spec builder.Spec) (builder.Builder, error)
+	// renderer renders a port's Dockerfile.tmpl for each node; nil builds the
+	// configured Dockerfile as is.
+	renderer *dockerfile.Renderer
 
 	push   bool
 	load   bool
 	dryRun bool
+	// verify re-stats every pushed tag after a build (see verifyPush).
+	verify bool
+	// smoke returns the runner of the smoke tests of a port by its build kind
+	// (see smokeRunners); nil skips them.
+	smoke func(kind string) smoke.Runner
+	// signer signs each pushed image and attests its provenance; nil skips
+	// signing.
+	signer sign.Signer
+	// logDir, when set, receives a directory per node with its output, the
+	// rendered command, the spec, timing and exit status (see nodeLog).
+	logDir string
+	// runID, when set, stages the run: nodes are pushed under stagingTag and
+	// promoted through writer only after all of them succeeded.
+	runID  string
+	writer registry.Writer
+	// staged maps every tag of a node built in a staged run to its staging
+	// tag, so dependents build on the staged image.
+	staged map[string]string
 	bin    string
 	stdout io.Writer
 	stderr io.Writer
+	// keepGoing builds the other nodes when one fails, skipping the nodes
+	// built on a failed one, and returns every failure at the end. It is not
+	// for staged runs, which promote all nodes or none.
+	keepGoing bool
+	// start, when set, is told of every node about to be built; done, the
+	// outcome of every node: nil when it was built, or an error wrapping
+	// errSkipped when it was skipped.
+	start func(node *cladev1.Node)
+	done  func(node *cladev1.Node, err error)
+	// history records every build attempt; nil, or a dry run, records none.
+	history *history.Store
 }
 
+// errSkipped marks a node not built because a node it is built on failed.
+var errSkipped = errors.New("skipped")
+
 func (r *buildRunner) run(ctx context.Context, targets []*cladev1.Node) error {
 	ports := map[string]*port.Port{}
-	for _, node := range targets {
-		p, ok := ports[node.Port]
-		if !ok {
-			var err error
-			p, err = r.loadPort(node.Port)
+	failed := map[string]bool{}
+	var errs []error
+	for i, node := range targets {
+		rec := r.newRecord(node)
+		err := r.runNode(ctx, i+1, ports, failed, node, rec)
+		r.record(rec, err)
+		if r.done != nil {
+			r.done(node, err)
+		}
+		if err == nil {
+			continue
+		}
+		if !r.keepGoing {
+			if r.runID != "" {
+				fmt.Fprintf(r.stdout, "staged run %s failed; nothing was promoted\n", r.runID)
+			}
+			return err
+		}
+		failed[node.Id] = true
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if r.runID == "" {
+		return nil
+	}
+
+	p := &promoter{reg: r.reg, w: r.writer, runID: r.runID, dryRun: r.dryRun, stdout: r.stdout, history: r.history}
+	if err := p.promote(ctx, targets); err != nil {
+		return z.Err(err, "promote run %s (resume with `clade promote --run-id %s`)", r.runID, r.runID)
+	}
+	return nil
+}
+
+// runNode builds node unless one of its parents failed, loading its port
+// into ports.
+func (r *buildRunner) runNode(ctx context.Context, seq int, ports map[string]*port.Port, failed map[string]bool, node *cladev1.Node, rec *history.Record) error {
+	for _, parent := range node.Parents {
+		if failed[parent] {
+			return fmt.Errorf("%q is built on %q, which failed: %w", node.Id, parent, errSkipped)
+		}
+	}
+	p, ok := ports[node.Port]
+	if !ok {
+		var err error
+		p, err = r.loadPort(node.Port)
+		if err != nil {
+			return z.Err(err, "load port %q", node.Port)
+		}
+		ports[node.Port] = p
+	}
+	if r.start != nil {
+		r.start(node)
+	}
+	return r.buildNode(ctx, seq, p, node, rec)
+}
+
+// buildNode builds (and verifies) one node. seq is its 1-based position in the
+// run, used to order the per-node log directories. rec, unless nil, is filled
+// with what the build used and produced.
+func (r *buildRunner) buildNode(ctx context.Context, seq int, p *port.Port, node *cladev1.Node, rec *history.Record) (err error) {
+	spec := r.spec(ctx, p, node)
+	if rec != nil {
+		// In a staged run, the staging tag; the promotion is recorded apart.
+		rec.Tags = spec.Tags
+		rec.BaseDigest = spec.Labels[compare.DefaultBaseDigestLabel]
+	}
+	var rendered []byte
+	if r.renderer != nil {
+		out, ok, err := renderNode(r.renderer, p, node)
+		if err != nil {
+			return z.Err(err, "render Dockerfile of %q", node.Id)
+		}
+		if ok {
+			path, err := writeTemp(out)
 			if err != nil {
-				return z.Err(err, "load port %q", node.Port)
+				return z.Err(err, "write Dockerfile of %q", node.Id)
 			}
-			ports[node.Port] = p
+			defer os.Remove(path)
+			spec.Dockerfile, rendered = path, out
+		}
+	}
+	var tester smoke.Runner
+	if r.smoke != nil {
+		tester = r.smoke(p.Build.Kind)
+	}
+	if r.logDir != "" {
+		l, lerr := openNodeLog(r.logDir, seq, node)
+		if lerr != nil {
+			return z.Err(lerr, "open build log for %q", node.Id)
+		}
+		defer func() {
+			l.finish(spec, p.Build.Kind, err)
+			fmt.Fprintf(r.stdout, "%s %s in %s (log: %s)\n", l.status(err), node.Id, l.duration().Round(time.Second), l.dir)
+		}()
+
+		spec.Stdout, spec.Stderr = l.out, l.out
+		if tester != nil {
+			tester = smoke.Logged(tester, l.out)
+		}
+		if rec != nil {
+			rec.Log = l.dir
+		}
+		l.writeDockerfile(rendered)
+		l.writeCommand(ctx, r.newBuilder, p.Build, spec)
+	}
+
+	suite, err := smoke.Parse(p.Test.Params, p.Dir)
+	if err != nil {
+		return z.Err(err, "tests of %q", node.Id)
+	}
+	if r.smoke != nil && tester == nil && len(suite) > 0 {
+		fmt.Fprintf(r.stderr, "warning: smoke tests of %s skipped: build kind %q has no runner for its images\n", node.Id, p.Build.Kind)
+	}
+	if tester != nil && len(suite) > 0 && (r.push || r.load) {
+		// Build into the local store, test, and only then push (the second
+		// build is served from the build cache). The local store holds a
+		// single platform, so only the one tested is built.
+		local := spec
+		local.Push, local.Load = false, true
+		if platforms := declaredPlatforms(p.Build.Params); len(platforms) > 0 {
+			local.Platforms = []string{testPlatform(platforms)}
 		}
+		if err := r.build(ctx, p, node, local); err != nil {
+			return err
+		}
+		if err := suite.Run(ctx, tester, spec.Tags[0]); err != nil {
+			return z.Err(err, "test %q", node.Id)
+		}
+		if !r.push {
+			return nil
+		}
+	}
+	if err := r.build(ctx, p, node, spec); err != nil {
+		return err
+	}
 
-		bld, err := r.newBuilder(p.Build.Kind, p.Build.Params, r.spec(ctx, node))
+	if r.push && r.verify && !r.dryRun {
+		digest, err := r.verifyPush(ctx, spec.Tags, spec.Labels, declaredPlatforms(p.Build.Params))
 		if err != nil {
-			return z.Err(err, "builder for %q", node.Id)
+			return z.Err(err, "verify %q", node.Id)
+		}
+		if rec != nil {
+			rec.Digest = digest
 		}
-		if err := bld.Build(ctx); err != nil {
-			return z.Err(err, "build %q", node.Id)
+	} else if r.push && rec != nil {
+		// Unverified, but recorded with its digest all the same.
+		if info, err := r.reg.Stat(ctx, spec.Tags[0]); err == nil {
+			rec.Digest = info.Digest
+		} else {
+			fmt.Fprintf(r.stderr, "warning: stat %s to record its digest: %v\n", spec.Tags[0], err)
+		}
+	}
+	if r.push && r.signer != nil {
+		if err := r.signNode(ctx, node, spec); err != nil {
+			return z.Err(err, "sign %q", node.Id)
 		}
 	}
 	return nil
 }
 
+// newRecord starts the record of node's build, or returns nil when builds are
+// not recorded.
+func (r *buildRunner) newRecord(node *cladev1.Node) *history.Record {
+	if r.history == nil || r.dryRun {
+		return nil
+	}
+	return &history.Record{
+		Node:    node.Id,
+		Port:    node.Port,
+		Tags:    node.Tags,
+		Base:    node.Base,
+		RunID:   r.runID,
+		Started: time.Now(),
+	}
+}
+
+// record finishes rec with the outcome of its build and adds it to the
+// history. A build is not failed for a history that cannot be written.
+func (r *buildRunner) record(rec *history.Record, err error) {
+	if rec == nil {
+		return
+	}
+	rec.Finished = time.Now()
+	switch {
+	case err == nil:
+		rec.Status = history.StatusSucceeded
+	case errors.Is(err, errSkipped):
+		rec.Status = history.StatusSkipped
+	default:
+		rec.Status = history.StatusFailed
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if herr := r.history.Add(rec); herr != nil {
+		fmt.Fprintf(r.stderr, "warning: record build of %s: %v\n", rec.Node, herr)
+	}
+}
+
+// writeTemp writes a rendered Dockerfile to a temporary file, outside the
+// port's context so it is not sent with it, and returns its path.
+func writeTemp(data []byte) (string, error) {
+	f, err := os.CreateTemp("", "clade-*.Dockerfile")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (r *buildRunner) build(ctx context.Context, p *port.Port, node *cladev1.Node, spec builder.Spec) error {
+	bld, err := r.newBuilder(p.Build.Kind, p.Build.Params, spec)
+	if err != nil {
+		return z.Err(err, "builder for %q", node.Id)
+	}
+	if err := bld.Build(ctx); err != nil {
+		return z.Err(err, "build %q", node.Id)
+	}
+	return nil
+}
+
+// verifyPush re-stats every tag of a just-pushed node and checks that they all
+// resolve to the same digest, carry the injected labels, and provide every
+// declared platform. A builder can exit successfully while a floating tag push
+// failed, leaving that tag on an older image that the outdated check (which
+// only stats the primary tag) would never revisit. It returns the digest the
+// tags resolve to.
+func (r *buildRunner) verifyPush(ctx context.Context, tags []string, labels map[string]string, platforms []string) (string, error) {
+	var first *registry.ImageInfo
+	for _, ref := range tags {
+		info, err := r.reg.Stat(ctx, ref)
+		if errors.Is(err, registry.ErrNotExist) {
+			return "", fmt.Errorf("%s: not found after push", ref)
+		}
+		if err != nil {
+			return "", z.Err(err, "stat %q", ref)
+		}
+
+		if first == nil {
+			first = info
+			continue
+		}
+		if info.Digest != first.Digest {
+			return "", fmt.Errorf("%s: digest %s differs from %s (%s)", ref, info.Digest, first.Digest, tags[0])
+		}
+	}
+	if first == nil {
+		return "", nil
+	}
+
+	for _, k := range sortedKeys(labels) {
+		if got, ok := first.Labels[k]; !ok || got != labels[k] {
+			return "", fmt.Errorf("%s: label %s = %q, want %q", tags[0], k, got, labels[k])
+		}
+	}
+	for _, want := range platforms {
+		if !hasPlatform(first.Platforms, want) {
+			return "", fmt.Errorf("%s: platform %s missing (has %s)", tags[0], want, strings.Join(first.Platforms, ", "))
+		}
+	}
+	return first.Digest, nil
+}
+
+// declaredPlatforms reads the platforms a port's build config asks for. Build
+// kinds without a platforms option yield none, so nothing is checked.
+func declaredPlatforms(params []byte) []string {
+	var o struct {
+		Platforms []string `yaml:"platforms"`
+	}
+	if err := yaml.Unmarshal(params, &o); err != nil {
+		return nil
+	}
+	return o.Platforms
+}
+
+// smokeRunners returns the runner of the smoke tests of ports by build kind.
+// The images of a podman build are loaded into the containers storage, so
+// podman runs them; buildah cannot run an image, so its ports are not tested.
+// Every other kind loads into docker, which bin runs.
+func smokeRunners(bin string, dry_run bool, out io.Writer) func(kind string) smoke.Runner {
+	return func(kind string) smoke.Runner {
+		switch kind {
+		case "podman":
+			return smoke.Docker{Bin: "podman", DryRun: dry_run, Stdout: out}
+		case "buildah":
+			return nil
+		default:
+			return smoke.Docker{Bin: bin, DryRun: dry_run, Stdout: out}
+		}
+	}
+}
+
+// testPlatform returns the platform of the declared ones to load and run the
+// smoke tests on: the host's, or the first declared when the port does not
+// build for the host, which then runs emulated.
+func testPlatform(declared []string) string {
+	host := "linux/" + runtime.GOARCH
+	for _, p := range declared {
+		if p == host || strings.HasPrefix(p, host+"/") {
+			return p
+		}
+	}
+	return declared[0]
+}
+
+// hasPlatform reports whether want ("os/arch[/variant]") is among have. A want
+// without a variant matches any variant, so "linux/arm64" is satisfied by the
+// "linux/arm64/v8" a registry reports.
+func hasPlatform(have []string, want string) bool {
+	for _, h := range have {
+		if h == want || strings.HasPrefix(h, want+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // spec builds the runtime build description for a node. The upstream name and
 // digest are recorded as labels so the digest comparator can detect future
 // upstream changes; the digest is resolved fresh so a just-pushed base counts.
-// A node without a base (e.g. an http source) records no base labels.
-func (r *buildRunner) spec(ctx context.Context, node *cladev1.Node) builder.Spec {
+// A node without a base (e.g. an http source) records no base labels. The
+// node's matrix values are passed as build args.
+//
+// In a staged run the node is tagged with its staging tag only, and a base
+// built earlier in the run is replaced by that base's staging tag. The base
+// name label keeps the real reference; the digest is the same once promoted.
+func (r *buildRunner) spec(ctx context.Context, p *port.Port, node *cladev1.Node) builder.Spec {
+	tags, base := node.Tags, node.Base
 	labels := map[string]string{}
+	if r.runID != "" && len(tags) > 0 {
+		if s, ok := r.staged[base]; ok {
+			base = s
+		}
+		staging := stagingTag(tags[0], r.runID)
+		if r.staged == nil {
+			r.staged = map[string]string{}
+		}
+		for _, t := range tags {
+			r.staged[t] = staging
+		}
+		tags = []string{staging}
+		labels[runIDLabel] = r.runID
+	}
 	if node.Base != "" {
 		labels[baseNameLabel] = node.Base
-		if info, err := r.reg.Stat(ctx, node.Base); err == nil {
+		if info, err := r.reg.Stat(ctx, base); err == nil {
 			labels[compare.DefaultBaseDigestLabel] = info.Digest
 		}
 	}
+	var args map[string]string
+	if len(node.Matrix) > 0 {
+		args = make(map[string]string, len(node.Matrix))
+		for k, v := range node.Matrix {
+			args[port.MatrixArg(k)] = v
+		}
+	}
 
 	return builder.Spec{
-		Dir:     node.Port,
-		Tags:    node.Tags,
-		Base:    node.Base,
+		Dir:     p.Dir,
+		Tags:    tags,
+		Base:    base,
 		BaseTag: node.BaseTag,
+		Args:    args,
 		Labels:  labels,
 		Push:    r.push,
 		Load:    r.load,
@@ -2,16 +2,22 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/lesomnus/clade/builder"
 	"github.com/lesomnus/clade/compare"
+	"github.com/lesomnus/clade/history"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
 	"github.com/lesomnus/clade/port"
 	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/clade/sign"
+	"github.com/lesomnus/clade/smoke"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
@@ -148,6 +154,16 @@ func TestBuildRunner(t *testing.T) {
 	}
 }
 
+func TestTestPlatform(t *testing.T) {
+	host := "linux/" + runtime.GOARCH
+	if got := testPlatform([]string{"linux/s390x", host + "/v8"}); got != host+"/v8" {
+		t.Errorf("with the host = %q", got)
+	}
+	if got := testPlatform([]string{"windows/amd64"}); got != "windows/amd64" {
+		t.Errorf("without the host = %q", got)
+	}
+}
+
 func TestReadGraphFile(t *testing.T) {
 	g := sampleGraph()
 	dir := t.TempDir()
@@ -180,3 +196,394 @@ func TestReadGraphFile(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildRunnerVerify(t *testing.T) {
+	p := &port.Port{
+		Dir: "ports/b",
+		Build: port.Build{
+			Repo:   "b",
+			Tags:   []string{"{{.Major}}"},
+			Params: []byte("platforms: [linux/amd64, linux/arm64]\n"),
+		},
+	}
+	labels := map[string]string{baseNameLabel: "a:1", compare.DefaultBaseDigestLabel: "sha256:base1"}
+	good := &registry.ImageInfo{
+		Digest:    "sha256:new",
+		Labels:    labels,
+		Platforms: []string{"linux/amd64", "linux/arm64/v8"},
+	}
+
+	cases := []struct {
+		name   string
+		pushed map[string]*registry.ImageInfo
+		want   string
+	}{
+		{"ok", map[string]*registry.ImageInfo{"b:1.0": good, "b:1": good}, ""},
+		{"stale floating tag", map[string]*registry.ImageInfo{
+			"b:1.0": good,
+			"b:1":   {Digest: "sha256:old", Labels: labels},
+		}, "digest sha256:old"},
+		{"missing tag", map[string]*registry.ImageInfo{"b:1.0": good}, "b:1: not found"},
+		{"missing label", map[string]*registry.ImageInfo{
+			"b:1.0": {Digest: "sha256:new", Platforms: good.Platforms},
+			"b:1":   {Digest: "sha256:new", Platforms: good.Platforms},
+		}, "label"},
+		{"missing platform", map[string]*registry.ImageInfo{
+			"b:1.0": {Digest: "sha256:new", Labels: labels, Platforms: []string{"linux/amd64"}},
+			"b:1":   {Digest: "sha256:new", Labels: labels, Platforms: []string{"linux/amd64"}},
+		}, "platform linux/arm64 missing"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := registry.NewFake()
+			reg.Set("a:1", &registry.ImageInfo{Digest: "sha256:base1"})
+			for ref, info := range tc.pushed {
+				reg.Set(ref, info)
+			}
+
+			var fakes []*builder.Fake
+			runner := &buildRunner{
+				reg:        reg,
+				loadPort:   func(string) (*port.Port, error) { return p, nil },
+				newBuilder: builder.NewFake(&fakes),
+				push:       true,
+				verify:     true,
+			}
+			n := node("b:1.0", "a:1", "ports/b", true)
+			n.Tags = []string{"b:1.0", "b:1"}
+
+			err := runner.run(context.Background(), []*cladev1.Node{n})
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildRunnerLogDir(t *testing.T) {
+	// The exec command runs in the port directory, so the ports must exist.
+	root := t.TempDir()
+	ok_dir, bad_dir := filepath.Join(root, "ok"), filepath.Join(root, "bad")
+	for _, d := range []string{ok_dir, bad_dir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ports := map[string]*port.Port{
+		ok_dir: {Dir: ok_dir, Build: port.Build{
+			Kind:   "exec",
+			Params: []byte("command: [sh, -c, \"echo built {{index .Tags 0}}; echo warn >&2\"]\n"),
+		}},
+		bad_dir: {Dir: bad_dir, Build: port.Build{
+			Kind:   "exec",
+			Params: []byte("command: [sh, -c, \"echo broken; exit 3\"]\n"),
+		}},
+	}
+
+	dir := t.TempDir()
+	var out strings.Builder
+	runner := &buildRunner{
+		reg:        registry.NewFake(),
+		loadPort:   func(d string) (*port.Port, error) { return ports[d], nil },
+		newBuilder: builder.New,
+		logDir:     dir,
+		stdout:     &out,
+	}
+	ok := node("x:1", "", ok_dir, true)
+	bad := node("y:1", "", bad_dir, true)
+
+	err := runner.run(context.Background(), []*cladev1.Node{ok, bad})
+	if err == nil {
+		t.Fatal("expected the second build to fail")
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if got := read("01-x_1/build.log"); got != "built x:1\nwarn\n" {
+		t.Errorf("build.log = %q", got)
+	}
+	if got := read("01-x_1/command.txt"); !strings.Contains(got, "sh -c 'echo built x:1; echo warn >&2'") {
+		t.Errorf("command.txt = %q", got)
+	}
+	if got := read("01-x_1/result.json"); !strings.Contains(got, `"status": "succeeded"`) || !strings.Contains(got, `"tags": [`) {
+		t.Errorf("result.json = %s", got)
+	}
+	if got := read("02-y_1/result.json"); !strings.Contains(got, `"status": "failed"`) || !strings.Contains(got, "exit status 3") {
+		t.Errorf("failed result.json = %s", got)
+	}
+	if !strings.Contains(out.String(), "succeeded x:1") || !strings.Contains(out.String(), "failed y:1") {
+		t.Errorf("status lines = %q", out.String())
+	}
+}
+
+func TestBuildRunnerSmokeTests(t *testing.T) {
+	p := &port.Port{
+		Dir:   "ports/b",
+		Build: port.Build{Repo: "b", Tags: []string{"{{.Major}}"}, Params: []byte("platforms: [linux/amd64, linux/arm64]\n")},
+		Test:  port.Test{Params: []byte("- run: [b, --version]\n")},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		exit   int
+		builds int // builds run: load, then push on success
+	}{
+		{"pass", 0, 2},
+		{"fail", 1, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fakes []*builder.Fake
+			tester := &smoke.Fake{Results: map[string]smoke.Result{"b --version": {Output: "b 1.0", ExitCode: tc.exit}}}
+			log_dir := t.TempDir()
+			runner := &buildRunner{
+				reg:        registry.NewFake(),
+				loadPort:   func(string) (*port.Port, error) { return p, nil },
+				newBuilder: builder.NewFake(&fakes),
+				smoke:      func(string) smoke.Runner { return tester },
+				push:       true,
+				logDir:     log_dir,
+				stdout:     io.Discard,
+			}
+
+			err := runner.run(context.Background(), []*cladev1.Node{node("b:1", "a:1", "ports/b", true)})
+			if (err != nil) != (tc.exit != 0) {
+				t.Fatalf("err = %v", err)
+			}
+			// The first is the dry run recording command.txt.
+			fakes = fakes[1:]
+			if len(fakes) != tc.builds {
+				t.Fatalf("builds = %d, want %d", len(fakes), tc.builds)
+			}
+			if s := fakes[0].Spec; !s.Load || s.Push {
+				t.Errorf("first build load=%v push=%v, want a local build", s.Load, s.Push)
+			}
+			// The local store holds one platform; the push builds them all.
+			if s := fakes[0].Spec; len(s.Platforms) != 1 || s.Platforms[0] != testPlatform([]string{"linux/amd64", "linux/arm64"}) {
+				t.Errorf("first build platforms = %v", s.Platforms)
+			}
+			if tc.builds == 2 && (!fakes[1].Spec.Push || fakes[1].Spec.Platforms != nil) {
+				t.Errorf("second build push=%v platforms=%v, want a push of the configured ones", fakes[1].Spec.Push, fakes[1].Spec.Platforms)
+			}
+			if len(tester.Calls) != 1 || tester.Calls[0].Image != "b:1" {
+				t.Errorf("test calls = %+v", tester.Calls)
+			}
+			log, err := os.ReadFile(filepath.Join(log_dir, "01-b_1", "build.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(log), "+ test b:1: b --version\nb 1.0\n") {
+				t.Errorf("build.log = %q", log)
+			}
+		})
+	}
+}
+
+func TestBuildRunnerSmokeRunners(t *testing.T) {
+	// Each kind's images are run where they were loaded; buildah's cannot be
+	// run, so its ports are pushed untested with a warning.
+	runners := smokeRunners("docker", false, io.Discard)
+	for kind, bin := range map[string]string{"": "docker", "bake": "docker", "podman": "podman"} {
+		if r, ok := runners(kind).(smoke.Docker); !ok || r.Bin != bin {
+			t.Errorf("runner of %q = %#v, want %s", kind, runners(kind), bin)
+		}
+	}
+
+	p := &port.Port{
+		Dir:   "ports/b",
+		Build: port.Build{Repo: "b", Tags: []string{"{{.Major}}"}, Kind: "buildah"},
+		Test:  port.Test{Params: []byte("- run: [b, --version]\n")},
+	}
+	var fakes []*builder.Fake
+	var stderr strings.Builder
+	runner := &buildRunner{
+		reg:        registry.NewFake(),
+		loadPort:   func(string) (*port.Port, error) { return p, nil },
+		newBuilder: builder.NewFake(&fakes),
+		smoke:      runners,
+		push:       true,
+		stdout:     io.Discard,
+		stderr:     &stderr,
+	}
+	if err := runner.run(context.Background(), []*cladev1.Node{node("b:1", "a:1", "ports/b", true)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fakes) != 1 || !fakes[0].Spec.Push {
+		t.Errorf("builds = %d, want the push only", len(fakes))
+	}
+	if !strings.Contains(stderr.String(), `smoke tests of b:1 skipped: build kind "buildah"`) {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestBuildRunnerSign(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("a:1", &registry.ImageInfo{Digest: "sha256:base1"})
+
+	var specs []builder.Spec
+	signer := &sign.Fake{}
+	runner := &buildRunner{
+		reg:        reg,
+		loadPort:   func(dir string) (*port.Port, error) { return &port.Port{Dir: dir}, nil },
+		newBuilder: pushingBuilder(reg, &specs),
+		push:       true,
+		signer:     signer,
+	}
+	n := node("b:1", "a:1", "ports/b", true)
+	n.BaseTag = "1"
+	if err := runner.run(context.Background(), []*cladev1.Node{n}); err != nil {
+		t.Fatal(err)
+	}
+
+	// pushingBuilder records "sha256:<tag>" as the digest.
+	if !eq(signer.Signed, []string{"b@sha256:b:1"}) {
+		t.Errorf("signed = %v", signer.Signed)
+	}
+	if len(signer.Attested) != 1 {
+		t.Fatalf("attested = %v", signer.Attested)
+	}
+	att := signer.Attested[0]
+	if att.Ref != "b@sha256:b:1" || att.PredicateType != provenancePredicateType {
+		t.Errorf("attestation = %+v", att)
+	}
+	deps := att.Predicate.(*provenance).BuildDefinition.ResolvedDependencies
+	if len(deps) != 1 || deps[0].Name != "a:1" || deps[0].Digest["sha256"] != "base1" {
+		t.Errorf("resolved dependencies = %+v", deps)
+	}
+
+	// Without a push there is nothing to sign.
+	signer = &sign.Fake{}
+	runner.push, runner.signer = false, signer
+	if err := runner.run(context.Background(), []*cladev1.Node{n}); err != nil {
+		t.Fatal(err)
+	}
+	if len(signer.Signed) != 0 {
+		t.Errorf("signed without push: %v", signer.Signed)
+	}
+}
+
+func TestBuildRunnerKeepGoing(t *testing.T) {
+	ports := map[string]*port.Port{
+		"ports/a": {Dir: "ports/a", Build: port.Build{Repo: "a", Kind: "build"}},
+		"ports/b": {Dir: "ports/b", Build: port.Build{Repo: "b", Kind: "build"}},
+		"ports/c": {Dir: "ports/c", Build: port.Build{Repo: "c", Kind: "build"}},
+	}
+	var fakes []*builder.Fake
+	new_fake := builder.NewFake(&fakes)
+	outcomes := map[string]string{}
+	runner := &buildRunner{
+		reg:      registry.NewFake(),
+		loadPort: func(dir string) (*port.Port, error) { return ports[dir], nil },
+		newBuilder: func(kind string, params []byte, spec builder.Spec) (builder.Builder, error) {
+			b, err := new_fake(kind, params, spec)
+			if spec.Tags[0] == "a:1" {
+				b.(*builder.Fake).Err = errors.New("boom")
+			}
+			return b, err
+		},
+		keepGoing: true,
+		done: func(node *cladev1.Node, err error) {
+			switch {
+			case err == nil:
+				outcomes[node.Id] = "built"
+			case errors.Is(err, errSkipped):
+				outcomes[node.Id] = "skipped"
+			default:
+				outcomes[node.Id] = "failed"
+			}
+		},
+	}
+
+	// b is built on the failed a; c is not.
+	targets := []*cladev1.Node{
+		node("a:1", "up:1", "ports/a", true),
+		node("b:1", "a:1", "ports/b", true, "a:1"),
+		node("c:1", "up:1", "ports/c", true),
+	}
+	err := runner.run(context.Background(), targets)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v", err)
+	}
+	if outcomes["a:1"] != "failed" || outcomes["b:1"] != "skipped" || outcomes["c:1"] != "built" {
+		t.Errorf("outcomes = %v", outcomes)
+	}
+	if len(fakes) != 2 {
+		t.Errorf("builds = %d, want 2", len(fakes))
+	}
+}
+
+func TestBuildRunnerHistory(t *testing.T) {
+	ports := map[string]*port.Port{
+		"ports/b": {Dir: "ports/b", Build: port.Build{Repo: "b", Kind: "build"}},
+		"ports/c": {Dir: "ports/c", Build: port.Build{Repo: "c", Kind: "build"}},
+		"ports/d": {Dir: "ports/d", Build: port.Build{Repo: "d", Kind: "build"}},
+	}
+	reg := registry.NewFake()
+	reg.Set("a:1", &registry.ImageInfo{Digest: "sha256:base1"})
+	labels := map[string]string{baseNameLabel: "a:1", compare.DefaultBaseDigestLabel: "sha256:base1"}
+	reg.Set("b:1", &registry.ImageInfo{Digest: "sha256:new", Labels: labels})
+
+	var fakes []*builder.Fake
+	new_fake := builder.NewFake(&fakes)
+	s := history.New(filepath.Join(t.TempDir(), "history.db"))
+	runner := &buildRunner{
+		reg:      reg,
+		loadPort: func(dir string) (*port.Port, error) { return ports[dir], nil },
+		newBuilder: func(kind string, params []byte, spec builder.Spec) (builder.Builder, error) {
+			b, err := new_fake(kind, params, spec)
+			if spec.Tags[0] == "c:1" {
+				b.(*builder.Fake).Err = errors.New("boom")
+			}
+			return b, err
+		},
+		push:      true,
+		verify:    true,
+		keepGoing: true,
+		history:   s,
+	}
+
+	// d is built on the failed c.
+	targets := []*cladev1.Node{
+		node("b:1", "a:1", "ports/b", true),
+		node("c:1", "a:1", "ports/c", true),
+		node("d:1", "c:1", "ports/d", true, "c:1"),
+	}
+	_ = runner.run(context.Background(), targets)
+
+	records, err := s.Query(history.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("records = %d, want 3", len(records))
+	}
+	d, c, b := records[0], records[1], records[2]
+	if b.Node != "b:1" || b.Port != "ports/b" || b.Status != history.StatusSucceeded || b.BaseDigest != "sha256:base1" || b.Digest != "sha256:new" {
+		t.Errorf("b = %+v", b)
+	}
+	if c.Status != history.StatusFailed || !strings.Contains(c.Error, "boom") || c.Digest != "" {
+		t.Errorf("c = %+v", c)
+	}
+	if d.Status != history.StatusSkipped {
+		t.Errorf("d = %+v", d)
+	}
+
+	// A dry run records nothing.
+	runner.dryRun = true
+	_ = runner.run(context.Background(), targets[:1])
+	if records, _ := s.Query(history.Query{}); len(records) != 3 {
+		t.Errorf("records after a dry run = %d, want 3", len(records))
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lesomnus/clade/builder"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+)
+
+// Files written into each node's log directory.
+const (
+	buildLogOutput     = "build.log"
+	buildLogCommand    = "command.txt"
+	buildLogDockerfile = "Dockerfile"
+	buildLogResult     = "result.json"
+)
+
+// nodeLog is the artifacts directory of one node's build under --log-dir:
+//
+//	<log-dir>/<seq>-<node id>/
+//	  build.log    the builder's stdout and stderr
+//	  command.txt  the rendered command (or bake definition), as --dry-run prints it
+//	  Dockerfile   the Dockerfile rendered from the port's template, if it has one
+//	  result.json  the node, builder.Spec, timing and exit status
+//
+// The sequence prefix keeps the directories in build order.
+type nodeLog struct {
+	dir  string
+	node *cladev1.Node
+	out  *os.File
+
+	started  time.Time
+	finished time.Time
+}
+
+// buildResult is the content of result.json.
+type buildResult struct {
+	Node     string       `json:"node"`
+	Port     string       `json:"port"`
+	Kind     string       `json:"kind,omitempty"`
+	Spec     builder.Spec `json:"spec"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Duration float64      `json:"duration_seconds"`
+	Status   string       `json:"status"`
+	Error    string       `json:"error,omitempty"`
+}
+
+func openNodeLog(root string, seq int, node *cladev1.Node) (*nodeLog, error) {
+	dir := filepath.Join(root, fmt.Sprintf("%02d-%s", seq, pathSafe(node.Id)))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", dir, err)
+	}
+
+	out, err := os.Create(filepath.Join(dir, buildLogOutput))
+	if err != nil {
+		return nil, fmt.Errorf("create build log: %w", err)
+	}
+	return &nodeLog{dir: dir, node: node, out: out, started: time.Now()}, nil
+}
+
+// writeDockerfile records the Dockerfile rendered for the node, if any.
+func (l *nodeLog) writeDockerfile(data []byte) {
+	if data == nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(l.dir, buildLogDockerfile), data, 0o644)
+}
+
+// writeCommand records what the node's builder runs by constructing it once
+// more in dry-run mode. A builder that cannot be constructed records its error,
+// which the real build then reports as well.
+func (l *nodeLog) writeCommand(ctx context.Context, newBuilder func(kind string, params []byte, spec builder.Spec) (builder.Builder, error), build port.Build, spec builder.Spec) {
+	var buf bytes.Buffer
+	spec.DryRun = true
+	spec.Stdout, spec.Stderr = &buf, &buf
+
+	b, err := newBuilder(build.Kind, build.Params, spec)
+	if err == nil {
+		err = b.Build(ctx)
+	}
+	if err != nil {
+		fmt.Fprintf(&buf, "error: %v\n", err)
+	}
+	_ = os.WriteFile(filepath.Join(l.dir, buildLogCommand), buf.Bytes(), 0o644)
+}
+
+// finish closes the output and writes result.json. err is the outcome of the
+// node's build.
+func (l *nodeLog) finish(spec builder.Spec, kind string, err error) {
+	l.finished = time.Now()
+	_ = l.out.Close()
+
+	res := buildResult{
+		Node:     l.node.Id,
+		Port:     l.node.Port,
+		Kind:     kind,
+		Spec:     spec,
+		Started:  l.started,
+		Finished: l.finished,
+		Duration: l.duration().Seconds(),
+		Status:   l.status(err),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	b, merr := json.MarshalIndent(res, "", "  ")
+	if merr != nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(l.dir, buildLogResult), append(b, '\n'), 0o644)
+}
+
+func (l *nodeLog) duration() time.Duration {
+	if l.finished.IsZero() {
+		return time.Since(l.started)
+	}
+	return l.finished.Sub(l.started)
+}
+
+func (l *nodeLog) status(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+// pathSafe turns a reference such as "ghcr.io/me/app:1.2" into a single path
+// element ("ghcr.io_me_app_1.2").
+func pathSafe(ref string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref)
+}
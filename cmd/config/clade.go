@@ -14,7 +14,72 @@ type CacheConfig struct {
 type BuildConfig struct {
 	// Docker is the docker binary to invoke (default "docker").
 	Docker string `yaml:"docker"`
+	// Partials is the directory of the shared *.dockerfile partials that
+	// Dockerfile.tmpl templates may expand (default: "_common" in the first
+	// ports root).
+	Partials string `yaml:"partials"`
+}
+
+// SignConfig configures how pushed images are signed. Signing is off unless
+// Kind is set.
+type SignConfig struct {
+	// Kind is the signing strategy: "key" (in-process, with a key file) or
+	// "cosign" (the cosign CLI; keyless when Key is empty).
+	Kind string `yaml:"kind"`
+	// Key is the signing key: a file path for kind key, or any --key value
+	// cosign accepts for kind cosign.
+	Key string `yaml:"key"`
+	// Bin is the cosign binary for kind cosign (default "cosign").
+	Bin string `yaml:"bin"`
+	// Args are extra arguments passed to cosign.
+	Args []string `yaml:"args"`
+}
+
+// PruneConfig sets the keep rules of `clade prune`.
+type PruneConfig struct {
+	// MinAge keeps images created less than this long ago, as a Go duration
+	// string (default "720h"), so consumers pinned to a superseded tag have
+	// time to move. "0" keeps none for their age.
+	MinAge string `yaml:"min-age"`
+	// Keep are tag patterns (path.Match syntax) that are never pruned.
+	Keep []string `yaml:"keep"`
 }
 
 // Outdated comparison is configured per port (port.yaml's compare list), not
 // globally, so there is no compare config here.
+
+// ServeConfig configures `clade serve`.
+type ServeConfig struct {
+	// Secret authenticates the registries' webhooks: the key GitHub signs
+	// its payloads with, and the token the others send. Empty refuses every
+	// payload. It is never read from nor written to YAML, so it cannot leak
+	// through a dump of the configuration: it is taken from the
+	// CLADE_SERVE_SECRET environment variable, else from SecretFile.
+	Secret string `yaml:"-"`
+	// SecretFile is a file holding Secret. Surrounding whitespace is
+	// trimmed.
+	SecretFile string `yaml:"secret-file"`
+	// APIToken is the bearer token the API requires. Empty authenticates no
+	// call and refuses those that make the daemon work. Like Secret, it is
+	// taken from the CLADE_API_TOKEN environment variable, else from
+	// APITokenFile.
+	APIToken string `yaml:"-"`
+	// APITokenFile is a file holding APIToken.
+	APITokenFile string `yaml:"api-token-file"`
+}
+
+// HistoryConfig configures the record of build attempts `clade history`
+// queries.
+type HistoryConfig struct {
+	// Path is the history file (default "history.db" in the cache
+	// directory).
+	Path string `yaml:"path"`
+	// Disabled records no build.
+	Disabled bool `yaml:"disabled"`
+	// Backoff, when set, makes `clade watch` and `clade serve` wait this long
+	// before building again a node whose last build failed, doubling the wait
+	// with every failure in a row, as a Go duration string (e.g. "15m").
+	Backoff string `yaml:"backoff"`
+	// MaxBackoff caps the wait (default "24h").
+	MaxBackoff string `yaml:"max-backoff"`
+}
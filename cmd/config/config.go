@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 
 	"github.com/goccy/go-yaml"
 	"github.com/lesomnus/z"
@@ -19,12 +20,29 @@ type Config struct {
 
 	Otel OtelConfig
 
-	// Ports is the directory that holds port definitions.
-	Ports string `yaml:"ports"`
+	// Ports are the roots searched for port definitions, at any depth. A
+	// single root may be written as a string.
+	Ports Paths `yaml:"ports"`
+	// PortsIgnore are patterns (path.Match syntax) of directories under the
+	// roots that are not searched, matched against the directory's name or
+	// its path relative to its root. Hidden directories are always skipped.
+	PortsIgnore []string `yaml:"ports-ignore"`
+	// Defaults are merged into every port, under the _defaults.yaml files of
+	// the ports directories. They may set select, compare, build, test and
+	// deprecate.
+	Defaults map[string]any `yaml:"defaults"`
 
 	Cache CacheConfig `yaml:"cache"`
 
 	Build BuildConfig `yaml:"build"`
+
+	Sign SignConfig `yaml:"sign"`
+
+	Prune PruneConfig `yaml:"prune"`
+
+	Serve ServeConfig `yaml:"serve"`
+
+	History HistoryConfig `yaml:"history"`
 }
 
 func ReadFromFile(p string) (*Config, error) {
@@ -48,8 +66,54 @@ func (c *Config) Path() string {
 
 func (c *Config) Evaluate() error {
 	z.FallbackP(&c.Greet.Format, "Hello, %s!")
-	z.FallbackP(&c.Ports, "ports")
+	if len(c.Ports) == 0 {
+		c.Ports = Paths{"ports"}
+	}
 	z.FallbackP(&c.Cache.TTL, "24h")
 	z.FallbackP(&c.Build.Docker, "docker")
+	z.FallbackP(&c.Prune.MinAge, "720h")
+	z.FallbackP(&c.History.MaxBackoff, "24h")
+	if err := readSecret(&c.Serve.Secret, "CLADE_SERVE_SECRET", c.Serve.SecretFile); err != nil {
+		return z.Err(err, "serve.secret-file")
+	}
+	if err := readSecret(&c.Serve.APIToken, "CLADE_API_TOKEN", c.Serve.APITokenFile); err != nil {
+		return z.Err(err, "serve.api-token-file")
+	}
+	return nil
+}
+
+// readSecret sets *v from the environment variable env, else from the file
+// p, if either is set.
+func readSecret(v *string, env string, p string) error {
+	if s, ok := os.LookupEnv(env); ok {
+		*v = s
+		return nil
+	}
+	if p == "" {
+		return nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	*v = strings.TrimSpace(string(data))
+	return nil
+}
+
+// Paths is a list of paths that may also be written as a single string.
+type Paths []string
+
+func (p *Paths) UnmarshalYAML(data []byte) error {
+	var s string
+	if err := yaml.Unmarshal(data, &s); err == nil {
+		*p = Paths{s}
+		return nil
+	}
+
+	var l []string
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	*p = l
 	return nil
 }
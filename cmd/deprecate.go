@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdDeprecate() *xli.Command {
+	return &xli.Command{
+		Name:  "deprecate",
+		Brief: "mark the last image of each dropped version line as end-of-life",
+
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.Switch{Name: "dry-run", Brief: "print the tags that would be marked without changing them"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			reg, err := buildRegistry(c)
+			if err != nil {
+				return z.Err(err, "build registry")
+			}
+			ports, err := loadPorts(c)
+			if err != nil {
+				return z.Err(err, "load ports")
+			}
+			g, err := (&graph.Builder{Registry: reg}).Build(ctx, ports)
+			if err != nil {
+				return z.Err(err, "build graph")
+			}
+
+			remote := registry.NewRemote()
+			dropped, err := (&graph.Builder{Registry: remote}).Dropped(ctx, ports, g)
+			if err != nil {
+				return z.Err(err, "find dropped lines")
+			}
+			if len(dropped) == 0 {
+				cmd.Println("no dropped lines")
+				return nil
+			}
+
+			dry_run := false
+			flg.VisitP(cmd, "dry-run", &dry_run)
+
+			by_id := make(map[string]*port.Port, len(ports))
+			for _, p := range ports {
+				by_id[p.ID] = p
+			}
+			d := &deprecator{w: remote, signed: c.Sign.Kind != "", dryRun: dry_run, now: time.Now(), stdout: cmd}
+			for _, line := range dropped {
+				if err := d.deprecate(ctx, by_id[line.Port].Deprecate.Mode, line); err != nil {
+					return z.Err(err, "deprecate %s", line.Repo)
+				}
+			}
+			return nil
+		}),
+	}
+}
+
+// deprecator marks a dropped line's last image as end-of-life, in the mode its
+// port declares.
+type deprecator struct {
+	w registry.Writer
+	// signed tags in annotate mode too: annotating gives the image a new
+	// digest, which the signatures and attestations of the old one do not
+	// cover.
+	signed bool
+
+	dryRun bool
+	now    time.Time
+	stdout io.Writer
+}
+
+func (d *deprecator) deprecate(ctx context.Context, mode string, line graph.Dropped) error {
+	if mode == "annotate" && d.signed {
+		fmt.Fprintf(d.stdout, "%s: images are signed, so the line is tagged instead of annotated\n", line.Port)
+		mode = "tag"
+	}
+	switch mode {
+	case "tag":
+		// Copy every tag to its "-eol" name; the originals are left for
+		// `clade prune`, which keeps "-eol" tags.
+		for _, t := range line.Tags {
+			src, dst := line.Repo+":"+t, line.Repo+":"+t+graph.EOLSuffix
+			fmt.Fprintf(d.stdout, "tag %s -> %s\n", src, dst)
+			if d.dryRun {
+				continue
+			}
+			if err := d.w.Copy(ctx, src, dst); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "annotate":
+		// Annotating gives the first tag a new manifest; move the other tags
+		// of the image onto it.
+		first := line.Repo + ":" + line.Tags[0]
+		date := d.now.UTC().Format(time.DateOnly)
+		fmt.Fprintf(d.stdout, "annotate %s %s=%s\n", first, graph.EOLAnnotation, date)
+		if !d.dryRun {
+			if err := d.w.Annotate(ctx, first, map[string]string{graph.EOLAnnotation: date}); err != nil {
+				return err
+			}
+		}
+		for _, t := range line.Tags[1:] {
+			dst := line.Repo + ":" + t
+			fmt.Fprintf(d.stdout, "tag %s -> %s\n", first, dst)
+			if d.dryRun {
+				continue
+			}
+			if err := d.w.Copy(ctx, first, dst); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown deprecate mode %q", mode)
+	}
+}
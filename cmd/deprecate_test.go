@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/registry"
+)
+
+func TestDeprecate(t *testing.T) {
+	ctx := context.Background()
+	line := graph.Dropped{Port: "ports/node", Repo: "me.io/node", Tags: []string{"18", "18.1.0"}, Digest: "sha256:18"}
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("tag", func(t *testing.T) {
+		reg := registry.NewFake()
+		reg.Set("me.io/node:18", &registry.ImageInfo{Digest: "sha256:18"})
+		reg.Set("me.io/node:18.1.0", &registry.ImageInfo{Digest: "sha256:18"})
+
+		d := &deprecator{w: reg, now: now, stdout: io.Discard}
+		if err := d.deprecate(ctx, "tag", line); err != nil {
+			t.Fatal(err)
+		}
+		for _, ref := range []string{"me.io/node:18-eol", "me.io/node:18.1.0-eol"} {
+			if info, err := reg.Stat(ctx, ref); err != nil || info.Digest != "sha256:18" {
+				t.Errorf("%s = %v, %v", ref, info, err)
+			}
+		}
+	})
+
+	t.Run("annotate", func(t *testing.T) {
+		reg := registry.NewFake()
+		reg.Set("me.io/node:18", &registry.ImageInfo{Digest: "sha256:18"})
+		reg.Set("me.io/node:18.1.0", &registry.ImageInfo{Digest: "sha256:18"})
+
+		d := &deprecator{w: reg, now: now, stdout: io.Discard}
+		if err := d.deprecate(ctx, "annotate", line); err != nil {
+			t.Fatal(err)
+		}
+		// Both tags move to the annotated manifest.
+		for _, ref := range []string{"me.io/node:18", "me.io/node:18.1.0"} {
+			info, err := reg.Stat(ctx, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Annotations[graph.EOLAnnotation] != "2026-10-01" || info.Digest != "sha256:18+annotated" {
+				t.Errorf("%s = %+v", ref, info)
+			}
+		}
+	})
+
+	t.Run("annotate signed", func(t *testing.T) {
+		reg := registry.NewFake()
+		reg.Set("me.io/node:18", &registry.ImageInfo{Digest: "sha256:18"})
+		reg.Set("me.io/node:18.1.0", &registry.ImageInfo{Digest: "sha256:18"})
+
+		// The signatures are of sha256:18, so the digest must not change.
+		d := &deprecator{w: reg, signed: true, now: now, stdout: io.Discard}
+		if err := d.deprecate(ctx, "annotate", line); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := reg.Stat(ctx, "me.io/node:18"); err != nil || info.Digest != "sha256:18" {
+			t.Errorf("me.io/node:18 = %+v, %v", info, err)
+		}
+		if info, err := reg.Stat(ctx, "me.io/node:18-eol"); err != nil || info.Digest != "sha256:18" {
+			t.Errorf("me.io/node:18-eol = %+v, %v", info, err)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		reg := registry.NewFake()
+		d := &deprecator{w: reg, dryRun: true, now: now, stdout: io.Discard}
+		if err := d.deprecate(ctx, "tag", line); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reg.Stat(ctx, "me.io/node:18-eol"); err == nil {
+			t.Error("dry run tagged")
+		}
+	})
+}
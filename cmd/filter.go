@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/lesomnus/clade/filter"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+)
+
+// filterFlags are the node filters shared by outdated, graph and build.
+func filterFlags() flg.Flags {
+	return flg.Flags{
+		&flg.String{Name: "port", Brief: "comma-separated globs of ports (id or directory name) to select"},
+		&flg.String{Name: "repo", Brief: "comma-separated globs of target repositories to select"},
+		&flg.String{Name: "select", Brief: "selection expression, e.g. 'outdated && port=dev-*'"},
+		&flg.Switch{Name: "with-ancestors", Brief: "also select the internal ancestors of selected nodes"},
+		&flg.Switch{Name: "with-descendants", Brief: "also select the descendants of selected nodes"},
+	}
+}
+
+// readFilter builds the filter given by filterFlags.
+func readFilter(cmd *xli.Command) (*filter.Filter, error) {
+	ports, repos, sel := "", "", ""
+	flg.VisitP(cmd, "port", &ports)
+	flg.VisitP(cmd, "repo", &repos)
+	flg.VisitP(cmd, "select", &sel)
+
+	f, err := filter.New(strings.Split(ports, ","), strings.Split(repos, ","), sel)
+	if err != nil {
+		return nil, err
+	}
+	flg.VisitP(cmd, "with-ancestors", &f.WithAncestors)
+	flg.VisitP(cmd, "with-descendants", &f.WithDescendants)
+	return f, nil
+}
@@ -3,13 +3,16 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/lesomnus/clade/graph"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
 	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
 	"github.com/lesomnus/xli/flg"
 	"github.com/lesomnus/z"
 )
@@ -17,58 +20,255 @@ import (
 func NewCmdGraph() *xli.Command {
 	return &xli.Command{
 		Name:  "graph",
-		Brief: "print the dependency graph as a tree",
+		Brief: "print the dependency graph as a tree, or export it",
 
 		Flags: flg.Flags{
-			&flg.String{Name: "ports", Brief: "path to the ports directory"},
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
 			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
+			&flg.String{Name: "format", Brief: "output format: text, dot, mermaid, html"},
+		}.WithCategory("filter", filterFlags()...),
+
+		Commands: []*xli.Command{
+			newCmdGraphDiff(),
 		},
 
 		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
 			c := use_config.Must(ctx)
-			flg.VisitP(cmd, "ports", &c.Ports)
+			readPortsFlag(cmd, c)
 
-			g, err := obtainGraph(ctx, c, cmd)
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
+			g, err := obtainGraph(ctx, c, cmd, f)
 			if err != nil {
 				return z.Err(err, "obtain graph")
 			}
 
-			return renderTree(cmd, g.Nodes)
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+
+			switch format {
+			case "", "text":
+				return renderTree(cmd, g.Nodes)
+			case "dot":
+				return renderDot(cmd, g.Nodes)
+			case "mermaid":
+				return renderMermaid(cmd, g.Nodes)
+			case "html":
+				return renderHTML(cmd, g.Nodes)
+			default:
+				return fmt.Errorf("unknown format %q (want text, dot, mermaid or html)", format)
+			}
 		}),
 	}
 }
 
-// renderTree prints the graph as an indented tree. Roots are the external
-// upstream images (and any baseless nodes, e.g. http sources); each node is
-// nested under the base it derives from. Outdated targets are flagged.
-func renderTree(w io.Writer, nodes []*cladev1.Node) error {
+func newCmdGraphDiff() *xli.Command {
+	return &xli.Command{
+		Name:  "diff",
+		Brief: "compare two serialized graphs",
+
+		Args: arg.Args{
+			&arg.String{Name: "old", Brief: "the earlier graph (.json or binary)"},
+			&arg.String{Name: "new", Brief: "the later graph (.json or binary)"},
+		},
+		Flags: flg.Flags{
+			&flg.String{Name: "format", Brief: "output format: text, json"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			old_path, _ := arg.Get[string](cmd, "old")
+			new_path, _ := arg.Get[string](cmd, "new")
+
+			before, err := readGraphFile(old_path)
+			if err != nil {
+				return err
+			}
+			after, err := readGraphFile(new_path)
+			if err != nil {
+				return err
+			}
+
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+
+			d := graph.Compare(before, after)
+			switch format {
+			case "", "text":
+				return renderDiff(cmd, d)
+			case "json":
+				enc := json.NewEncoder(cmd)
+				enc.SetIndent("", "  ")
+				return enc.Encode(d)
+			default:
+				return fmt.Errorf("unknown format %q (want text or json)", format)
+			}
+		}),
+	}
+}
+
+// renderDiff prints one line per change, grouped by kind.
+func renderDiff(w io.Writer, d *graph.Diff) error {
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+
 	bw := bufio.NewWriter(w)
 
-	by_id := map[string]*cladev1.Node{}
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	for _, id := range d.Added {
+		fmt.Fprintf(bw, "%s    %s\n", green("added"), id)
+	}
+	for _, id := range d.Removed {
+		fmt.Fprintf(bw, "%s  %s\n", red("removed"), id)
+	}
+	for _, m := range d.Retagged {
+		fmt.Fprintf(bw, "%s %s: %s -> %s\n", yellow("retagged"), m.Tag, m.From, m.To)
+	}
+	for _, c := range d.Rebased {
+		fmt.Fprintf(bw, "%s  %s: %s -> %s\n", yellow("rebased"), c.Id, c.From, c.To)
+	}
+	for _, f := range d.Flipped {
+		if f.Outdated {
+			fmt.Fprintf(bw, "%s %s\n", red("outdated"), f.Id)
+		} else {
+			fmt.Fprintf(bw, "%s       %s\n", green("ok"), f.Id)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// tree is the graph arranged for rendering: roots are the external upstream
+// images, the nodes a filter left out that others are built on, and any
+// baseless nodes (e.g. http sources); each node is a child of the base it
+// derives from.
+type tree struct {
+	nodes    []*cladev1.Node
+	byID     map[string]*cladev1.Node
+	children map[string][]*cladev1.Node
+	// base is the id each node is a child of: the node its base is, by any
+	// of its tags, or the base reference itself when external.
+	base  map[string]string
+	roots []string
+	// filtered are the roots that are nodes of the graph left out by a
+	// filter, rather than external upstream images.
+	filtered map[string]bool
+}
+
+func newTree(nodes []*cladev1.Node) *tree {
+	t := &tree{
+		nodes:    nodes,
+		byID:     map[string]*cladev1.Node{},
+		children: map[string][]*cladev1.Node{},
+		base:     map[string]string{},
+		filtered: map[string]bool{},
+	}
+	by_tag := map[string]string{}
 	for _, n := range nodes {
-		by_id[n.Id] = n
+		t.byID[n.Id] = n
+		by_tag[n.Id] = n.Id
+		for _, ref := range n.Tags {
+			by_tag[ref] = n.Id
+		}
 	}
 
-	children := map[string][]*cladev1.Node{}
+	// Roots have children but are not children themselves: bases that are not
+	// among the nodes, plus any node with no base at all.
+	seen := map[string]bool{}
 	for _, n := range nodes {
-		children[n.Base] = append(children[n.Base], n)
+		if n.Base == "" {
+			continue
+		}
+		id, ok := by_tag[n.Base]
+		if !ok {
+			// The graph records the node a base is as the parent, so a base
+			// with a parent is a node the filter left out.
+			id = n.Base
+			if len(n.Parents) > 0 {
+				id = n.Parents[0]
+				t.filtered[id] = true
+			}
+			if !seen[id] {
+				seen[id] = true
+				t.roots = append(t.roots, id)
+			}
+		}
+		t.base[n.Id] = id
+		t.children[id] = append(t.children[id], n)
+	}
+	for _, n := range nodes {
+		if n.Base == "" {
+			t.roots = append(t.roots, n.Id)
+		}
+	}
+	return t
+}
+
+// rootLabel is the suffix marking a root that is not a node: "filtered" for a
+// node a filter left out, "external" for an upstream image.
+func (t *tree) rootLabel(ref string) string {
+	if t.filtered[ref] {
+		return "filtered"
+	}
+	return "external"
+}
+
+// edges lists the graph's edges as (from, to) pairs in graph order: each node
+// from its base, plus from any internal parent that is not its base and is
+// among the nodes.
+func (t *tree) edges() [][2]string {
+	out := [][2]string{}
+	for _, n := range t.nodes {
+		base, ok := t.base[n.Id]
+		if ok {
+			out = append(out, [2]string{base, n.Id})
+		}
+		for _, p := range n.Parents {
+			if _, is_node := t.byID[p]; is_node && (!ok || p != base) {
+				out = append(out, [2]string{p, n.Id})
+			}
+		}
+	}
+	return out
+}
+
+// extraTags returns the tags of n after the canonical one, as "+tag".
+func extraTags(n *cladev1.Node) []string {
+	if len(n.Tags) < 2 {
+		return nil
 	}
+	out := make([]string, 0, len(n.Tags)-1)
+	for _, t := range n.Tags[1:] {
+		out = append(out, "+"+tagOf(t))
+	}
+	return out
+}
+
+// renderTree prints the graph as an indented tree. Roots are the external
+// upstream images, the filtered-out nodes others are built on, and any
+// baseless nodes (e.g. http sources); each node is nested under the base it
+// derives from. Outdated targets are flagged.
+func renderTree(w io.Writer, nodes []*cladev1.Node) error {
+	bw := bufio.NewWriter(w)
+	t := newTree(nodes)
 
 	faint := color.New(color.Faint).SprintFunc()
 	red := color.New(color.FgRed).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
 
 	label := func(ref string) string {
-		n, ok := by_id[ref]
+		n, ok := t.byID[ref]
 		if !ok {
-			return faint(ref + " (external)")
+			return faint(ref + " (" + t.rootLabel(ref) + ")")
 		}
 		s := n.Id
-		if len(n.Tags) > 1 {
-			extra := make([]string, 0, len(n.Tags)-1)
-			for _, t := range n.Tags[1:] {
-				extra = append(extra, "+"+tagOf(t))
-			}
+		if extra := extraTags(n); len(extra) > 0 {
 			s += " " + faint(strings.Join(extra, " "))
 		}
 		if n.Outdated {
@@ -87,24 +287,15 @@ func renderTree(w io.Writer, nodes []*cladev1.Node) error {
 		}
 		fmt.Fprintf(bw, "%s%s%s\n", prefix, connector, label(ref))
 
-		kids := children[ref]
+		kids := t.children[ref]
 		for i, k := range kids {
 			walk(k.Id, next, i == len(kids)-1)
 		}
 	}
 
-	// Roots have children but are not children themselves: external upstreams
-	// plus any node with no base at all (e.g. an http source).
-	roots := externalBases(nodes)
-	for _, n := range nodes {
-		if n.Base == "" {
-			roots = append(roots, n.Id)
-		}
-	}
-
-	for _, r := range roots {
+	for _, r := range t.roots {
 		fmt.Fprintln(bw, label(r))
-		kids := children[r]
+		kids := t.children[r]
 		for i, k := range kids {
 			walk(k.Id, "", i == len(kids)-1)
 		}
@@ -113,25 +304,6 @@ func renderTree(w io.Writer, nodes []*cladev1.Node) error {
 	return bw.Flush()
 }
 
-// externalBases lists, in graph order, the base references that are not produced
-// by any node (i.e. upstream images clade only consumes). Each appears once.
-func externalBases(nodes []*cladev1.Node) []string {
-	is_node := map[string]bool{}
-	for _, n := range nodes {
-		is_node[n.Id] = true
-	}
-
-	seen := map[string]bool{}
-	out := []string{}
-	for _, n := range nodes {
-		if n.Base != "" && !is_node[n.Base] && !seen[n.Base] {
-			seen[n.Base] = true
-			out = append(out, n.Base)
-		}
-	}
-	return out
-}
-
 // tagOf returns the tag portion of a "repo:tag" reference.
 func tagOf(ref string) string {
 	if i := strings.LastIndex(ref, ":"); i >= 0 {
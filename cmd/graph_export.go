@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+// renderDot prints the graph in Graphviz DOT. External upstreams are dashed
+// and grey, nodes a filter left out dotted and grey; outdated targets are red.
+func renderDot(w io.Writer, nodes []*cladev1.Node) error {
+	bw := bufio.NewWriter(w)
+	t := newTree(nodes)
+
+	fmt.Fprintln(bw, "digraph clade {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=\"monospace\"];")
+	for _, r := range t.roots {
+		if _, ok := t.byID[r]; ok {
+			continue
+		}
+		if t.filtered[r] {
+			fmt.Fprintf(bw, "\t%s [label=%s, style=dotted, color=gray50, fontcolor=gray50];\n", strconv.Quote(r), strconv.Quote(r+"\n(filtered)"))
+		} else {
+			fmt.Fprintf(bw, "\t%s [style=dashed, color=gray50, fontcolor=gray50];\n", strconv.Quote(r))
+		}
+	}
+	for _, n := range nodes {
+		label := strings.Join(append([]string{n.Id}, extraTags(n)...), "\n")
+		attrs := "label=" + strconv.Quote(label)
+		if n.Outdated {
+			attrs += ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", strconv.Quote(n.Id), attrs)
+	}
+	for _, e := range t.edges() {
+		fmt.Fprintf(bw, "\t%s -> %s;\n", strconv.Quote(e[0]), strconv.Quote(e[1]))
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// renderMermaid prints the graph as a Mermaid flowchart, which GitHub renders
+// in Markdown. Node ids are positional (n0, n1, ...) since references are not
+// valid Mermaid ids.
+func renderMermaid(w io.Writer, nodes []*cladev1.Node) error {
+	bw := bufio.NewWriter(w)
+	t := newTree(nodes)
+
+	ids := map[string]string{}
+	declare := func(ref, label, class string) {
+		ids[ref] = "n" + strconv.Itoa(len(ids))
+		label = strings.ReplaceAll(label, `"`, "#quot;")
+		fmt.Fprintf(bw, "\t%s[\"%s\"]", ids[ref], label)
+		if class != "" {
+			fmt.Fprintf(bw, ":::%s", class)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, r := range t.roots {
+		if _, ok := t.byID[r]; !ok && t.filtered[r] {
+			declare(r, r+"<br/>(filtered)", "filtered")
+		} else if !ok {
+			declare(r, r, "external")
+		}
+	}
+	for _, n := range nodes {
+		class := ""
+		if n.Outdated {
+			class = "outdated"
+		}
+		declare(n.Id, strings.Join(append([]string{n.Id}, extraTags(n)...), "<br/>"), class)
+	}
+	for _, e := range t.edges() {
+		fmt.Fprintf(bw, "\t%s --> %s\n", ids[e[0]], ids[e[1]])
+	}
+	fmt.Fprintln(bw, "\tclassDef external stroke-dasharray:5 5,color:#888")
+	fmt.Fprintln(bw, "\tclassDef filtered stroke-dasharray:2 2,color:#888")
+	fmt.Fprintln(bw, "\tclassDef outdated stroke:#d00,color:#d00")
+
+	return bw.Flush()
+}
+
+//go:embed graph.html.tmpl
+var graphHTML string
+
+var graphHTMLTemplate = template.Must(template.New("graph").Parse(graphHTML))
+
+// htmlNode is a node of the HTML page's tree.
+type htmlNode struct {
+	Ref      string
+	Extra    []string
+	External bool
+	// Filtered is an External node of the graph a filter left out.
+	Filtered bool
+	Outdated bool
+
+	Port    string
+	Digest  string
+	Created string
+	Labels  [][2]string
+
+	Children []*htmlNode
+}
+
+// renderHTML writes the graph as a single self-contained HTML page: the tree
+// of renderTree with collapsible subtrees and each target's image details.
+func renderHTML(w io.Writer, nodes []*cladev1.Node) error {
+	t := newTree(nodes)
+
+	var build func(ref string) *htmlNode
+	build = func(ref string) *htmlNode {
+		h := &htmlNode{Ref: ref}
+		if n, ok := t.byID[ref]; !ok {
+			h.External, h.Filtered = true, t.filtered[ref]
+		} else {
+			h.Extra = extraTags(n)
+			h.Outdated = n.Outdated
+			h.Port = n.Port
+			if img := n.Image; img != nil {
+				h.Digest = img.Digest
+				if img.Created != nil {
+					h.Created = img.Created.AsTime().UTC().Format(time.RFC3339)
+				}
+				for k, v := range img.Labels {
+					h.Labels = append(h.Labels, [2]string{k, v})
+				}
+				sort.Slice(h.Labels, func(i, j int) bool { return h.Labels[i][0] < h.Labels[j][0] })
+			}
+		}
+		for _, k := range t.children[ref] {
+			h.Children = append(h.Children, build(k.Id))
+		}
+		return h
+	}
+
+	roots := make([]*htmlNode, 0, len(t.roots))
+	for _, r := range t.roots {
+		roots = append(roots, build(r))
+	}
+
+	outdated := 0
+	for _, n := range nodes {
+		if n.Outdated {
+			outdated++
+		}
+	}
+
+	return graphHTMLTemplate.Execute(w, map[string]any{
+		"Roots":    roots,
+		"Targets":  len(nodes),
+		"Outdated": outdated,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/fatih/color"
+	"github.com/lesomnus/clade/graph"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
 )
 
@@ -85,3 +86,203 @@ func TestRenderTreeBaselessRoot(t *testing.T) {
 		t.Errorf("tree mismatch\n got:\n%s\nwant:\n%s", got, want)
 	}
 }
+
+func TestRenderDiff(t *testing.T) {
+	color.NoColor = true
+
+	d := &graph.Diff{
+		Added:    []string{"a:2"},
+		Removed:  []string{"a:0"},
+		Retagged: []graph.TagMove{{Tag: "a:latest", From: "a:1", To: "a:2"}},
+		Rebased:  []graph.BaseChange{{Id: "b:1", From: "a:1", To: "a:2"}},
+		Flipped:  []graph.Flip{{Id: "b:1", Outdated: true}, {Id: "c:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderDiff(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"added    a:2",
+		"removed  a:0",
+		"retagged a:latest: a:1 -> a:2",
+		"rebased  b:1: a:1 -> a:2",
+		"outdated b:1",
+		"ok       c:1",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("diff mismatch\n got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := renderDiff(&buf, &graph.Diff{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "no changes\n" {
+		t.Errorf("empty diff = %q", buf.String())
+	}
+}
+
+func TestRenderDot(t *testing.T) {
+	nodes := []*cladev1.Node{
+		{Id: "a:1", Tags: []string{"a:1", "a:1.0"}, Base: "up:1"},
+		{Id: "b:1", Tags: []string{"b:1"}, Base: "a:1", Outdated: true, Parents: []string{"a:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderDot(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"digraph clade {",
+		"\trankdir=LR;",
+		"\tnode [shape=box, fontname=\"monospace\"];",
+		"\t\"up:1\" [style=dashed, color=gray50, fontcolor=gray50];",
+		"\t\"a:1\" [label=\"a:1\\n+1.0\"];",
+		"\t\"b:1\" [label=\"b:1\", color=red, fontcolor=red];",
+		"\t\"up:1\" -> \"a:1\";",
+		"\t\"a:1\" -> \"b:1\";",
+		"}",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("dot mismatch\n got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	nodes := []*cladev1.Node{
+		{Id: "a:1", Tags: []string{"a:1", "a:1.0"}, Base: "up:1"},
+		{Id: "b:1", Tags: []string{"b:1"}, Base: "a:1", Outdated: true, Parents: []string{"a:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderMermaid(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"flowchart LR",
+		"\tn0[\"up:1\"]:::external",
+		"\tn1[\"a:1<br/>+1.0\"]",
+		"\tn2[\"b:1\"]:::outdated",
+		"\tn0 --> n1",
+		"\tn1 --> n2",
+		"\tclassDef external stroke-dasharray:5 5,color:#888",
+		"\tclassDef filtered stroke-dasharray:2 2,color:#888",
+		"\tclassDef outdated stroke:#d00,color:#d00",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("mermaid mismatch\n got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	nodes := []*cladev1.Node{
+		{
+			Id: "a:1", Tags: []string{"a:1"}, Base: "up:1", Port: "ports/a",
+			Image: &cladev1.Image{Digest: "sha256:ab", Labels: map[string]string{"note": "<b>"}},
+		},
+		{Id: "b:1", Tags: []string{"b:1"}, Base: "a:1", Outdated: true, Parents: []string{"a:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderHTML(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`<summary>up:1 (external)</summary>`,
+		`<dt>digest</dt><dd>sha256:ab</dd>`,
+		`<dt>note</dt><dd>&lt;b&gt;</dd>`,
+		`<details open class="outdated">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("html lacks %q:\n%s", want, out)
+		}
+	}
+	// b:1 is nested inside a:1, which is nested inside up:1.
+	if i, j := strings.Index(out, "a:1"), strings.Index(out, "b:1"); i < 0 || j < i {
+		t.Errorf("b:1 not nested under a:1:\n%s", out)
+	}
+}
+
+func TestRenderFilteredParent(t *testing.T) {
+	// b:1 is built on a:1.0, the node a:1 tagged so, which a filter left out.
+	// It is drawn as a:1, marked apart from the external upstreams.
+	nodes := []*cladev1.Node{
+		{Id: "b:1", Tags: []string{"b:1"}, Base: "a:1.0", Parents: []string{"a:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderMermaid(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\tn0[\"a:1<br/>(filtered)\"]:::filtered\n", "\tn0 --> n1\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("mermaid lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := renderDot(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"a:1" [label="a:1\n(filtered)", style=dotted`, `"a:1" -> "b:1";`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("dot lacks %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "a:1.0") {
+		t.Errorf("dot draws the base reference:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderHTML(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<details open class="filtered">`+"\n<summary>a:1 (filtered)</summary>") {
+		t.Errorf("html:\n%s", buf.String())
+	}
+}
+
+func TestRenderBaseByTag(t *testing.T) {
+	// b:1 is built on a:1.0, a tag of the node a:1, not on an external image.
+	nodes := []*cladev1.Node{
+		{Id: "a:1", Tags: []string{"a:1", "a:1.0"}, Base: "up:1"},
+		{Id: "b:1", Tags: []string{"b:1"}, Base: "a:1.0", Parents: []string{"a:1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := renderDot(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"digraph clade {",
+		"\trankdir=LR;",
+		"\tnode [shape=box, fontname=\"monospace\"];",
+		"\t\"up:1\" [style=dashed, color=gray50, fontcolor=gray50];",
+		"\t\"a:1\" [label=\"a:1\\n+1.0\"];",
+		"\t\"b:1\" [label=\"b:1\"];",
+		"\t\"up:1\" -> \"a:1\";",
+		"\t\"a:1\" -> \"b:1\";",
+		"}",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("dot mismatch\n got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := renderTree(&buf, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "a:1.0") {
+		t.Errorf("tree draws the base reference:\n%s", buf.String())
+	}
+}
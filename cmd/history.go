@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/history"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdHistory() *xli.Command {
+	return &xli.Command{
+		Name:  "history",
+		Brief: "list the recorded build attempts, newest first",
+
+		Args: arg.Args{
+			&arg.String{Name: "node", Optional: true, Brief: "node id or tag whose builds to list (default: every node)"},
+		},
+		Flags: flg.Flags{
+			&flg.Int{Name: "limit", Brief: "list at most this many builds, 0 for all (default 20)"},
+			&flg.String{Name: "status", Brief: "only builds that ended so: succeeded, failed, skipped or promoted"},
+			&flg.String{Name: "since", Brief: "only builds started within this duration, e.g. 24h"},
+			&flg.String{Name: "format", Brief: "output format: text, json"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			s := openHistory(c)
+			if s == nil {
+				return fmt.Errorf("build history is disabled")
+			}
+
+			q := history.Query{Limit: 20}
+			q.Ref, _ = arg.Get[string](cmd, "node")
+			flg.VisitP(cmd, "limit", &q.Limit)
+			if q.Limit < 0 {
+				return fmt.Errorf("--limit must not be negative")
+			}
+			status := ""
+			flg.VisitP(cmd, "status", &status)
+			switch q.Status = history.Status(status); q.Status {
+			case "", history.StatusSucceeded, history.StatusFailed, history.StatusSkipped, history.StatusPromoted:
+			default:
+				return fmt.Errorf("unknown status %q (want succeeded, failed, skipped or promoted)", status)
+			}
+			since := ""
+			flg.VisitP(cmd, "since", &since)
+			if since != "" {
+				d, err := time.ParseDuration(since)
+				if err != nil || d <= 0 {
+					return fmt.Errorf("--since %q: want a positive duration", since)
+				}
+				q.Since = time.Now().Add(-d)
+			}
+
+			records, err := s.Query(q)
+			if err != nil {
+				return z.Err(err, "query history")
+			}
+
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+			switch format {
+			case "", "text":
+				printHistory(cmd, s.Path(), records)
+			case "json":
+				enc := json.NewEncoder(cmd)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(records); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unknown format %q (want text or json)", format)
+			}
+			if format == "json" || q.Ref == "" {
+				return nil
+			}
+
+			b, err := readBackoff(c)
+			if err != nil || b.Base == 0 {
+				return err
+			}
+			at, err := s.RetryAt(q.Ref, b)
+			if err != nil {
+				return z.Err(err, "query history")
+			}
+			if !at.IsZero() {
+				cmd.Printf("backed off: not built again before %s\n", at.Local().Format(time.DateTime))
+			}
+			return nil
+		}),
+	}
+}
+
+// openHistory returns the configured history, or nil when it is disabled or
+// there is nowhere to keep it.
+func openHistory(c *config.Config) *history.Store {
+	if c.History.Disabled {
+		return nil
+	}
+	if c.History.Path != "" {
+		return history.New(c.History.Path)
+	}
+	dir := cacheDir(c)
+	if dir == "" {
+		return nil
+	}
+	return history.New(filepath.Join(dir, "history.db"))
+}
+
+// readBackoff reads the configured backoff; its Base is zero when there is
+// none.
+func readBackoff(c *config.Config) (history.Backoff, error) {
+	b := history.Backoff{}
+	if c.History.Backoff == "" {
+		return b, nil
+	}
+	d, err := time.ParseDuration(c.History.Backoff)
+	if err != nil || d <= 0 {
+		return b, fmt.Errorf("parse history backoff %q: want a positive duration", c.History.Backoff)
+	}
+	b.Base = d
+	if c.History.MaxBackoff != "" {
+		d, err := time.ParseDuration(c.History.MaxBackoff)
+		if err != nil || d <= 0 {
+			return b, fmt.Errorf("parse history max-backoff %q: want a positive duration", c.History.MaxBackoff)
+		}
+		b.Max = d
+	}
+	return b, nil
+}
+
+// printHistory prints one row per record, and the first line of the error of
+// each failed one under it.
+func printHistory(cmd *xli.Command, path string, records []*history.Record) {
+	if len(records) == 0 {
+		cmd.Printf("no builds recorded in %s\n", path)
+		return
+	}
+
+	width := len("NODE")
+	for _, r := range records {
+		width = max(width, len(r.Node))
+	}
+	cmd.Printf("%-19s  %-9s  %8s  %-*s  %-12s  %-12s  %s\n", "STARTED", "STATUS", "DURATION", width, "NODE", "BASE", "DIGEST", "LOG")
+	for _, r := range records {
+		cmd.Printf("%-19s  %-9s  %8s  %-*s  %-12s  %-12s  %s\n",
+			r.Started.Local().Format(time.DateTime),
+			r.Status,
+			r.Duration().Round(time.Second),
+			width, r.Node,
+			orDash(shortDigest(r.BaseDigest)),
+			orDash(shortDigest(r.Digest)),
+			orDash(r.Log),
+		)
+		if r.Status == history.StatusFailed && r.Error != "" {
+			msg, _, _ := strings.Cut(r.Error, "\n")
+			cmd.Printf("  %s\n", msg)
+		}
+	}
+}
+
+// shortDigest abbreviates a digest to the first 12 characters of its hex, as
+// docker does.
+func shortDigest(d string) string {
+	_, hex, ok := strings.Cut(d, ":")
+	if !ok {
+		hex = d
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
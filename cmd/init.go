@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/clade/scaffold"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdInit() *xli.Command {
+	return newCmdScaffold("init")
+}
+
+func NewCmdPort() *xli.Command {
+	return &xli.Command{
+		Name:  "port",
+		Brief: "manage ports",
+
+		Commands: []*xli.Command{
+			newCmdScaffold("new"),
+		},
+
+		Handler: xli.RequireSubcommand(),
+	}
+}
+
+// newCmdScaffold is `clade init` and `clade port new`.
+func newCmdScaffold(name string) *xli.Command {
+	return &xli.Command{
+		Name:  name,
+		Brief: "create a port, suggesting how to select among the upstream's tags",
+
+		Args: arg.Args{
+			&arg.String{Name: "name", Brief: "directory of the new port, under the first ports root"},
+		},
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "source", Brief: "upstream repository to build on, e.g. docker.io/library/golang"},
+			&flg.String{Name: "repo", Brief: "repository to push to (default: beside the other ports')"},
+			&flg.String{Name: "pre-release", Brief: "track versions with this pre-release, e.g. alpine"},
+			&flg.Switch{Name: "dry-run", Brief: "print the suggestion and the tags it would push without creating the port"},
+			&flg.Switch{Name: "yes", Brief: "do not prompt; take the suggestions"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+			if len(c.Ports) == 0 {
+				return errors.New("no ports root configured")
+			}
+
+			reg, err := buildRegistry(c)
+			if err != nil {
+				return z.Err(err, "build registry")
+			}
+
+			port_name, _ := arg.Get[string](cmd, "name")
+			dir, err := portDir(c.Ports[0], port_name)
+			if err != nil {
+				return err
+			}
+			r := &initRunner{reg: reg, loader: portLoader(c), out: cmd}
+			flg.VisitP(cmd, "source", &r.source)
+			flg.VisitP(cmd, "repo", &r.repo)
+			flg.VisitP(cmd, "pre-release", &r.preRelease)
+			flg.VisitP(cmd, "dry-run", &r.dryRun)
+
+			yes := false
+			flg.VisitP(cmd, "yes", &yes)
+			if !yes && isTerminal(os.Stdin) {
+				r.in = bufio.NewReader(os.Stdin)
+			}
+			if r.repo == "" {
+				// Ports that fail to load are linted elsewhere; they only
+				// suggest the repository here.
+				ports, _ := loadPorts(c)
+				r.repo = suggestRepo(ports, port_name)
+			}
+			return r.run(ctx, dir)
+		}),
+	}
+}
+
+// portDir returns the directory of the port named name under root. The name
+// must stay within root.
+func portDir(root, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("port name %q must be a relative path within the ports root", name)
+	}
+	return filepath.Join(root, name), nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// suggestRepo suggests the repository a port named name pushes to: beside the
+// repository most ports push to.
+func suggestRepo(ports []*port.Port, name string) string {
+	counts := map[string]int{}
+	best := ""
+	for _, p := range ports {
+		dir := path.Dir(p.Build.Repo)
+		if dir == "." {
+			continue
+		}
+		counts[dir]++
+		if counts[dir] > counts[best] || (counts[dir] == counts[best] && dir < best) {
+			best = dir
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return best + "/" + path.Base(filepath.ToSlash(name))
+}
+
+type initRunner struct {
+	reg registry.Registry
+	// loader loads the new port as it would be loaded once created.
+	loader *port.Loader
+	// in reads the answers to prompts; nil takes the flags and suggestions as
+	// they are.
+	in  *bufio.Reader
+	out io.Writer
+
+	source     string
+	repo       string
+	preRelease string
+	dryRun     bool
+}
+
+// ask prompts for a value, def when the answer is empty.
+func (r *initRunner) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(r.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(r.out, "%s: ", prompt)
+	}
+	line, err := r.in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// run suggests a select mapping for the upstream's tags, previews the tags
+// the port would push and creates the port in dir.
+func (r *initRunner) run(ctx context.Context, dir string) error {
+	var err error
+	if r.source == "" && r.in != nil {
+		if r.source, err = r.ask("upstream repository", ""); err != nil {
+			return err
+		}
+	}
+	if r.source == "" {
+		return errors.New("--source is required")
+	}
+
+	tags, err := r.reg.Tags(ctx, r.source)
+	if err != nil {
+		return z.Err(err, "list tags of %s", r.source)
+	}
+	s, err := scaffold.Suggest(tags, r.preRelease)
+	if err != nil {
+		return z.Err(err, "suggest select of %s", r.source)
+	}
+	if r.in != nil && r.preRelease == "" && len(s.PreReleases) > 0 {
+		pre, err := r.ask(fmt.Sprintf("pre-release to track (%s; empty for none)", strings.Join(firstN(s.PreReleases, 8), ", ")), "")
+		if err != nil {
+			return err
+		}
+		if pre != "" {
+			if s, err = scaffold.Suggest(tags, pre); err != nil {
+				return z.Err(err, "suggest select of %s", r.source)
+			}
+		}
+	}
+
+	if r.in != nil {
+		if r.repo, err = r.ask("repository to push to", r.repo); err != nil {
+			return err
+		}
+	}
+	if r.repo == "" {
+		return errors.New("--repo is required")
+	}
+
+	files, p, err := scaffold.New(r.loader, dir, r.source, r.repo, s)
+	if err != nil {
+		return z.Err(err, "load new port")
+	}
+	targets, err := scaffold.Preview(p, tags)
+	if err != nil {
+		return z.Err(err, "preview")
+	}
+	fmt.Fprintln(r.out, "select:")
+	for _, line := range strings.Split(strings.TrimSuffix(s.Select(), "\n"), "\n") {
+		fmt.Fprintf(r.out, "  %s\n", line)
+	}
+	fmt.Fprintln(r.out, "would push:")
+	for _, t := range targets {
+		refs := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			refs[i] = p.Build.Repo + ":" + tag
+		}
+		fmt.Fprintf(r.out, "  %s -> %s\n", t.Upstream, strings.Join(refs, ", "))
+	}
+	if r.dryRun {
+		return nil
+	}
+
+	if r.in != nil {
+		ok, err := r.ask(fmt.Sprintf("create %s? (y/n)", dir), "y")
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(ok, "y") && !strings.EqualFold(ok, "yes") {
+			return nil
+		}
+	}
+	if err := scaffold.Create(dir, files); err != nil {
+		return z.Err(err, "create port")
+	}
+	fmt.Fprintf(r.out, "created %s\n", dir)
+	return nil
+}
+
+func firstN(vs []string, n int) []string {
+	if len(vs) > n {
+		return vs[:n]
+	}
+	return vs
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+)
+
+func TestInitRunner(t *testing.T) {
+	reg := registry.NewFake()
+	for _, tag := range []string{"1.21.5", "1.22.3", "1.21.5-alpine", "1.22.3-alpine", "latest"} {
+		reg.Set("docker.io/library/golang:"+tag, &registry.ImageInfo{})
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "golang")
+	var out strings.Builder
+	r := &initRunner{
+		reg:    reg,
+		loader: &port.Loader{Roots: []string{root}},
+		in:     bufio.NewReader(strings.NewReader("docker.io/library/golang\nalpine\n\ny\n")),
+		out:    &out,
+		repo:   "ghcr.io/me/golang",
+	}
+	if err := r.run(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	// The pre-release is offered, the suggested repository taken, and the
+	// tags previewed before the port is created.
+	for _, want := range []string{
+		"pre-release to track (alpine; empty for none)",
+		"repository to push to [ghcr.io/me/golang]",
+		"  pre-release: alpine\n",
+		"  1.22.3-alpine -> ghcr.io/me/golang:1.22.3-alpine, ghcr.io/me/golang:1.22-alpine\n",
+		"created " + dir,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, port.Filename)); err != nil {
+		t.Error(err)
+	}
+
+	// Without prompts, the flags are required.
+	r = &initRunner{reg: reg, loader: &port.Loader{Roots: []string{root}}, out: &out, source: "docker.io/library/golang", dryRun: true}
+	if err := r.run(context.Background(), dir); err == nil || !strings.Contains(err.Error(), "--repo") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestInitRunnerDefaults(t *testing.T) {
+	reg := registry.NewFake()
+	for _, tag := range []string{"1.21.5", "1.22.3"} {
+		reg.Set("docker.io/library/golang:"+tag, &registry.ImageInfo{})
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, port.DefaultsFilename), []byte("build:\n  tags: ['{{.Major}}.{{.Minor}}']\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The root's defaults give the build tags: the port does not override
+	// them, and the preview shows them.
+	dir := filepath.Join(root, "golang")
+	var out strings.Builder
+	r := &initRunner{reg: reg, loader: &port.Loader{Roots: []string{root}}, out: &out, source: "docker.io/library/golang", repo: "ghcr.io/me/golang"}
+	if err := r.run(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if want := "  1.22.3 -> ghcr.io/me/golang:1.22\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("output lacks %q:\n%s", want, out.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, port.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "tags:") {
+		t.Errorf("port.yaml sets build.tags:\n%s", data)
+	}
+}
+
+func TestPortDir(t *testing.T) {
+	if dir, err := portDir("ports", "lang/golang"); err != nil || dir != filepath.Join("ports", "lang", "golang") {
+		t.Errorf("dir = %q, err = %v", dir, err)
+	}
+	for _, name := range []string{"../golang", "lang/../../golang", "/tmp/golang", ""} {
+		if _, err := portDir("ports", name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
+
+func TestSuggestRepo(t *testing.T) {
+	ports := []*port.Port{
+		{Build: port.Build{Repo: "ghcr.io/me/a"}},
+		{Build: port.Build{Repo: "ghcr.io/me/b"}},
+		{Build: port.Build{Repo: "docker.io/other/c"}},
+	}
+	if got := suggestRepo(ports, "lang/golang"); got != "ghcr.io/me/golang" {
+		t.Errorf("repo = %q", got)
+	}
+	if got := suggestRepo(nil, "golang"); got != "" {
+		t.Errorf("repo without ports = %q", got)
+	}
+}
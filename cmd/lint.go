@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lesomnus/clade/lint"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdLint() *xli.Command {
+	return &xli.Command{
+		Name:  "lint",
+		Brief: "check every port against the port schema and for template, tag, cycle and Dockerfile mistakes",
+
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "format", Brief: "output format: text, json"},
+			&flg.Switch{Name: "strict", Brief: "fail on warnings too"},
+			&flg.Switch{Name: "schema", Brief: "print the port JSON Schema, for editors, instead of linting"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			schema := false
+			flg.VisitP(cmd, "schema", &schema)
+			if schema {
+				data, err := lint.SchemaJSON()
+				if err != nil {
+					return z.Err(err, "assemble schema")
+				}
+				_, err = cmd.Write(data)
+				return err
+			}
+
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			// Every manifest is linted, the invalid ones too, rather than
+			// stopping at the first that fails to load.
+			loaded, err := portLoader(c).LoadEach()
+			if err != nil {
+				return z.Err(err, "load ports")
+			}
+			findings, err := lint.CheckLoaded(loaded)
+			if err != nil {
+				return z.Err(err, "lint ports")
+			}
+
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+			if err := renderFindings(cmd, findings, format); err != nil {
+				return err
+			}
+
+			strict := false
+			flg.VisitP(cmd, "strict", &strict)
+			errs, warns := 0, 0
+			for _, f := range findings {
+				if f.Severity == lint.Error {
+					errs++
+				} else {
+					warns++
+				}
+			}
+			if errs > 0 || (strict && warns > 0) {
+				return fmt.Errorf("%d errors and %d warnings in %d ports", errs, warns, len(loaded))
+			}
+			return nil
+		}),
+	}
+}
+
+// renderFindings prints findings one per line as "file:line:column: severity:
+// message", or as a JSON array.
+func renderFindings(w io.Writer, findings []lint.Finding, format string) error {
+	switch format {
+	case "", "text":
+		for _, f := range findings {
+			if _, err := fmt.Fprintln(w, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	default:
+		return fmt.Errorf("unknown format %q (want text or json)", format)
+	}
+}
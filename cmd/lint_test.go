@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lesomnus/clade/lint"
+)
+
+func TestRenderFindings(t *testing.T) {
+	findings := []lint.Finding{
+		{File: "ports/go/port.yaml", Line: 6, Column: 3, Severity: lint.Error, Message: `select: unknown key "lastmajor"`},
+		{File: "ports/go/port.yaml", Severity: lint.Warning, Message: "build.repo me/go is also pushed to by port ports/go2"},
+	}
+
+	var buf bytes.Buffer
+	if err := renderFindings(&buf, findings, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := `ports/go/port.yaml:6:3: error: select: unknown key "lastmajor"
+ports/go/port.yaml: warning: build.repo me/go is also pushed to by port ports/go2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("text:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := renderFindings(&buf, findings, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got []lint.Finding
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != findings[0] || got[1] != findings[1] {
+		t.Errorf("json = %+v", got)
+	}
+
+	if err := renderFindings(&buf, findings, "xml"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/cmd/version"
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/z"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// graphConfig is the part of the configuration a graph is computed from, which
+// its metadata records. It is an allow-list: the rest of the configuration may
+// hold secrets (the webhook secret, the telemetry exporters' headers), and a
+// graph is uploaded as a CI artifact and served by `clade serve`.
+type graphConfig struct {
+	Ports       config.Paths   `yaml:"ports"`
+	PortsIgnore []string       `yaml:"ports-ignore,omitempty"`
+	Defaults    map[string]any `yaml:"defaults,omitempty"`
+	Cache       struct {
+		TTL string `yaml:"ttl"`
+	} `yaml:"cache"`
+	Build struct {
+		Partials string `yaml:"partials,omitempty"`
+	} `yaml:"build,omitempty"`
+}
+
+// graphMetadata describes a graph computed now, under c, from ports: every
+// port loaded from the roots of c.Ports, before any filter.
+func graphMetadata(c *config.Config, ports []*port.Port) (*cladev1.Metadata, error) {
+	hashes, err := graph.HashPorts(ports)
+	if err != nil {
+		return nil, z.Err(err, "hash ports")
+	}
+	gc := graphConfig{Ports: c.Ports, PortsIgnore: c.PortsIgnore, Defaults: c.Defaults}
+	gc.Cache.TTL = c.Cache.TTL
+	gc.Build.Partials = c.Build.Partials
+	conf, err := yaml.Marshal(gc)
+	if err != nil {
+		return nil, z.Err(err, "marshal config")
+	}
+	return &cladev1.Metadata{
+		SchemaVersion: graph.SchemaVersion,
+		GeneratedAt:   timestamppb.New(time.Now()),
+		CladeVersion:  version.Get().Version,
+		PortRoots:     c.Ports,
+		PortHashes:    hashes,
+		Config:        string(conf),
+	}, nil
+}
+
+// checkGraph refuses a saved graph that this clade cannot read, or that was
+// computed before a port was changed, added or removed: its nodes would carry
+// the old tags and bases. The ports are read from the roots the graph was
+// computed from. With allowStale, a stale graph only prints a warning to w; a
+// graph without metadata always does, since it cannot be checked.
+func checkGraph(c *config.Config, g *cladev1.Graph, allowStale bool, w io.Writer) error {
+	meta := g.Metadata
+	if meta == nil {
+		fmt.Fprintln(w, "warning: the graph has no metadata; cannot check it against the ports")
+		return nil
+	}
+	if meta.SchemaVersion > graph.SchemaVersion {
+		return fmt.Errorf("the graph has schema version %d, newer than this clade's %d; upgrade clade", meta.SchemaVersion, graph.SchemaVersion)
+	}
+
+	roots := meta.PortRoots
+	if len(roots) == 0 {
+		roots = c.Ports
+	}
+	l := portLoader(c)
+	l.Roots = roots
+	ports, err := l.LoadAll()
+	if err != nil {
+		return z.Err(err, "load ports")
+	}
+	hashes, err := graph.HashPorts(ports)
+	if err != nil {
+		return z.Err(err, "hash ports")
+	}
+
+	changes := graph.Stale(meta, hashes)
+	if len(changes) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("the graph was computed at %s, before: %s", meta.GeneratedAt.AsTime().UTC().Format(time.RFC3339), strings.Join(changes, "; "))
+	if !allowStale {
+		return fmt.Errorf("%s; recompute it, or pass --allow-stale", msg)
+	}
+	fmt.Fprintf(w, "warning: %s\n", msg)
+	return nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+)
+
+const metaPort = `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: ghcr.io/me/dev-golang
+  tags: ["{{.Major}}.{{.Minor}}"]
+`
+
+func TestCheckGraph(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "dev-golang")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(manifest string) {
+		if err := os.WriteFile(filepath.Join(dir, port.Filename), []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(metaPort)
+
+	c := &config.Config{Ports: config.Paths{root}}
+	c.Serve.Secret = "s3cret"
+	ports, err := loadPorts(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := graphMetadata(c, ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.SchemaVersion != graph.SchemaVersion || !slices.Equal(meta.PortRoots, []string{root}) || len(meta.PortHashes) != 1 {
+		t.Fatalf("metadata = %v", meta)
+	}
+	if !strings.Contains(meta.Config, root) || strings.Contains(meta.Config, "s3cret") {
+		t.Errorf("config = %q", meta.Config)
+	}
+
+	g := &cladev1.Graph{Metadata: meta}
+	var out strings.Builder
+	if err := checkGraph(c, g, false, &out); err != nil || out.Len() != 0 {
+		t.Fatalf("fresh graph: err = %v, output = %q", err, out.String())
+	}
+
+	write(strings.Replace(metaPort, "{{.Major}}.{{.Minor}}", "{{.Major}}", 1))
+	err = checkGraph(c, g, false, &out)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, port.Filename)+" changed") {
+		t.Errorf("stale graph: err = %v", err)
+	}
+	if err := checkGraph(c, g, true, &out); err != nil || !strings.HasPrefix(out.String(), "warning: ") {
+		t.Errorf("allowed stale graph: err = %v, output = %q", err, out.String())
+	}
+
+	// A graph of a newer schema is refused even when stale graphs are allowed.
+	g.Metadata.SchemaVersion = graph.SchemaVersion + 1
+	if err := checkGraph(c, g, true, &out); err == nil {
+		t.Error("expected error for a newer schema version")
+	}
+
+	out.Reset()
+	if err := checkGraph(c, &cladev1.Graph{}, false, &out); err != nil || !strings.Contains(out.String(), "no metadata") {
+		t.Errorf("graph without metadata: err = %v, output = %q", err, out.String())
+	}
+}
+
+func TestGraphMetadataSecret(t *testing.T) {
+	dir := t.TempDir()
+	secret_file := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret_file, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "clade.yaml")
+	conf := "ports: " + dir + "\nserve:\n  secret: inline\n  secret-file: " + secret_file + "\n"
+	if err := os.WriteFile(p, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want string) {
+		t.Helper()
+		c, err := config.ReadFromFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Evaluate(); err != nil {
+			t.Fatal(err)
+		}
+		if c.Serve.Secret != want {
+			t.Fatalf("secret = %q, want %q", c.Serve.Secret, want)
+		}
+		meta, err := graphMetadata(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(meta.Config, want) {
+			t.Errorf("metadata config holds the secret: %q", meta.Config)
+		}
+		data, err := yaml.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), want) {
+			t.Errorf("marshalled config holds the secret: %q", data)
+		}
+	}
+	// The inline secret is ignored; only the file and the environment count.
+	check("s3cret")
+	t.Setenv("CLADE_SERVE_SECRET", "from-env")
+	check("from-env")
+}
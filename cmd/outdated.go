@@ -27,24 +27,34 @@ func NewCmdOutdated() *xli.Command {
 		Brief: "list build targets that are out of date with their upstream",
 
 		Flags: flg.Flags{
-			&flg.String{Name: "ports", Brief: "path to the ports directory"},
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
 			&flg.String{Name: "format", Brief: "output format: text, json, binary"},
 			&flg.Switch{Name: "all", Brief: "include up-to-date targets"},
-		},
+		}.WithCategory("filter", filterFlags()...),
 
 		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
 			c := use_config.Must(ctx)
-			flg.VisitP(cmd, "ports", &c.Ports)
+			readPortsFlag(cmd, c)
+
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
 
 			reg, err := buildRegistry(c)
 			if err != nil {
 				return z.Err(err, "build registry")
 			}
 
-			ports, err := port.LoadAll(c.Ports)
+			ports, err := loadPorts(c)
 			if err != nil {
 				return z.Err(err, "load ports")
 			}
+			meta, err := graphMetadata(c, ports)
+			if err != nil {
+				return err
+			}
+			ports = f.Ports(ports)
 
 			b := &graph.Builder{Registry: reg}
 			g, err := b.Build(ctx, ports)
@@ -58,11 +68,20 @@ func NewCmdOutdated() *xli.Command {
 			format := "text"
 			flg.VisitP(cmd, "format", &format)
 
-			by_dir := make(map[string]*port.Port, len(ports))
+			by_id := make(map[string]*port.Port, len(ports))
 			for _, p := range ports {
-				by_dir[p.Dir] = p
+				by_id[p.ID] = p
 			}
-			return renderGraph(cmd, selectNodes(g, all), format, by_dir)
+			// The dropped lines are a notice beside the outdated targets, so
+			// failing to find them does not fail the listing.
+			dropped, err := b.Dropped(ctx, ports, g)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: find dropped lines: %v\n", err)
+			}
+
+			selected := &cladev1.Graph{Nodes: f.Nodes(g.Nodes)}
+			out := &cladev1.Graph{Nodes: selectNodes(selected, all), Metadata: meta, Dropped: droppedLines(dropped)}
+			return renderGraph(cmd, out, format, by_id)
 		}),
 	}
 }
@@ -118,12 +137,11 @@ func selectNodes(g *cladev1.Graph, all bool) []*cladev1.Node {
 	return out
 }
 
-func renderGraph(cmd *xli.Command, nodes []*cladev1.Node, format string, ports map[string]*port.Port) error {
-	g := &cladev1.Graph{Nodes: nodes}
-
+func renderGraph(cmd *xli.Command, g *cladev1.Graph, format string, ports map[string]*port.Port) error {
 	switch format {
 	case "", "text":
-		renderText(cmd, nodes, ports, !color.NoColor)
+		renderText(cmd, g.Nodes, ports, !color.NoColor)
+		renderDropped(cmd, g.Dropped, ports, !color.NoColor)
 		return nil
 
 	case "json":
@@ -151,7 +169,7 @@ func renderGraph(cmd *xli.Command, nodes []*cladev1.Node, format string, ports m
 // "<status>  <port name> from <base>" (the "from <base>" part is omitted when
 // the node has no base image, e.g. an http source) followed by its tags,
 // indented. When link is set, the port name is wrapped in an OSC 8 hyperlink
-// that opens its port.yaml in terminals that support it.
+// that opens its manifest in terminals that support it.
 func renderText(w io.Writer, nodes []*cladev1.Node, ports map[string]*port.Port, link bool) {
 	dimmed := color.New(color.Faint).SprintFunc()
 	for _, n := range nodes {
@@ -161,7 +179,7 @@ func renderText(w io.Writer, nodes []*cladev1.Node, ports map[string]*port.Port,
 		}
 
 		label := portLabel(n.Port, ports, link)
-		loc := dimmed(relDir(n.Port) + "/" + port.Filename)
+		loc := dimmed(relDir(manifestOf(n.Port, ports)))
 		if n.Base != "" {
 			fmt.Fprintf(w, "%s  %s %s from %s\n", status, label, loc, color.New(color.Underline).Sprint(n.Base))
 		} else {
@@ -178,12 +196,25 @@ func renderText(w io.Writer, nodes []*cladev1.Node, ports map[string]*port.Port,
 	}
 }
 
+// renderDropped lists the newly dropped version lines after the nodes, in the
+// layout of renderText, so consumers of a line can be warned before it goes.
+func renderDropped(w io.Writer, dropped []*cladev1.DroppedLine, ports map[string]*port.Port, link bool) {
+	dimmed := color.New(color.Faint).SprintFunc()
+	for _, d := range dropped {
+		loc := dimmed(relDir(manifestOf(d.Port, ports)))
+		fmt.Fprintf(w, "%s  %s %s\n", color.New(color.FgYellow).Sprint("dropped"), portLabel(d.Port, ports, link), loc)
+		for _, t := range d.Tags {
+			fmt.Fprintf(w, "\t%s\n", color.New(color.Bold).Sprint(d.Repo+":"+t))
+		}
+	}
+}
+
 // portLabel is the styled (and, when link is set, OSC 8 hyperlinked) display
-// name of the port that produced a node, looked up by its directory. It falls
-// back to the directory's base name when the port is unknown.
-func portLabel(dir string, ports map[string]*port.Port, link bool) string {
-	name := filepath.Base(dir)
-	if p, ok := ports[dir]; ok && p.Name != "" {
+// name of the port that produced a node, looked up by its id. It falls back to
+// the id's base name when the port is unknown.
+func portLabel(id string, ports map[string]*port.Port, link bool) string {
+	name := filepath.Base(id)
+	if p, ok := ports[id]; ok && p.Name != "" {
 		name = p.Name
 	}
 
@@ -192,22 +223,31 @@ func portLabel(dir string, ports map[string]*port.Port, link bool) string {
 		return styled
 	}
 
-	abs, err := filepath.Abs(filepath.Join(dir, port.Filename))
+	abs, err := filepath.Abs(manifestOf(id, ports))
 	if err != nil {
 		return styled
 	}
 	return hyperlink("file://"+abs, styled)
 }
 
+// manifestOf returns the path of the manifest of the port with the given id,
+// derived from the id when the port is unknown.
+func manifestOf(id string, ports map[string]*port.Port) string {
+	if p, ok := ports[id]; ok && p.File != "" {
+		return p.File
+	}
+	return port.ManifestPath(id)
+}
+
 // hyperlink wraps text in an OSC 8 terminal hyperlink. Terminals that do not
 // support OSC 8 ignore the escape and show text unchanged.
 func hyperlink(uri, text string) string {
 	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", uri, text)
 }
 
-// relDir returns dir relative to the current working directory, so the path
-// shown is meaningful from where the command was run. It falls back to dir
-// unchanged when the relative path cannot be computed.
+// relDir returns the path dir relative to the current working directory, so
+// the path shown is meaningful from where the command was run. It falls back
+// to dir unchanged when the relative path cannot be computed.
 func relDir(dir string) string {
 	abs, err := filepath.Abs(dir)
 	if err != nil {
@@ -223,3 +263,11 @@ func relDir(dir string) string {
 	}
 	return rel
 }
+
+func droppedLines(dropped []graph.Dropped) []*cladev1.DroppedLine {
+	out := make([]*cladev1.DroppedLine, 0, len(dropped))
+	for _, d := range dropped {
+		out = append(out, &cladev1.DroppedLine{Port: d.Port, Repo: d.Repo, Tags: d.Tags, Digest: d.Digest})
+	}
+	return out
+}
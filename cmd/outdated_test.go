@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/fatih/color"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
 	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/xli"
 )
 
 func TestHyperlink(t *testing.T) {
@@ -72,3 +74,40 @@ func TestRenderText(t *testing.T) {
 		t.Errorf("tags should be listed indented: %q", out)
 	}
 }
+
+func TestRenderGraphDropped(t *testing.T) {
+	defer func(prev bool) { color.NoColor = prev }(color.NoColor)
+	color.NoColor = true
+
+	ports := map[string]*port.Port{"ports/node": {Dir: "ports/node", Name: "node"}}
+	g := &cladev1.Graph{Dropped: []*cladev1.DroppedLine{
+		{Port: "ports/node", Repo: "me.io/node", Tags: []string{"18", "18.1.0"}, Digest: "sha256:18"},
+	}}
+
+	var buf bytes.Buffer
+	cmd := &xli.Command{Writer: &buf}
+	if err := renderGraph(cmd, g, "text", ports); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "dropped  node ports/node/port.yaml\n\tme.io/node:18\n") {
+		t.Errorf("text = %q", buf.String())
+	}
+
+	// The workflows read the JSON, so it carries them too.
+	buf.Reset()
+	if err := renderGraph(cmd, g, "json", ports); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Dropped []struct {
+			Repo string
+			Tags []string
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Dropped) != 1 || out.Dropped[0].Repo != "me.io/node" || len(out.Dropped[0].Tags) != 2 {
+		t.Errorf("json = %s", buf.String())
+	}
+}
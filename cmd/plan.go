@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdPlan() *xli.Command {
+	return &xli.Command{
+		Name:  "plan",
+		Brief: "split the build targets into dependency levels and shards for parallel CI jobs",
+
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
+			&flg.Switch{Name: "all", Brief: "plan every node in the graph, not only outdated ones"},
+			&flg.Int{Name: "shards", Brief: "split each level into at most this many shards (default: one per node)"},
+			&flg.String{Name: "format", Brief: "output format: text, json, github"},
+		}.WithCategory("filter", filterFlags()...),
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
+			g, err := obtainGraph(ctx, c, cmd, f)
+			if err != nil {
+				return z.Err(err, "obtain graph")
+			}
+
+			all := false
+			flg.VisitP(cmd, "all", &all)
+			shards := 0
+			flg.VisitP(cmd, "shards", &shards)
+			if shards < 0 {
+				return fmt.Errorf("--shards must not be negative")
+			}
+
+			targets, err := selectBuildTargets(g, nil, all)
+			if err != nil {
+				return z.Err(err, "select targets")
+			}
+			p := newPlan(g, targets, shards)
+
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+			switch format {
+			case "", "text":
+				return renderPlan(cmd, p)
+			case "json":
+				enc := json.NewEncoder(cmd)
+				enc.SetIndent("", "  ")
+				return enc.Encode(p)
+			case "github":
+				return renderPlanGitHub(cmd, p)
+			default:
+				return fmt.Errorf("unknown format %q (want text, json or github)", format)
+			}
+		}),
+	}
+}
+
+// plan is the build targets arranged for parallel jobs. Every shard of a level
+// can be built at once; a level must wait for the previous one, since it holds
+// the ancestors of its targets.
+type plan struct {
+	Levels [][]shard `json:"levels"`
+}
+
+// shard is a job's share of a level: the ids of the nodes it builds, in graph
+// order.
+type shard struct {
+	Level int      `json:"level"`
+	Index int      `json:"index"`
+	Nodes []string `json:"nodes"`
+}
+
+// newPlan levels targets, which must be nodes of g in its order: a target's
+// level is the number of targets among its ancestors on the longest path, so
+// a target is always in a later level than any target it is built on, even
+// through ancestors that are not rebuilt. Each level is split into at most
+// shards contiguous, near-equal shards; zero gives every node its own shard.
+// The plan depends only on its inputs, so a job can recompute its shard from
+// the same serialized graph.
+func newPlan(g *cladev1.Graph, targets []*cladev1.Node, shards int) *plan {
+	is_target := map[string]bool{}
+	for _, n := range targets {
+		is_target[n.Id] = true
+	}
+
+	// depth counts the targets strictly above each node.
+	depth := map[string]int{}
+	for _, n := range g.Nodes {
+		d := 0
+		for _, p := range n.Parents {
+			pd := depth[p]
+			if is_target[p] {
+				pd++
+			}
+			d = max(d, pd)
+		}
+		depth[n.Id] = d
+	}
+
+	var levels [][]string
+	for _, n := range targets {
+		l := depth[n.Id]
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], n.Id)
+	}
+
+	p := &plan{Levels: [][]shard{}}
+	// Levels are dense: a target at level l has one at l-1 among its ancestors.
+	for i, ids := range levels {
+		n := len(ids)
+		if shards > 0 && shards < n {
+			n = shards
+		}
+		level := make([]shard, 0, n)
+		for j := range n {
+			lo, hi := j*len(ids)/n, (j+1)*len(ids)/n
+			level = append(level, shard{Level: i, Index: j, Nodes: ids[lo:hi]})
+		}
+		p.Levels = append(p.Levels, level)
+	}
+	return p
+}
+
+// renderPlan prints one line per shard under its level.
+func renderPlan(w io.Writer, p *plan) error {
+	if len(p.Levels) == 0 {
+		_, err := fmt.Fprintln(w, "nothing to build")
+		return err
+	}
+	for i, level := range p.Levels {
+		fmt.Fprintf(w, "level %d\n", i)
+		for _, s := range level {
+			fmt.Fprintf(w, "  shard %d: %s\n", s.Index, strings.Join(s.Nodes, " "))
+		}
+	}
+	return nil
+}
+
+// githubMatrix is a GitHub Actions matrix: one job per entry of include.
+type githubMatrix struct {
+	Include []githubJob `json:"include"`
+}
+
+type githubJob struct {
+	// Name identifies the job, "<level>-<index>".
+	Name string `json:"name"`
+	// Nodes are the node ids, space-separated for `clade build`.
+	Nodes string `json:"nodes"`
+}
+
+// renderPlanGitHub prints the plan as step outputs for $GITHUB_OUTPUT:
+//
+//	levels=<number of levels>
+//	level-<i>=<matrix of level i>
+//
+// A workflow declares one job per level, each needing the previous level, and
+// feeds "level-<i>" to its strategy.matrix through fromJSON.
+func renderPlanGitHub(w io.Writer, p *plan) error {
+	fmt.Fprintf(w, "levels=%d\n", len(p.Levels))
+	for i, level := range p.Levels {
+		m := githubMatrix{Include: make([]githubJob, 0, len(level))}
+		for _, s := range level {
+			m.Include = append(m.Include, githubJob{
+				Name:  fmt.Sprintf("%d-%d", s.Level, s.Index),
+				Nodes: strings.Join(s.Nodes, " "),
+			})
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return z.Err(err, "marshal matrix")
+		}
+		fmt.Fprintf(w, "level-%d=%s\n", i, b)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+// planGraph is up -> go:1 -> pay:1, go:2 -> pay:2, with node:1 and cpp:1 beside;
+// go:1 is up to date, so pay:1 does not wait for anything.
+func planGraph() *cladev1.Graph {
+	return &cladev1.Graph{Nodes: []*cladev1.Node{
+		{Id: "go:1", Base: "up/go:1"},
+		{Id: "go:2", Base: "up/go:2", Outdated: true},
+		{Id: "node:1", Base: "up/node:1", Outdated: true},
+		{Id: "cpp:1", Base: "up/cpp:1", Outdated: true},
+		{Id: "pay:1", Base: "go:1", Parents: []string{"go:1"}, Outdated: true},
+		{Id: "pay:2", Base: "go:2", Parents: []string{"go:2"}, Outdated: true},
+	}}
+}
+
+func planNodes(p *plan) [][][]string {
+	out := [][][]string{}
+	for _, level := range p.Levels {
+		l := [][]string{}
+		for _, s := range level {
+			l = append(l, s.Nodes)
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func TestNewPlan(t *testing.T) {
+	g := planGraph()
+	targets, err := selectBuildTargets(g, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := planNodes(newPlan(g, targets, 0))
+	want := [][][]string{
+		{{"go:2"}, {"node:1"}, {"cpp:1"}, {"pay:1"}},
+		{{"pay:2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("one shard per node\n got: %v\nwant: %v", got, want)
+	}
+
+	got = planNodes(newPlan(g, targets, 3))
+	want = [][][]string{
+		{{"go:2"}, {"node:1"}, {"cpp:1", "pay:1"}},
+		{{"pay:2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("three shards\n got: %v\nwant: %v", got, want)
+	}
+
+	// With --all, go:1 is rebuilt too, so pay:1 moves after it.
+	got = planNodes(newPlan(g, g.Nodes, 1))
+	want = [][][]string{
+		{{"go:1", "go:2", "node:1", "cpp:1"}},
+		{{"pay:1", "pay:2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("all, one shard\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestRenderPlanGitHub(t *testing.T) {
+	g := planGraph()
+	targets, err := selectBuildTargets(g, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := renderPlanGitHub(&buf, newPlan(g, targets, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"levels=2",
+		`level-0={"include":[{"name":"0-0","nodes":"go:2 node:1"},{"name":"0-1","nodes":"cpp:1 pay:1"}]}`,
+		`level-1={"include":[{"name":"1-0","nodes":"pay:2"}]}`,
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("github output\n got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := renderPlanGitHub(&buf, newPlan(g, nil, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "levels=0\n" {
+		t.Errorf("empty plan = %q", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+)
+
+// readPortsFlag overrides the configured ports roots with the --ports flag, a
+// comma-separated list, when it is given.
+func readPortsFlag(cmd *xli.Command, c *config.Config) {
+	v := ""
+	if !flg.VisitP(cmd, "ports", &v) {
+		return
+	}
+
+	roots := config.Paths{}
+	for _, r := range strings.Split(v, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roots = append(roots, r)
+		}
+	}
+	if len(roots) > 0 {
+		c.Ports = roots
+	}
+}
+
+// portLoader loads ports from the configured roots with the configured
+// defaults.
+func portLoader(c *config.Config) *port.Loader {
+	return &port.Loader{Roots: c.Ports, Ignore: c.PortsIgnore, Defaults: c.Defaults}
+}
+
+// loadPorts loads every port under the configured roots.
+func loadPorts(c *config.Config) ([]*port.Port, error) {
+	return portLoader(c).LoadAll()
+}
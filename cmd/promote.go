@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lesomnus/clade/history"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+// runIDLabel records the staged run an image was built in, so a promotion that
+// is resumed after its staging tag was already deleted can recognise the node
+// as promoted.
+const runIDLabel = "dev.clade.run-id"
+
+func NewCmdPromote() *xli.Command {
+	return &xli.Command{
+		Name:  "promote",
+		Brief: "retag the staging images of a `build --stage` run to their real tags",
+
+		Args: arg.Args{
+			&arg.RestStrings{Name: "node", Brief: "node ids to promote (default: all outdated)"},
+		},
+		Flags: flg.Flags{
+			&flg.String{Name: "run-id", Brief: "run id printed by `build --stage`"},
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
+			&flg.Switch{Name: "all", Brief: "promote every node in the graph, not only outdated ones"},
+			&flg.Switch{Name: "dry-run", Brief: "print the tag copies and deletions without performing them"},
+		}.WithCategory("filter", filterFlags()...),
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			run_id := ""
+			flg.VisitP(cmd, "run-id", &run_id)
+			if run_id == "" {
+				return fmt.Errorf("--run-id is required")
+			}
+
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
+			g, err := obtainGraph(ctx, c, cmd, f)
+			if err != nil {
+				return z.Err(err, "obtain graph")
+			}
+
+			all := false
+			flg.VisitP(cmd, "all", &all)
+			ids, _ := arg.Get[[]string](cmd, "node")
+
+			targets, err := selectBuildTargets(g, ids, all)
+			if err != nil {
+				return z.Err(err, "select targets")
+			}
+
+			dry_run := false
+			flg.VisitP(cmd, "dry-run", &dry_run)
+
+			reg := registry.NewRemote()
+			p := &promoter{reg: reg, w: reg, runID: run_id, dryRun: dry_run, stdout: cmd, history: openHistory(c)}
+			return p.promote(ctx, targets)
+		}),
+	}
+}
+
+// newRunID returns a run id for a staged build. It is a UTC timestamp, which
+// is valid in a tag and sorts in run order.
+func newRunID() string {
+	return time.Now().UTC().Format("20060102150405")
+}
+
+// stagingInfix separates a staging tag from the run id.
+const stagingInfix = "-clade-"
+
+// stagingTag is the reference a node's image is pushed to in a staged run.
+// ref is the node's primary tag.
+func stagingTag(ref, runID string) string {
+	return ref + stagingInfix + runID
+}
+
+// promoter publishes a staged run: every node's staging image is copied,
+// registry-side, to each of its real tags, and the staging tags are deleted
+// afterwards.
+//
+// Promotion runs in three passes so it can be repeated after any failure: all
+// staging tags are checked first (nothing is published if one is missing),
+// then every real tag is written, and only then are the staging tags removed.
+// A node whose staging tag is gone but whose primary tag carries the run id is
+// taken as already promoted.
+type promoter struct {
+	reg   registry.Registry
+	w     registry.Writer
+	runID string
+
+	dryRun bool
+	stdout io.Writer
+	// history records every node promoted; nil, or a dry run, records none.
+	history *history.Store
+}
+
+func (p *promoter) promote(ctx context.Context, targets []*cladev1.Node) error {
+	staged := make([]*cladev1.Node, 0, len(targets))
+	digests := map[string]string{} // node id -> digest of its staging image
+	for _, node := range targets {
+		if len(node.Tags) == 0 {
+			continue
+		}
+		if p.dryRun {
+			staged = append(staged, node)
+			continue
+		}
+
+		info, err := p.isStaged(ctx, node)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			staged = append(staged, node)
+			digests[node.Id] = info.Digest
+		} else {
+			fmt.Fprintf(p.stdout, "already promoted %s\n", node.Id)
+		}
+	}
+
+	for _, node := range staged {
+		src := stagingTag(node.Tags[0], p.runID)
+		started := time.Now()
+		for _, tag := range node.Tags {
+			fmt.Fprintf(p.stdout, "promote %s -> %s\n", src, tag)
+			if p.dryRun {
+				continue
+			}
+			if err := p.w.Copy(ctx, src, tag); err != nil {
+				return z.Err(err, "promote %q", node.Id)
+			}
+		}
+		p.record(node, digests[node.Id], started)
+	}
+
+	// The run is published at this point; a staging tag that cannot be
+	// deleted (not every registry allows deleting a tag) is only reported.
+	for _, node := range staged {
+		src := stagingTag(node.Tags[0], p.runID)
+		fmt.Fprintf(p.stdout, "delete %s\n", src)
+		if p.dryRun {
+			continue
+		}
+		if err := p.w.Delete(ctx, src); err != nil && !errors.Is(err, registry.ErrNotExist) {
+			fmt.Fprintf(p.stdout, "warning: delete %s: %v\n", src, err)
+		}
+	}
+	return nil
+}
+
+// isStaged returns the staging image of node, or nil if its staging tag does
+// not exist. The node must then already have been promoted from this run;
+// anything else is an error.
+func (p *promoter) isStaged(ctx context.Context, node *cladev1.Node) (*registry.ImageInfo, error) {
+	src := stagingTag(node.Tags[0], p.runID)
+	staged, err := p.reg.Stat(ctx, src)
+	if err == nil {
+		return staged, nil
+	}
+	if !errors.Is(err, registry.ErrNotExist) {
+		return nil, z.Err(err, "stat %q", src)
+	}
+
+	info, err := p.reg.Stat(ctx, node.Tags[0])
+	if err == nil && info.Labels[runIDLabel] == p.runID {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s: not staged in run %s (%s not found)", node.Id, p.runID, src)
+}
+
+// record adds the promotion of node, started at started, to the history. A
+// promotion is not failed for a history that cannot be written.
+func (p *promoter) record(node *cladev1.Node, digest string, started time.Time) {
+	if p.history == nil || p.dryRun {
+		return
+	}
+	rec := &history.Record{
+		Node:     node.Id,
+		Port:     node.Port,
+		Tags:     node.Tags,
+		Base:     node.Base,
+		Digest:   digest,
+		RunID:    p.runID,
+		Started:  started,
+		Finished: time.Now(),
+		Status:   history.StatusPromoted,
+	}
+	if err := p.history.Add(rec); err != nil {
+		fmt.Fprintf(p.stdout, "warning: record promotion of %s: %v\n", node.Id, err)
+	}
+}
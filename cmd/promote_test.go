@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/history"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+)
+
+// pushingBuilder is a builder constructor that "pushes" by recording the
+// spec's tags (with its labels) in reg, and fails the builds of the given tags.
+func pushingBuilder(reg *registry.Fake, specs *[]builder.Spec, fail ...string) func(string, []byte, builder.Spec) (builder.Builder, error) {
+	return func(_ string, _ []byte, spec builder.Spec) (builder.Builder, error) {
+		*specs = append(*specs, spec)
+		for _, f := range fail {
+			if spec.Tags[0] == f {
+				return &builder.Fake{Err: errors.New("boom")}, nil
+			}
+		}
+		for _, t := range spec.Tags {
+			reg.Set(t, &registry.ImageInfo{Digest: "sha256:" + t, Labels: spec.Labels})
+		}
+		return &builder.Fake{}, nil
+	}
+}
+
+func stagedTargets() []*cladev1.Node {
+	a := node("a:1", "up:1", "ports/a", true)
+	a.Tags = []string{"a:1", "a:latest"}
+	b := node("b:1", "a:latest", "ports/b", true, "a:1")
+	return []*cladev1.Node{a, b}
+}
+
+func TestBuildRunnerStaged(t *testing.T) {
+	reg := registry.NewFake()
+	var specs []builder.Spec
+	s := history.New(filepath.Join(t.TempDir(), "history.db"))
+	runner := &buildRunner{
+		reg:        reg,
+		loadPort:   func(dir string) (*port.Port, error) { return &port.Port{Dir: dir}, nil },
+		newBuilder: pushingBuilder(reg, &specs),
+		push:       true,
+		runID:      "42",
+		writer:     reg,
+		stdout:     io.Discard,
+		history:    s,
+	}
+	if err := runner.run(context.Background(), stagedTargets()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(specs) != 2 {
+		t.Fatalf("got %d builds, want 2", len(specs))
+	}
+	if !eq(specs[0].Tags, []string{"a:1-clade-42"}) {
+		t.Errorf("a tags = %v, want the staging tag only", specs[0].Tags)
+	}
+	// b builds on the staged a, but records the real base name.
+	if specs[1].Base != "a:1-clade-42" {
+		t.Errorf("b base = %q, want a:1-clade-42", specs[1].Base)
+	}
+	if specs[1].Labels[baseNameLabel] != "a:latest" || specs[1].Labels[runIDLabel] != "42" {
+		t.Errorf("b labels = %v", specs[1].Labels)
+	}
+
+	ctx := context.Background()
+	for _, ref := range []string{"a:1", "a:latest", "b:1"} {
+		if _, err := reg.Stat(ctx, ref); err != nil {
+			t.Errorf("%s not promoted: %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"a:1-clade-42", "b:1-clade-42"} {
+		if _, err := reg.Stat(ctx, ref); !errors.Is(err, registry.ErrNotExist) {
+			t.Errorf("staging tag %s not deleted: %v", ref, err)
+		}
+	}
+
+	// The builds are recorded with the staging tags they pushed, unverified
+	// but with their digest, and the promotions apart with the real tags.
+	records, err := s.Query(history.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("records = %d, want 4", len(records))
+	}
+	for i, want := range []struct {
+		status history.Status
+		tags   []string
+		digest string
+	}{
+		{history.StatusPromoted, []string{"b:1"}, "sha256:b:1-clade-42"},
+		{history.StatusPromoted, []string{"a:1", "a:latest"}, "sha256:a:1-clade-42"},
+		{history.StatusSucceeded, []string{"b:1-clade-42"}, "sha256:b:1-clade-42"},
+		{history.StatusSucceeded, []string{"a:1-clade-42"}, "sha256:a:1-clade-42"},
+	} {
+		r := records[i]
+		if r.Status != want.status || !eq(r.Tags, want.tags) || r.Digest != want.digest || r.RunID != "42" {
+			t.Errorf("record %d = %+v", i, r)
+		}
+	}
+}
+
+func TestBuildRunnerStagedFailurePublishesNothing(t *testing.T) {
+	reg := registry.NewFake()
+	var specs []builder.Spec
+	runner := &buildRunner{
+		reg:        reg,
+		loadPort:   func(dir string) (*port.Port, error) { return &port.Port{Dir: dir}, nil },
+		newBuilder: pushingBuilder(reg, &specs, "b:1-clade-42"),
+		push:       true,
+		runID:      "42",
+		writer:     reg,
+		stdout:     io.Discard,
+	}
+	if err := runner.run(context.Background(), stagedTargets()); err == nil {
+		t.Fatal("expected b to fail")
+	}
+
+	ctx := context.Background()
+	if _, err := reg.Stat(ctx, "a:1"); !errors.Is(err, registry.ErrNotExist) {
+		t.Errorf("a:1 published despite the failed run: %v", err)
+	}
+	if _, err := reg.Stat(ctx, "a:1-clade-42"); err != nil {
+		t.Errorf("staging tag of a removed: %v", err)
+	}
+}
+
+func TestPromoteResume(t *testing.T) {
+	ctx := context.Background()
+	targets := stagedTargets()
+
+	// a was promoted and its staging tag deleted before the previous attempt
+	// stopped; b is still staged.
+	reg := registry.NewFake()
+	staged := map[string]string{runIDLabel: "42"}
+	reg.Set("a:1", &registry.ImageInfo{Digest: "sha256:a", Labels: staged})
+	reg.Set("b:1-clade-42", &registry.ImageInfo{Digest: "sha256:b", Labels: staged})
+
+	p := &promoter{reg: reg, w: reg, runID: "42", stdout: io.Discard}
+	if err := p.promote(ctx, targets); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := reg.Stat(ctx, "b:1"); err != nil || info.Digest != "sha256:b" {
+		t.Errorf("b:1 = %v, %v", info, err)
+	}
+
+	// A node that was neither staged nor promoted by this run stops the
+	// promotion before any tag is written.
+	reg = registry.NewFake()
+	reg.Set("b:1-clade-43", &registry.ImageInfo{Digest: "sha256:b", Labels: map[string]string{runIDLabel: "43"}})
+	p = &promoter{reg: reg, w: reg, runID: "43", stdout: io.Discard}
+	if err := p.promote(ctx, targets); err == nil {
+		t.Fatal("expected error for unstaged a:1")
+	}
+	if _, err := reg.Stat(ctx, "b:1"); !errors.Is(err, registry.ErrNotExist) {
+		t.Errorf("b:1 promoted despite unstaged a:1: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/cmd/version"
+	"github.com/lesomnus/clade/compare"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/z"
+)
+
+// Provenance is attested as a SLSA v1 predicate whose only resolved dependency
+// is the base image the node was built from.
+const (
+	provenancePredicateType = "https://slsa.dev/provenance/v1"
+	provenanceBuildType     = "https://github.com/lesomnus/clade/build/v1"
+	provenanceBuilderID     = "https://github.com/lesomnus/clade"
+)
+
+type provenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   provenanceParameters `json:"externalParameters"`
+		ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies,omitempty"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version,omitempty"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+type provenanceParameters struct {
+	Port    string   `json:"port"`
+	Tags    []string `json:"tags"`
+	BaseTag string   `json:"baseTag,omitempty"`
+}
+
+type resourceDescriptor struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// nodeProvenance describes node's build from the base labels buildRunner.spec
+// injected, so the attestation records exactly the base digest built on.
+func nodeProvenance(node *cladev1.Node, spec builder.Spec) *provenance {
+	p := &provenance{}
+	p.BuildDefinition.BuildType = provenanceBuildType
+	p.BuildDefinition.ExternalParameters = provenanceParameters{Port: node.Port, Tags: node.Tags, BaseTag: node.BaseTag}
+	p.RunDetails.Builder.ID = provenanceBuilderID
+	p.RunDetails.Builder.Version = map[string]string{"clade": version.Get().Version}
+
+	if base, ok := spec.Labels[baseNameLabel]; ok {
+		dep := resourceDescriptor{Name: base}
+		if algo, hex, ok := strings.Cut(spec.Labels[compare.DefaultBaseDigestLabel], ":"); ok {
+			dep.Digest = map[string]string{algo: hex}
+		}
+		p.BuildDefinition.ResolvedDependencies = []resourceDescriptor{dep}
+	}
+	return p
+}
+
+// signNode signs the digest the node's primary tag was pushed as and attests
+// its provenance. In a dry run nothing was pushed, so the tag stands in for
+// the digest.
+func (r *buildRunner) signNode(ctx context.Context, node *cladev1.Node, spec builder.Spec) error {
+	ref := spec.Tags[0]
+	if !r.dryRun {
+		info, err := r.reg.Stat(ctx, ref)
+		if errors.Is(err, registry.ErrNotExist) {
+			return fmt.Errorf("%s: not found after push", ref)
+		}
+		if err != nil {
+			return z.Err(err, "stat %q", ref)
+		}
+		ref = repoOf(ref) + "@" + info.Digest
+	}
+
+	if err := r.signer.Sign(ctx, ref); err != nil {
+		return z.Err(err, "sign")
+	}
+	if err := r.signer.Attest(ctx, ref, provenancePredicateType, nodeProvenance(node, spec)); err != nil {
+		return z.Err(err, "attest provenance")
+	}
+	return nil
+}
+
+// repoOf strips the tag from a "repo:tag" reference.
+func repoOf(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
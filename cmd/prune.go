@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+// defaultPruneKeep protects cosign's signature, attestation and SBOM tags
+// ("sha256-<hex>.sig"), which belong to a digest rather than to a selection,
+// the "-eol" tags `clade deprecate` keeps a dropped line's last image under,
+// and the staging tags of `build --stage`, which `promote` may still copy.
+var defaultPruneKeep = []string{"sha256-*", "*" + graph.EOLSuffix, "*" + stagingInfix + "*"}
+
+func NewCmdPrune() *xli.Command {
+	return &xli.Command{
+		Name:  "prune",
+		Brief: "delete tags of the ports' repositories that the current selection no longer produces",
+
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
+			&flg.Switch{Name: "dry-run", Brief: "list the tags that would be deleted without deleting them"},
+			&flg.String{Name: "min-age", Brief: "keep images created less than this long ago (default 720h; 0 keeps none for their age)"},
+			&flg.String{Name: "keep", Brief: "comma-separated tag patterns to keep (e.g. 'latest,*-rc*')"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+			flg.VisitP(cmd, "min-age", &c.Prune.MinAge)
+
+			keep := append(append([]string{}, defaultPruneKeep...), c.Prune.Keep...)
+			if v, ok := flg.Get[string](cmd, "keep"); ok && v != "" {
+				keep = append(keep, strings.Split(v, ",")...)
+			}
+			rules, err := newPruneRules(c.Prune.MinAge, keep)
+			if err != nil {
+				return err
+			}
+
+			g, err := obtainGraph(ctx, c, cmd, nil)
+			if err != nil {
+				return z.Err(err, "obtain graph")
+			}
+
+			dry_run := false
+			flg.VisitP(cmd, "dry-run", &dry_run)
+
+			reg := registry.NewRemote() // fresh: a cached listing may name deleted tags
+			p := &pruner{reg: reg, w: reg, rules: rules, dryRun: dry_run, stdout: cmd}
+			return p.prune(ctx, g)
+		}),
+	}
+}
+
+// pruneRules decide which stale tags are kept anyway.
+type pruneRules struct {
+	// minAge keeps images created less recently than this (zero keeps none).
+	minAge time.Duration
+	// keep are path.Match patterns of tags that are never deleted.
+	keep []string
+	now  time.Time
+}
+
+func newPruneRules(minAge string, keep []string) (pruneRules, error) {
+	r := pruneRules{now: time.Now()}
+	if minAge != "" {
+		d, err := time.ParseDuration(minAge)
+		if err != nil {
+			return r, fmt.Errorf("parse min age %q: %w", minAge, err)
+		}
+		r.minAge = d
+	}
+	for _, p := range keep {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return r, fmt.Errorf("keep pattern %q: %w", p, err)
+		}
+		r.keep = append(r.keep, p)
+	}
+	return r, nil
+}
+
+// protected returns the keep pattern tag matches, if any.
+func (r pruneRules) protected(tag string) (string, bool) {
+	for _, p := range r.keep {
+		if ok, _ := path.Match(p, tag); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// pruneTag is a tag of a port's repository that no node produces.
+type pruneTag struct {
+	Ref string
+	// Keep is why the tag is kept; empty means it is deleted.
+	Keep string
+}
+
+// pruner deletes the tags of every repository in the graph that none of the
+// repository's nodes carries. A repository without nodes is not touched: an
+// empty selection more likely means a broken port than a retired one.
+type pruner struct {
+	reg   registry.Registry
+	w     registry.Writer
+	rules pruneRules
+
+	dryRun bool
+	stdout io.Writer
+}
+
+// plan lists the stale tags of each repository in the graph, sorted, with the
+// keep rules applied.
+func (p *pruner) plan(ctx context.Context, g *cladev1.Graph) ([]pruneTag, error) {
+	live := map[string]map[string]bool{}
+	for _, n := range g.Nodes {
+		for _, ref := range n.Tags {
+			repo, tag := repoOf(ref), tagOf(ref)
+			if live[repo] == nil {
+				live[repo] = map[string]bool{}
+			}
+			live[repo][tag] = true
+		}
+	}
+
+	repos := make([]string, 0, len(live))
+	for repo := range live {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	out := []pruneTag{}
+	for _, repo := range repos {
+		tags, err := p.reg.Tags(ctx, repo)
+		if errors.Is(err, registry.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, z.Err(err, "list tags of %q", repo)
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			if live[repo][tag] {
+				continue
+			}
+			t := pruneTag{Ref: repo + ":" + tag}
+			if t.Keep, err = p.keep(ctx, t.Ref, tag); err != nil {
+				return nil, err
+			}
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// keep returns why the stale tag ref is kept, or "" to delete it.
+func (p *pruner) keep(ctx context.Context, ref, tag string) (string, error) {
+	if pattern, ok := p.rules.protected(tag); ok {
+		return "matches " + pattern, nil
+	}
+
+	info, err := p.reg.Stat(ctx, ref)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", z.Err(err, "stat %q", ref)
+	}
+	if date, ok := info.Annotations[graph.EOLAnnotation]; ok {
+		return "deprecated " + date, nil
+	}
+	if p.rules.minAge == 0 {
+		return "", nil
+	}
+	if info.Created.IsZero() {
+		return "creation time unknown", nil
+	}
+	if age := p.rules.now.Sub(info.Created); age < p.rules.minAge {
+		return fmt.Sprintf("created %s ago", age.Round(time.Hour)), nil
+	}
+	return "", nil
+}
+
+func (p *pruner) prune(ctx context.Context, g *cladev1.Graph) error {
+	tags, err := p.plan(ctx, g)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, t := range tags {
+		if t.Keep != "" {
+			fmt.Fprintf(p.stdout, "keep %s (%s)\n", t.Ref, t.Keep)
+			continue
+		}
+		fmt.Fprintf(p.stdout, "delete %s\n", t.Ref)
+		if p.dryRun {
+			continue
+		}
+		if err := p.w.Delete(ctx, t.Ref); err != nil && !errors.Is(err, registry.ErrNotExist) {
+			fmt.Fprintf(p.stdout, "error: delete %s: %v\n", t.Ref, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d tag(s) could not be deleted", failed)
+	}
+	return nil
+}
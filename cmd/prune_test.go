@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/registry"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	reg := registry.NewFake()
+	for tag, age := range map[string]time.Duration{
+		"3":                      0,
+		"latest":                 0,
+		"1":                      90 * 24 * time.Hour,
+		"2":                      time.Hour,
+		"1-rc":                   90 * 24 * time.Hour,
+		"sha256-abc.sig":         90 * 24 * time.Hour,
+		"3-clade-20260930000000": 90 * 24 * time.Hour,
+	} {
+		reg.Set("b:"+tag, &registry.ImageInfo{Digest: "sha256:" + tag, Created: now.Add(-age)})
+	}
+	reg.Set("b:unknown", &registry.ImageInfo{Digest: "sha256:unknown"})
+	reg.Set("b:0", &registry.ImageInfo{Digest: "sha256:0", Annotations: map[string]string{graph.EOLAnnotation: "2026-01-01"}})
+	reg.Set("b:0-eol", &registry.ImageInfo{Digest: "sha256:0"})
+	reg.Set("c:1", &registry.ImageInfo{Digest: "sha256:c"}) // no node: not pruned
+
+	n := node("b:3", "a:1", "ports/b", false)
+	n.Tags = []string{"b:3", "b:latest"}
+	g := &cladev1.Graph{Nodes: []*cladev1.Node{n}}
+
+	rules, err := newPruneRules("720h", append(defaultPruneKeep, "*-rc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.now = now
+
+	var out strings.Builder
+	p := &pruner{reg: reg, w: reg, rules: rules, dryRun: true, stdout: &out}
+	if err := p.prune(context.Background(), g); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"keep b:0 (deprecated 2026-01-01)",
+		"keep b:0-eol (matches *-eol)",
+		"delete b:1",
+		"keep b:1-rc (matches *-rc)",
+		"keep b:2 (created 1h0m0s ago)",
+		"keep b:3-clade-20260930000000 (matches *-clade-*)",
+		"keep b:sha256-abc.sig (matches sha256-*)",
+		"keep b:unknown (creation time unknown)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("dry run\n got:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if _, err := reg.Stat(context.Background(), "b:1"); err != nil {
+		t.Errorf("dry run deleted b:1: %v", err)
+	}
+
+	p.dryRun, p.stdout = false, io.Discard
+	if err := p.prune(context.Background(), g); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := reg.Stat(ctx, "b:1"); !errors.Is(err, registry.ErrNotExist) {
+		t.Errorf("b:1 not deleted: %v", err)
+	}
+	for _, ref := range []string{"b:3", "b:latest", "b:2", "b:1-rc", "c:1"} {
+		if _, err := reg.Stat(ctx, ref); err != nil {
+			t.Errorf("%s deleted: %v", ref, err)
+		}
+	}
+}
+
+func TestPruneRulesRejectBadPattern(t *testing.T) {
+	if _, err := newPruneRules("", []string{"[a"}); err == nil {
+		t.Error("expected error for a malformed pattern")
+	}
+	if _, err := newPruneRules("soon", nil); err == nil {
+		t.Error("expected error for a malformed min age")
+	}
+}
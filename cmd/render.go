@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/dockerfile"
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdRender() *xli.Command {
+	return &xli.Command{
+		Name:  "render",
+		Brief: "render the ports' Dockerfile.tmpl templates as the build would",
+
+		Args: arg.Args{
+			&arg.RestStrings{Name: "node", Brief: "node ids to render (default: every node)"},
+		},
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "graph", Brief: "read a serialized graph (.json or binary) instead of recomputing"},
+			&flg.Switch{Name: "write", Brief: "write each port's Dockerfile, rendered for its first node, beside its template"},
+			&flg.Switch{Name: "check", Brief: "fail if a port's committed Dockerfile differs from its template rendered for its first node"},
+		}.WithCategory("filter", filterFlags()...),
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			f, err := readFilter(cmd)
+			if err != nil {
+				return err
+			}
+			g, err := obtainGraph(ctx, c, cmd, f)
+			if err != nil {
+				return z.Err(err, "obtain graph")
+			}
+			ids, _ := arg.Get[[]string](cmd, "node")
+			nodes, err := selectBuildTargets(g, ids, true)
+			if err != nil {
+				return z.Err(err, "select nodes")
+			}
+
+			r, err := newRenderer(c)
+			if err != nil {
+				return err
+			}
+			rn := &renderRunner{renderer: r, loadPort: portLoader(c).LoadID, explicit: len(ids) > 0}
+			flg.VisitP(cmd, "write", &rn.write)
+			flg.VisitP(cmd, "check", &rn.check)
+			if rn.write && rn.check {
+				return fmt.Errorf("--write and --check cannot be combined")
+			}
+			return rn.run(cmd, nodes)
+		}),
+	}
+}
+
+// newRenderer parses the configured shared partials.
+func newRenderer(c *config.Config) (*dockerfile.Renderer, error) {
+	dir := c.Build.Partials
+	if dir == "" && len(c.Ports) > 0 {
+		dir = filepath.Join(c.Ports[0], "_common")
+	}
+	r, err := dockerfile.NewRenderer(dir)
+	if err != nil {
+		return nil, z.Err(err, "Dockerfile partials")
+	}
+	return r, nil
+}
+
+// dockerfileTemplate returns the Dockerfile.tmpl p's build renders, if it has
+// one: the configured Dockerfile's path plus ".tmpl".
+func dockerfileTemplate(p *port.Port) (string, bool, error) {
+	path, err := builder.Dockerfile(p.Build.Kind, p.Build.Params, p.Dir)
+	if err != nil || path == "" {
+		return "", false, err
+	}
+	tmpl := dockerfile.TemplatePath(path)
+	if _, err := os.Stat(tmpl); errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return tmpl, true, nil
+}
+
+// versionData returns the data of node's selected upstream version, which its
+// build tags were rendered with, by running p's selector again over the node's
+// base tag alone.
+func versionData(p *port.Port, node *cladev1.Node) (any, error) {
+	f, err := graph.NewFamily(p, node.Matrix)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := f.Selector.Select([]string{node.BaseTag})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matched {
+		if m.Tag == node.BaseTag {
+			return m.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("port %s does not select %q", p.ID, node.BaseTag)
+}
+
+// renderNode renders the Dockerfile of node from p's template; ok is false
+// when p has none.
+func renderNode(r *dockerfile.Renderer, p *port.Port, node *cladev1.Node) (out []byte, ok bool, err error) {
+	tmpl, ok, err := dockerfileTemplate(p)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	data, err := versionData(p, node)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err = r.Render(tmpl, data, node.Matrix)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+type renderRunner struct {
+	renderer *dockerfile.Renderer
+	loadPort func(id string) (*port.Port, error)
+	// explicit is set when the nodes were named, so a node whose port has no
+	// template is an error rather than skipped.
+	explicit bool
+	write    bool
+	check    bool
+}
+
+// run prints the Dockerfile of every node, or, with write or check, writes or
+// compares the Dockerfile beside each port's template, rendered for the
+// port's first node: the newest version of its first matrix combination.
+func (r *renderRunner) run(w io.Writer, nodes []*cladev1.Node) error {
+	ports := map[string]*port.Port{}
+	done := map[string]bool{}
+	drifted := 0
+	for _, node := range nodes {
+		if (r.write || r.check) && done[node.Port] {
+			continue
+		}
+		done[node.Port] = true
+
+		p, ok := ports[node.Port]
+		if !ok {
+			var err error
+			if p, err = r.loadPort(node.Port); err != nil {
+				return z.Err(err, "load port %q", node.Port)
+			}
+			ports[node.Port] = p
+		}
+		out, ok, err := renderNode(r.renderer, p, node)
+		if err != nil {
+			return z.Err(err, "render %q", node.Id)
+		}
+		if !ok {
+			if r.explicit {
+				return fmt.Errorf("port %s of %q has no Dockerfile template", p.ID, node.Id)
+			}
+			continue
+		}
+
+		if !r.write && !r.check {
+			fmt.Fprintf(w, "# ==> %s <==\n", node.Id)
+			w.Write(out)
+			fmt.Fprintln(w)
+			continue
+		}
+		tmpl, _, _ := dockerfileTemplate(p)
+		path := strings.TrimSuffix(tmpl, dockerfile.TemplateSuffix)
+		if r.write {
+			if err := os.WriteFile(path, out, 0o644); err != nil {
+				return z.Err(err, "write %s", path)
+			}
+			fmt.Fprintf(w, "wrote %s\n", path)
+			continue
+		}
+		have, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // nothing committed to drift
+		}
+		if err != nil {
+			return z.Err(err, "read %s", path)
+		}
+		if !bytes.Equal(have, out) {
+			drifted++
+			fmt.Fprintf(w, "%s differs from %s rendered for %s\n", path, filepath.Base(tmpl), node.Id)
+		}
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d Dockerfiles differ from their templates; run `clade render --write`", drifted)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/dockerfile"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+)
+
+// templatedPort writes a port directory whose Dockerfile is rendered from a
+// template using the version and the "variant" matrix value.
+func templatedPort(t *testing.T) *port.Port {
+	t.Helper()
+	dir := t.TempDir()
+	tmpl := "ARG BASE\nFROM ${BASE}\nLABEL version={{.Major}}.{{.Minor}} variant={{matrix \"variant\"}}\n"
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile.tmpl"), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &port.Port{
+		ID:     dir,
+		Dir:    dir,
+		Select: port.Select{Kind: "semver", Params: []byte("kind: semver\npre-release: '{{matrix \"variant\"}}'\n")},
+		Build:  port.Build{Repo: "me/x", Kind: "build"},
+	}
+}
+
+func templatedNode(p *port.Port, id, base_tag, variant string) *cladev1.Node {
+	n := node(id, "up/x:"+base_tag, p.ID, true)
+	n.BaseTag = base_tag
+	n.Matrix = map[string]string{"variant": variant}
+	return n
+}
+
+func TestRenderRunner(t *testing.T) {
+	p := templatedPort(t)
+	r, err := dockerfile.NewRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []*cladev1.Node{
+		templatedNode(p, "x:1.2-alpine", "1.2.3-alpine", "alpine"),
+		templatedNode(p, "x:1.1-alpine", "1.1.0-alpine", "alpine"),
+	}
+	runner := func() *renderRunner {
+		return &renderRunner{renderer: r, loadPort: func(string) (*port.Port, error) { return p, nil }}
+	}
+
+	var out strings.Builder
+	if err := runner().run(&out, nodes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# ==> x:1.2-alpine <==", "LABEL version=1.2 variant=alpine", "LABEL version=1.1 variant=alpine"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	// Without a committed Dockerfile there is nothing to drift.
+	check := runner()
+	check.check = true
+	if err := check.run(&out, nodes); err != nil {
+		t.Errorf("check without Dockerfile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(p.Dir, "Dockerfile"), []byte("FROM stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.run(&out, nodes); err == nil {
+		t.Error("expected drift of a stale Dockerfile")
+	}
+
+	write := runner()
+	write.write = true
+	if err := write.run(&out, nodes); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written for the port's first node only.
+	if !strings.Contains(string(data), "version=1.2 ") {
+		t.Errorf("Dockerfile = %s", data)
+	}
+	if err := check.run(&out, nodes); err != nil {
+		t.Errorf("check after write: %v", err)
+	}
+}
+
+func TestBuildRunnerRender(t *testing.T) {
+	p := templatedPort(t)
+	r, err := dockerfile.NewRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fakes []*builder.Fake
+	log_dir := t.TempDir()
+	runner := &buildRunner{
+		reg:        registry.NewFake(),
+		loadPort:   func(string) (*port.Port, error) { return p, nil },
+		newBuilder: builder.NewFake(&fakes),
+		renderer:   r,
+		logDir:     log_dir,
+		stdout:     &strings.Builder{},
+	}
+	n := templatedNode(p, "x:1.2-slim", "1.2.3-slim", "slim")
+	if err := runner.run(context.Background(), []*cladev1.Node{n}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := fakes[0].Spec.Dockerfile
+	if path == "" || filepath.Dir(path) == p.Dir {
+		t.Errorf("dockerfile = %q, want a rendered file outside the context", path)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("rendered Dockerfile %s is left behind", path)
+	}
+	data, err := os.ReadFile(filepath.Join(log_dir, "01-x_1.2-slim", buildLogDockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "LABEL version=1.2 variant=slim") {
+		t.Errorf("logged Dockerfile = %s", data)
+	}
+}
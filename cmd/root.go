@@ -23,7 +23,19 @@ func NewCmdRoot() *xli.Command {
 			NewCmdOutdated(),
 			NewCmdGraph(),
 			NewCmdBuild(),
+			NewCmdPlan(),
+			NewCmdLint(),
+			NewCmdRender(),
+			NewCmdSelect(),
+			NewCmdInit(),
+			NewCmdPort(),
+			NewCmdWatch(),
+			NewCmdServe(),
+			NewCmdPromote(),
+			NewCmdPrune(),
+			NewCmdDeprecate(),
 			NewCmdCache(),
+			NewCmdHistory(),
 		},
 
 		Handler: xli.Chain(
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/tag"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/arg"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+)
+
+func NewCmdSelect() *xli.Command {
+	return &xli.Command{
+		Name:    "select",
+		Aliases: []string{"tags"},
+		Brief:   "trace how a port selects among its source versions",
+
+		Args: arg.Args{
+			&arg.String{Name: "port", Brief: "port id or directory"},
+		},
+		Flags: flg.Flags{
+			&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+			&flg.String{Name: "match", Brief: "only show candidate tags matching this glob, e.g. '1.24.*'"},
+			&flg.String{Name: "format", Brief: "output format: text, json"},
+		},
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			c := use_config.Must(ctx)
+			readPortsFlag(cmd, c)
+
+			id, _ := arg.Get[string](cmd, "port")
+			p, err := portLoader(c).LoadID(strings.TrimSuffix(id, "/"))
+			if err != nil {
+				return z.Err(err, "load port %q", id)
+			}
+			reg, err := buildRegistry(c)
+			if err != nil {
+				return z.Err(err, "build registry")
+			}
+			ports, err := loadPorts(c)
+			if err != nil {
+				return z.Err(err, "load ports")
+			}
+			if !slices.ContainsFunc(ports, func(q *port.Port) bool { return q.ID == p.ID }) {
+				ports = append(ports, p)
+			}
+			b := &graph.Builder{Registry: reg}
+			versions, err := b.Candidates(ctx, ports, p)
+			if err != nil {
+				return err
+			}
+
+			match := ""
+			flg.VisitP(cmd, "match", &match)
+			if _, err := path.Match(match, ""); err != nil {
+				return z.Err(err, "--match")
+			}
+			traces, err := traceSelect(p, versions, match)
+			if err != nil {
+				return err
+			}
+
+			format := "text"
+			flg.VisitP(cmd, "format", &format)
+			switch format {
+			case "", "text":
+				renderTraces(cmd, traces)
+				return nil
+			case "json":
+				enc := json.NewEncoder(cmd)
+				enc.SetIndent("", "  ")
+				return enc.Encode(traces)
+			default:
+				return fmt.Errorf("unknown format %q (want text or json)", format)
+			}
+		}),
+	}
+}
+
+// selectTrace is the selection of one family of a port's nodes: one matrix
+// combination.
+type selectTrace struct {
+	Port       string            `json:"port"`
+	Matrix     map[string]string `json:"matrix,omitempty"`
+	Kind       string            `json:"kind"`
+	Candidates int               `json:"candidates"`
+	Verdicts   []traceVerdict    `json:"verdicts"`
+}
+
+type traceVerdict struct {
+	tag.Verdict
+	// Targets are the references a selected tag is built into.
+	Targets []string `json:"targets,omitempty"`
+}
+
+// traceSelect selects among the candidate versions (see graph.Builder's
+// Candidates) for every family of p, as the graph does, with the verdict of
+// each version matching the glob match (every version when empty) and the
+// build tags rendered for the selected.
+func traceSelect(p *port.Port, versions []string, match string) ([]selectTrace, error) {
+	families, err := graph.Families(p)
+	if err != nil {
+		return nil, z.Err(err, "port %q", p.ID)
+	}
+	traces := []selectTrace{}
+	for _, f := range families {
+		matched, verdicts, err := tag.Trace(f.Selector, versions)
+		if err != nil {
+			return nil, z.Err(err, "select tags for port %q", p.ID)
+		}
+		by_tag := map[string]tag.Matched{}
+		for _, m := range matched {
+			by_tag[m.Tag] = m
+		}
+
+		trace := selectTrace{Port: p.ID, Matrix: f.Values, Kind: p.Select.Kind, Candidates: len(versions), Verdicts: []traceVerdict{}}
+		for _, v := range verdicts {
+			if ok, _ := path.Match(match, v.Tag); match != "" && !ok {
+				continue
+			}
+			tv := traceVerdict{Verdict: v}
+			if v.Selected {
+				tags, err := f.Tags(by_tag[v.Tag])
+				if err != nil {
+					return nil, z.Err(err, "port %q", p.ID)
+				}
+				for _, t := range tags {
+					tv.Targets = append(tv.Targets, p.Build.Repo+":"+t)
+				}
+			}
+			trace.Verdicts = append(trace.Verdicts, tv)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// renderTraces prints each family's candidates, one per line, with the step
+// that dropped it or the references it is built into.
+func renderTraces(w io.Writer, traces []selectTrace) {
+	green := color.New(color.FgGreen).SprintFunc()
+	dimmed := color.New(color.Faint).SprintFunc()
+	for i, t := range traces {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		selected := 0
+		width := 0
+		for _, v := range t.Verdicts {
+			width = max(width, len(v.Tag))
+			if v.Selected {
+				selected++
+			}
+		}
+		fmt.Fprintf(w, "%s: %s over %d candidates, %d selected\n", graph.FamilyName(t.Port, t.Matrix), t.Kind, t.Candidates, selected)
+		for _, v := range t.Verdicts {
+			switch {
+			case v.Selected:
+				fmt.Fprintf(w, "  %-*s  %s  %s\n", width, v.Tag, green(fmt.Sprintf("%-11s", "selected")), strings.Join(v.Targets, ", "))
+			case v.Step == "":
+				fmt.Fprintf(w, "  %-*s  %s\n", width, v.Tag, dimmed("dropped"))
+			default:
+				fmt.Fprintf(w, "  %-*s  %-11s  %s\n", width, v.Tag, v.Step, dimmed(v.Detail))
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/port"
+)
+
+func TestTraceSelect(t *testing.T) {
+	p := &port.Port{
+		ID:     "ports/golang",
+		Matrix: port.Matrix{"variant": {"alpine", "bookworm"}},
+		Select: port.Select{Kind: "semver", Params: []byte("kind: semver\nlast-minor: 1\npre-release: '{{matrix \"variant\"}}'\n")},
+		Build:  port.Build{Repo: "me/golang", Tags: []string{"{{.Major}}.{{.Minor}}-{{matrix \"variant\"}}"}},
+	}
+	versions := []string{"latest", "1.23.2-alpine", "1.24.0-alpine", "1.24.0-bookworm", "1.24.0"}
+
+	traces, err := traceSelect(p, versions, "1.24.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	renderTraces(&out, traces)
+	want := `ports/golang {variant=alpine}: semver over 5 candidates, 1 selected
+  1.24.0-alpine    selected     me/golang:1.24-alpine
+  1.24.0-bookworm  pre-release  pre-release "bookworm", want "alpine"
+  1.24.0           pre-release  pre-release "", want "alpine"
+
+ports/golang {variant=bookworm}: semver over 5 candidates, 1 selected
+  1.24.0-alpine    pre-release  pre-release "alpine", want "bookworm"
+  1.24.0-bookworm  selected     me/golang:1.24-bookworm
+  1.24.0           pre-release  pre-release "", want "bookworm"
+`
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
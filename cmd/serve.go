@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/lesomnus/clade/api"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/watch"
+	"github.com/lesomnus/clade/watch/webhook"
+	"github.com/lesomnus/otx/log"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+)
+
+func NewCmdServe() *xli.Command {
+	return &xli.Command{
+		Name:  "serve",
+		Brief: "run as a daemon, rebuilding what a registry's push notification outdates",
+
+		Flags: append(flg.Flags{
+			&flg.String{Name: "every", Brief: "also run a full cycle this often, e.g. 6h"},
+			&flg.String{Name: "cron", Brief: "also run a full cycle on this cron schedule"},
+			&flg.String{Name: "grpc-listen", Brief: "address serving the clade.v1 gRPC API (default 127.0.0.1:9091)"},
+		}, daemonFlags()...).WithCategory("filter", filterFlags()...),
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			schedule, err := readSchedule(cmd, "")
+			if err != nil {
+				return err
+			}
+			w, err := newWatcher(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			l := log.From(ctx)
+			d := &watch.Daemon{Schedule: schedule, Cycle: w.cycle, Logger: l}
+			if w.c.Serve.Secret == "" {
+				l.Warn("neither CLADE_SERVE_SECRET nor serve.secret-file is set; webhooks are refused")
+			}
+			hooks := &webhook.Handler{
+				Secret: w.c.Serve.Secret,
+				OnEvents: func(provider string, events []webhook.Event) {
+					for _, e := range events {
+						l.Info("push received", slog.String("provider", provider), slog.String("repo", e.Repo), slog.String("tag", e.Tag))
+					}
+					d.Trigger(watch.Request{Pushes: events})
+				},
+				Observe: d.Metrics().ObserveWebhook,
+			}
+
+			w.events = &api.Events{}
+			srv := &api.Server{
+				Graph:  w.Graph,
+				Build:  func(nodes []string) { d.Trigger(watch.Request{Nodes: nodes}) },
+				Events: w.events,
+			}
+			if w.c.Serve.APIToken == "" {
+				l.Warn("neither CLADE_API_TOKEN nor serve.api-token-file is set; the API is not authenticated and triggers no work")
+			}
+			grpc_listen := "127.0.0.1:9091"
+			flg.VisitP(cmd, "grpc-listen", &grpc_listen)
+			gateway, stop, err := serveAPI(ctx, srv, w.c.Serve.APIToken, grpc_listen)
+			if err != nil {
+				return err
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/", d.Handler())
+			mux.Handle("/webhook/", hooks)
+			mux.Handle("/v1/", gateway)
+
+			listen := ":9090"
+			flg.VisitP(cmd, "listen", &listen)
+			return serveDaemon(ctx, mux, listen, func(ctx context.Context) error {
+				// Stopped before the HTTP server, so it ends the gateway's
+				// streams the HTTP server would wait for.
+				defer stop()
+				return d.Run(ctx)
+			})
+		}),
+	}
+}
+
+// serveAPI serves srv over gRPC on listen, requiring token, and returns its
+// HTTP/JSON gateway and a function stopping both.
+func serveAPI(ctx context.Context, srv *api.Server, token string, listen string) (http.Handler, func(), error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, nil, z.Err(err, "listen")
+	}
+	s := grpc.NewServer(api.Authenticate(token)...)
+	cladev1.RegisterCladeServiceServer(s, srv)
+	reflection.Register(s)
+	go s.Serve(ln)
+	log.From(ctx).Info("serving gRPC", "addr", ln.Addr().String())
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		s.Stop()
+		return nil, nil, z.Err(err, "dial gRPC")
+	}
+	gateway, err := api.Gateway(ctx, conn)
+	if err != nil {
+		conn.Close()
+		s.Stop()
+		return nil, nil, err
+	}
+	// WatchBuilds streams end only with their clients, so a graceful stop
+	// could wait forever.
+	return gateway, func() { conn.Close(); s.Stop() }, nil
+}
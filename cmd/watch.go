@@ -0,0 +1,573 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lesomnus/clade/api"
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/cmd/config"
+	"github.com/lesomnus/clade/filter"
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/history"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/clade/sign"
+	"github.com/lesomnus/clade/watch"
+	"github.com/lesomnus/clade/watch/webhook"
+	"github.com/lesomnus/otx/log"
+	"github.com/lesomnus/xli"
+	"github.com/lesomnus/xli/flg"
+	"github.com/lesomnus/z"
+	"google.golang.org/protobuf/proto"
+)
+
+func NewCmdWatch() *xli.Command {
+	return &xli.Command{
+		Name:  "watch",
+		Brief: "run as a daemon, building outdated images on a schedule",
+
+		Flags: append(flg.Flags{
+			&flg.String{Name: "every", Brief: "run a cycle this often, e.g. 10m (default 15m)"},
+			&flg.String{Name: "cron", Brief: "run a cycle on this cron schedule instead, e.g. '*/10 * * * *'"},
+		}, daemonFlags()...).WithCategory("filter", filterFlags()...),
+
+		Handler: xli.OnRun(func(ctx context.Context, cmd *xli.Command, next xli.Next) error {
+			schedule, err := readSchedule(cmd, "15m")
+			if err != nil {
+				return err
+			}
+			w, err := newWatcher(ctx, cmd)
+			if err != nil {
+				return err
+			}
+
+			d := &watch.Daemon{Schedule: schedule, Cycle: w.cycle, Logger: log.From(ctx)}
+			listen := ":9090"
+			flg.VisitP(cmd, "listen", &listen)
+			return serveDaemon(ctx, d.Handler(), listen, d.Run)
+		}),
+	}
+}
+
+// daemonFlags are the flags `clade watch` and `clade serve` share.
+func daemonFlags() flg.Flags {
+	return flg.Flags{
+		&flg.String{Name: "ports", Brief: "comma-separated ports roots (default: from config)"},
+		&flg.String{Name: "listen", Brief: "address serving /healthz, /readyz and /metrics (default :9090)"},
+		&flg.Switch{Name: "no-push", Brief: "do not push built images"},
+		&flg.Switch{Name: "dry-run", Brief: "print build commands without executing them"},
+		&flg.Switch{Name: "no-test", Brief: "do not run the ports' smoke tests before pushing"},
+		&flg.Switch{Name: "no-sign", Brief: "do not sign pushed images even if signing is configured"},
+		&flg.String{Name: "docker", Brief: "docker binary to invoke (default docker)"},
+		&flg.String{Name: "log-dir", Brief: "write each cycle's build logs under a directory of its own here"},
+	}
+}
+
+// newWatcher reads the daemonFlags and the filter.
+func newWatcher(ctx context.Context, cmd *xli.Command) (*watcher, error) {
+	c := use_config.Must(ctx)
+	readPortsFlag(cmd, c)
+	flg.VisitP(cmd, "docker", &c.Build.Docker)
+
+	f, err := readFilter(cmd)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := time.ParseDuration(c.Cache.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("parse cache ttl %q: %w", c.Cache.TTL, err)
+	}
+
+	backoff, err := readBackoff(c)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		c:       c,
+		f:       f,
+		cache:   registry.NewMemCache(),
+		history: openHistory(c),
+		backoff: backoff,
+	}
+	w.reg = registry.WithCache(registry.NewRemote(), w.cache, ttl)
+	flg.VisitP(cmd, "no-push", &w.noPush)
+	flg.VisitP(cmd, "dry-run", &w.dryRun)
+	flg.VisitP(cmd, "no-test", &w.noTest)
+	flg.VisitP(cmd, "no-sign", &w.noSign)
+	flg.VisitP(cmd, "log-dir", &w.logDir)
+	w.newRunner = func() (*buildRunner, error) { return w.buildRunner(cmd) }
+	return w, nil
+}
+
+// readSchedule reads --every and --cron, defaulting to every def; with no
+// default and neither flag, there is no schedule.
+func readSchedule(cmd *xli.Command, def string) (watch.Schedule, error) {
+	every, expr := "", ""
+	flg.VisitP(cmd, "every", &every)
+	flg.VisitP(cmd, "cron", &expr)
+	switch {
+	case every != "" && expr != "":
+		return nil, errors.New("--every and --cron cannot be combined")
+	case expr != "":
+		return watch.Cron(expr)
+	case every == "" && def == "":
+		return nil, nil
+	case every == "":
+		every = def
+	}
+	d, err := time.ParseDuration(every)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("--every %q: want a positive duration", every)
+	}
+	return watch.Every(d), nil
+}
+
+// serveDaemon serves h on listen while run runs, until SIGINT or SIGTERM. The
+// signal lets the cycle in flight finish; a second one kills the process.
+func serveDaemon(ctx context.Context, h http.Handler, listen string, run func(ctx context.Context) error) error {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return z.Err(err, "listen")
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+
+	l := log.From(ctx)
+	l.Info("serving", "addr", ln.Addr().String())
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		l.Info("shutting down; waiting for the cycle in flight")
+		stop()
+	}()
+	err = run(ctx)
+
+	shutdown, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if serr := srv.Shutdown(shutdown); serr != nil && err == nil {
+		err = serr
+	}
+	return err
+}
+
+// watcher runs the cycles of `clade watch`: compute the graph with registry
+// metadata kept warm in memory, and build the outdated nodes.
+type watcher struct {
+	c *config.Config
+	f *filter.Filter
+
+	reg   registry.Registry
+	cache *registry.MemCache
+
+	newRunner func() (*buildRunner, error)
+	// events, when set, receives the progress of every build.
+	events *api.Events
+	// history records the builds; with a backoff, it defers the nodes that
+	// keep failing (see backOff).
+	history *history.Store
+	backoff history.Backoff
+
+	// mu guards graph, the graph of the last cycle.
+	mu    sync.Mutex
+	graph *cladev1.Graph
+
+	noPush bool
+	dryRun bool
+	noTest bool
+	noSign bool
+	logDir string
+}
+
+// buildRunner builds as `clade build` does with the watch flags.
+func (w *watcher) buildRunner(cmd *xli.Command) (*buildRunner, error) {
+	renderer, err := newRenderer(w.c)
+	if err != nil {
+		return nil, err
+	}
+	r := &buildRunner{
+		reg:        registry.NewRemote(), // fresh: a just-pushed base must resolve
+		loadPort:   portLoader(w.c).LoadID,
+		newBuilder: builder.New,
+		renderer:   renderer,
+		push:       !w.noPush,
+		dryRun:     w.dryRun,
+		verify:     true,
+		bin:        w.c.Build.Docker,
+		stdout:     cmd,
+		stderr:     os.Stderr,
+		history:    w.history,
+	}
+	if w.logDir != "" {
+		r.logDir = filepath.Join(w.logDir, newRunID())
+	}
+	if !w.noTest {
+		r.smoke = smokeRunners(w.c.Build.Docker, w.dryRun, cmd)
+	}
+	if w.c.Sign.Kind != "" && !w.noSign && r.push {
+		r.signer, err = sign.New(w.c.Sign.Kind, sign.Options{
+			Key:    w.c.Sign.Key,
+			Bin:    w.c.Sign.Bin,
+			Args:   w.c.Sign.Args,
+			DryRun: w.dryRun,
+			Stdout: cmd,
+			Stderr: os.Stderr,
+		})
+		if err != nil {
+			return nil, z.Err(err, "signer")
+		}
+	}
+	return r, nil
+}
+
+// cycle lists every repository and stats every external base anew, so new
+// upstream versions and rebuilt upstream tags are seen, and reuses the
+// metadata of the ports' own images cached by earlier cycles. The ports are
+// loaded anew too, so changes to them apply without a restart. A failed build
+// does not fail the cycle; it is counted in the outcome and retried next
+// cycle, or later under a backoff.
+//
+// A triggered cycle fetches anew only the metadata of the pushed repositories,
+// computes and builds only the ports they affect, and builds the requested
+// nodes of the last graph.
+func (w *watcher) cycle(ctx context.Context, req *watch.Request) (watch.Outcome, error) {
+	if req == nil {
+		g, err := w.compute(ctx, true)
+		if err != nil {
+			return watch.Outcome{}, err
+		}
+		w.setGraph(g)
+		targets, err := selectBuildTargets(g, nil, false)
+		if err != nil {
+			return watch.Outcome{}, err
+		}
+		return w.build(ctx, len(g.Nodes), targets, false)
+	}
+
+	out := watch.Outcome{}
+	if len(req.Pushes) > 0 {
+		o, err := w.recompute(ctx, req.Pushes)
+		if err != nil {
+			return o, err
+		}
+		out = o
+	}
+	if len(req.Nodes) > 0 {
+		g, err := w.Graph(ctx, false)
+		if err != nil {
+			return out, err
+		}
+		targets, err := selectBuildTargets(g, req.Nodes, false)
+		if err != nil {
+			return out, err
+		}
+		// Asked for by name, so built whatever the backoff.
+		o, err := w.build(ctx, len(g.Nodes), targets, true)
+		out.Nodes += o.Nodes
+		out.Outdated += o.Outdated
+		out.Built += o.Built
+		out.Failed += o.Failed
+		out.Skipped += o.Skipped
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// recompute computes and builds the ports pushes affect, and puts their nodes
+// in place of the ones of the last graph.
+func (w *watcher) recompute(ctx context.Context, pushes []webhook.Event) (watch.Outcome, error) {
+	ports, err := loadPorts(w.c)
+	if err != nil {
+		return watch.Outcome{}, z.Err(err, "load ports")
+	}
+	ports = affectedPorts(ports, pushes)
+	if len(ports) == 0 {
+		log.From(ctx).Info("no port is built on the pushed repositories")
+		return watch.Outcome{}, nil
+	}
+	w.forgetPushes(ports, pushes)
+
+	g, err := (&graph.Builder{Registry: w.reg}).Build(ctx, w.f.Ports(ports))
+	if err != nil {
+		return watch.Outcome{}, z.Err(err, "build graph")
+	}
+	g.Nodes = w.f.Nodes(g.Nodes)
+	w.mergeGraph(ports, g)
+
+	targets, err := selectBuildTargets(g, nil, false)
+	if err != nil {
+		return watch.Outcome{}, err
+	}
+	return w.build(ctx, len(g.Nodes), targets, false)
+}
+
+// compute computes the graph of every port the filter selects. When fresh is
+// set, the upstreams are fetched anew (see forgetUpstreams).
+func (w *watcher) compute(ctx context.Context, fresh bool) (*cladev1.Graph, error) {
+	ports, err := loadPorts(w.c)
+	if err != nil {
+		return nil, z.Err(err, "load ports")
+	}
+	if fresh {
+		w.forgetUpstreams(ports)
+	}
+	meta, err := graphMetadata(w.c, ports)
+	if err != nil {
+		return nil, err
+	}
+	g, err := (&graph.Builder{Registry: w.reg}).Build(ctx, w.f.Ports(ports))
+	if err != nil {
+		return nil, z.Err(err, "build graph")
+	}
+	g.Nodes = w.f.Nodes(g.Nodes)
+	g.Metadata = meta
+	return g, nil
+}
+
+// Graph returns the graph of the last cycle, computing it anew when refresh
+// is set or there is none yet. The graph is never modified once returned; the
+// cycles replace it.
+func (w *watcher) Graph(ctx context.Context, refresh bool) (*cladev1.Graph, error) {
+	w.mu.Lock()
+	g := w.graph
+	w.mu.Unlock()
+	if g != nil && !refresh {
+		return g, nil
+	}
+
+	g, err := w.compute(ctx, refresh)
+	if err != nil {
+		return nil, err
+	}
+	w.setGraph(g)
+	return g, nil
+}
+
+func (w *watcher) setGraph(g *cladev1.Graph) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.graph = g
+}
+
+// mergeGraph replaces the nodes of ports in the last graph with those of g.
+// The ports are closed under descendants (see affectedPorts), so the nodes of
+// g may follow the others and the graph stays in topological order.
+func (w *watcher) mergeGraph(ports []*port.Port, g *cladev1.Graph) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.graph == nil {
+		return
+	}
+	replaced := map[string]bool{}
+	for _, p := range ports {
+		replaced[p.ID] = true
+	}
+	merged := &cladev1.Graph{Metadata: w.graph.Metadata}
+	for _, n := range w.graph.Nodes {
+		if !replaced[n.Port] {
+			merged.Nodes = append(merged.Nodes, n)
+		}
+	}
+	merged.Nodes = append(merged.Nodes, g.Nodes...)
+	w.graph = merged
+}
+
+// markBuilt marks the node id of the last graph up to date.
+func (w *watcher) markBuilt(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.graph == nil {
+		return
+	}
+	g := proto.Clone(w.graph).(*cladev1.Graph)
+	for _, n := range g.Nodes {
+		if n.Id == id {
+			n.Outdated = false
+		}
+	}
+	w.graph = g
+}
+
+// affectedPorts returns the ports a push may outdate: those whose source is a
+// pushed repository, and the ports built on those, transitively.
+func affectedPorts(ports []*port.Port, pushes []webhook.Event) []*port.Port {
+	pushed := map[string]bool{}
+	for _, e := range pushes {
+		pushed[webhook.Normalize(e.Repo)] = true
+	}
+
+	affected := map[*port.Port]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range ports {
+			if affected[p] || p.Source.Kind != "container" || !pushed[webhook.Normalize(p.Source.Repo)] {
+				continue
+			}
+			affected[p] = true
+			pushed[webhook.Normalize(p.Build.Repo)] = true
+			changed = true
+		}
+	}
+
+	out := []*port.Port{}
+	for _, p := range ports {
+		if affected[p] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// forgetUpstreams drops every cached tag listing, and the cached metadata of
+// the external bases: the images of the ports' container sources no port
+// builds. An upstream may push a tag again without a notification, so they
+// cannot be reused from an earlier cycle. The metadata of the ports' own
+// images is kept; forget drops it as they are pushed.
+func (w *watcher) forgetUpstreams(ports []*port.Port) {
+	w.cache.RemovePrefix(registry.KeyTags)
+	built := map[string]bool{}
+	for _, p := range ports {
+		built[p.Build.Repo] = true
+	}
+	for _, p := range ports {
+		if p.Source.Kind == "container" && !built[p.Source.Repo] {
+			w.cache.RemovePrefix(registry.KeyStat + p.Source.Repo + ":")
+		}
+	}
+}
+
+// forgetPushes drops the cached metadata of the pushed tags of the affected
+// ports' sources.
+func (w *watcher) forgetPushes(ports []*port.Port, pushes []webhook.Event) {
+	for _, p := range ports {
+		for _, e := range pushes {
+			if p.Source.Kind != "container" || !webhook.SameRepo(p.Source.Repo, e.Repo) {
+				continue
+			}
+			w.cache.Remove(registry.KeyTags + p.Source.Repo)
+			if e.Tag == "" {
+				w.cache.RemovePrefix(registry.KeyStat + p.Source.Repo + ":")
+			} else {
+				w.cache.Remove(registry.KeyStat + p.Source.Repo + ":" + e.Tag)
+			}
+		}
+	}
+}
+
+// build builds targets, the outdated nodes of a graph of n nodes. Unless
+// force is set, the nodes the backoff defers are skipped.
+func (w *watcher) build(ctx context.Context, n int, targets []*cladev1.Node, force bool) (watch.Outcome, error) {
+	out := watch.Outcome{Nodes: n, Outdated: len(targets)}
+	if !force {
+		targets, out.Skipped = w.backOff(ctx, targets)
+	}
+	if len(targets) == 0 {
+		return out, nil
+	}
+
+	r, err := w.newRunner()
+	if err != nil {
+		return out, err
+	}
+	l := log.From(ctx)
+	r.keepGoing = true
+	r.start = func(node *cladev1.Node) {
+		w.publish(node, cladev1.BuildEvent_STATE_STARTED, nil)
+	}
+	r.done = func(node *cladev1.Node, err error) {
+		switch {
+		case err == nil:
+			out.Built++
+			w.forget(node)
+			w.markBuilt(node.Id)
+			w.publish(node, cladev1.BuildEvent_STATE_SUCCEEDED, nil)
+		case errors.Is(err, errSkipped):
+			out.Skipped++
+			l.Warn("build skipped", slog.String("node", node.Id), slog.String("error", err.Error()))
+			w.publish(node, cladev1.BuildEvent_STATE_SKIPPED, err)
+		default:
+			out.Failed++
+			l.Error("build failed", slog.String("node", node.Id), slog.String("error", err.Error()))
+			w.publish(node, cladev1.BuildEvent_STATE_FAILED, err)
+		}
+	}
+	// Every failure was counted and logged.
+	_ = r.run(ctx, targets)
+	return out, nil
+}
+
+// backOff drops from targets the nodes whose last builds failed and that are
+// not due again under the backoff, and the nodes built on those. It returns
+// the targets left and how many it dropped.
+func (w *watcher) backOff(ctx context.Context, targets []*cladev1.Node) ([]*cladev1.Node, int) {
+	if w.history == nil || w.backoff.Base == 0 {
+		return targets, 0
+	}
+
+	l := log.From(ctx)
+	deferred := map[string]bool{}
+	out := make([]*cladev1.Node, 0, len(targets))
+	for _, node := range targets {
+		var err error
+		for _, parent := range node.Parents {
+			if deferred[parent] {
+				err = fmt.Errorf("%q is built on %q, which is backed off: %w", node.Id, parent, errSkipped)
+				break
+			}
+		}
+		if err == nil {
+			at, herr := w.history.RetryAt(node.Id, w.backoff)
+			if herr != nil {
+				// Better to build again than to never build.
+				l.Warn("read build history", slog.String("node", node.Id), slog.String("error", herr.Error()))
+			} else if !at.IsZero() {
+				err = fmt.Errorf("%q keeps failing; backed off until %s: %w", node.Id, at.Format(time.RFC3339), errSkipped)
+			}
+		}
+		if err == nil {
+			out = append(out, node)
+			continue
+		}
+		deferred[node.Id] = true
+		l.Info("build deferred", slog.String("node", node.Id), slog.String("reason", err.Error()))
+		w.publish(node, cladev1.BuildEvent_STATE_SKIPPED, err)
+	}
+	return out, len(targets) - len(out)
+}
+
+// forget drops the cached metadata of a built node's tags, which now name the
+// new image.
+func (w *watcher) forget(node *cladev1.Node) {
+	for _, ref := range node.Tags {
+		w.cache.Remove(registry.KeyStat + ref)
+	}
+	if node.Image != nil {
+		w.cache.Remove(registry.KeyTags + node.Image.Repo)
+	}
+}
+
+func (w *watcher) publish(node *cladev1.Node, state cladev1.BuildEvent_State, err error) {
+	if w.events == nil {
+		return
+	}
+	e := &cladev1.BuildEvent{Node: node.Id, Port: node.Port, State: state}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	w.events.Publish(e)
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/history"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+	"github.com/lesomnus/clade/watch/webhook"
+)
+
+func TestWatcherBuild(t *testing.T) {
+	ports := map[string]*port.Port{
+		"ports/a": {Dir: "ports/a", Build: port.Build{Repo: "a", Kind: "build"}},
+		"ports/b": {Dir: "ports/b", Build: port.Build{Repo: "b", Kind: "build"}},
+	}
+	w := &watcher{cache: registry.NewMemCache()}
+	for _, key := range []string{registry.KeyStat + "a:1", registry.KeyTags + "a", registry.KeyStat + "b:1"} {
+		w.cache.Set(key, []byte("{}"), 0)
+	}
+	var fakes []*builder.Fake
+	new_fake := builder.NewFake(&fakes)
+	w.newRunner = func() (*buildRunner, error) {
+		return &buildRunner{
+			reg:      registry.NewFake(),
+			loadPort: func(dir string) (*port.Port, error) { return ports[dir], nil },
+			newBuilder: func(kind string, params []byte, spec builder.Spec) (builder.Builder, error) {
+				b, err := new_fake(kind, params, spec)
+				if spec.Tags[0] == "b:1" {
+					b.(*builder.Fake).Err = errors.New("boom")
+				}
+				return b, err
+			},
+		}, nil
+	}
+
+	a := node("a:1", "up:1", "ports/a", true)
+	a.Image = &cladev1.Image{Repo: "a", Tag: "1"}
+	b := node("b:1", "up:1", "ports/b", true)
+	out, err := w.build(context.Background(), 3, []*cladev1.Node{a, b}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Nodes != 3 || out.Outdated != 2 || out.Built != 1 || out.Failed != 1 {
+		t.Errorf("outcome = %+v", out)
+	}
+	// The built node's metadata is fetched anew; the failed one's is kept.
+	if _, ok := w.cache.Get(registry.KeyStat + "a:1"); ok {
+		t.Error("stat of the built a:1 is still cached")
+	}
+	if _, ok := w.cache.Get(registry.KeyTags + "a"); ok {
+		t.Error("tags of a are still cached")
+	}
+	if _, ok := w.cache.Get(registry.KeyStat + "b:1"); !ok {
+		t.Error("stat of the failed b:1 was dropped")
+	}
+}
+
+func TestAffectedPorts(t *testing.T) {
+	container := func(id, source, repo string) *port.Port {
+		return &port.Port{ID: id, Source: port.Source{Kind: "container", Repo: source}, Build: port.Build{Repo: repo}}
+	}
+	ports := []*port.Port{
+		container("ports/golang", "docker.io/library/golang", "ghcr.io/me/golang"),
+		container("ports/dev-golang", "ghcr.io/me/golang", "ghcr.io/me/dev-golang"),
+		container("ports/ide", "ghcr.io/me/dev-golang", "ghcr.io/me/ide"),
+		container("ports/python", "docker.io/library/python", "ghcr.io/me/python"),
+		{ID: "ports/tool", Source: port.Source{Kind: "http", Url: "https://example.com"}, Build: port.Build{Repo: "ghcr.io/me/tool"}},
+	}
+	ids := func(ps []*port.Port) []string {
+		out := []string{}
+		for _, p := range ps {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	got := ids(affectedPorts(ports, []webhook.Event{{Repo: "index.docker.io/library/golang", Tag: "1.22"}}))
+	if !slices.Equal(got, []string{"ports/golang", "ports/dev-golang", "ports/ide"}) {
+		t.Errorf("affected by golang = %v", got)
+	}
+	got = ids(affectedPorts(ports, []webhook.Event{{Repo: "ghcr.io/me/dev-golang", Tag: "1.22"}}))
+	if !slices.Equal(got, []string{"ports/ide"}) {
+		t.Errorf("affected by dev-golang = %v", got)
+	}
+	if got = ids(affectedPorts(ports, []webhook.Event{{Repo: "docker.io/library/node"}})); len(got) != 0 {
+		t.Errorf("affected by node = %v", got)
+	}
+}
+
+func TestForgetPushes(t *testing.T) {
+	w := &watcher{cache: registry.NewMemCache()}
+	for _, key := range []string{
+		registry.KeyTags + "golang", registry.KeyStat + "golang:1.22", registry.KeyStat + "golang:1.21",
+		registry.KeyTags + "python", registry.KeyStat + "python:3",
+	} {
+		w.cache.Set(key, []byte("{}"), 0)
+	}
+	ports := []*port.Port{{ID: "ports/golang", Source: port.Source{Kind: "container", Repo: "golang"}}}
+	w.forgetPushes(ports, []webhook.Event{{Repo: "docker.io/library/golang", Tag: "1.22"}})
+
+	for key, want := range map[string]bool{
+		registry.KeyTags + "golang":      false,
+		registry.KeyStat + "golang:1.22": false,
+		registry.KeyStat + "golang:1.21": true,
+		registry.KeyTags + "python":      true,
+		registry.KeyStat + "python:3":    true,
+	} {
+		if _, ok := w.cache.Get(key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestForgetUpstreams(t *testing.T) {
+	w := &watcher{cache: registry.NewMemCache()}
+	for _, key := range []string{
+		registry.KeyTags + "golang", registry.KeyStat + "golang:1.22",
+		registry.KeyTags + "me/golang", registry.KeyStat + "me/golang:1.22", registry.KeyStat + "me/dev:1.22",
+	} {
+		w.cache.Set(key, []byte("{}"), 0)
+	}
+	ports := []*port.Port{
+		{ID: "ports/golang", Source: port.Source{Kind: "container", Repo: "golang"}, Build: port.Build{Repo: "me/golang"}},
+		{ID: "ports/dev", Source: port.Source{Kind: "container", Repo: "me/golang"}, Build: port.Build{Repo: "me/dev"}},
+	}
+	w.forgetUpstreams(ports)
+
+	// golang is an external base; me/golang is built by a port.
+	for key, want := range map[string]bool{
+		registry.KeyTags + "golang":         false,
+		registry.KeyStat + "golang:1.22":    false,
+		registry.KeyTags + "me/golang":      false,
+		registry.KeyStat + "me/golang:1.22": true,
+		registry.KeyStat + "me/dev:1.22":    true,
+	} {
+		if _, ok := w.cache.Get(key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestWatcherGraph(t *testing.T) {
+	w := &watcher{}
+	w.setGraph(&cladev1.Graph{Nodes: []*cladev1.Node{
+		node("golang:1", "up:1", "ports/golang", true),
+		node("dev:1", "golang:1", "ports/dev", true, "golang:1"),
+		node("python:3", "up:3", "ports/python", true),
+	}})
+	before, err := w.Graph(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A push to the golang upstream recomputed golang and dev.
+	w.mergeGraph(
+		[]*port.Port{{ID: "ports/golang"}, {ID: "ports/dev"}},
+		&cladev1.Graph{Nodes: []*cladev1.Node{
+			node("golang:2", "up:2", "ports/golang", true),
+			node("dev:2", "golang:2", "ports/dev", true, "golang:2"),
+		}},
+	)
+	w.markBuilt("golang:2")
+
+	g, err := w.Graph(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(g.Nodes); !eq(got, []string{"python:3", "golang:2", "dev:2"}) {
+		t.Errorf("nodes = %v", got)
+	}
+	if g.Nodes[1].Outdated || !g.Nodes[2].Outdated {
+		t.Errorf("outdated = %v, %v", g.Nodes[1].Outdated, g.Nodes[2].Outdated)
+	}
+	// Graphs handed out are never modified.
+	if got := ids(before.Nodes); !eq(got, []string{"golang:1", "dev:1", "python:3"}) || !before.Nodes[0].Outdated {
+		t.Errorf("the graph handed out changed: %v", got)
+	}
+}
+
+func TestWatcherBackOff(t *testing.T) {
+	s := history.New(filepath.Join(t.TempDir(), "history.db"))
+	now := time.Now()
+	for range 2 {
+		if err := s.Add(&history.Record{Node: "a:1", Status: history.StatusFailed, Started: now, Finished: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(&history.Record{Node: "c:1", Status: history.StatusFailed, Started: now.Add(-2 * time.Hour), Finished: now.Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed twice just now; c once, long enough ago; b is built on a.
+	targets := []*cladev1.Node{
+		node("a:1", "up:1", "ports/a", true),
+		node("b:1", "a:1", "ports/b", true, "a:1"),
+		node("c:1", "up:1", "ports/c", true),
+	}
+	w := &watcher{history: s, backoff: history.Backoff{Base: time.Hour, Max: 24 * time.Hour}}
+	left, n := w.backOff(context.Background(), targets)
+	if !eq(ids(left), []string{"c:1"}) || n != 2 {
+		t.Errorf("left %v, %d deferred", ids(left), n)
+	}
+
+	w.backoff = history.Backoff{}
+	if left, n := w.backOff(context.Background(), targets); len(left) != 3 || n != 0 {
+		t.Errorf("without backoff: left %v, %d deferred", ids(left), n)
+	}
+}
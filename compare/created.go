@@ -7,6 +7,7 @@ import (
 
 func init() {
 	Register("created", newCreated)
+	RegisterSchema("created", `{"properties": {}}`)
 }
 
 // created compares creation timestamps: the target is outdated if it was
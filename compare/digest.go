@@ -13,6 +13,11 @@ const DefaultBaseDigestLabel = "org.opencontainers.image.base.digest"
 
 func init() {
 	Register("digest", newDigest)
+	RegisterSchema("digest", `{
+		"properties": {
+			"label": {"type": "string", "description": "label recording the base digest on the target"}
+		}
+	}`)
 }
 
 // digestConfig is the optional config for the digest strategy.
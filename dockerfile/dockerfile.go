@@ -1,33 +1,40 @@
-// Command gen-dockerfiles renders each ports/<port>/Dockerfile.tmpl template
-// into a sibling Dockerfile, expanding the shared partials in
-// ports/_common/*.dockerfile.
+// Package dockerfile renders Dockerfile templates. A port may ship a
+// Dockerfile.tmpl next to the Dockerfile its build names (see TemplatePath),
+// which clade renders for every node at build time instead of reading a
+// committed Dockerfile. The template is a text/template executed with the
+// data of the node's selected upstream version, as build.tags templates are,
+// so {{.Major}} is available, and {{matrix "key"}} gives its matrix values.
 //
-// Each shared partial is a standalone *.dockerfile holding raw Dockerfile
-// content (so editors highlight it natively); text/template names the partial
-// after its filename, so a port references it as {{ template "apt.dockerfile" . }}.
-//
-// The generated Dockerfile files are committed; edit the Dockerfile.tmpl
-// templates (and the shared partials) instead. Run via `go generate`.
-package main
+// Shared partials are standalone *.dockerfile files in a partials directory,
+// holding raw Dockerfile content (so editors highlight them natively);
+// text/template names each after its filename, so a template references one as
+// {{ template "apt.dockerfile" . }}.
+package dockerfile
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"text/template"
-)
 
-const (
-	portsDir = "ports"
-	// srcName is the template marker: ports/<port>/Dockerfile.tmpl renders to
-	// ports/<port>/Dockerfile.
-	srcName = "Dockerfile.tmpl"
-	outName = "Dockerfile"
+	"github.com/lesomnus/clade/port"
 )
 
+// TemplateSuffix marks a Dockerfile template: Dockerfile.tmpl renders to the
+// Dockerfile.
+const TemplateSuffix = ".tmpl"
+
+// TemplatePath returns the path of the template the Dockerfile at p is
+// rendered from.
+func TemplatePath(p string) string {
+	return p + TemplateSuffix
+}
+
 // blankRuns matches three or more consecutive newlines. Each partial file ends
 // with a trailing newline, which—combined with the blank line a port leaves
 // between {{ template }} calls—would yield a double blank line at every seam;
@@ -114,59 +121,61 @@ var funcs = template.FuncMap{
 	},
 }
 
-func main() {
-	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, "gen-dockerfiles:", err)
-		os.Exit(1)
-	}
+// Renderer renders Dockerfile templates with a set of shared partials.
+type Renderer struct {
+	partials *template.Template
 }
 
-func run() error {
-	partials, err := template.New("partials").Funcs(funcs).ParseGlob(filepath.Join(portsDir, "_common", "*.dockerfile"))
-	if err != nil {
-		return fmt.Errorf("parse shared partials: %w", err)
+// NewRenderer parses the shared partials, every *.dockerfile file in dir. A
+// missing dir provides none.
+func NewRenderer(dir string) (*Renderer, error) {
+	partials := template.New("partials").Funcs(funcs).Funcs(port.MatrixFuncs(nil))
+	if dir == "" {
+		return &Renderer{partials: partials}, nil
 	}
-
-	srcs, err := filepath.Glob(filepath.Join(portsDir, "*", srcName))
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return &Renderer{partials: partials}, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.dockerfile"))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, src := range srcs {
-		if err := render(partials, src); err != nil {
-			return fmt.Errorf("render %s: %w", src, err)
+	if len(paths) > 0 {
+		if partials, err = partials.ParseFiles(paths...); err != nil {
+			return nil, fmt.Errorf("parse partials in %s: %w", dir, err)
 		}
-		fmt.Println("generated", filepath.Join(filepath.Dir(src), outName))
 	}
-	return nil
+	return &Renderer{partials: partials}, nil
 }
 
-func render(partials *template.Template, src string) error {
+// Render renders the template at src with data, the selected version's data,
+// and the node's matrix values.
+func (r *Renderer) Render(src string, data any, matrix map[string]string) ([]byte, error) {
 	body, err := os.ReadFile(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	t, err := partials.Clone()
+	t, err := r.partials.Clone()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := t.New(srcName).Parse(string(body)); err != nil {
-		return err
+	name := filepath.Base(src)
+	if _, err := t.Funcs(port.MatrixFuncs(matrix)).New(name).Parse(string(body)); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", src, err)
 	}
 
 	var buf bytes.Buffer
 	// The syntax parser directive must be the very first line of a Dockerfile,
 	// so it precedes the generated-file notice.
 	buf.WriteString("# syntax=docker/dockerfile:1\n")
-	fmt.Fprintf(&buf, "# Code generated from %s by scripts/gen-dockerfiles; DO NOT EDIT.\n\n", srcName)
-	if err := t.ExecuteTemplate(&buf, srcName, nil); err != nil {
-		return err
+	fmt.Fprintf(&buf, "# Code generated from %s by clade; DO NOT EDIT.\n\n", name)
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, fmt.Errorf("render %s: %w", src, err)
 	}
 
-	out := filepath.Join(filepath.Dir(src), outName)
 	// Collapse the double blank line left at each partial seam, then normalize
 	// to a single trailing newline (the last partial contributes one of its own).
 	rendered := blankRuns.ReplaceAll(buf.Bytes(), []byte("\n\n"))
-	rendered = append(bytes.TrimRight(rendered, "\n"), '\n')
-	return os.WriteFile(out, rendered, 0o644)
+	return append(bytes.TrimRight(rendered, "\n"), '\n'), nil
 }
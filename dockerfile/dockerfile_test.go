@@ -1,28 +1,27 @@
-package main
+package dockerfile
 
 import (
 	"bytes"
+	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"testing"
-	"text/template"
 )
 
 // renderApt renders the real ports/_common/apt.dockerfile partial, invoked with
 // the given dict expression exactly as a port's Dockerfile.tmpl would — e.g.
 // `dict "Exclude" (list "eza")`. Tests run with the working directory at the
-// package dir, so the shared partials live two levels up.
+// package dir, so the shared partials live one level up.
 func renderApt(t *testing.T, dictExpr string) string {
 	t.Helper()
 
-	partials, err := template.New("partials").Funcs(funcs).
-		ParseGlob(filepath.Join("..", "..", portsDir, "_common", "*.dockerfile"))
+	r, err := NewRenderer(filepath.Join("..", "ports", "_common"))
 	if err != nil {
 		t.Fatalf("parse partials: %v", err)
 	}
-	driver, err := partials.New("driver").Parse(`{{ template "apt.dockerfile" ` + dictExpr + ` }}`)
+	driver, err := r.partials.New("driver").Parse(`{{ template "apt.dockerfile" ` + dictExpr + ` }}`)
 	if err != nil {
 		t.Fatalf("parse driver %q: %v", dictExpr, err)
 	}
@@ -176,3 +175,36 @@ func TestHelpersDoNotMutateInputs(t *testing.T) {
 		}
 	}
 }
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	partials := filepath.Join(dir, "_common")
+	if err := os.MkdirAll(partials, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(partials, "user.dockerfile"), []byte("USER {{ matrix \"user\" }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "Dockerfile.tmpl")
+	if err := os.WriteFile(src, []byte("FROM golang:{{ .Major }}\n\n\n{{ template \"user.dockerfile\" . }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer(partials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.Render(src, map[string]int{"Major": 1}, map[string]string{"user": "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# syntax=docker/dockerfile:1\n# Code generated from Dockerfile.tmpl by clade; DO NOT EDIT.\n\nFROM golang:1\n\nUSER dev\n"
+	if string(out) != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", out, want)
+	}
+
+	// A missing partials directory leaves templates without partials.
+	if _, err := NewRenderer(filepath.Join(dir, "none")); err != nil {
+		t.Errorf("missing partials: %v", err)
+	}
+}
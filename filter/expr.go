@@ -0,0 +1,312 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+// Expr is a parsed selection expression:
+//
+//	expr  = or
+//	or    = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" expr ")" | "outdated" | key ( "=" | "!=" ) glob
+//	key   = "port" | "repo" | "id" | "tag" | "base" | "matrix." name
+//
+// Globs are path.Match patterns. port matches the port id, its last element
+// or the name of the port's directory (so "python" selects both
+// "ports/python:alpine" and "ports/python:debian"), repo the target repository, id the node id, tag any of the node's
+// tags (the part after ":"), base the base reference and matrix.<name> the
+// node's value of that matrix key (never matching a node without it).
+type Expr interface {
+	eval(s subject) truth
+}
+
+// truth is a three-valued boolean: an expression evaluated against a port,
+// before its nodes exist, is unknown when it depends on node fields.
+type truth int8
+
+const (
+	no truth = iota
+	yes
+	unknown
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// subject is what an expression is evaluated against. node is nil for a port.
+type subject struct {
+	port string
+	repo string
+	node *cladev1.Node
+}
+
+type andExpr struct{ l, r Expr }
+
+func (e andExpr) eval(s subject) truth {
+	l, r := e.l.eval(s), e.r.eval(s)
+	switch {
+	case l == no || r == no:
+		return no
+	case l == yes && r == yes:
+		return yes
+	default:
+		return unknown
+	}
+}
+
+type orExpr struct{ l, r Expr }
+
+func (e orExpr) eval(s subject) truth {
+	l, r := e.l.eval(s), e.r.eval(s)
+	switch {
+	case l == yes || r == yes:
+		return yes
+	case l == no && r == no:
+		return no
+	default:
+		return unknown
+	}
+}
+
+type notExpr struct{ x Expr }
+
+func (e notExpr) eval(s subject) truth {
+	switch e.x.eval(s) {
+	case yes:
+		return no
+	case no:
+		return yes
+	default:
+		return unknown
+	}
+}
+
+type outdatedExpr struct{}
+
+func (outdatedExpr) eval(s subject) truth {
+	if s.node == nil {
+		return unknown
+	}
+	return truthOf(s.node.Outdated)
+}
+
+type matchExpr struct {
+	key  string
+	glob string
+	neg  bool
+}
+
+func (e matchExpr) eval(s subject) truth {
+	t := e.match(s)
+	if t == unknown || !e.neg {
+		return t
+	}
+	return truthOf(t == no)
+}
+
+func (e matchExpr) match(s subject) truth {
+	switch e.key {
+	case "port":
+		return truthOf(portMatch(e.glob, s.port))
+	case "repo":
+		return truthOf(globMatch(e.glob, s.repo))
+	}
+	if s.node == nil {
+		return unknown
+	}
+	if name, ok := strings.CutPrefix(e.key, "matrix."); ok {
+		v, ok := s.node.Matrix[name]
+		return truthOf(ok && globMatch(e.glob, v))
+	}
+	switch e.key {
+	case "id":
+		return truthOf(globMatch(e.glob, s.node.Id))
+	case "base":
+		return truthOf(globMatch(e.glob, s.node.Base))
+	default: // "tag"
+		for _, ref := range s.node.Tags {
+			if globMatch(e.glob, ref[strings.LastIndex(ref, ":")+1:]) {
+				return yes
+			}
+		}
+		return no
+	}
+}
+
+func globMatch(glob, s string) bool {
+	ok, _ := path.Match(glob, s)
+	return ok
+}
+
+// portMatch reports whether glob matches the port id, its last element or the
+// name of its directory.
+func portMatch(glob, id string) bool {
+	base := path.Base(filepath.ToSlash(id))
+	dir, _, _ := strings.Cut(base, ":")
+	return globMatch(glob, id) || globMatch(glob, base) || globMatch(glob, dir)
+}
+
+// Parse parses a selection expression, e.g. "outdated && port=dev-*".
+func Parse(s string) (Expr, error) {
+	p := &parser{src: s}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.text != "" {
+		return nil, fmt.Errorf("select: unexpected %q at %d", t.text, t.pos)
+	}
+	return e, nil
+}
+
+type token struct {
+	text string
+	pos  int
+	word bool
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		switch {
+		case unicode.IsSpace(rune(s[i])):
+			i++
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"), strings.HasPrefix(s[i:], "!="):
+			p.toks = append(p.toks, token{text: s[i : i+2], pos: i})
+			i += 2
+		case strings.ContainsRune("()!=", rune(s[i])):
+			p.toks = append(p.toks, token{text: s[i : i+1], pos: i})
+			i++
+		case s[i] == '&' || s[i] == '|':
+			return fmt.Errorf("select: unexpected %q at %d (use %q)", s[i:i+1], i, s[i:i+1]+s[i:i+1])
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("()!=&|", rune(s[j])) {
+				j++
+			}
+			p.toks = append(p.toks, token{text: s[i:j], pos: i, word: true})
+			i = j
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return token{pos: len(p.src)}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.i < len(p.toks) {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) or() (Expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = orExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" {
+		p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = andExpr{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	t := p.next()
+	switch {
+	case t.text == "!":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+
+	case t.text == "(":
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.text != ")" {
+			return nil, fmt.Errorf("select: expected \")\" at %d", c.pos)
+		}
+		return x, nil
+
+	case t.text == "outdated":
+		return outdatedExpr{}, nil
+
+	case t.word:
+		switch t.text {
+		case "port", "repo", "id", "tag", "base":
+		default:
+			if name, ok := strings.CutPrefix(t.text, "matrix."); ok && name != "" {
+				break
+			}
+			return nil, fmt.Errorf("select: unknown key %q at %d", t.text, t.pos)
+		}
+		op := p.next()
+		if op.text != "=" && op.text != "!=" {
+			return nil, fmt.Errorf("select: expected \"=\" or \"!=\" after %q at %d", t.text, op.pos)
+		}
+		g := p.next()
+		if !g.word {
+			return nil, fmt.Errorf("select: expected a pattern after %q at %d", t.text+op.text, g.pos)
+		}
+		if _, err := path.Match(g.text, ""); err != nil {
+			return nil, fmt.Errorf("select: pattern %q: %w", g.text, err)
+		}
+		return matchExpr{key: t.text, glob: g.text, neg: op.text == "!="}, nil
+
+	case t.text == "":
+		return nil, fmt.Errorf("select: unexpected end of expression")
+
+	default:
+		return nil, fmt.Errorf("select: unexpected %q at %d", t.text, t.pos)
+	}
+}
@@ -0,0 +1,242 @@
+// Package filter narrows a graph to the nodes a command acts on.
+//
+// A Filter is applied twice. Before the graph is built, Ports drops the ports
+// none of whose nodes can match, so their upstream tags and images are never
+// fetched. After, Nodes picks the matching nodes and, optionally, their
+// ancestors or descendants.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+)
+
+// Filter selects nodes. The zero value selects every node.
+type Filter struct {
+	// Port are globs of ports (see the port key of Expr); a node matches any
+	// of them.
+	Port []string
+	// Repo are globs of target repositories; a node matches any of them.
+	Repo []string
+	// Select further restricts the nodes; nil selects all.
+	Select Expr
+
+	// WithAncestors adds the internal ancestors of every selected node.
+	WithAncestors bool
+	// WithDescendants adds the descendants of every selected node.
+	WithDescendants bool
+}
+
+// New returns a filter of the given globs and selection expression. Empty
+// strings are ignored.
+func New(ports, repos []string, sel string) (*Filter, error) {
+	f := &Filter{}
+	for _, g := range ports {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("port pattern %q: %w", g, err)
+		}
+		f.Port = append(f.Port, g)
+	}
+	for _, g := range repos {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("repo pattern %q: %w", g, err)
+		}
+		f.Repo = append(f.Repo, g)
+	}
+	if strings.TrimSpace(sel) != "" {
+		e, err := Parse(sel)
+		if err != nil {
+			return nil, err
+		}
+		f.Select = e
+	}
+	return f, nil
+}
+
+// IsZero reports whether f selects every node.
+func (f *Filter) IsZero() bool {
+	return f == nil || (len(f.Port) == 0 && len(f.Repo) == 0 && f.Select == nil)
+}
+
+func (f *Filter) eval(s subject) truth {
+	if len(f.Port) > 0 && !anyPortMatch(f.Port, s.port) {
+		return no
+	}
+	if len(f.Repo) > 0 && !anyMatch(f.Repo, s.repo) {
+		return no
+	}
+	if f.Select == nil {
+		return yes
+	}
+	return f.Select.eval(s)
+}
+
+func anyPortMatch(globs []string, id string) bool {
+	for _, g := range globs {
+		if portMatch(g, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyMatch(globs []string, s string) bool {
+	for _, g := range globs {
+		if globMatch(g, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ports returns, in their order, the ports whose nodes may be selected and
+// every port those depend on (their nodes are needed to expand and judge the
+// selected ones), plus, with WithDescendants, the ports depending on them.
+func (f *Filter) Ports(ports []*port.Port) []*port.Port {
+	if f.IsZero() {
+		return ports
+	}
+
+	// Several ports, such as the variants of a directory, may build one repo.
+	by_repo := map[string][]*port.Port{}
+	for _, p := range ports {
+		by_repo[p.Build.Repo] = append(by_repo[p.Build.Repo], p)
+	}
+	up := func(p *port.Port) []*port.Port {
+		out := []*port.Port{}
+		for _, u := range by_repo[p.Source.Repo] {
+			if u != p {
+				out = append(out, u)
+			}
+		}
+		return out
+	}
+	down := map[*port.Port][]*port.Port{}
+	for _, p := range ports {
+		for _, u := range up(p) {
+			down[u] = append(down[u], p)
+		}
+	}
+
+	keep := map[*port.Port]bool{}
+	var keepUp func(p *port.Port)
+	keepUp = func(p *port.Port) {
+		if keep[p] {
+			return
+		}
+		keep[p] = true
+		for _, u := range up(p) {
+			keepUp(u)
+		}
+	}
+	descended := map[*port.Port]bool{}
+	var keepDown func(p *port.Port)
+	keepDown = func(p *port.Port) {
+		if descended[p] {
+			return
+		}
+		descended[p] = true
+		for _, c := range down[p] {
+			keepUp(c)
+			keepDown(c)
+		}
+	}
+
+	for _, p := range ports {
+		if f.eval(subject{port: p.ID, repo: p.Build.Repo}) == no {
+			continue
+		}
+		keepUp(p)
+		if f.WithDescendants {
+			keepDown(p)
+		}
+	}
+
+	out := make([]*port.Port, 0, len(keep))
+	for _, p := range ports {
+		if keep[p] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Nodes returns, in graph order, the nodes that match and, as requested, their
+// ancestors and descendants.
+func (f *Filter) Nodes(nodes []*cladev1.Node) []*cladev1.Node {
+	if f == nil || (f.IsZero() && !f.WithAncestors && !f.WithDescendants) {
+		return nodes
+	}
+
+	by_id := map[string]*cladev1.Node{}
+	children := map[string][]*cladev1.Node{}
+	for _, n := range nodes {
+		by_id[n.Id] = n
+		for _, p := range n.Parents {
+			children[p] = append(children[p], n)
+		}
+	}
+
+	keep := map[string]bool{}
+	var keepUp, keepDown func(n *cladev1.Node)
+	keepUp = func(n *cladev1.Node) {
+		for _, p := range n.Parents {
+			if parent, ok := by_id[p]; ok && !keep[p] {
+				keep[p] = true
+				keepUp(parent)
+			}
+		}
+	}
+	descended := map[string]bool{}
+	keepDown = func(n *cladev1.Node) {
+		if descended[n.Id] {
+			return
+		}
+		descended[n.Id] = true
+		for _, c := range children[n.Id] {
+			keep[c.Id] = true
+			keepDown(c)
+		}
+	}
+
+	for _, n := range nodes {
+		if f.eval(subject{port: n.Port, repo: repoOf(n), node: n}) != yes {
+			continue
+		}
+		keep[n.Id] = true
+		if f.WithAncestors {
+			keepUp(n)
+		}
+		if f.WithDescendants {
+			keepDown(n)
+		}
+	}
+
+	out := make([]*cladev1.Node, 0, len(keep))
+	for _, n := range nodes {
+		if keep[n.Id] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func repoOf(n *cladev1.Node) string {
+	if n.Image != nil && n.Image.Repo != "" {
+		return n.Image.Repo
+	}
+	if i := strings.LastIndex(n.Id, ":"); i >= 0 {
+		return n.Id[:i]
+	}
+	return n.Id
+}
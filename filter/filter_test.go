@@ -0,0 +1,158 @@
+package filter_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lesomnus/clade/filter"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+)
+
+func mustNew(t *testing.T, ports, repos []string, sel string) *filter.Filter {
+	t.Helper()
+	f, err := filter.New(ports, repos, sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func ids(nodes []*cladev1.Node) []string {
+	out := []string{}
+	for _, n := range nodes {
+		out = append(out, n.Id)
+	}
+	return out
+}
+
+// up:1 -> go:1 -> app:1, go:1 -> tool:1; node:1 stands alone.
+var nodes = []*cladev1.Node{
+	{Id: "me/go:1", Tags: []string{"me/go:1", "me/go:latest"}, Base: "up/go:1", Port: "ports/dev-golang"},
+	{Id: "me/node:1", Tags: []string{"me/node:1"}, Base: "up/node:1", Port: "ports/dev-node", Outdated: true},
+	{Id: "me/app:1", Tags: []string{"me/app:1"}, Base: "me/go:1", Parents: []string{"me/go:1"}, Port: "ports/app", Outdated: true},
+	{Id: "me/tool:1", Tags: []string{"me/tool:1"}, Base: "me/go:1", Parents: []string{"me/go:1"}, Port: "ports/tool", Matrix: map[string]string{"variant": "alpine"}},
+}
+
+func TestNodes(t *testing.T) {
+	tcs := []struct {
+		desc string
+		f    *filter.Filter
+		want []string
+	}{
+		{"zero", &filter.Filter{}, []string{"me/go:1", "me/node:1", "me/app:1", "me/tool:1"}},
+		{"port glob", mustNew(t, []string{"dev-*"}, nil, ""), []string{"me/go:1", "me/node:1"}},
+		{"repo glob", mustNew(t, nil, []string{"me/app", "me/tool"}, ""), []string{"me/app:1", "me/tool:1"}},
+		{"outdated and port", mustNew(t, nil, nil, "outdated && port=dev-*"), []string{"me/node:1"}},
+		{"or and not", mustNew(t, nil, nil, "!(port=dev-* || tag=latest) && repo!=me/tool"), []string{"me/app:1"}},
+		{"base", mustNew(t, nil, nil, "base=up/*"), []string{"me/go:1", "me/node:1"}},
+		{"globs and select", mustNew(t, []string{"app", "tool"}, nil, "outdated"), []string{"me/app:1"}},
+		{"matrix", mustNew(t, nil, nil, "matrix.variant=alp*"), []string{"me/tool:1"}},
+		{"matrix negated", mustNew(t, nil, nil, "matrix.variant!=alpine"), []string{"me/go:1", "me/node:1", "me/app:1"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := ids(tc.f.Nodes(nodes)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNodesClosure(t *testing.T) {
+	f := mustNew(t, []string{"dev-golang"}, nil, "")
+	f.WithDescendants = true
+	if got, want := ids(f.Nodes(nodes)), []string{"me/go:1", "me/app:1", "me/tool:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with descendants: got %v, want %v", got, want)
+	}
+
+	f = mustNew(t, nil, nil, "id=me/app:1")
+	f.WithAncestors = true
+	if got, want := ids(f.Nodes(nodes)), []string{"me/go:1", "me/app:1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with ancestors: got %v, want %v", got, want)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	mk := func(dir, source, build string) *port.Port {
+		return &port.Port{Dir: dir, ID: dir, Source: port.Source{Kind: "container", Repo: source}, Build: port.Build{Repo: build}}
+	}
+	golang := mk("ports/dev-golang", "up/go", "me/go")
+	node := mk("ports/dev-node", "up/node", "me/node")
+	app := mk("ports/app", "me/go", "me/app")
+	tool := mk("ports/tool", "me/go", "me/tool")
+	ports := []*port.Port{golang, node, app, tool}
+
+	dirs := func(ps []*port.Port) []string {
+		out := []string{}
+		for _, p := range ps {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	// A port is kept with the ports it is expanded from.
+	f := mustNew(t, []string{"app"}, nil, "")
+	if got, want := dirs(f.Ports(ports)), []string{"ports/dev-golang", "ports/app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("port: got %v, want %v", got, want)
+	}
+
+	f = mustNew(t, []string{"dev-golang"}, nil, "")
+	f.WithDescendants = true
+	if got, want := dirs(f.Ports(ports)), []string{"ports/dev-golang", "ports/app", "ports/tool"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with descendants: got %v, want %v", got, want)
+	}
+
+	// Node fields are unknown before the graph is built, so they keep a port.
+	f = mustNew(t, nil, nil, "outdated && repo=me/n*")
+	if got, want := dirs(f.Ports(ports)), []string{"ports/dev-node"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("select: got %v, want %v", got, want)
+	}
+	f = mustNew(t, nil, nil, "!outdated || port=nothing")
+	if got := f.Ports(ports); len(got) != len(ports) {
+		t.Errorf("unknown select dropped ports: %v", dirs(got))
+	}
+}
+
+func TestPortsVariants(t *testing.T) {
+	mk := func(id, source, build string) *port.Port {
+		return &port.Port{ID: id, Source: port.Source{Kind: "container", Repo: source}, Build: port.Build{Repo: build}}
+	}
+	// Both variants push to one repository, which app is built on.
+	alpine := mk("ports/lang/python:alpine", "up/python", "me/python")
+	debian := mk("ports/lang/python:debian", "up/python", "me/python")
+	app := mk("ports/app", "me/python", "me/app")
+	ports := []*port.Port{alpine, debian, app}
+
+	for _, tc := range []struct {
+		glob string
+		want int
+	}{
+		{"python", 2},
+		{"python:alpine", 1},
+		{"ports/lang/*", 2},
+		{"app", 3},
+	} {
+		f := mustNew(t, []string{tc.glob}, nil, "")
+		if got := f.Ports(ports); len(got) != tc.want {
+			t.Errorf("%s: got %d ports, want %d", tc.glob, len(got), tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"outdated &&",
+		"port dev",
+		"name=x",
+		"(outdated",
+		"outdated & port=x",
+		"port=[",
+		"outdated)",
+		"matrix.=x",
+	} {
+		if _, err := filter.Parse(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
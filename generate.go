@@ -1,4 +1,3 @@
 package main
 
 //go:generate buf generate
-//go:generate go run ./scripts/gen-dockerfiles
@@ -0,0 +1,110 @@
+package graph
+
+import (
+	"sort"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+// Diff is what changed between two graphs of the same ports, e.g. yesterday's
+// and today's.
+type Diff struct {
+	// Added are the ids of the nodes only the later graph has, in its order.
+	Added []string `json:"added"`
+	// Removed are the ids of the nodes only the earlier graph has, in its order.
+	Removed []string `json:"removed"`
+	// Retagged are the tags that moved from one node to another (typically
+	// floating tags following a new release), sorted by tag.
+	Retagged []TagMove `json:"retagged"`
+	// Rebased are the nodes, present in both graphs, whose base changed.
+	Rebased []BaseChange `json:"rebased"`
+	// Flipped are the nodes, present in both graphs, whose outdated flag
+	// changed.
+	Flipped []Flip `json:"flipped"`
+}
+
+// TagMove is a tag reassigned between nodes.
+type TagMove struct {
+	Tag  string `json:"tag"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// BaseChange is a node whose base reference changed.
+type BaseChange struct {
+	Id   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Flip is a node whose outdated flag changed; Outdated is the new value.
+type Flip struct {
+	Id       string `json:"id"`
+	Outdated bool   `json:"outdated"`
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Retagged) == 0 && len(d.Rebased) == 0 && len(d.Flipped) == 0
+}
+
+// Compare reports the changes from before to after. Nodes are matched by id, and
+// tags by the node carrying them; a tag that only one graph has is part of an
+// added or removed node, not a move.
+func Compare(before, after *cladev1.Graph) *Diff {
+	old_by_id := map[string]*cladev1.Node{}
+	for _, n := range before.Nodes {
+		old_by_id[n.Id] = n
+	}
+	new_by_id := map[string]*cladev1.Node{}
+	for _, n := range after.Nodes {
+		new_by_id[n.Id] = n
+	}
+
+	d := &Diff{
+		Added:    []string{},
+		Removed:  []string{},
+		Retagged: []TagMove{},
+		Rebased:  []BaseChange{},
+		Flipped:  []Flip{},
+	}
+	for _, n := range before.Nodes {
+		if _, ok := new_by_id[n.Id]; !ok {
+			d.Removed = append(d.Removed, n.Id)
+		}
+	}
+	for _, n := range after.Nodes {
+		o, ok := old_by_id[n.Id]
+		if !ok {
+			d.Added = append(d.Added, n.Id)
+			continue
+		}
+		if o.Base != n.Base {
+			d.Rebased = append(d.Rebased, BaseChange{Id: n.Id, From: o.Base, To: n.Base})
+		}
+		if o.Outdated != n.Outdated {
+			d.Flipped = append(d.Flipped, Flip{Id: n.Id, Outdated: n.Outdated})
+		}
+	}
+
+	old_owner := tagOwners(before)
+	for tag, to := range tagOwners(after) {
+		if from, ok := old_owner[tag]; ok && from != to {
+			d.Retagged = append(d.Retagged, TagMove{Tag: tag, From: from, To: to})
+		}
+	}
+	sort.Slice(d.Retagged, func(i, j int) bool { return d.Retagged[i].Tag < d.Retagged[j].Tag })
+
+	return d
+}
+
+// tagOwners maps every tag in g to the id of the node carrying it.
+func tagOwners(g *cladev1.Graph) map[string]string {
+	out := map[string]string{}
+	for _, n := range g.Nodes {
+		for _, t := range n.Tags {
+			out[t] = n.Id
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package graph_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+func TestCompare(t *testing.T) {
+	before := &cladev1.Graph{Nodes: []*cladev1.Node{
+		{Id: "me/go:1.23.0", Tags: []string{"me/go:1.23.0", "me/go:1.23"}, Base: "up/go:1.23.0"},
+		{Id: "me/go:1.24.0", Tags: []string{"me/go:1.24.0", "me/go:1.24", "me/go:latest"}, Base: "up/go:1.24.0"},
+		{Id: "me/app:1", Tags: []string{"me/app:1"}, Base: "me/go:1.24.0", Parents: []string{"me/go:1.24.0"}},
+	}}
+	after := &cladev1.Graph{Nodes: []*cladev1.Node{
+		{Id: "me/go:1.24.0", Tags: []string{"me/go:1.24.0"}, Base: "up/go:1.24.0", Outdated: true},
+		{Id: "me/go:1.24.1", Tags: []string{"me/go:1.24.1", "me/go:1.24", "me/go:latest"}, Base: "up/go:1.24.1", Outdated: true},
+		{Id: "me/app:1", Tags: []string{"me/app:1"}, Base: "me/go:1.24.1", Parents: []string{"me/go:1.24.1"}, Outdated: true},
+	}}
+
+	got := graph.Compare(before, after)
+	want := &graph.Diff{
+		Added:   []string{"me/go:1.24.1"},
+		Removed: []string{"me/go:1.23.0"},
+		Retagged: []graph.TagMove{
+			{Tag: "me/go:1.24", From: "me/go:1.24.0", To: "me/go:1.24.1"},
+			{Tag: "me/go:latest", From: "me/go:1.24.0", To: "me/go:1.24.1"},
+		},
+		Rebased: []graph.BaseChange{{Id: "me/app:1", From: "me/go:1.24.0", To: "me/go:1.24.1"}},
+		Flipped: []graph.Flip{
+			{Id: "me/go:1.24.0", Outdated: true},
+			{Id: "me/app:1", Outdated: true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff\n got: %+v\nwant: %+v", got, want)
+	}
+
+	if d := graph.Compare(after, after); !d.Empty() {
+		t.Errorf("diff of a graph with itself = %+v", d)
+	}
+}
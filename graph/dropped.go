@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+)
+
+const (
+	// EOLSuffix is appended to the tags of a dropped line's last image in
+	// deprecation mode "tag".
+	EOLSuffix = "-eol"
+	// EOLAnnotation marks the manifest of a dropped line's last image in
+	// deprecation mode "annotate". Its value is the date the line was
+	// deprecated.
+	EOLAnnotation = "dev.clade.eol"
+)
+
+// Dropped is a version line that fell out of selection, identified by the
+// last image built for it.
+type Dropped struct {
+	// Port is the id of the port that built the line.
+	Port string
+	Repo string
+	// Tags are the image's tags, sorted; none is produced by the port anymore.
+	Tags   []string
+	Digest string
+}
+
+// Dropped finds the version lines that the ports opting in with `deprecate`
+// no longer select, and that are not yet marked end-of-life. g must be the
+// graph built from ports.
+//
+// Every tag of the port's repository that no node carries is stale. The stale
+// tags are grouped by the image they point to; a group is a dropped line when
+// it still carries several tags (the line's floating tags stayed on its last
+// image), or when the port renders a single tag per image, so every stale tag
+// is a line of its own. A single leftover tag of a multi-tag port is an image
+// superseded within a line that is still selected, and is not reported.
+// Cosign ("sha256-*"), staging ("*-clade-*") and "-eol" tags are ignored.
+//
+// A port whose lines cannot be found does not hide those of the others: they
+// are returned with the errors of the failed ports joined.
+func (b *Builder) Dropped(ctx context.Context, ports []*port.Port, g *cladev1.Graph) ([]Dropped, error) {
+	// Tags are live per repository, as ports sharing one (e.g. the variants
+	// of a directory) must not take each other's tags for stale ones.
+	live := map[string]map[string]bool{} // build.repo -> produced tags
+	for _, n := range g.Nodes {
+		for _, ref := range n.Tags {
+			i := strings.LastIndex(ref, ":")
+			if i < 0 {
+				continue
+			}
+			if live[ref[:i]] == nil {
+				live[ref[:i]] = map[string]bool{}
+			}
+			live[ref[:i]][ref[i+1:]] = true
+		}
+	}
+
+	out := []Dropped{}
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, p := range ports {
+		if p.Deprecate.Mode == "" || seen[p.Build.Repo] {
+			continue
+		}
+		seen[p.Build.Repo] = true
+		lines, err := b.dropped(ctx, p, live[p.Build.Repo])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %q: %w", p.ID, err))
+			continue
+		}
+		out = append(out, lines...)
+	}
+	return out, errors.Join(errs...)
+}
+
+func (b *Builder) dropped(ctx context.Context, p *port.Port, live map[string]bool) ([]Dropped, error) {
+	repo := p.Build.Repo
+	tags, err := b.Registry.Tags(ctx, repo)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, t := range tags {
+		existing[t] = true
+	}
+
+	groups := map[string]*Dropped{}
+	annotated := map[string]bool{}
+	for _, t := range tags {
+		if live[t] || strings.HasPrefix(t, "sha256-") || strings.Contains(t, "-clade-") || strings.HasSuffix(t, EOLSuffix) {
+			continue
+		}
+
+		info, err := b.Registry.Stat(ctx, repo+":"+t)
+		if errors.Is(err, registry.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stat %q: %w", repo+":"+t, err)
+		}
+
+		d, ok := groups[info.Digest]
+		if !ok {
+			d = &Dropped{Port: p.ID, Repo: repo, Digest: info.Digest}
+			groups[info.Digest] = d
+		}
+		d.Tags = append(d.Tags, t)
+		if info.Annotations[EOLAnnotation] != "" {
+			annotated[info.Digest] = true
+		}
+	}
+
+	out := []Dropped{}
+	for digest, d := range groups {
+		if len(d.Tags) < 2 && len(p.Build.Tags) > 1 {
+			continue
+		}
+		// Either mark counts whatever the mode: a signed annotate port is
+		// tagged instead (see `clade deprecate`).
+		if annotated[digest] || allEOL(d.Tags, existing) {
+			continue
+		}
+		sort.Strings(d.Tags)
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tags[0] < out[j].Tags[0] })
+	return out, nil
+}
+
+// allEOL reports whether every tag already has its "-eol" copy.
+func allEOL(tags []string, existing map[string]bool) bool {
+	for _, t := range tags {
+		if !existing[t+EOLSuffix] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/registry"
+)
+
+func TestDropped(t *testing.T) {
+	reg := registry.NewFake()
+	for _, tag := range []string{"18.1.0", "20.0.0", "22.0.0"} {
+		reg.Set("up.io/node:"+tag, &registry.ImageInfo{Created: at(100)})
+	}
+	set := func(digest string, tags ...string) {
+		for _, tag := range tags {
+			reg.Set("me.io/node:"+tag, &registry.ImageInfo{Digest: digest, Created: at(200)})
+		}
+	}
+	set("sha256:20", "20.0.0", "20")
+	set("sha256:22", "22.0.0", "22")
+	set("sha256:18", "18.1.0", "18")                         // line 18 fell out of last-major: 2
+	set("sha256:18old", "18.0.0")                            // superseded within line 18
+	set("sha256:16", "16.0.0", "16", "16.0.0-eol", "16-eol") // already deprecated
+	set("sha256:sig", "sha256-18.sig")
+
+	p := semverPort("ports/node", "up.io/node", "me.io/node")
+	p.Select.Params = []byte("kind: semver\nlast-major: 2\n")
+	p.Build.Tags = []string{"{{.Major}}.{{.Minor}}.{{.Patch}}", "{{.Major}}"}
+	p.Deprecate.Mode = "tag"
+	ports := []*port.Port{p}
+
+	b := &graph.Builder{Registry: reg}
+	g, err := b.Build(context.Background(), ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := b.Dropped(context.Background(), ports, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 {
+		t.Fatalf("dropped = %+v, want line 18 only", dropped)
+	}
+	d := dropped[0]
+	if d.Port != "ports/node" || d.Repo != "me.io/node" || d.Digest != "sha256:18" || !equalRefs(d.Tags, []string{"18", "18.1.0"}) {
+		t.Errorf("dropped = %+v", d)
+	}
+
+	// An annotated image is already deprecated, and so is a line tagged
+	// "-eol" in annotate mode, as a signed port is.
+	p.Deprecate.Mode = "annotate"
+	if dropped, err = b.Dropped(context.Background(), ports, g); err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 || dropped[0].Tags[0] != "18" {
+		t.Errorf("dropped = %+v, want line 18 only", dropped)
+	}
+	reg.Set("me.io/node:18", &registry.ImageInfo{Digest: "sha256:18", Annotations: map[string]string{graph.EOLAnnotation: "2026-10-01"}})
+	if dropped, err = b.Dropped(context.Background(), ports, g); err != nil || len(dropped) != 0 {
+		t.Errorf("dropped = %+v, %v, want none", dropped, err)
+	}
+
+	// Ports without deprecate are not inspected.
+	p.Deprecate.Mode = ""
+	if dropped, err = b.Dropped(context.Background(), ports, g); err != nil || len(dropped) != 0 {
+		t.Errorf("dropped = %+v, %v", dropped, err)
+	}
+}
+
+// failingTags fails to list the tags of repo.
+type failingTags struct {
+	registry.Registry
+	repo string
+}
+
+func (r failingTags) Tags(ctx context.Context, repo string) ([]string, error) {
+	if repo == r.repo {
+		return nil, errors.New("unauthorized")
+	}
+	return r.Registry.Tags(ctx, repo)
+}
+
+func TestDroppedPartial(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("up.io/node:20.0.0", &registry.ImageInfo{Created: at(100)})
+	reg.Set("me.io/node:20.0.0", &registry.ImageInfo{Digest: "sha256:20", Created: at(200)})
+	reg.Set("me.io/node:18.0.0", &registry.ImageInfo{Digest: "sha256:18", Created: at(200)})
+
+	node := semverPort("ports/node", "up.io/node", "me.io/node")
+	node.Deprecate.Mode = "tag"
+	bad := semverPort("ports/bad", "up.io/node", "me.io/bad")
+	bad.Deprecate.Mode = "tag"
+	ports := []*port.Port{bad, node}
+
+	g, err := (&graph.Builder{Registry: reg}).Build(context.Background(), ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &graph.Builder{Registry: failingTags{Registry: reg, repo: "me.io/bad"}}
+	dropped, err := b.Dropped(context.Background(), ports, g)
+	if err == nil || !strings.Contains(err.Error(), `port "ports/bad"`) {
+		t.Errorf("err = %v, want the failure of ports/bad", err)
+	}
+	if len(dropped) != 1 || dropped[0].Port != "ports/node" || dropped[0].Tags[0] != "18.0.0" {
+		t.Errorf("dropped = %+v, want line 18 of ports/node", dropped)
+	}
+}
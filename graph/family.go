@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/tag"
+)
+
+// Family is a family of a port's nodes: one combination of its matrix values,
+// with the select mapping and the build tag templates rendered for it. The
+// Builder, `clade select`, the linter and the renderer all select and tag
+// through it.
+type Family struct {
+	Port *port.Port
+	// Values are the matrix values of the family; nil when the port has no
+	// matrix.
+	Values map[string]string
+	// Select is the select mapping rendered with Values.
+	Select []byte
+	// Selector selects among the candidate tags as Select says.
+	Selector tag.Selector
+
+	tags []*template.Template
+}
+
+// Families returns a family per combination of p's matrix values, in the order
+// of Matrix.Combinations.
+func Families(p *port.Port) ([]*Family, error) {
+	combinations := p.Matrix.Combinations()
+	out := make([]*Family, 0, len(combinations))
+	for _, values := range combinations {
+		f, err := NewFamily(p, values)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// NewFamily returns the family of p with the given matrix values.
+func NewFamily(p *port.Port, values map[string]string) (*Family, error) {
+	f := &Family{Port: p, Select: p.Select.Params}
+	if len(values) > 0 {
+		s, err := port.RenderMatrix(string(p.Select.Params), values)
+		if err != nil {
+			return nil, fmt.Errorf("render select: %w", err)
+		}
+		f.Values = values
+		f.Select = []byte(s)
+	}
+
+	var err error
+	if f.Selector, err = tag.New(p.Select.Kind, f.Select); err != nil {
+		return nil, err
+	}
+	f.tags = make([]*template.Template, len(p.Build.Tags))
+	for i, t := range p.Build.Tags {
+		f.tags[i], err = template.New(p.ID).Funcs(port.MatrixFuncs(f.Values)).Option("missingkey=error").Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("parse build tag: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// Tags renders the build tags for a selected tag, with the data its selector
+// matched it with, in the order of build.tags.
+func (f *Family) Tags(m tag.Matched) ([]string, error) {
+	out := make([]string, len(f.tags))
+	for i, t := range f.tags {
+		var sb strings.Builder
+		if err := t.Execute(&sb, m.Data); err != nil {
+			return nil, fmt.Errorf("render build tag for tag %q: %w", m.Tag, err)
+		}
+		out[i] = sb.String()
+	}
+	return out, nil
+}
+
+// Name names the family, e.g. "ports/python {variant=alpine}".
+func (f *Family) Name() string {
+	return FamilyName(f.Port.ID, f.Values)
+}
+
+// FamilyName names the family of the port id with the given matrix values.
+func FamilyName(id string, values map[string]string) string {
+	if len(values) == 0 {
+		return id
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + values[k]
+	}
+	return id + " {" + strings.Join(pairs, ", ") + "}"
+}
@@ -0,0 +1,55 @@
+package graph_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+)
+
+func TestFamilies(t *testing.T) {
+	p := &port.Port{
+		ID:     "ports/go",
+		Matrix: port.Matrix{"variant": {"alpine", "bookworm"}},
+		Select: port.Select{Kind: "semver", Params: []byte("kind: semver\npre-release: '{{matrix \"variant\"}}'\n")},
+		Build:  port.Build{Repo: "me.io/go", Tags: []string{`{{.Major}}.{{.Minor}}-{{matrix "variant"}}`, "{{.Major}}"}},
+	}
+	families, err := graph.Families(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 2 {
+		t.Fatalf("families = %v", families)
+	}
+
+	f := families[1]
+	if f.Name() != "ports/go {variant=bookworm}" || string(f.Select) != "kind: semver\npre-release: 'bookworm'\n" {
+		t.Errorf("family %q selects %q", f.Name(), f.Select)
+	}
+	matched, err := f.Selector.Select([]string{"1.22.3", "1.22.3-alpine", "1.22.3-bookworm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Tag != "1.22.3-bookworm" {
+		t.Fatalf("matched = %v", matched)
+	}
+	tags, err := f.Tags(matched[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"1.22-bookworm", "1"}) {
+		t.Errorf("tags = %v", tags)
+	}
+
+	// A port without matrix is a single family, named after the port.
+	p.Matrix = nil
+	p.Select.Params = []byte("kind: semver\n")
+	if f, err := graph.NewFamily(p, nil); err != nil || f.Name() != "ports/go" || f.Values != nil {
+		t.Errorf("family = %v, %v", f, err)
+	}
+	p.Build.Tags = []string{"{{.Major"}
+	if _, err := graph.Families(p); err == nil {
+		t.Error("expected error for a bad build tag")
+	}
+}
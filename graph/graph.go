@@ -2,7 +2,8 @@
 // of ports and marks which targets are outdated with respect to their base.
 //
 // Each port is expanded into one or more concrete target images by selecting
-// upstream versions and rendering the build tag template. A container port
+// upstream versions and rendering the build tag template, once per combination
+// of its matrix values. A container port
 // whose source.repo is the build.repo of another port forms an internal edge;
 // such ports are expanded after their upstream so the upstream's produced tags
 // are available.
@@ -12,8 +13,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
-	"text/template"
+	"maps"
 
 	"github.com/lesomnus/clade/compare"
 	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
@@ -34,114 +34,175 @@ type Builder struct {
 // Build expands the ports into a graph and marks outdated nodes. The returned
 // graph's nodes are ordered topologically (parents before children).
 func (b *Builder) Build(ctx context.Context, ports []*port.Port) (*cladev1.Graph, error) {
-	ordered, err := topoSort(ports)
+	e, err := b.expand(ctx, ports)
 	if err != nil {
 		return nil, err
 	}
 
-	by_repo := map[string]*port.Port{}
+	chains := map[string]compare.Chain{} // port id -> comparator chain
 	for _, p := range ports {
-		by_repo[p.Build.Repo] = p
+		chain, err := compareChain(p)
+		if err != nil {
+			return nil, fmt.Errorf("port %q: %w", p.ID, err)
+		}
+		chains[p.ID] = chain
+	}
+	if err := b.markOutdated(ctx, e.nodes, e.nodeByID, chains); err != nil {
+		return nil, err
 	}
+	return &cladev1.Graph{Nodes: e.nodes}, nil
+}
 
-	expanded := map[string][]string{} // build.repo -> produced target tags
-	nodes := []*cladev1.Node{}
-	node_by_id := map[string]*cladev1.Node{}
-	chains := map[string]compare.Chain{} // port dir -> comparator chain
+// Candidates returns the tags p selects among, as Build resolves them: the
+// versions of its source or, on an internal edge, the tags the ports building
+// its source repository produce. ports are every port; those p is built on,
+// transitively, are expanded to find those tags.
+func (b *Builder) Candidates(ctx context.Context, ports []*port.Port, p *port.Port) ([]string, error) {
+	by_repo := producers(ports)
+	if !internal(by_repo, p) {
+		return b.versions(ctx, p)
+	}
 
-	for _, p := range ordered {
-		var parent_tags []string
-		if up, internal := by_repo[p.Source.Repo]; p.Source.Kind == "container" && internal && up != p {
-			// Internal edge: reuse the upstream port's produced tags.
-			parent_tags = expanded[p.Source.Repo]
-		} else {
-			src, err := source.New(p.Source.Kind, p.Source.Params, source.Deps{Tags: b.Registry.Tags})
-			if err != nil {
-				return nil, fmt.Errorf("port %q: %w", p.Dir, err)
-			}
-			vs, err := src.Versions(ctx)
-			if err != nil {
-				return nil, fmt.Errorf("list versions for port %q: %w", p.Dir, err)
+	ups := []*port.Port{}
+	seen := map[*port.Port]bool{p: true}
+	queue := []*port.Port{p}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		for _, up := range by_repo[q.Source.Repo] {
+			if !seen[up] {
+				seen[up] = true
+				ups = append(ups, up)
+				queue = append(queue, up)
 			}
-			parent_tags = vs
 		}
+	}
+	e, err := b.expand(ctx, ups)
+	if err != nil {
+		return nil, err
+	}
+	return e.produced[p.Source.Repo], nil
+}
 
-		chain, err := compareChain(p)
-		if err != nil {
-			return nil, fmt.Errorf("port %q: %w", p.Dir, err)
-		}
-		chains[p.Dir] = chain
+// expansion is the nodes ports expand into.
+type expansion struct {
+	nodes    []*cladev1.Node
+	nodeByID map[string]*cladev1.Node
+	// produced are the tags of the nodes by build.repo.
+	produced map[string][]string
+}
 
-		selector, err := tag.New(p.Select.Kind, p.Select.Params)
-		if err != nil {
-			return nil, fmt.Errorf("port %q: %w", p.Dir, err)
+// expand expands each port into its nodes: a node per candidate tag each
+// family of the port selects, tagged with the family's build tags.
+func (b *Builder) expand(ctx context.Context, ports []*port.Port) (*expansion, error) {
+	ordered, err := topoSort(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &expansion{
+		nodes:    []*cladev1.Node{},
+		nodeByID: map[string]*cladev1.Node{},
+		produced: map[string][]string{},
+	}
+	by_repo := producers(ports)
+	for _, p := range ordered {
+		candidates := e.produced[p.Source.Repo]
+		if !internal(by_repo, p) {
+			if candidates, err = b.versions(ctx, p); err != nil {
+				return nil, err
+			}
 		}
-		matched, err := selector.Select(parent_tags)
+
+		families, err := Families(p)
 		if err != nil {
-			return nil, fmt.Errorf("select tags for port %q: %w", p.Dir, err)
+			return nil, fmt.Errorf("port %q: %w", p.ID, err)
 		}
-
-		tmpls := make([]*template.Template, len(p.Build.Tags))
-		for i, t := range p.Build.Tags {
-			tmpls[i], err = template.New(p.Dir).Option("missingkey=error").Parse(t)
+		// Each combination of the matrix values is a family of nodes of its
+		// own, selected and tagged with those values.
+		for _, f := range families {
+			matched, err := f.Selector.Select(candidates)
 			if err != nil {
-				return nil, fmt.Errorf("parse build tag for port %q: %w", p.Dir, err)
+				return nil, fmt.Errorf("select tags for port %q: %w", p.ID, err)
 			}
-		}
-
-		for _, m := range matched {
-			// Render every build tag for this upstream tag. They all point to
-			// the same image, so collect their full references.
-			var refs, tags []string
-			for _, tmpl := range tmpls {
-				var sb strings.Builder
-				if err := tmpl.Execute(&sb, m.Data); err != nil {
-					return nil, fmt.Errorf("render build tag for port %q tag %q: %w", p.Dir, m.Tag, err)
-				}
-				target_tag := sb.String()
-				target_ref := p.Build.Repo + ":" + target_tag
-				// matched is ordered newest first, so a reference already taken
-				// belongs to a newer image; leave a floating tag (e.g. "1") on it.
-				if _, taken := node_by_id[target_ref]; taken {
-					continue
+			for _, m := range matched {
+				if err := e.add(p, f, m); err != nil {
+					return nil, err
 				}
-				tags = append(tags, target_tag)
-				refs = append(refs, target_ref)
-			}
-			if len(refs) == 0 {
-				continue
 			}
+		}
+	}
+	return e, nil
+}
 
-			// A container source provides the base image; other sources (e.g.
-			// http) have no upstream image, so the Dockerfile sets its own FROM.
-			base_ref := ""
-			if p.Source.Kind == "container" {
-				base_ref = p.Source.Repo + ":" + m.Tag
-			}
-			node := &cladev1.Node{
-				Id:      refs[0],
-				Tags:    refs,
-				Base:    base_ref,
-				BaseTag: m.Tag,
-				Port:    p.Dir,
-				Image:   &cladev1.Image{Repo: p.Build.Repo, Tag: tags[0]},
-			}
-			if parent, ok := node_by_id[base_ref]; ok {
-				node.Parents = []string{parent.Id}
-			}
+// add adds the node family f builds on the matched tag m, unless newer nodes
+// took all its tags.
+func (e *expansion) add(p *port.Port, f *Family, m tag.Matched) error {
+	rendered, err := f.Tags(m)
+	if err != nil {
+		return fmt.Errorf("port %q: %w", p.ID, err)
+	}
 
-			for i, ref := range refs {
-				node_by_id[ref] = node
-				expanded[p.Build.Repo] = append(expanded[p.Build.Repo], tags[i])
+	// Every build tag points to the same image, so collect their full
+	// references.
+	var refs, tags []string
+	for _, target_tag := range rendered {
+		target_ref := p.Build.Repo + ":" + target_tag
+		// matched is ordered newest first, so a reference already taken
+		// belongs to a newer image; leave a floating tag (e.g. "1") on it.
+		// Another combination of the matrix is another image, though: its
+		// tags must tell the combinations apart.
+		if taken, ok := e.nodeByID[target_ref]; ok {
+			if taken.Port == p.ID && !maps.Equal(taken.Matrix, f.Values) {
+				return fmt.Errorf("port %q: build tag %q of matrix %v is also rendered for matrix %v; use the matrix values in build.tags", p.ID, target_ref, f.Values, taken.Matrix)
 			}
-			nodes = append(nodes, node)
+			continue
 		}
+		tags = append(tags, target_tag)
+		refs = append(refs, target_ref)
+	}
+	if len(refs) == 0 {
+		return nil
 	}
 
-	if err := b.markOutdated(ctx, nodes, node_by_id, chains); err != nil {
-		return nil, err
+	// A container source provides the base image; other sources (e.g. http)
+	// have no upstream image, so the Dockerfile sets its own FROM.
+	base_ref := ""
+	if p.Source.Kind == "container" {
+		base_ref = p.Source.Repo + ":" + m.Tag
+	}
+	node := &cladev1.Node{
+		Id:      refs[0],
+		Tags:    refs,
+		Base:    base_ref,
+		BaseTag: m.Tag,
+		Port:    p.ID,
+		Image:   &cladev1.Image{Repo: p.Build.Repo, Tag: tags[0]},
+		Matrix:  f.Values,
 	}
-	return &cladev1.Graph{Nodes: nodes}, nil
+	if parent, ok := e.nodeByID[base_ref]; ok {
+		node.Parents = []string{parent.Id}
+	}
+
+	for i, ref := range refs {
+		e.nodeByID[ref] = node
+		e.produced[p.Build.Repo] = append(e.produced[p.Build.Repo], tags[i])
+	}
+	e.nodes = append(e.nodes, node)
+	return nil
+}
+
+// versions lists the versions of p's source.
+func (b *Builder) versions(ctx context.Context, p *port.Port) ([]string, error) {
+	src, err := source.New(p.Source.Kind, p.Source.Params, source.Deps{Tags: b.Registry.Tags})
+	if err != nil {
+		return nil, fmt.Errorf("port %q: %w", p.ID, err)
+	}
+	vs, err := src.Versions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list versions for port %q: %w", p.ID, err)
+	}
+	return vs, nil
 }
 
 // compareChain builds a port's outdated-comparison chain from its own compare
@@ -247,13 +308,34 @@ func imageOf(repo, tag string, info *registry.ImageInfo) *cladev1.Image {
 	}
 }
 
-// topoSort orders ports so that a port whose parent.repo is the build.repo of
-// another port comes after that port. It returns an error on a cycle.
-func topoSort(ports []*port.Port) ([]*port.Port, error) {
-	by_repo := map[string]*port.Port{}
+// producers maps each build.repo to the ports pushing to it. Several ports,
+// such as the variants of a directory, may share a repository.
+func producers(ports []*port.Port) map[string][]*port.Port {
+	by_repo := map[string][]*port.Port{}
 	for _, p := range ports {
-		by_repo[p.Build.Repo] = p
+		by_repo[p.Build.Repo] = append(by_repo[p.Build.Repo], p)
+	}
+	return by_repo
+}
+
+// internal reports whether p is built on another port: its container source
+// repository is another port's build.repo.
+func internal(by_repo map[string][]*port.Port, p *port.Port) bool {
+	if p.Source.Kind != "container" {
+		return false
 	}
+	for _, up := range by_repo[p.Source.Repo] {
+		if up != p {
+			return true
+		}
+	}
+	return false
+}
+
+// topoSort orders ports so that a port whose parent.repo is the build.repo of
+// other ports comes after those ports. It returns an error on a cycle.
+func topoSort(ports []*port.Port) ([]*port.Port, error) {
+	by_repo := producers(ports)
 
 	indeg := map[*port.Port]int{}
 	children := map[*port.Port][]*port.Port{}
@@ -261,9 +343,11 @@ func topoSort(ports []*port.Port) ([]*port.Port, error) {
 		indeg[p] = 0
 	}
 	for _, p := range ports {
-		if up, ok := by_repo[p.Source.Repo]; ok && up != p {
-			children[up] = append(children[up], p)
-			indeg[p]++
+		for _, up := range by_repo[p.Source.Repo] {
+			if up != p {
+				children[up] = append(children[up], p)
+				indeg[p]++
+			}
 		}
 	}
 
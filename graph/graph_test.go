@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 func semverPort(dir, sourceRepo, buildRepo string) *port.Port {
 	return &port.Port{
 		Dir: dir,
+		ID:  dir,
 		Source: port.Source{
 			Kind:   "container",
 			Repo:   sourceRepo,
@@ -122,6 +125,120 @@ func TestBuildGraph(t *testing.T) {
 	}
 }
 
+func TestBuildVariants(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("up.io/base:1.0.0", &registry.ImageInfo{Created: at(100)})
+
+	// Two variants of one directory push to one repository.
+	variant := func(name string) *port.Port {
+		p := semverPort("ports/py", "up.io/base", "me.io/py")
+		p.ID = "ports/py:" + name
+		p.Build.Tags = []string{"{{.Major}}.{{.Minor}}.{{.Patch}}-" + name}
+		return p
+	}
+	app := semverPort("ports/app", "me.io/py", "me.io/app")
+	app.Select.Params = []byte("kind: semver\npre-release: alpine\n")
+
+	b := &graph.Builder{Registry: reg}
+	g, err := b.Build(context.Background(), []*port.Port{app, variant("alpine"), variant("debian")})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	for id, port := range map[string]string{
+		"me.io/py:1.0.0-alpine": "ports/py:alpine",
+		"me.io/py:1.0.0-debian": "ports/py:debian",
+		"me.io/app:1.0.0":       "ports/app",
+	} {
+		n := nodeByID(g, id)
+		if n == nil {
+			t.Fatalf("missing node %q", id)
+		}
+		if n.Port != port {
+			t.Errorf("%s port = %q, want %q", id, n.Port, port)
+		}
+	}
+	if n := nodeByID(g, "me.io/app:1.0.0"); len(n.Parents) != 1 || n.Parents[0] != "me.io/py:1.0.0-alpine" {
+		t.Errorf("app parents = %v, want [me.io/py:1.0.0-alpine]", n.Parents)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("up.io/base:1.0.0", &registry.ImageInfo{Created: at(100)})
+	reg.Set("up.io/base:1.1.0", &registry.ImageInfo{Created: at(100)})
+	// Pushed to the upstream port's repository, but not one it builds.
+	reg.Set("me.io/py:0.9.0", &registry.ImageInfo{Created: at(100)})
+
+	py := semverPort("ports/py", "up.io/base", "me.io/py")
+	py.Build.Tags = []string{"{{.Major}}.{{.Minor}}.{{.Patch}}", "{{.Major}}"}
+	app := semverPort("ports/app", "me.io/py", "me.io/app")
+	ports := []*port.Port{app, py}
+
+	b := &graph.Builder{Registry: reg}
+	got, err := b.Candidates(context.Background(), ports, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.1.0", "1", "1.0.0"}; !slices.Equal(got, want) {
+		t.Errorf("candidates of app = %v, want %v", got, want)
+	}
+	got, err = b.Candidates(context.Background(), ports, py)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0.0", "1.1.0"}; !slices.Equal(got, want) {
+		t.Errorf("candidates of py = %v, want %v", got, want)
+	}
+}
+
+func TestBuildMatrix(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("up.io/go:1.22.3-alpine", &registry.ImageInfo{Created: at(100)})
+	reg.Set("up.io/go:1.22.3-bookworm", &registry.ImageInfo{Created: at(100)})
+	reg.Set("up.io/go:1.22.3", &registry.ImageInfo{Created: at(100)})
+
+	p := semverPort("ports/go", "up.io/go", "me.io/go")
+	p.Matrix = port.Matrix{"variant": {"alpine", "bookworm"}}
+	p.Select.Params = []byte("kind: semver\npre-release: '{{matrix \"variant\"}}'\n")
+	p.Build.Tags = []string{`{{.Major}}.{{.Minor}}-{{matrix "variant"}}`}
+
+	b := &graph.Builder{Registry: reg}
+	g, err := b.Build(context.Background(), []*port.Port{p})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(g.Nodes) != 2 {
+		t.Fatalf("nodes = %v, want one per variant", g.Nodes)
+	}
+	for _, variant := range []string{"alpine", "bookworm"} {
+		n := nodeByID(g, "me.io/go:1.22-"+variant)
+		if n == nil {
+			t.Fatalf("missing node for %s", variant)
+		}
+		if n.Base != "up.io/go:1.22.3-"+variant || n.Port != "ports/go" || n.Matrix["variant"] != variant {
+			t.Errorf("%s: base = %q, port = %q, matrix = %v", variant, n.Base, n.Port, n.Matrix)
+		}
+	}
+}
+
+func TestBuildMatrixCollision(t *testing.T) {
+	reg := registry.NewFake()
+	reg.Set("up.io/go:1.22.3-alpine", &registry.ImageInfo{Created: at(100)})
+	reg.Set("up.io/go:1.22.3-bookworm", &registry.ImageInfo{Created: at(100)})
+
+	p := semverPort("ports/go", "up.io/go", "me.io/go")
+	p.Matrix = port.Matrix{"variant": {"alpine", "bookworm"}}
+	p.Select.Params = []byte("kind: semver\npre-release: '{{matrix \"variant\"}}'\n")
+	p.Build.Tags = []string{`{{.Major}}.{{.Minor}}-{{matrix "variant"}}`, "{{.Major}}"}
+
+	b := &graph.Builder{Registry: reg}
+	_, err := b.Build(context.Background(), []*port.Port{p})
+	if err == nil || !strings.Contains(err.Error(), `"me.io/go:1"`) {
+		t.Fatalf("err = %v, want a collision on me.io/go:1", err)
+	}
+}
+
 func TestBuildMultiTag(t *testing.T) {
 	reg := registry.NewFake()
 	reg.Set("up.io/base:1.22.3", &registry.ImageInfo{Created: at(100)})
@@ -130,6 +247,7 @@ func TestBuildMultiTag(t *testing.T) {
 
 	p := &port.Port{
 		Dir: "ports/x",
+		ID:  "ports/x",
 		Source: port.Source{
 			Kind:   "container",
 			Repo:   "up.io/base",
@@ -182,6 +300,7 @@ func TestBuildHTTPSource(t *testing.T) {
 	reg := registry.NewFake()
 	p := &port.Port{
 		Dir:    "ports/tool",
+		ID:     "ports/tool",
 		Source: port.Source{Kind: "http", Url: srv.URL, Params: []byte("kind: http\nurl: " + srv.URL + "\n")},
 		Select: port.Select{Kind: "semver", Params: []byte("kind: semver\n")},
 		Build: port.Build{Repo: "me.io/tool", Tags: []string{
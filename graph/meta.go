@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+	"github.com/lesomnus/clade/port"
+)
+
+// SchemaVersion is the version of the graph schema this clade writes. It is
+// bumped when a change would make an older clade misread a graph.
+const SchemaVersion = 1
+
+// HashPorts returns the hex SHA-256 of each port's effective manifest, keyed
+// by the port id, so a change to the defaults or an extended port is seen as
+// a change to the ports it applies to. A port without a Manifest is hashed
+// from its File.
+func HashPorts(ports []*port.Port) (map[string]string, error) {
+	out := make(map[string]string, len(ports))
+	for _, p := range ports {
+		data := p.Manifest
+		if data == nil {
+			var err error
+			if data, err = os.ReadFile(p.File); err != nil {
+				return nil, fmt.Errorf("port %q: %w", p.ID, err)
+			}
+		}
+		sum := sha256.Sum256(data)
+		out[p.ID] = hex.EncodeToString(sum[:])
+	}
+	return out, nil
+}
+
+// Stale lists how the ports, given by their hashes (see HashPorts), changed
+// since the graph of meta was computed: ports whose manifest changed, and
+// ports added or removed. It is empty when the graph is current.
+func Stale(meta *cladev1.Metadata, hashes map[string]string) []string {
+	out := []string{}
+	for id, h := range hashes {
+		was, ok := meta.PortHashes[id]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("port %s was added", id))
+		case was != h:
+			out = append(out, fmt.Sprintf("%s changed", port.ManifestPath(id)))
+		}
+	}
+	for id := range meta.PortHashes {
+		if _, ok := hashes[id]; !ok {
+			out = append(out, fmt.Sprintf("port %s was removed", id))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,31 @@
+package graph_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lesomnus/clade/graph"
+	cladev1 "github.com/lesomnus/clade/pb/clade/v1"
+)
+
+func TestStale(t *testing.T) {
+	meta := &cladev1.Metadata{PortHashes: map[string]string{
+		"ports/a": "1",
+		"ports/b": "2",
+		"ports/c": "3",
+	}}
+
+	if got := graph.Stale(meta, map[string]string{"ports/a": "1", "ports/b": "2", "ports/c": "3"}); len(got) != 0 {
+		t.Errorf("unchanged ports: %v", got)
+	}
+
+	got := graph.Stale(meta, map[string]string{"ports/a": "1", "ports/b": "9", "ports/d": "4"})
+	want := []string{
+		"port ports/c was removed",
+		"port ports/d was added",
+		"ports/b/port.yaml changed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+// Package history keeps a record of every build attempt in a local bbolt
+// file, so when a node was last built, from which base digest and with what
+// result can be answered later, and nodes that keep failing can be backed off.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	// StatusSkipped is a node not built because a node it is built on failed
+	// or is backed off.
+	StatusSkipped Status = "skipped"
+	// StatusPromoted is a node built in a staged run whose staging image was
+	// promoted to its real tags. The build itself is recorded on its own,
+	// with the staging tag.
+	StatusPromoted Status = "promoted"
+)
+
+// Record is a build attempt of a node.
+type Record struct {
+	// Seq orders the records; Add assigns it.
+	Seq uint64 `json:"seq"`
+
+	Node string   `json:"node"`
+	Port string   `json:"port"`
+	Tags []string `json:"tags,omitempty"`
+	// Base is the reference built on, and BaseDigest its digest at the time.
+	Base       string `json:"base,omitempty"`
+	BaseDigest string `json:"base_digest,omitempty"`
+	// Digest is of the image pushed, or promoted; empty when none was.
+	Digest string `json:"digest,omitempty"`
+	// RunID is the staged run the build was part of, if any.
+	RunID string `json:"run_id,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   Status    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	// Log is the directory of the build's log (see `clade build --log-dir`).
+	Log string `json:"log,omitempty"`
+}
+
+func (r *Record) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+var (
+	bucketBuilds = []byte("builds")
+	// bucketRefs holds a bucket per node id and tag, of the sequence numbers
+	// of the node's records.
+	bucketRefs = []byte("refs")
+)
+
+// lockTimeout is how long to wait for another clade holding the file.
+const lockTimeout = 10 * time.Second
+
+// Store is a history file. It is opened for every operation rather than held,
+// so a daemon recording builds does not lock `clade history` out.
+type Store struct {
+	path string
+}
+
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) open(readOnly bool) (*bolt.DB, error) {
+	if readOnly {
+		if _, err := os.Stat(s.path); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return nil, fmt.Errorf("create history directory: %w", err)
+	}
+	db, err := bolt.Open(s.path, 0o644, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("open history %s: locked by another process", s.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open history %s: %w", s.path, err)
+	}
+	return db, nil
+}
+
+// Add records r, assigning its Seq.
+func (s *Store) Add(r *Record) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		builds, err := tx.CreateBucketIfNotExists(bucketBuilds)
+		if err != nil {
+			return err
+		}
+		refs, err := tx.CreateBucketIfNotExists(bucketRefs)
+		if err != nil {
+			return err
+		}
+
+		r.Seq, err = builds.NextSequence()
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("marshal record: %w", err)
+		}
+		k := key(r.Seq)
+		if err := builds.Put(k, v); err != nil {
+			return err
+		}
+		for _, ref := range append([]string{r.Node}, r.Tags...) {
+			b, err := refs.CreateBucketIfNotExists([]byte(ref))
+			if err != nil {
+				return err
+			}
+			if err := b.Put(k, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// Query selects records. The zero value selects every record.
+type Query struct {
+	// Ref is a node id or any of its tags.
+	Ref    string
+	Status Status
+	// Since drops the records of builds started before it.
+	Since time.Time
+	// Limit caps the records returned, unless 0.
+	Limit int
+}
+
+// Query returns the records q selects, newest first. A store never written
+// to has none.
+func (s *Store) Query(q Query) ([]*Record, error) {
+	db, err := s.open(true)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	out := []*Record{}
+	err = db.View(func(tx *bolt.Tx) error {
+		builds := tx.Bucket(bucketBuilds)
+		if builds == nil {
+			return nil
+		}
+		// Keys of the records, newest first.
+		c := builds.Cursor()
+		if q.Ref != "" {
+			refs := tx.Bucket(bucketRefs)
+			if refs == nil {
+				return nil
+			}
+			b := refs.Bucket([]byte(q.Ref))
+			if b == nil {
+				return nil
+			}
+			c = b.Cursor()
+		}
+
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			var r Record
+			if err := json.Unmarshal(builds.Get(k), &r); err != nil {
+				return fmt.Errorf("decode record %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if !q.Since.IsZero() && r.Started.Before(q.Since) {
+				// Records are added in the order their builds finish, which
+				// is not quite the order they started in.
+				continue
+			}
+			if q.Status != "" && r.Status != q.Status {
+				continue
+			}
+			out = append(out, &r)
+			if q.Limit > 0 && len(out) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Backoff spaces the builds of a node that keeps failing: after n failures in
+// a row, the next build waits Base doubled n-1 times, up to Max.
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b Backoff) Delay(failures int) time.Duration {
+	if failures <= 0 || b.Base <= 0 {
+		return 0
+	}
+	d := b.Base
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			return b.Max
+		}
+	}
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+	return d
+}
+
+// Failures returns how many of the latest records, newest first, are failures
+// in a row, and the newest of them. Skipped builds are passed over.
+func Failures(records []*Record) (int, *Record) {
+	n := 0
+	var last *Record
+	for _, r := range records {
+		if r.Status == StatusSkipped {
+			continue
+		}
+		if r.Status != StatusFailed {
+			break
+		}
+		if last == nil {
+			last = r
+		}
+		n++
+	}
+	return n, last
+}
+
+// RetryAt returns when node may be built again under b: zero when it may be
+// now.
+func (s *Store) RetryAt(node string, b Backoff) (time.Time, error) {
+	records, err := s.Query(Query{Ref: node})
+	if err != nil {
+		return time.Time{}, err
+	}
+	n, last := Failures(records)
+	if n == 0 {
+		return time.Time{}, nil
+	}
+	at := last.Finished.Add(b.Delay(n))
+	if !at.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return at, nil
+}
@@ -0,0 +1,95 @@
+package history_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/history"
+)
+
+func TestStore(t *testing.T) {
+	s := history.New(filepath.Join(t.TempDir(), "sub", "history.db"))
+	if rs, err := s.Query(history.Query{}); err != nil || len(rs) != 0 {
+		t.Fatalf("empty store: %v, %v", rs, err)
+	}
+
+	at := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	add := func(node string, tags []string, status history.Status, day int) {
+		t.Helper()
+		r := &history.Record{
+			Node:     node,
+			Tags:     tags,
+			Status:   status,
+			Started:  at.AddDate(0, 0, day),
+			Finished: at.AddDate(0, 0, day).Add(time.Minute),
+		}
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golang := []string{"me/golang:1.22.3", "me/golang:1.22"}
+	add("me/golang:1.22.3", golang, history.StatusSucceeded, 0)
+	add("me/python:3.12", nil, history.StatusFailed, 1)
+	add("me/golang:1.22.3", golang, history.StatusFailed, 2)
+
+	all, err := s.Query(history.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Seq != 3 || all[2].Seq != 1 {
+		t.Fatalf("records not newest first: %v", all)
+	}
+	if all[0].Duration() != time.Minute {
+		t.Errorf("duration = %v", all[0].Duration())
+	}
+
+	rs, err := s.Query(history.Query{Ref: "me/golang:1.22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].Status != history.StatusFailed || rs[1].Status != history.StatusSucceeded {
+		t.Errorf("by tag = %v", rs)
+	}
+	rs, err = s.Query(history.Query{Status: history.StatusFailed, Since: at.AddDate(0, 0, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Node != "me/golang:1.22.3" {
+		t.Errorf("failed since day 2 = %v", rs)
+	}
+	if rs, _ = s.Query(history.Query{Limit: 1}); len(rs) != 1 || rs[0].Seq != 3 {
+		t.Errorf("limit 1 = %v", rs)
+	}
+	if rs, _ = s.Query(history.Query{Ref: "me/rust:1"}); len(rs) != 0 {
+		t.Errorf("unknown ref = %v", rs)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := history.Backoff{Base: 10 * time.Minute, Max: time.Hour}
+	for n, want := range []time.Duration{0, 10 * time.Minute, 20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour} {
+		if got := b.Delay(n); got != want {
+			t.Errorf("delay after %d failures = %v, want %v", n, got, want)
+		}
+	}
+
+	s := history.New(filepath.Join(t.TempDir(), "history.db"))
+	now := time.Now()
+	for _, st := range []history.Status{history.StatusFailed, history.StatusSucceeded, history.StatusFailed, history.StatusSkipped, history.StatusFailed} {
+		if err := s.Add(&history.Record{Node: "x", Status: st, Started: now, Finished: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Two failures in a row since the success; the skip does not count.
+	at, err := s.RetryAt("x", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(20 * time.Minute); !at.Equal(want) {
+		t.Errorf("retry at %v, want %v", at, want)
+	}
+	if at, _ := s.RetryAt("y", b); !at.IsZero() {
+		t.Errorf("never built: retry at %v", at)
+	}
+}
@@ -0,0 +1,350 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/dockerfile"
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+)
+
+// templates checks that every build tag parses and names only matrix keys the
+// port has, and that the select mapping renders with every combination.
+func (l *linter) templates(p *port.Port) {
+	for i, t := range p.Build.Tags {
+		path := []string{"build", "tags", strconv.Itoa(i)}
+		keys, err := matrixKeys(t)
+		if err != nil {
+			l.add(l.at(p, Error, path, "build.tags[%d]: %s", i, err))
+			continue
+		}
+		for _, k := range keys {
+			if _, ok := p.Matrix[k]; !ok {
+				l.add(l.at(p, Error, path, "build.tags[%d]: no matrix key %q", i, k))
+			}
+		}
+		for j := range i {
+			if p.Build.Tags[j] == t {
+				l.add(l.at(p, Error, path, "build.tags[%d] repeats build.tags[%d]", i, j))
+				break
+			}
+		}
+	}
+
+	if len(p.Matrix) == 0 {
+		return
+	}
+	for _, values := range p.Matrix.Combinations() {
+		if _, err := port.RenderMatrix(string(p.Select.Params), values); err != nil {
+			l.add(l.at(p, Error, []string{"select"}, "select: %s", err))
+			break
+		}
+	}
+}
+
+// matrixKeys parses the template s and returns the matrix keys it names with
+// {{matrix "key"}}.
+func matrixKeys(s string) ([]string, error) {
+	t, err := template.New("").Funcs(port.MatrixFuncs(nil)).Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 2 {
+				f, ok1 := n.Args[0].(*parse.IdentifierNode)
+				k, ok2 := n.Args[1].(*parse.StringNode)
+				if ok1 && ok2 && f.Ident == "matrix" {
+					seen[k.Text] = true
+				}
+			}
+			for _, a := range n.Args {
+				walk(a)
+			}
+		}
+	}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			walk(tt.Tree.Root)
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+var (
+	argBase = regexp.MustCompile(`(?i)^\s*ARG\s+BASE(\s*=.*|\s*)$`)
+	useBase = regexp.MustCompile(`\$BASE\b|\$\{BASE[}:]`)
+)
+
+// dockerfile checks that a port built from a Dockerfile has one, and that the
+// Dockerfile uses the base image exactly when the source provides one: only a
+// container source sets the BASE build arg. A Dockerfile.tmpl stands in for a
+// missing Dockerfile.
+func (l *linter) dockerfile(p *port.Port) {
+	path, err := builder.Dockerfile(p.Build.Kind, p.Build.Params, p.Dir)
+	if err != nil || path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// The build renders the Dockerfile from its template.
+		path = dockerfile.TemplatePath(path)
+		data, err = os.ReadFile(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		path = strings.TrimSuffix(path, dockerfile.TemplateSuffix)
+		field := []string{"build", "dockerfile"}
+		if _, _, ok := locate(l.doc(p.File), field); !ok {
+			field = []string{"build"}
+		}
+		l.add(l.at(p, Error, field, "Dockerfile %s does not exist", path))
+		return
+	}
+	if err != nil {
+		l.add(l.at(p, Error, []string{"build"}, "read Dockerfile: %s", err))
+		return
+	}
+
+	declared, used := 0, 0
+	for n, line := range dockerfileLines(data) {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if argBase.MatchString(line) {
+			if declared == 0 {
+				declared = n
+			}
+			continue
+		}
+		if used == 0 && useBase.MatchString(line) {
+			used = n
+		}
+	}
+
+	if p.Source.Kind == "container" {
+		switch {
+		case declared == 0:
+			l.add(l.at(p, Warning, []string{"source"}, "%s does not declare ARG BASE; the base image %s is not built on", path, p.Source.Repo))
+		case used == 0:
+			l.add(Finding{File: path, Line: declared, Column: 1, Severity: Warning, Message: "ARG BASE is declared but never used; the base image is not built on"})
+		}
+		return
+	}
+	n := declared
+	if n == 0 {
+		n = used
+	}
+	if n > 0 {
+		l.add(Finding{File: path, Line: n, Column: 1, Severity: Warning, Message: fmt.Sprintf("BASE is not set for source kind %q; set FROM directly", p.Source.Kind)})
+	}
+}
+
+// dockerfileLines returns the instructions of a Dockerfile by the number of
+// the line each starts on, continuation lines joined.
+func dockerfileLines(data []byte) map[int]string {
+	out := map[int]string{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	start, cur := 0, ""
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if cur == "" {
+			start = n
+		}
+		if strings.HasSuffix(line, `\`) {
+			cur += strings.TrimSuffix(line, `\`) + " "
+			continue
+		}
+		out[start] = cur + line
+		cur = ""
+	}
+	if cur != "" {
+		out[start] = cur
+	}
+	return out
+}
+
+// repos checks the ports that push to the same repository. Their families
+// push the same tags when a tag template is the same, with the same matrix
+// values, and the versions it is rendered with are the same: the source and
+// the select mapping are. Ports sharing a repository from different
+// directories are worth a warning even when their tags differ; variants of a
+// directory share one by design.
+func (l *linter) repos(ports []*port.Port) {
+	by_repo := map[string][]*port.Port{}
+	for _, p := range ports {
+		by_repo[p.Build.Repo] = append(by_repo[p.Build.Repo], p)
+	}
+
+	for _, p := range ports {
+		for _, q := range by_repo[p.Build.Repo] {
+			if q != p && q.Dir != p.Dir {
+				l.add(l.at(p, Warning, []string{"build", "repo"}, "build.repo %s is also pushed to by port %s", p.Build.Repo, q.ID))
+				break
+			}
+		}
+	}
+
+	type pushed struct {
+		*graph.Family
+		index int
+	}
+	for _, repo := range sortedKeys(by_repo) {
+		taken := map[string]pushed{}
+		for _, p := range by_repo[repo] {
+			families, err := graph.Families(p)
+			if err != nil {
+				continue // found by templates
+			}
+			for _, f := range families {
+				for i, t := range p.Build.Tags {
+					keys, err := matrixKeys(t)
+					if err != nil {
+						continue
+					}
+					key := strings.Join([]string{t, p.Source.Kind, p.Source.Repo, p.Source.Url, string(f.Select)}, "\x00")
+					for _, k := range keys {
+						key += "\x00" + f.Values[k]
+					}
+					prev, ok := taken[key]
+					if !ok {
+						taken[key] = pushed{f, i}
+						continue
+					}
+					if prev.Port == p && maps.Equal(prev.Values, f.Values) {
+						continue // repeated template; found by templates
+					}
+					l.add(l.at(p, Error, []string{"build", "tags", strconv.Itoa(i)},
+						"build.tags[%d] of %s pushes the same tags to %s as build.tags[%d] of %s", i, f.Name(), repo, prev.index, prev.Name()))
+				}
+			}
+		}
+	}
+}
+
+// cycles reports each dependency cycle among the ports once, at the port of
+// the cycle that sorts first.
+func (l *linter) cycles(ports []*port.Port) {
+	by_repo := map[string][]*port.Port{}
+	for _, p := range ports {
+		by_repo[p.Build.Repo] = append(by_repo[p.Build.Repo], p)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[*port.Port]int{}
+	stack := []*port.Port{}
+	reported := map[string]bool{}
+	var visit func(p *port.Port)
+	visit = func(p *port.Port) {
+		state[p] = visiting
+		stack = append(stack, p)
+		for _, up := range by_repo[p.Source.Repo] {
+			if up == p {
+				continue
+			}
+			switch state[up] {
+			case unvisited:
+				visit(up)
+			case visiting:
+				i := len(stack) - 1
+				for stack[i] != up {
+					i--
+				}
+				l.cycle(stack[i:], reported)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[p] = done
+	}
+	for _, p := range ports {
+		if state[p] == unvisited {
+			visit(p)
+		}
+	}
+}
+
+// cycle reports the cycle of ports, each built on the next and the last on the
+// first, unless it was already.
+func (l *linter) cycle(ports []*port.Port, reported map[string]bool) {
+	first := 0
+	for i, p := range ports {
+		if p.ID < ports[first].ID {
+			first = i
+		}
+	}
+	ids := make([]string, 0, len(ports)+1)
+	for i := range ports {
+		ids = append(ids, ports[(first+i)%len(ports)].ID)
+	}
+	ids = append(ids, ids[0])
+	key := strings.Join(ids, " ")
+	if reported[key] {
+		return
+	}
+	reported[key] = true
+	l.add(l.at(ports[first], Error, []string{"source", "repo"}, "dependency cycle: %s (each built on the next)", strings.Join(ids, " -> ")))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
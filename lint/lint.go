@@ -0,0 +1,347 @@
+// Package lint checks ports for mistakes that loading them lets through. Every
+// effective manifest is validated against the JSON Schema assembled from the
+// registered kinds (see Schema), which catches unknown keys and values of the
+// wrong type, and the ports are checked together for problems that otherwise
+// only show when a graph is built or an image pushed: template errors, ports
+// pushing the same tags, dependency cycles and Dockerfiles that are missing or
+// ignore the base image.
+//
+// A finding is located in the file it comes from, which may be a
+// _defaults.yaml or an extended manifest rather than the port's own. A port
+// that fails to load is a finding too (see CheckLoaded).
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/lesomnus/clade/port"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Severity tells whether a finding fails the lint.
+type Severity string
+
+const (
+	// Error is a mistake: the port does not build, or builds the wrong thing.
+	Error Severity = "error"
+	// Warning is likely, but not surely, a mistake.
+	Warning Severity = "warning"
+)
+
+// Finding is a problem found in a port.
+type Finding struct {
+	File string `json:"file"`
+	// Line and Column are 1-based; zero when the problem has no position in
+	// File (e.g. it comes from clade.yaml's defaults).
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String formats f as "file:line:column: severity: message".
+func (f Finding) String() string {
+	loc := f.File
+	if f.Line > 0 {
+		loc += fmt.Sprintf(":%d:%d", f.Line, f.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, f.Severity, f.Message)
+}
+
+// Check lints ports, which must be every port under the roots so that cycles
+// and colliding tags are seen. Findings are sorted by location; the error is
+// for failures to lint at all.
+func Check(ports []*port.Port) ([]Finding, error) {
+	loaded := make([]port.Loaded, 0, len(ports))
+	for _, p := range ports {
+		loaded = append(loaded, port.Loaded{File: p.File, Port: p})
+	}
+	return CheckLoaded(loaded)
+}
+
+// CheckLoaded lints the outcome of port.Loader.LoadEach. Every manifest that
+// decodes is checked against the schema, valid or not, and a manifest that
+// fails to load is a finding rather than the end of the lint; the other checks
+// see the valid ports only.
+func CheckLoaded(loaded []port.Loaded) ([]Finding, error) {
+	schema, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{schema: schema, docs: map[string]*ast.File{}}
+	ports := []*port.Port{}
+	for _, r := range loaded {
+		n := len(l.findings)
+		if r.Port != nil {
+			if err := l.validate(r.Port); err != nil {
+				return nil, err
+			}
+		}
+		if r.Err != nil {
+			l.failure(r, l.findings[n:])
+			continue
+		}
+		ports = append(ports, r.Port)
+	}
+	for _, p := range ports {
+		l.templates(p)
+		l.dockerfile(p)
+	}
+	l.repos(ports)
+	l.cycles(ports)
+	return l.sorted(), nil
+}
+
+func compile() (*jsonschema.Schema, error) {
+	data, err := SchemaJSON()
+	if err != nil {
+		return nil, err
+	}
+	s, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode port schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(SchemaID, s); err != nil {
+		return nil, fmt.Errorf("add port schema: %w", err)
+	}
+	schema, err := c.Compile(SchemaID)
+	if err != nil {
+		return nil, fmt.Errorf("compile port schema: %w", err)
+	}
+	return schema, nil
+}
+
+type linter struct {
+	schema   *jsonschema.Schema
+	docs     map[string]*ast.File // parsed manifests by path; nil if unparsable
+	findings []Finding
+}
+
+func (l *linter) add(f Finding) {
+	l.findings = append(l.findings, f)
+}
+
+// at returns a finding about the field at path (keys and list indexes) of p's
+// effective manifest, located in the first of p.Files that sets it.
+func (l *linter) at(p *port.Port, sev Severity, path []string, format string, args ...any) Finding {
+	f := Finding{File: p.File, Severity: sev, Message: fmt.Sprintf(format, args...)}
+	for _, file := range p.Files {
+		if line, col, ok := locate(l.doc(file), path); ok {
+			f.File, f.Line, f.Column = file, line, col
+			break
+		}
+	}
+	return f
+}
+
+func (l *linter) doc(path string) *ast.File {
+	if d, ok := l.docs[path]; ok {
+		return d
+	}
+	var d *ast.File
+	if data, err := os.ReadFile(path); err == nil {
+		d, _ = parser.ParseBytes(data, 0)
+	}
+	l.docs[path] = d
+	return d
+}
+
+// failure adds the finding of a manifest that failed to load, given those the
+// schema found in it: a Validate error at the field it is about, or the
+// closest parent that is set, and a YAML error where the decoder found it. An
+// error the schema found already, at the same field, or a manifest the schema
+// faulted that does not decode into a port, is the same mistake and is not
+// added again.
+func (l *linter) failure(r port.Loaded, faults []Finding) {
+	var field *port.FieldError
+	var decode *port.DecodeError
+	var yerr yaml.Error
+	switch {
+	case r.Port != nil && errors.As(r.Err, &field):
+		f := Finding{File: r.Port.File, Line: 1, Column: 1, Severity: Error, Message: field.Message}
+		for i := len(field.Path); i > 0; i-- {
+			if at := l.at(r.Port, Error, field.Path[:i], "%s", field.Message); at.Line > 0 {
+				f = at
+				break
+			}
+		}
+		for _, fault := range faults {
+			if fault.File == f.File && fault.Line == f.Line && fault.Column == f.Column {
+				return
+			}
+		}
+		l.add(f)
+	case errors.As(r.Err, &decode) && errors.As(decode.Err, &yerr) && yerr.GetToken() != nil:
+		pos := yerr.GetToken().Position
+		l.add(Finding{File: decode.File, Line: pos.Line, Column: pos.Column, Severity: Error, Message: "invalid YAML: " + yerr.GetMessage()})
+	case r.Port != nil && len(faults) > 0:
+	default:
+		l.add(Finding{File: r.File, Severity: Error, Message: r.Err.Error()})
+	}
+}
+
+// sorted returns the findings by location, without duplicates: a mistake in a
+// _defaults.yaml is found once for every port it applies to.
+func (l *linter) sorted() []Finding {
+	out := []Finding{}
+	seen := map[Finding]bool{}
+	for _, f := range l.findings {
+		if !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Message < b.Message
+	})
+	return out
+}
+
+// validate checks p's effective manifest against the schema.
+func (l *linter) validate(p *port.Port) error {
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(p.Manifest, &doc); err != nil {
+		return fmt.Errorf("decode %s: %w", p.File, err)
+	}
+	// The validator takes JSON values; YAML's integers are not.
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", p.File, err)
+	}
+	v, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", p.File, err)
+	}
+
+	err = l.schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("validate %s: %w", p.File, err)
+	}
+	l.violations(p, verr)
+	return nil
+}
+
+var printer = message.NewPrinter(language.English)
+
+// violations adds a finding for each leaf of e, the most specific reasons the
+// manifest is invalid. An unknown key is located at the key itself.
+func (l *linter) violations(p *port.Port, e *jsonschema.ValidationError) {
+	if len(e.Causes) > 0 {
+		for _, c := range e.Causes {
+			l.violations(p, c)
+		}
+		return
+	}
+
+	path := e.InstanceLocation
+	if k, ok := e.ErrorKind.(*kind.AdditionalProperties); ok {
+		for _, name := range k.Properties {
+			key := append(append([]string{}, path...), name)
+			l.add(l.at(p, Error, key, "%s: unknown key %q", fieldPath(path), name))
+		}
+		return
+	}
+	l.add(l.at(p, Error, path, "%s: %s", fieldPath(path), e.ErrorKind.LocalizedString(printer)))
+}
+
+// fieldPath formats a path as in "build.tags[0]"; "." is the whole document.
+func fieldPath(path []string) string {
+	s := ""
+	for _, t := range path {
+		if _, err := strconv.Atoi(t); err == nil {
+			s += "[" + t + "]"
+			continue
+		}
+		if s != "" {
+			s += "."
+		}
+		s += t
+	}
+	if s == "" {
+		return "."
+	}
+	return s
+}
+
+// locate returns the position of the field at path in doc: of its key in a
+// mapping, of the item in a list.
+func locate(doc *ast.File, path []string) (int, int, bool) {
+	if doc == nil || len(doc.Docs) == 0 || doc.Docs[0].Body == nil {
+		return 0, 0, false
+	}
+	node := doc.Docs[0].Body
+	tok := node.GetToken()
+	for _, t := range path {
+		switch n := unwrap(node).(type) {
+		case *ast.MappingNode:
+			node = nil
+			for _, v := range n.Values {
+				if v.Key.GetToken().Value == t {
+					node, tok = v.Value, v.Key.GetToken()
+					break
+				}
+			}
+		case *ast.MappingValueNode:
+			node = nil
+			if n.Key.GetToken().Value == t {
+				node, tok = n.Value, n.Key.GetToken()
+			}
+		case *ast.SequenceNode:
+			node = nil
+			if i, err := strconv.Atoi(t); err == nil && i >= 0 && i < len(n.Values) {
+				node = n.Values[i]
+				tok = node.GetToken()
+			}
+		default:
+			node = nil
+		}
+		if node == nil {
+			return 0, 0, false
+		}
+	}
+	if tok == nil {
+		return 0, 0, false
+	}
+	return tok.Position.Line, tok.Position.Column, true
+}
+
+func unwrap(n ast.Node) ast.Node {
+	for {
+		switch v := n.(type) {
+		case *ast.AnchorNode:
+			n = v.Value
+		case *ast.TagNode:
+			n = v.Value
+		default:
+			return n
+		}
+	}
+}
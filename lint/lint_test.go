@@ -0,0 +1,359 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/lint"
+	"github.com/lesomnus/clade/port"
+)
+
+func write(t *testing.T, p string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func check(t *testing.T, root string) []string {
+	t.Helper()
+	loaded, err := (&port.Loader{Roots: []string{root}}).LoadEach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := lint.CheckLoaded(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, len(findings))
+	for i, f := range findings {
+		out[i] = strings.TrimPrefix(f.String(), root+string(filepath.Separator))
+	}
+	return out
+}
+
+func expect(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+const dockerfile = "ARG BASE\nFROM ${BASE}\n"
+
+func TestCheckInvalidPorts(t *testing.T) {
+	// A port that does not load does not end the lint: each mistake of every
+	// port is located, the misspelled key along with what it left missing.
+	root := t.TempDir()
+	write(t, filepath.Join(root, "a", "Dockerfile"), dockerfile)
+	write(t, filepath.Join(root, "a", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+bulid:
+  repo: me/a
+  tags: ["{{.Major}}"]
+`)
+	write(t, filepath.Join(root, "b", "Dockerfile"), dockerfile)
+	write(t, filepath.Join(root, "b", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+  last_minor: 2
+build:
+  repo: me/b
+  tags: ["{{.Major}}"]
+deprecate:
+  mode: delete
+`)
+	write(t, filepath.Join(root, "c", port.Filename), "source: [\n")
+
+	expect(t, check(t, root),
+		`a/port.yaml:1:1: error: build.repo is required`,
+		`a/port.yaml:6:1: error: .: unknown key "bulid"`,
+		`b/port.yaml:6:3: error: select: unknown key "last_minor"`,
+		`b/port.yaml:11:3: error: deprecate.mode: value must be one of 'tag', 'annotate'`,
+		`c/port.yaml:1:9: error: invalid YAML: sequence end token ']' not found`,
+	)
+}
+
+func TestCheckClean(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "golang", "Dockerfile"), dockerfile)
+	write(t, filepath.Join(root, "golang", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+  last-major: 1
+build:
+  repo: me/golang
+  tags: ["{{.Major}}.{{.Minor}}"]
+  platforms: [linux/amd64]
+test:
+  - run: [go, version]
+`)
+	expect(t, check(t, root))
+}
+
+func TestCheckSchema(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, port.DefaultsFilename), `build:
+  platfroms: [linux/amd64]
+`)
+	write(t, filepath.Join(root, "golang", "Dockerfile"), dockerfile)
+	write(t, filepath.Join(root, "golang", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+  last_major: 1
+  last-minor: two
+build:
+  repo: me/golang
+  tags: ["{{.Major}}"]
+`)
+	write(t, filepath.Join(root, "tool", "Dockerfile"), "FROM scratch\n")
+	write(t, filepath.Join(root, "tool", port.Filename), `source:
+  kind: http
+  url: https://example.com/version
+select:
+  kind: semver
+build:
+  kind: exec
+  repo: me/tool
+  tags: ["{{.Major}}"]
+  command: [make]
+  dockerfile: Dockerfile
+`)
+
+	// The unknown key of the defaults is reported once, where it is written.
+	expect(t, check(t, root),
+		"_defaults.yaml:2:3: error: build: unknown key \"platfroms\"",
+		"golang/port.yaml:6:3: error: select: unknown key \"last_major\"",
+		"golang/port.yaml:7:3: error: select.last-minor: got string, want integer",
+		"tool/port.yaml:11:3: error: build: unknown key \"dockerfile\"",
+	)
+}
+
+func TestCheckTemplates(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "python", "Dockerfile"), dockerfile)
+	write(t, filepath.Join(root, "python", port.Filename), `matrix:
+  variant: [alpine, slim]
+source:
+  kind: container
+  repo: docker.io/library/python
+select:
+  kind: semver
+  pre-release: '{{matrix "varaint"}}'
+build:
+  repo: me/python
+  tags:
+    - "{{.Major}}.{{.Minor}}-{{matrix \"variant\"}}"
+    - "{{.Major}}-{{matrix \"flavor\"}}"
+    - "{{.Major}"
+    - "{{.Major}}.{{.Minor}}-{{matrix \"variant\"}}"
+`)
+
+	expect(t, check(t, root),
+		"python/port.yaml:6:1: error: select: template: :2:16: executing \"\" at <matrix \"varaint\">: error calling matrix: no matrix key \"varaint\"",
+		"python/port.yaml:13:7: error: build.tags[1]: no matrix key \"flavor\"",
+		"python/port.yaml:14:7: error: build.tags[2]: template: :1: bad character U+007D '}'",
+		"python/port.yaml:15:7: error: build.tags[3] repeats build.tags[0]",
+	)
+}
+
+func TestCheckRepos(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"golang", "golang-mirror", "node"} {
+		write(t, filepath.Join(root, dir, "Dockerfile"), dockerfile)
+	}
+	write(t, filepath.Join(root, "golang", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/golang
+  tags: ["{{.Major}}.{{.Minor}}", "{{.Major}}"]
+`)
+	// Variants of a directory share the repository without a warning between
+	// them, and push different tags since their select mappings differ.
+	write(t, filepath.Join(root, "golang", "port.alpine.yaml"), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+  pre-release: alpine
+build:
+  repo: me/golang
+  tags: ["{{.Major}}.{{.Minor}}", "{{.Major}}"]
+`)
+	write(t, filepath.Join(root, "golang-mirror", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/golang
+  tags: ["{{.Major}}.{{.Minor}}.{{.Patch}}", "{{.Major}}"]
+`)
+	// Both families of node push the floating tag "{{.Major}}".
+	write(t, filepath.Join(root, "node", port.Filename), `matrix:
+  variant: [a, b]
+source:
+  kind: container
+  repo: docker.io/library/node
+select:
+  kind: semver
+build:
+  repo: me/node
+  tags: ["{{.Major}}-{{matrix \"variant\"}}", "{{.Major}}"]
+`)
+
+	expect(t, check(t, root),
+		"golang-mirror/port.yaml:7:3: warning: build.repo me/golang is also pushed to by port "+filepath.Join(root, "golang"),
+		"golang-mirror/port.yaml:8:46: error: build.tags[1] of "+filepath.Join(root, "golang-mirror")+" pushes the same tags to me/golang as build.tags[1] of "+filepath.Join(root, "golang"),
+		"golang/port.alpine.yaml:8:3: warning: build.repo me/golang is also pushed to by port "+filepath.Join(root, "golang-mirror"),
+		"golang/port.yaml:7:3: warning: build.repo me/golang is also pushed to by port "+filepath.Join(root, "golang-mirror"),
+		"node/port.yaml:10:47: error: build.tags[1] of "+filepath.Join(root, "node")+" {variant=b} pushes the same tags to me/node as build.tags[1] of "+filepath.Join(root, "node")+" {variant=a}",
+	)
+}
+
+func TestCheckCycle(t *testing.T) {
+	root := t.TempDir()
+	for _, pair := range [][2]string{{"a", "me/b"}, {"b", "me/c"}, {"c", "me/a"}, {"d", "me/a"}} {
+		write(t, filepath.Join(root, pair[0], "Dockerfile"), dockerfile)
+		write(t, filepath.Join(root, pair[0], port.Filename), `source:
+  kind: container
+  repo: `+pair[1]+`
+select:
+  kind: semver
+build:
+  repo: me/`+pair[0]+`
+  tags: ["{{.Major}}"]
+`)
+	}
+
+	a, b, c := filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "c")
+	expect(t, check(t, root),
+		"a/port.yaml:3:3: error: dependency cycle: "+a+" -> "+b+" -> "+c+" -> "+a+" (each built on the next)",
+	)
+}
+
+func TestCheckDockerfile(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "missing", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/missing
+  tags: ["{{.Major}}"]
+  dockerfile: build/Dockerfile
+`)
+	write(t, filepath.Join(root, "unused", "Dockerfile"), "# uses ${BASE} only in a comment\nARG BASE=golang \\\n  OTHER=1\nFROM golang\n")
+	write(t, filepath.Join(root, "unused", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/unused
+  tags: ["{{.Major}}"]
+`)
+	write(t, filepath.Join(root, "undeclared", "Dockerfile"), "FROM golang\n")
+	write(t, filepath.Join(root, "undeclared", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/undeclared
+  tags: ["{{.Major}}"]
+`)
+	write(t, filepath.Join(root, "http", "Dockerfile"), "FROM alpine\nRUN echo $BASE\n")
+	write(t, filepath.Join(root, "http", port.Filename), `source:
+  kind: http
+  url: https://example.com/version
+select:
+  kind: semver
+build:
+  repo: me/http
+  tags: ["{{.Major}}"]
+`)
+	// A template stands in for the Dockerfile the build renders.
+	write(t, filepath.Join(root, "tmpl", "Dockerfile.tmpl"), "FROM golang:{{.Major}}\n")
+	write(t, filepath.Join(root, "tmpl", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/tmpl
+  tags: ["{{.Major}}"]
+`)
+	// exec builds without a Dockerfile.
+	write(t, filepath.Join(root, "exec", port.Filename), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  kind: exec
+  repo: me/exec
+  tags: ["{{.Major}}"]
+  command: [make]
+`)
+
+	expect(t, check(t, root),
+		"http/Dockerfile:2:1: warning: BASE is not set for source kind \"http\"; set FROM directly",
+		"missing/port.yaml:9:3: error: Dockerfile "+filepath.Join(root, "missing", "build", "Dockerfile")+" does not exist",
+		"tmpl/port.yaml:1:1: warning: "+filepath.Join(root, "tmpl", "Dockerfile.tmpl")+" does not declare ARG BASE; the base image docker.io/library/golang is not built on",
+		"undeclared/port.yaml:1:1: warning: "+filepath.Join(root, "undeclared", "Dockerfile")+" does not declare ARG BASE; the base image docker.io/library/golang is not built on",
+		"unused/Dockerfile:2:1: warning: ARG BASE is declared but never used; the base image is not built on",
+	)
+}
+
+func TestSchemaJSON(t *testing.T) {
+	data, err := lint.SchemaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		ID         string `json:"$id"`
+		Properties map[string]struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != lint.SchemaID {
+		t.Errorf("$id = %q", s.ID)
+	}
+	// Every registered kind is offered.
+	kinds := map[string]string{
+		"source": "container,http",
+		"select": "calver,semver",
+		"build":  "bake,build,buildah,exec,podman",
+	}
+	for section, want := range kinds {
+		got := strings.Join(s.Properties[section].Properties["kind"].Enum, ",")
+		if got != want {
+			t.Errorf("%s kinds = %s, want %s", section, got, want)
+		}
+	}
+}
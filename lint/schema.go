@@ -0,0 +1,172 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lesomnus/clade/builder"
+	"github.com/lesomnus/clade/compare"
+	"github.com/lesomnus/clade/smoke"
+	"github.com/lesomnus/clade/source"
+	"github.com/lesomnus/clade/tag"
+)
+
+// SchemaID is the $id of the port schema.
+const SchemaID = "https://github.com/lesomnus/clade/port.schema.json"
+
+// Schema assembles the JSON Schema of a port manifest. The source, select,
+// compare and build mappings are checked against the schema their kind
+// registered (see source.RegisterSchema and its siblings), so a kind added to
+// a registry is linted and completed without changes here.
+//
+// No field is required at the top level, nor a kind in a source, select or
+// build mapping: a port.yaml may get them from the defaults or the port it
+// extends. Loading a port checks the merged result for them.
+func Schema() (map[string]any, error) {
+	sources, err := kinded("source", source.Schemas(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	selects, err := kinded("select", tag.Schemas(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	compares, err := kinded("compare", compare.Schemas(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	compares["required"] = []any{"kind"}
+	builds, err := kinded("build", builder.Schemas(), map[string]any{
+		"repo": map[string]any{
+			"type":        "string",
+			"description": "repository the image is pushed to",
+		},
+		"tags": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string", "minLength": 1},
+			"minItems":    1,
+			"description": "templates of the tags of the image, rendered with each selected version; the first is canonical",
+		},
+	}, "build")
+	if err != nil {
+		return nil, err
+	}
+	step := map[string]any{}
+	if err := json.Unmarshal([]byte(smoke.StepSchema), &step); err != nil {
+		return nil, fmt.Errorf("test step schema: %w", err)
+	}
+
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         SchemaID,
+		"title":       "clade port",
+		"description": "A port manifest (port.yaml, port.<variant>.yaml or _defaults.yaml).",
+		"type":        "object",
+		"properties": map[string]any{
+			"name": map[string]any{
+				"type":        "string",
+				"description": "display name (default: the directory name)",
+			},
+			"extends": map[string]any{
+				"type":        "string",
+				"description": "port whose fields this one inherits, relative to its directory",
+			},
+			"matrix": map[string]any{
+				"type":          "object",
+				"description":   "values to expand the port over, one node family per combination",
+				"propertyNames": map[string]any{"pattern": "^[a-z][a-z0-9-]*$"},
+				"additionalProperties": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": []any{"string", "number"}},
+					"minItems":    1,
+					"uniqueItems": true,
+				},
+			},
+			"source":  sources,
+			"select":  selects,
+			"compare": map[string]any{"type": "array", "items": compares},
+			"build":   builds,
+			"test":    map[string]any{"type": "array", "items": step},
+			"deprecate": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"mode": map[string]any{"enum": []any{"tag", "annotate"}},
+				},
+				"additionalProperties": false,
+			},
+		},
+		"additionalProperties": false,
+	}, nil
+}
+
+// SchemaJSON returns Schema as indented JSON, to save for an editor.
+func SchemaJSON() ([]byte, error) {
+	s, err := Schema()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return nil, fmt.Errorf("encode port schema: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// kinded returns the schema of a mapping configured by kind. Each kind's own
+// schema applies when its kind is set (or, for the fallback kind, when none
+// is), with common and kind added to its fields; a schema that lists its fields
+// rejects any other. Each becomes a resource of its own, "<section>/<kind>",
+// so its "#/$defs" references resolve within it.
+func kinded(section string, schemas map[string]json.RawMessage, common map[string]any, fallback string) (map[string]any, error) {
+	kinds := make([]string, 0, len(schemas))
+	for k := range schemas {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	enum := make([]any, len(kinds))
+	all_of := make([]any, len(kinds))
+	for i, k := range kinds {
+		enum[i] = k
+
+		s := map[string]any{}
+		if err := json.Unmarshal(schemas[k], &s); err != nil {
+			return nil, fmt.Errorf("schema of %s kind %q: %w", section, k, err)
+		}
+		s["$id"] = section + "/" + k
+		s["type"] = "object"
+		if props, ok := s["properties"].(map[string]any); ok {
+			for name, p := range common {
+				props[name] = p
+			}
+			props["kind"] = map[string]any{"const": k}
+			if _, ok := s["additionalProperties"]; !ok {
+				s["additionalProperties"] = false
+			}
+		}
+
+		cond := any(map[string]any{
+			"properties": map[string]any{"kind": map[string]any{"const": k}},
+			"required":   []any{"kind"},
+		})
+		if k == fallback {
+			cond = map[string]any{"anyOf": []any{cond, map[string]any{"not": map[string]any{"required": []any{"kind"}}}}}
+		}
+		all_of[i] = map[string]any{"if": cond, "then": s}
+	}
+
+	props := map[string]any{"kind": map[string]any{"enum": enum}}
+	for name, p := range common {
+		props[name] = p
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": props,
+		"allOf":      all_of,
+	}, nil
+}
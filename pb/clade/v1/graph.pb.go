@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.11
+// 	protoc-gen-go v1.36.12
 // 	protoc        (unknown)
 // source: clade/v1/graph.proto
 
@@ -105,7 +105,7 @@ func (x *Image) GetLabels() map[string]string {
 }
 
 // Node is a buildable target image in the dependency graph. How it is built
-// (Dockerfile, context, buildx options, ...) is read from the port's port.yaml
+// (Dockerfile, context, buildx options, ...) is read from the port's manifest
 // at build time, so only the identity and dependency information is carried here.
 type Node struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -117,7 +117,8 @@ type Node struct {
 	// Reference of the upstream (base) image, "repo:tag".
 	// Passed to the build as the BASE build argument.
 	Base string `protobuf:"bytes,3,opt,name=base,proto3" json:"base,omitempty"`
-	// Directory of the port that produces this image.
+	// Id of the port that produces this image: its directory, suffixed with
+	// ":<variant>" when it is read from port.<variant>.yaml.
 	Port string `protobuf:"bytes,4,opt,name=port,proto3" json:"port,omitempty"`
 	// Node ids of internal parents (i.e. bases that are themselves built by clade).
 	// Empty when the base is an external upstream image.
@@ -133,7 +134,11 @@ type Node struct {
 	// The selected upstream tag this node was expanded from, e.g. "1.22.3-alpine"
 	// for a container source or "1.2.3" for an http source. Passed to the build
 	// as the BASE_TAG build argument for every source kind.
-	BaseTag       string `protobuf:"bytes,8,opt,name=base_tag,json=baseTag,proto3" json:"base_tag,omitempty"`
+	BaseTag string `protobuf:"bytes,8,opt,name=base_tag,json=baseTag,proto3" json:"base_tag,omitempty"`
+	// The port's matrix values this node was expanded with, e.g.
+	// {"variant": "alpine"}. Empty for a port without a matrix. Passed to the
+	// build as build arguments named after the upper-cased keys.
+	Matrix        map[string]string `protobuf:"bytes,9,rep,name=matrix,proto3" json:"matrix,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -224,11 +229,25 @@ func (x *Node) GetBaseTag() string {
 	return ""
 }
 
+func (x *Node) GetMatrix() map[string]string {
+	if x != nil {
+		return x.Matrix
+	}
+	return nil
+}
+
 // Graph is a serializable dependency graph of build target images.
 // Nodes are ordered topologically (parents before children).
 type Graph struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Nodes         []*Node                `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Nodes []*Node                `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	// How and from what the graph was computed. Absent in graphs written before
+	// it was introduced.
+	Metadata *Metadata `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// Version lines of the ports opting in to `deprecate` that fell out of
+	// selection and are not yet marked end-of-life. Only `clade outdated` sets
+	// them.
+	Dropped       []*DroppedLine `protobuf:"bytes,3,rep,name=dropped,proto3" json:"dropped,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -270,6 +289,187 @@ func (x *Graph) GetNodes() []*Node {
 	return nil
 }
 
+func (x *Graph) GetMetadata() *Metadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Graph) GetDropped() []*DroppedLine {
+	if x != nil {
+		return x.Dropped
+	}
+	return nil
+}
+
+// DroppedLine is a version line that fell out of selection, identified by the
+// last image built for it.
+type DroppedLine struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Id of the port that built the line.
+	Port string `protobuf:"bytes,1,opt,name=port,proto3" json:"port,omitempty"`
+	Repo string `protobuf:"bytes,2,opt,name=repo,proto3" json:"repo,omitempty"`
+	// The image's tags, sorted; none is produced by the port anymore.
+	Tags          []string `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Digest        string   `protobuf:"bytes,4,opt,name=digest,proto3" json:"digest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DroppedLine) Reset() {
+	*x = DroppedLine{}
+	mi := &file_clade_v1_graph_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DroppedLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DroppedLine) ProtoMessage() {}
+
+func (x *DroppedLine) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_graph_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DroppedLine.ProtoReflect.Descriptor instead.
+func (*DroppedLine) Descriptor() ([]byte, []int) {
+	return file_clade_v1_graph_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DroppedLine) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *DroppedLine) GetRepo() string {
+	if x != nil {
+		return x.Repo
+	}
+	return ""
+}
+
+func (x *DroppedLine) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *DroppedLine) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+// Metadata records what a graph was computed from, so a saved graph can be
+// checked against the ports before it is used.
+type Metadata struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Version of this schema. A reader refuses a graph of a newer version.
+	SchemaVersion uint32 `protobuf:"varint,1,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// When the graph was computed.
+	GeneratedAt *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=generated_at,json=generatedAt,proto3" json:"generated_at,omitempty"`
+	// Version of the clade that computed the graph.
+	CladeVersion string `protobuf:"bytes,3,opt,name=clade_version,json=cladeVersion,proto3" json:"clade_version,omitempty"`
+	// The ports roots the graph was computed from.
+	PortRoots []string `protobuf:"bytes,7,rep,name=port_roots,json=portRoots,proto3" json:"port_roots,omitempty"`
+	// Hex SHA-256 of each port's manifest, keyed by the port id (as in
+	// Node.port). Covers every port of port_roots, not only those with nodes.
+	PortHashes map[string]string `protobuf:"bytes,5,rep,name=port_hashes,json=portHashes,proto3" json:"port_hashes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// The settings of the effective configuration the graph is computed from,
+	// as YAML: ports, ports-ignore, defaults, cache.ttl and build.partials.
+	// Nothing else of the configuration, which may hold secrets, is recorded.
+	Config        string `protobuf:"bytes,6,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metadata) Reset() {
+	*x = Metadata{}
+	mi := &file_clade_v1_graph_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metadata) ProtoMessage() {}
+
+func (x *Metadata) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_graph_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metadata.ProtoReflect.Descriptor instead.
+func (*Metadata) Descriptor() ([]byte, []int) {
+	return file_clade_v1_graph_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Metadata) GetSchemaVersion() uint32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *Metadata) GetGeneratedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.GeneratedAt
+	}
+	return nil
+}
+
+func (x *Metadata) GetCladeVersion() string {
+	if x != nil {
+		return x.CladeVersion
+	}
+	return ""
+}
+
+func (x *Metadata) GetPortRoots() []string {
+	if x != nil {
+		return x.PortRoots
+	}
+	return nil
+}
+
+func (x *Metadata) GetPortHashes() map[string]string {
+	if x != nil {
+		return x.PortHashes
+	}
+	return nil
+}
+
+func (x *Metadata) GetConfig() string {
+	if x != nil {
+		return x.Config
+	}
+	return ""
+}
+
 var File_clade_v1_graph_proto protoreflect.FileDescriptor
 
 const file_clade_v1_graph_proto_rawDesc = "" +
@@ -283,7 +483,7 @@ const file_clade_v1_graph_proto_rawDesc = "" +
 	"\x06labels\x18\x05 \x03(\v2\x1b.clade.v1.Image.LabelsEntryR\x06labels\x1a9\n" +
 	"\vLabelsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xca\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb9\x02\n" +
 	"\x04Node\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12%\n" +
 	"\x05image\x18\x02 \x01(\v2\x0f.clade.v1.ImageR\x05image\x12\x12\n" +
@@ -292,9 +492,32 @@ const file_clade_v1_graph_proto_rawDesc = "" +
 	"\aparents\x18\x05 \x03(\tR\aparents\x12\x1a\n" +
 	"\boutdated\x18\x06 \x01(\bR\boutdated\x12\x12\n" +
 	"\x04tags\x18\a \x03(\tR\x04tags\x12\x19\n" +
-	"\bbase_tag\x18\b \x01(\tR\abaseTag\"-\n" +
+	"\bbase_tag\x18\b \x01(\tR\abaseTag\x122\n" +
+	"\x06matrix\x18\t \x03(\v2\x1a.clade.v1.Node.MatrixEntryR\x06matrix\x1a9\n" +
+	"\vMatrixEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8e\x01\n" +
 	"\x05Graph\x12$\n" +
-	"\x05nodes\x18\x01 \x03(\v2\x0e.clade.v1.NodeR\x05nodesB/Z-github.com/lesomnus/clade/pb/clade/v1;cladev1b\x06proto3"
+	"\x05nodes\x18\x01 \x03(\v2\x0e.clade.v1.NodeR\x05nodes\x12.\n" +
+	"\bmetadata\x18\x02 \x01(\v2\x12.clade.v1.MetadataR\bmetadata\x12/\n" +
+	"\adropped\x18\x03 \x03(\v2\x15.clade.v1.DroppedLineR\adropped\"a\n" +
+	"\vDroppedLine\x12\x12\n" +
+	"\x04port\x18\x01 \x01(\tR\x04port\x12\x12\n" +
+	"\x04repo\x18\x02 \x01(\tR\x04repo\x12\x12\n" +
+	"\x04tags\x18\x03 \x03(\tR\x04tags\x12\x16\n" +
+	"\x06digest\x18\x04 \x01(\tR\x06digest\"\xe1\x02\n" +
+	"\bMetadata\x12%\n" +
+	"\x0eschema_version\x18\x01 \x01(\rR\rschemaVersion\x12=\n" +
+	"\fgenerated_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\vgeneratedAt\x12#\n" +
+	"\rclade_version\x18\x03 \x01(\tR\fcladeVersion\x12\x1d\n" +
+	"\n" +
+	"port_roots\x18\a \x03(\tR\tportRoots\x12C\n" +
+	"\vport_hashes\x18\x05 \x03(\v2\".clade.v1.Metadata.PortHashesEntryR\n" +
+	"portHashes\x12\x16\n" +
+	"\x06config\x18\x06 \x01(\tR\x06config\x1a=\n" +
+	"\x0fPortHashesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01J\x04\b\x04\x10\x05R\tports_dirB/Z-github.com/lesomnus/clade/pb/clade/v1;cladev1b\x06proto3"
 
 var (
 	file_clade_v1_graph_proto_rawDescOnce sync.Once
@@ -308,24 +531,33 @@ func file_clade_v1_graph_proto_rawDescGZIP() []byte {
 	return file_clade_v1_graph_proto_rawDescData
 }
 
-var file_clade_v1_graph_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_clade_v1_graph_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_clade_v1_graph_proto_goTypes = []any{
 	(*Image)(nil),                 // 0: clade.v1.Image
 	(*Node)(nil),                  // 1: clade.v1.Node
 	(*Graph)(nil),                 // 2: clade.v1.Graph
-	nil,                           // 3: clade.v1.Image.LabelsEntry
-	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+	(*DroppedLine)(nil),           // 3: clade.v1.DroppedLine
+	(*Metadata)(nil),              // 4: clade.v1.Metadata
+	nil,                           // 5: clade.v1.Image.LabelsEntry
+	nil,                           // 6: clade.v1.Node.MatrixEntry
+	nil,                           // 7: clade.v1.Metadata.PortHashesEntry
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
 }
 var file_clade_v1_graph_proto_depIdxs = []int32{
-	4, // 0: clade.v1.Image.created:type_name -> google.protobuf.Timestamp
-	3, // 1: clade.v1.Image.labels:type_name -> clade.v1.Image.LabelsEntry
+	8, // 0: clade.v1.Image.created:type_name -> google.protobuf.Timestamp
+	5, // 1: clade.v1.Image.labels:type_name -> clade.v1.Image.LabelsEntry
 	0, // 2: clade.v1.Node.image:type_name -> clade.v1.Image
-	1, // 3: clade.v1.Graph.nodes:type_name -> clade.v1.Node
-	4, // [4:4] is the sub-list for method output_type
-	4, // [4:4] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	6, // 3: clade.v1.Node.matrix:type_name -> clade.v1.Node.MatrixEntry
+	1, // 4: clade.v1.Graph.nodes:type_name -> clade.v1.Node
+	4, // 5: clade.v1.Graph.metadata:type_name -> clade.v1.Metadata
+	3, // 6: clade.v1.Graph.dropped:type_name -> clade.v1.DroppedLine
+	8, // 7: clade.v1.Metadata.generated_at:type_name -> google.protobuf.Timestamp
+	7, // 8: clade.v1.Metadata.port_hashes:type_name -> clade.v1.Metadata.PortHashesEntry
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_clade_v1_graph_proto_init() }
@@ -339,7 +571,7 @@ func file_clade_v1_graph_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clade_v1_graph_proto_rawDesc), len(file_clade_v1_graph_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
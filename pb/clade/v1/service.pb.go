@@ -0,0 +1,874 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: clade/v1/service.proto
+
+package cladev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Reason is why a node is outdated or up to date.
+type Reason int32
+
+const (
+	Reason_REASON_UNSPECIFIED Reason = 0
+	// The target is present and its base has not changed since it was built.
+	Reason_REASON_UP_TO_DATE Reason = 1
+	// The target image does not exist.
+	Reason_REASON_MISSING Reason = 2
+	// A node it is built on is outdated, so it is rebuilt after that one.
+	Reason_REASON_PARENT_OUTDATED Reason = 3
+	// The port's compare chain judged the base newer than the target.
+	Reason_REASON_BASE_CHANGED Reason = 4
+)
+
+// Enum value maps for Reason.
+var (
+	Reason_name = map[int32]string{
+		0: "REASON_UNSPECIFIED",
+		1: "REASON_UP_TO_DATE",
+		2: "REASON_MISSING",
+		3: "REASON_PARENT_OUTDATED",
+		4: "REASON_BASE_CHANGED",
+	}
+	Reason_value = map[string]int32{
+		"REASON_UNSPECIFIED":     0,
+		"REASON_UP_TO_DATE":      1,
+		"REASON_MISSING":         2,
+		"REASON_PARENT_OUTDATED": 3,
+		"REASON_BASE_CHANGED":    4,
+	}
+)
+
+func (x Reason) Enum() *Reason {
+	p := new(Reason)
+	*p = x
+	return p
+}
+
+func (x Reason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Reason) Descriptor() protoreflect.EnumDescriptor {
+	return file_clade_v1_service_proto_enumTypes[0].Descriptor()
+}
+
+func (Reason) Type() protoreflect.EnumType {
+	return &file_clade_v1_service_proto_enumTypes[0]
+}
+
+func (x Reason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Reason.Descriptor instead.
+func (Reason) EnumDescriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{0}
+}
+
+type BuildEvent_State int32
+
+const (
+	BuildEvent_STATE_UNSPECIFIED BuildEvent_State = 0
+	BuildEvent_STATE_STARTED     BuildEvent_State = 1
+	BuildEvent_STATE_SUCCEEDED   BuildEvent_State = 2
+	BuildEvent_STATE_FAILED      BuildEvent_State = 3
+	// Not built because a node it is built on failed.
+	BuildEvent_STATE_SKIPPED BuildEvent_State = 4
+)
+
+// Enum value maps for BuildEvent_State.
+var (
+	BuildEvent_State_name = map[int32]string{
+		0: "STATE_UNSPECIFIED",
+		1: "STATE_STARTED",
+		2: "STATE_SUCCEEDED",
+		3: "STATE_FAILED",
+		4: "STATE_SKIPPED",
+	}
+	BuildEvent_State_value = map[string]int32{
+		"STATE_UNSPECIFIED": 0,
+		"STATE_STARTED":     1,
+		"STATE_SUCCEEDED":   2,
+		"STATE_FAILED":      3,
+		"STATE_SKIPPED":     4,
+	}
+)
+
+func (x BuildEvent_State) Enum() *BuildEvent_State {
+	p := new(BuildEvent_State)
+	*p = x
+	return p
+}
+
+func (x BuildEvent_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BuildEvent_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_clade_v1_service_proto_enumTypes[1].Descriptor()
+}
+
+func (BuildEvent_State) Type() protoreflect.EnumType {
+	return &file_clade_v1_service_proto_enumTypes[1]
+}
+
+func (x BuildEvent_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BuildEvent_State.Descriptor instead.
+func (BuildEvent_State) EnumDescriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{10, 0}
+}
+
+type GetGraphRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Compute the graph anew instead of returning the last cycle's.
+	Refresh       bool `protobuf:"varint,1,opt,name=refresh,proto3" json:"refresh,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGraphRequest) Reset() {
+	*x = GetGraphRequest{}
+	mi := &file_clade_v1_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGraphRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGraphRequest) ProtoMessage() {}
+
+func (x *GetGraphRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGraphRequest.ProtoReflect.Descriptor instead.
+func (*GetGraphRequest) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetGraphRequest) GetRefresh() bool {
+	if x != nil {
+		return x.Refresh
+	}
+	return false
+}
+
+type GetGraphResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Graph         *Graph                 `protobuf:"bytes,1,opt,name=graph,proto3" json:"graph,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetGraphResponse) Reset() {
+	*x = GetGraphResponse{}
+	mi := &file_clade_v1_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetGraphResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetGraphResponse) ProtoMessage() {}
+
+func (x *GetGraphResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetGraphResponse.ProtoReflect.Descriptor instead.
+func (*GetGraphResponse) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetGraphResponse) GetGraph() *Graph {
+	if x != nil {
+		return x.Graph
+	}
+	return nil
+}
+
+// ListOutdatedRequest narrows the nodes as the filter flags of `clade
+// outdated` do. Every outdated node is listed when it is empty.
+type ListOutdatedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Globs of ports, as --port.
+	Ports []string `protobuf:"bytes,1,rep,name=ports,proto3" json:"ports,omitempty"`
+	// Globs of target repositories, as --repo.
+	Repos []string `protobuf:"bytes,2,rep,name=repos,proto3" json:"repos,omitempty"`
+	// Selection expression, as --select.
+	Select        string `protobuf:"bytes,3,opt,name=select,proto3" json:"select,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOutdatedRequest) Reset() {
+	*x = ListOutdatedRequest{}
+	mi := &file_clade_v1_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOutdatedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOutdatedRequest) ProtoMessage() {}
+
+func (x *ListOutdatedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOutdatedRequest.ProtoReflect.Descriptor instead.
+func (*ListOutdatedRequest) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListOutdatedRequest) GetPorts() []string {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+func (x *ListOutdatedRequest) GetRepos() []string {
+	if x != nil {
+		return x.Repos
+	}
+	return nil
+}
+
+func (x *ListOutdatedRequest) GetSelect() string {
+	if x != nil {
+		return x.Select
+	}
+	return ""
+}
+
+type ListOutdatedResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Outdated nodes, parents before children.
+	Nodes []*Node `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	// When the graph was computed.
+	GeneratedAt   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=generated_at,json=generatedAt,proto3" json:"generated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOutdatedResponse) Reset() {
+	*x = ListOutdatedResponse{}
+	mi := &file_clade_v1_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOutdatedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOutdatedResponse) ProtoMessage() {}
+
+func (x *ListOutdatedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOutdatedResponse.ProtoReflect.Descriptor instead.
+func (*ListOutdatedResponse) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListOutdatedResponse) GetNodes() []*Node {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *ListOutdatedResponse) GetGeneratedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.GeneratedAt
+	}
+	return nil
+}
+
+type ExplainRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Node id, or any of its tags.
+	Node          string `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainRequest) Reset() {
+	*x = ExplainRequest{}
+	mi := &file_clade_v1_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainRequest) ProtoMessage() {}
+
+func (x *ExplainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainRequest.ProtoReflect.Descriptor instead.
+func (*ExplainRequest) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExplainRequest) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+type ExplainResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Node   *Node                  `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	Reason Reason                 `protobuf:"varint,2,opt,name=reason,proto3,enum=clade.v1.Reason" json:"reason,omitempty"`
+	// The reason in a sentence, e.g. "the base ghcr.io/me/golang:1.22 is
+	// outdated".
+	Detail string `protobuf:"bytes,3,opt,name=detail,proto3" json:"detail,omitempty"`
+	// Outdated nodes it is built on, nearest first, for REASON_PARENT_OUTDATED.
+	OutdatedAncestors []string `protobuf:"bytes,4,rep,name=outdated_ancestors,json=outdatedAncestors,proto3" json:"outdated_ancestors,omitempty"`
+	// Nodes built on it, which are rebuilt with it.
+	Descendants   []string `protobuf:"bytes,5,rep,name=descendants,proto3" json:"descendants,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExplainResponse) Reset() {
+	*x = ExplainResponse{}
+	mi := &file_clade_v1_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExplainResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainResponse) ProtoMessage() {}
+
+func (x *ExplainResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainResponse.ProtoReflect.Descriptor instead.
+func (*ExplainResponse) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExplainResponse) GetNode() *Node {
+	if x != nil {
+		return x.Node
+	}
+	return nil
+}
+
+func (x *ExplainResponse) GetReason() Reason {
+	if x != nil {
+		return x.Reason
+	}
+	return Reason_REASON_UNSPECIFIED
+}
+
+func (x *ExplainResponse) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *ExplainResponse) GetOutdatedAncestors() []string {
+	if x != nil {
+		return x.OutdatedAncestors
+	}
+	return nil
+}
+
+func (x *ExplainResponse) GetDescendants() []string {
+	if x != nil {
+		return x.Descendants
+	}
+	return nil
+}
+
+type TriggerBuildRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Node ids or tags to build, whether outdated or not. Every outdated node
+	// when empty.
+	Nodes         []string `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerBuildRequest) Reset() {
+	*x = TriggerBuildRequest{}
+	mi := &file_clade_v1_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerBuildRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerBuildRequest) ProtoMessage() {}
+
+func (x *TriggerBuildRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerBuildRequest.ProtoReflect.Descriptor instead.
+func (*TriggerBuildRequest) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TriggerBuildRequest) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type TriggerBuildResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Ids of the nodes queued, parents before children.
+	Nodes         []string `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerBuildResponse) Reset() {
+	*x = TriggerBuildResponse{}
+	mi := &file_clade_v1_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerBuildResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerBuildResponse) ProtoMessage() {}
+
+func (x *TriggerBuildResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerBuildResponse.ProtoReflect.Descriptor instead.
+func (*TriggerBuildResponse) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TriggerBuildResponse) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type WatchBuildsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only events of these node ids. Every node's when empty.
+	Nodes         []string `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchBuildsRequest) Reset() {
+	*x = WatchBuildsRequest{}
+	mi := &file_clade_v1_service_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchBuildsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchBuildsRequest) ProtoMessage() {}
+
+func (x *WatchBuildsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchBuildsRequest.ProtoReflect.Descriptor instead.
+func (*WatchBuildsRequest) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchBuildsRequest) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+type WatchBuildsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *BuildEvent            `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchBuildsResponse) Reset() {
+	*x = WatchBuildsResponse{}
+	mi := &file_clade_v1_service_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchBuildsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchBuildsResponse) ProtoMessage() {}
+
+func (x *WatchBuildsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchBuildsResponse.ProtoReflect.Descriptor instead.
+func (*WatchBuildsResponse) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WatchBuildsResponse) GetEvent() *BuildEvent {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+// BuildEvent is a step of a node's build.
+type BuildEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// Node id.
+	Node string `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	// Id of the node's port.
+	Port  string           `protobuf:"bytes,3,opt,name=port,proto3" json:"port,omitempty"`
+	State BuildEvent_State `protobuf:"varint,4,opt,name=state,proto3,enum=clade.v1.BuildEvent_State" json:"state,omitempty"`
+	// Why the build failed or was skipped.
+	Error         string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuildEvent) Reset() {
+	*x = BuildEvent{}
+	mi := &file_clade_v1_service_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuildEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildEvent) ProtoMessage() {}
+
+func (x *BuildEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_clade_v1_service_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildEvent.ProtoReflect.Descriptor instead.
+func (*BuildEvent) Descriptor() ([]byte, []int) {
+	return file_clade_v1_service_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *BuildEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *BuildEvent) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *BuildEvent) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *BuildEvent) GetState() BuildEvent_State {
+	if x != nil {
+		return x.State
+	}
+	return BuildEvent_STATE_UNSPECIFIED
+}
+
+func (x *BuildEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_clade_v1_service_proto protoreflect.FileDescriptor
+
+const file_clade_v1_service_proto_rawDesc = "" +
+	"\n" +
+	"\x16clade/v1/service.proto\x12\bclade.v1\x1a\x14clade/v1/graph.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"+\n" +
+	"\x0fGetGraphRequest\x12\x18\n" +
+	"\arefresh\x18\x01 \x01(\bR\arefresh\"9\n" +
+	"\x10GetGraphResponse\x12%\n" +
+	"\x05graph\x18\x01 \x01(\v2\x0f.clade.v1.GraphR\x05graph\"Y\n" +
+	"\x13ListOutdatedRequest\x12\x14\n" +
+	"\x05ports\x18\x01 \x03(\tR\x05ports\x12\x14\n" +
+	"\x05repos\x18\x02 \x03(\tR\x05repos\x12\x16\n" +
+	"\x06select\x18\x03 \x01(\tR\x06select\"{\n" +
+	"\x14ListOutdatedResponse\x12$\n" +
+	"\x05nodes\x18\x01 \x03(\v2\x0e.clade.v1.NodeR\x05nodes\x12=\n" +
+	"\fgenerated_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\vgeneratedAt\"$\n" +
+	"\x0eExplainRequest\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\"\xc8\x01\n" +
+	"\x0fExplainResponse\x12\"\n" +
+	"\x04node\x18\x01 \x01(\v2\x0e.clade.v1.NodeR\x04node\x12(\n" +
+	"\x06reason\x18\x02 \x01(\x0e2\x10.clade.v1.ReasonR\x06reason\x12\x16\n" +
+	"\x06detail\x18\x03 \x01(\tR\x06detail\x12-\n" +
+	"\x12outdated_ancestors\x18\x04 \x03(\tR\x11outdatedAncestors\x12 \n" +
+	"\vdescendants\x18\x05 \x03(\tR\vdescendants\"+\n" +
+	"\x13TriggerBuildRequest\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\",\n" +
+	"\x14TriggerBuildResponse\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\"*\n" +
+	"\x12WatchBuildsRequest\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\"A\n" +
+	"\x13WatchBuildsResponse\x12*\n" +
+	"\x05event\x18\x01 \x01(\v2\x14.clade.v1.BuildEventR\x05event\"\x99\x02\n" +
+	"\n" +
+	"BuildEvent\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04node\x18\x02 \x01(\tR\x04node\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\tR\x04port\x120\n" +
+	"\x05state\x18\x04 \x01(\x0e2\x1a.clade.v1.BuildEvent.StateR\x05state\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"k\n" +
+	"\x05State\x12\x15\n" +
+	"\x11STATE_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rSTATE_STARTED\x10\x01\x12\x13\n" +
+	"\x0fSTATE_SUCCEEDED\x10\x02\x12\x10\n" +
+	"\fSTATE_FAILED\x10\x03\x12\x11\n" +
+	"\rSTATE_SKIPPED\x10\x04*\x80\x01\n" +
+	"\x06Reason\x12\x16\n" +
+	"\x12REASON_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11REASON_UP_TO_DATE\x10\x01\x12\x12\n" +
+	"\x0eREASON_MISSING\x10\x02\x12\x1a\n" +
+	"\x16REASON_PARENT_OUTDATED\x10\x03\x12\x17\n" +
+	"\x13REASON_BASE_CHANGED\x10\x042\xfd\x02\n" +
+	"\fCladeService\x12A\n" +
+	"\bGetGraph\x12\x19.clade.v1.GetGraphRequest\x1a\x1a.clade.v1.GetGraphResponse\x12M\n" +
+	"\fListOutdated\x12\x1d.clade.v1.ListOutdatedRequest\x1a\x1e.clade.v1.ListOutdatedResponse\x12>\n" +
+	"\aExplain\x12\x18.clade.v1.ExplainRequest\x1a\x19.clade.v1.ExplainResponse\x12M\n" +
+	"\fTriggerBuild\x12\x1d.clade.v1.TriggerBuildRequest\x1a\x1e.clade.v1.TriggerBuildResponse\x12L\n" +
+	"\vWatchBuilds\x12\x1c.clade.v1.WatchBuildsRequest\x1a\x1d.clade.v1.WatchBuildsResponse0\x01B/Z-github.com/lesomnus/clade/pb/clade/v1;cladev1b\x06proto3"
+
+var (
+	file_clade_v1_service_proto_rawDescOnce sync.Once
+	file_clade_v1_service_proto_rawDescData []byte
+)
+
+func file_clade_v1_service_proto_rawDescGZIP() []byte {
+	file_clade_v1_service_proto_rawDescOnce.Do(func() {
+		file_clade_v1_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_clade_v1_service_proto_rawDesc), len(file_clade_v1_service_proto_rawDesc)))
+	})
+	return file_clade_v1_service_proto_rawDescData
+}
+
+var file_clade_v1_service_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_clade_v1_service_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_clade_v1_service_proto_goTypes = []any{
+	(Reason)(0),                   // 0: clade.v1.Reason
+	(BuildEvent_State)(0),         // 1: clade.v1.BuildEvent.State
+	(*GetGraphRequest)(nil),       // 2: clade.v1.GetGraphRequest
+	(*GetGraphResponse)(nil),      // 3: clade.v1.GetGraphResponse
+	(*ListOutdatedRequest)(nil),   // 4: clade.v1.ListOutdatedRequest
+	(*ListOutdatedResponse)(nil),  // 5: clade.v1.ListOutdatedResponse
+	(*ExplainRequest)(nil),        // 6: clade.v1.ExplainRequest
+	(*ExplainResponse)(nil),       // 7: clade.v1.ExplainResponse
+	(*TriggerBuildRequest)(nil),   // 8: clade.v1.TriggerBuildRequest
+	(*TriggerBuildResponse)(nil),  // 9: clade.v1.TriggerBuildResponse
+	(*WatchBuildsRequest)(nil),    // 10: clade.v1.WatchBuildsRequest
+	(*WatchBuildsResponse)(nil),   // 11: clade.v1.WatchBuildsResponse
+	(*BuildEvent)(nil),            // 12: clade.v1.BuildEvent
+	(*Graph)(nil),                 // 13: clade.v1.Graph
+	(*Node)(nil),                  // 14: clade.v1.Node
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_clade_v1_service_proto_depIdxs = []int32{
+	13, // 0: clade.v1.GetGraphResponse.graph:type_name -> clade.v1.Graph
+	14, // 1: clade.v1.ListOutdatedResponse.nodes:type_name -> clade.v1.Node
+	15, // 2: clade.v1.ListOutdatedResponse.generated_at:type_name -> google.protobuf.Timestamp
+	14, // 3: clade.v1.ExplainResponse.node:type_name -> clade.v1.Node
+	0,  // 4: clade.v1.ExplainResponse.reason:type_name -> clade.v1.Reason
+	12, // 5: clade.v1.WatchBuildsResponse.event:type_name -> clade.v1.BuildEvent
+	15, // 6: clade.v1.BuildEvent.time:type_name -> google.protobuf.Timestamp
+	1,  // 7: clade.v1.BuildEvent.state:type_name -> clade.v1.BuildEvent.State
+	2,  // 8: clade.v1.CladeService.GetGraph:input_type -> clade.v1.GetGraphRequest
+	4,  // 9: clade.v1.CladeService.ListOutdated:input_type -> clade.v1.ListOutdatedRequest
+	6,  // 10: clade.v1.CladeService.Explain:input_type -> clade.v1.ExplainRequest
+	8,  // 11: clade.v1.CladeService.TriggerBuild:input_type -> clade.v1.TriggerBuildRequest
+	10, // 12: clade.v1.CladeService.WatchBuilds:input_type -> clade.v1.WatchBuildsRequest
+	3,  // 13: clade.v1.CladeService.GetGraph:output_type -> clade.v1.GetGraphResponse
+	5,  // 14: clade.v1.CladeService.ListOutdated:output_type -> clade.v1.ListOutdatedResponse
+	7,  // 15: clade.v1.CladeService.Explain:output_type -> clade.v1.ExplainResponse
+	9,  // 16: clade.v1.CladeService.TriggerBuild:output_type -> clade.v1.TriggerBuildResponse
+	11, // 17: clade.v1.CladeService.WatchBuilds:output_type -> clade.v1.WatchBuildsResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_clade_v1_service_proto_init() }
+func file_clade_v1_service_proto_init() {
+	if File_clade_v1_service_proto != nil {
+		return
+	}
+	file_clade_v1_graph_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clade_v1_service_proto_rawDesc), len(file_clade_v1_service_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_clade_v1_service_proto_goTypes,
+		DependencyIndexes: file_clade_v1_service_proto_depIdxs,
+		EnumInfos:         file_clade_v1_service_proto_enumTypes,
+		MessageInfos:      file_clade_v1_service_proto_msgTypes,
+	}.Build()
+	File_clade_v1_service_proto = out.File
+	file_clade_v1_service_proto_goTypes = nil
+	file_clade_v1_service_proto_depIdxs = nil
+}
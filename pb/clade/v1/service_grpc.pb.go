@@ -0,0 +1,301 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: clade/v1/service.proto
+
+package cladev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CladeService_GetGraph_FullMethodName     = "/clade.v1.CladeService/GetGraph"
+	CladeService_ListOutdated_FullMethodName = "/clade.v1.CladeService/ListOutdated"
+	CladeService_Explain_FullMethodName      = "/clade.v1.CladeService/Explain"
+	CladeService_TriggerBuild_FullMethodName = "/clade.v1.CladeService/TriggerBuild"
+	CladeService_WatchBuilds_FullMethodName  = "/clade.v1.CladeService/WatchBuilds"
+)
+
+// CladeServiceClient is the client API for CladeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CladeService exposes the graph kept by `clade serve` and the builds it runs.
+// The graph is the one its last cycle computed, so reading it costs no
+// registry request. Its HTTP/JSON mapping is in service.yaml.
+type CladeServiceClient interface {
+	// GetGraph returns the whole graph.
+	GetGraph(ctx context.Context, in *GetGraphRequest, opts ...grpc.CallOption) (*GetGraphResponse, error)
+	// ListOutdated returns the outdated nodes, as `clade outdated` does.
+	ListOutdated(ctx context.Context, in *ListOutdatedRequest, opts ...grpc.CallOption) (*ListOutdatedResponse, error)
+	// Explain tells why a node is outdated or up to date.
+	Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainResponse, error)
+	// TriggerBuild queues a build of nodes, run by the daemon between its
+	// cycles. It returns once the build is queued, not built; WatchBuilds
+	// reports its progress.
+	TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error)
+	// WatchBuilds streams the events of every build from now on, whatever
+	// started it: a schedule, a webhook or TriggerBuild.
+	WatchBuilds(ctx context.Context, in *WatchBuildsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchBuildsResponse], error)
+}
+
+type cladeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCladeServiceClient(cc grpc.ClientConnInterface) CladeServiceClient {
+	return &cladeServiceClient{cc}
+}
+
+func (c *cladeServiceClient) GetGraph(ctx context.Context, in *GetGraphRequest, opts ...grpc.CallOption) (*GetGraphResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetGraphResponse)
+	err := c.cc.Invoke(ctx, CladeService_GetGraph_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cladeServiceClient) ListOutdated(ctx context.Context, in *ListOutdatedRequest, opts ...grpc.CallOption) (*ListOutdatedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListOutdatedResponse)
+	err := c.cc.Invoke(ctx, CladeService_ListOutdated_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cladeServiceClient) Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExplainResponse)
+	err := c.cc.Invoke(ctx, CladeService_Explain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cladeServiceClient) TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerBuildResponse)
+	err := c.cc.Invoke(ctx, CladeService_TriggerBuild_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cladeServiceClient) WatchBuilds(ctx context.Context, in *WatchBuildsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchBuildsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CladeService_ServiceDesc.Streams[0], CladeService_WatchBuilds_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchBuildsRequest, WatchBuildsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CladeService_WatchBuildsClient = grpc.ServerStreamingClient[WatchBuildsResponse]
+
+// CladeServiceServer is the server API for CladeService service.
+// All implementations must embed UnimplementedCladeServiceServer
+// for forward compatibility.
+//
+// CladeService exposes the graph kept by `clade serve` and the builds it runs.
+// The graph is the one its last cycle computed, so reading it costs no
+// registry request. Its HTTP/JSON mapping is in service.yaml.
+type CladeServiceServer interface {
+	// GetGraph returns the whole graph.
+	GetGraph(context.Context, *GetGraphRequest) (*GetGraphResponse, error)
+	// ListOutdated returns the outdated nodes, as `clade outdated` does.
+	ListOutdated(context.Context, *ListOutdatedRequest) (*ListOutdatedResponse, error)
+	// Explain tells why a node is outdated or up to date.
+	Explain(context.Context, *ExplainRequest) (*ExplainResponse, error)
+	// TriggerBuild queues a build of nodes, run by the daemon between its
+	// cycles. It returns once the build is queued, not built; WatchBuilds
+	// reports its progress.
+	TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error)
+	// WatchBuilds streams the events of every build from now on, whatever
+	// started it: a schedule, a webhook or TriggerBuild.
+	WatchBuilds(*WatchBuildsRequest, grpc.ServerStreamingServer[WatchBuildsResponse]) error
+	mustEmbedUnimplementedCladeServiceServer()
+}
+
+// UnimplementedCladeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCladeServiceServer struct{}
+
+func (UnimplementedCladeServiceServer) GetGraph(context.Context, *GetGraphRequest) (*GetGraphResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetGraph not implemented")
+}
+func (UnimplementedCladeServiceServer) ListOutdated(context.Context, *ListOutdatedRequest) (*ListOutdatedResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListOutdated not implemented")
+}
+func (UnimplementedCladeServiceServer) Explain(context.Context, *ExplainRequest) (*ExplainResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Explain not implemented")
+}
+func (UnimplementedCladeServiceServer) TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method TriggerBuild not implemented")
+}
+func (UnimplementedCladeServiceServer) WatchBuilds(*WatchBuildsRequest, grpc.ServerStreamingServer[WatchBuildsResponse]) error {
+	return status.Error(codes.Unimplemented, "method WatchBuilds not implemented")
+}
+func (UnimplementedCladeServiceServer) mustEmbedUnimplementedCladeServiceServer() {}
+func (UnimplementedCladeServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeCladeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CladeServiceServer will
+// result in compilation errors.
+type UnsafeCladeServiceServer interface {
+	mustEmbedUnimplementedCladeServiceServer()
+}
+
+func RegisterCladeServiceServer(s grpc.ServiceRegistrar, srv CladeServiceServer) {
+	// If the following call panics, it indicates UnimplementedCladeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CladeService_ServiceDesc, srv)
+}
+
+func _CladeService_GetGraph_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetGraphRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CladeServiceServer).GetGraph(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CladeService_GetGraph_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CladeServiceServer).GetGraph(ctx, req.(*GetGraphRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CladeService_ListOutdated_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOutdatedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CladeServiceServer).ListOutdated(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CladeService_ListOutdated_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CladeServiceServer).ListOutdated(ctx, req.(*ListOutdatedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CladeService_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CladeServiceServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CladeService_Explain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CladeServiceServer).Explain(ctx, req.(*ExplainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CladeService_TriggerBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerBuildRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CladeServiceServer).TriggerBuild(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CladeService_TriggerBuild_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CladeServiceServer).TriggerBuild(ctx, req.(*TriggerBuildRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CladeService_WatchBuilds_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBuildsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CladeServiceServer).WatchBuilds(m, &grpc.GenericServerStream[WatchBuildsRequest, WatchBuildsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CladeService_WatchBuildsServer = grpc.ServerStreamingServer[WatchBuildsResponse]
+
+// CladeService_ServiceDesc is the grpc.ServiceDesc for CladeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CladeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clade.v1.CladeService",
+	HandlerType: (*CladeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetGraph",
+			Handler:    _CladeService_GetGraph_Handler,
+		},
+		{
+			MethodName: "ListOutdated",
+			Handler:    _CladeService_ListOutdated_Handler,
+		},
+		{
+			MethodName: "Explain",
+			Handler:    _CladeService_Explain_Handler,
+		},
+		{
+			MethodName: "TriggerBuild",
+			Handler:    _CladeService_TriggerBuild_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchBuilds",
+			Handler:       _CladeService_WatchBuilds_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "clade/v1/service.proto",
+}
@@ -2,69 +2,362 @@ package port
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/goccy/go-yaml"
 )
 
-// Filename is the manifest file name expected in a port directory.
+// Filename is the manifest file name expected in a port directory. A directory
+// may also hold variants, "port.<variant>.yaml", each a port of its own that
+// shares the directory's Dockerfile and context.
 const Filename = "port.yaml"
 
+// manifestName returns the manifest file name of a variant: Filename for "",
+// otherwise "port.<variant>.yaml".
+func manifestName(variant string) string {
+	if variant == "" {
+		return Filename
+	}
+	return "port." + variant + ".yaml"
+}
+
+// variantOf reports whether name is a manifest file name, and of which variant.
+func variantOf(name string) (string, bool) {
+	if name == Filename {
+		return "", true
+	}
+	v, ok := strings.CutPrefix(name, "port.")
+	if !ok {
+		return "", false
+	}
+	v, ok = strings.CutSuffix(v, ".yaml")
+	if !ok || v == "" || strings.Contains(v, ".") {
+		return "", false
+	}
+	return v, true
+}
+
+// ID returns the id of the port in dir with the given variant: dir itself for
+// the directory's port.yaml, "<dir>:<variant>" for a variant. The id is what
+// graph nodes refer to a port by; LoadID and ManifestPath map it back.
+func ID(dir, variant string) string {
+	if variant == "" {
+		return dir
+	}
+	return dir + ":" + variant
+}
+
+// resolveID splits a port id into its directory and variant. Only the part
+// after the last path separator can hold a variant, so a directory name with
+// a ":" in a parent element does not confuse it.
+func resolveID(id string) (dir string, variant string) {
+	i := strings.LastIndex(id, ":")
+	if i < 0 || strings.ContainsAny(id[i+1:], `/\`) {
+		return id, ""
+	}
+	return id[:i], id[i+1:]
+}
+
+// ManifestPath returns the path of the manifest of the port with the given id.
+func ManifestPath(id string) string {
+	dir, variant := resolveID(id)
+	return filepath.Join(dir, manifestName(variant))
+}
+
+// Loader loads ports, merging into each the defaults that apply to it. The
+// zero Loader applies only a _defaults.yaml in the port's own directory.
+type Loader struct {
+	// Roots are the directories LoadAll searches. A port under a root gets the
+	// _defaults.yaml of every directory from the root down to its own.
+	Roots []string
+	// Ignore are patterns of directories LoadAll skips (see LoadAll).
+	Ignore []string
+	// Defaults are merged into every port under all _defaults.yaml files
+	// (clade.yaml's defaults). They may set the fields CheckDefaults allows.
+	Defaults map[string]any
+}
+
 // Load reads and validates the port in the given directory.
 func Load(dir string) (*Port, error) {
+	return (&Loader{}).Load(dir)
+}
+
+// LoadID reads and validates the port with the given id (see ID).
+func LoadID(id string) (*Port, error) {
+	return (&Loader{}).LoadID(id)
+}
+
+// LoadAll loads every port under roots; see Loader.LoadAll.
+func LoadAll(roots []string, ignore []string) ([]*Port, error) {
+	return (&Loader{Roots: roots, Ignore: ignore}).LoadAll()
+}
+
+// Load reads and validates the port in the given directory.
+func (l *Loader) Load(dir string) (*Port, error) {
+	return valid(l.load(l.rootOf(dir), dir, ""))
+}
+
+// LoadID reads and validates the port with the given id (see ID).
+func (l *Loader) LoadID(id string) (*Port, error) {
+	dir, variant := resolveID(id)
+	return valid(l.load(l.rootOf(dir), dir, variant))
+}
+
+// valid drops the port that decode returns along with an error.
+func valid(p *Port, err error) (*Port, error) {
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// rootOf returns the root dir is under, or "" for none.
+func (l *Loader) rootOf(dir string) string {
+	for _, r := range l.Roots {
+		if _, ok := under(r, dir); ok {
+			return r
+		}
+	}
+	return ""
+}
+
+// LoadData reads and validates data as the manifest of a port in dir, merged
+// over the defaults that would apply to it there, so a port can be checked
+// before it is written.
+func (l *Loader) LoadData(dir string, data []byte) (*Port, error) {
 	p := filepath.Join(dir, Filename)
-	data, err := os.ReadFile(p)
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, &DecodeError{File: p, Err: err}
+	}
+	return valid(l.decode(l.rootOf(dir), dir, "", p, doc, data))
+}
+
+// load reads the manifest of the given variant in dir and decodes it.
+func (l *Loader) load(root, dir, variant string) (*Port, error) {
+	p := filepath.Join(dir, manifestName(variant))
+	doc, data, err := readDoc(p)
 	if err != nil {
-		return nil, fmt.Errorf("read %s: %w", p, err)
+		return nil, err
 	}
+	return l.decode(root, dir, variant, p, doc, data)
+}
 
-	var port Port
-	if err := yaml.Unmarshal(data, &port); err != nil {
-		return nil, fmt.Errorf("decode %s: %w", p, err)
+// decode decodes the manifest at p, read as doc and data, merging in order of
+// precedence the manifest itself, the port it extends (recursively), the
+// _defaults.yaml files from dir up to root and the loader's Defaults. Once the
+// files merge, the port is returned even with an error, with at least the
+// fields set on load, so the invalid manifest can still be linted.
+func (l *Loader) decode(root, dir, variant, p string, doc map[string]any, data []byte) (*Port, error) {
+	layers := []map[string]any{}
+	if len(l.Defaults) > 0 {
+		if err := CheckDefaults(l.Defaults); err != nil {
+			return nil, fmt.Errorf("defaults: %w", err)
+		}
+		layers = append(layers, l.Defaults)
+	}
+	dir_defaults, defaults_paths, err := dirDefaults(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, dir_defaults...)
+
+	files := []string{p}
+	if _, ok := doc["extends"]; ok || len(layers) > 0 {
+		own, err := extend(p, doc, map[string]bool{}, &files)
+		if err != nil {
+			return nil, err
+		}
+		merged := map[string]any{}
+		for _, layer := range append(layers, own) {
+			merged = merge(merged, layer)
+		}
+		if data, err = yaml.Marshal(merged); err != nil {
+			return nil, fmt.Errorf("encode %s: %w", p, err)
+		}
 	}
 
+	var port Port
+	err = yaml.Unmarshal(data, &port)
+
 	port.Dir = dir
+	port.ID = ID(dir, variant)
+	port.File = p
+	port.Manifest = data
+	port.Files = files
+	for i := len(defaults_paths) - 1; i >= 0; i-- {
+		port.Files = append(port.Files, defaults_paths[i])
+	}
+	if err != nil {
+		return &port, fmt.Errorf("decode %s: %w", p, err)
+	}
 	if port.Name == "" {
 		port.Name = filepath.Base(dir)
+		if variant != "" {
+			port.Name += "-" + variant
+		}
 	}
 	if err := port.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid %s: %w", p, err)
+		return &port, fmt.Errorf("invalid %s: %w", p, err)
 	}
 	return &port, nil
 }
 
-// LoadAll scans root for immediate subdirectories that contain a port.yaml and
-// loads each one. Subdirectories without a manifest are ignored. The result is
-// sorted by directory for deterministic ordering.
-func LoadAll(root string) ([]*Port, error) {
-	entries, err := os.ReadDir(root)
+// extend merges doc, the manifest at p, over the port it extends, if any. The
+// extended port is named relative to p's directory, as a directory or an id
+// (e.g. "../golang" or "../python:alpine"). Its name is not inherited. The
+// path of every extended manifest is appended to files.
+func extend(p string, doc map[string]any, seen map[string]bool, files *[]string) (map[string]any, error) {
+	v, ok := doc["extends"]
+	if !ok {
+		return doc, nil
+	}
+	target, ok := v.(string)
+	if !ok || target == "" {
+		return nil, fmt.Errorf("%s: extends must name a port", p)
+	}
+
+	seen[p] = true
+	base_path := ManifestPath(filepath.Join(filepath.Dir(p), target))
+	if seen[base_path] {
+		return nil, fmt.Errorf("%s: extends %s, which extends it back", p, base_path)
+	}
+	base, _, err := readDoc(base_path)
 	if err != nil {
-		return nil, fmt.Errorf("read dir %s: %w", root, err)
+		return nil, fmt.Errorf("%s: extends: %w", p, err)
 	}
+	*files = append(*files, base_path)
+	if base, err = extend(base_path, base, seen, files); err != nil {
+		return nil, err
+	}
+
+	base = merge(base, nil)
+	delete(base, "name")
+	return merge(base, doc), nil
+}
 
-	ports := make([]*Port, 0, len(entries))
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+// LoadAll walks each root for port manifests (port.yaml and port.<variant>.yaml)
+// and loads each one, at any depth. Hidden directories are skipped, as are
+// directories matching one of the ignore patterns (path.Match syntax), which
+// are tried against the directory's name and its slash-separated path relative
+// to the root. A directory may be a port and also contain ports. The result is
+// sorted by id for deterministic ordering.
+func (l *Loader) LoadAll() ([]*Port, error) {
+	ports := []*Port{}
+	seen := map[string]string{} // id -> root
+	err := l.walk(func(root, dir, variant string) error {
+		port, err := valid(l.load(root, dir, variant))
+		if err != nil {
+			return err
+		}
+		if r, ok := seen[port.ID]; ok {
+			return fmt.Errorf("port %s is found under both %s and %s", port.ID, r, root)
 		}
+		seen[port.ID] = root
+		ports = append(ports, port)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		dir := filepath.Join(root, entry.Name())
-		if _, err := os.Stat(filepath.Join(dir, Filename)); err != nil {
-			if os.IsNotExist(err) {
-				continue
+	sort.Slice(ports, func(i, j int) bool { return ports[i].ID < ports[j].ID })
+	return ports, nil
+}
+
+// Loaded is the outcome of loading one manifest (see LoadEach).
+type Loaded struct {
+	// File is the path of the manifest.
+	File string
+	// Port is set once the manifest and the files merged into it decode, even
+	// when the port is invalid; Err then tells why.
+	Port *Port
+	Err  error
+}
+
+// LoadEach loads the manifests LoadAll does, but does not stop at one that
+// fails to load or validate: each has its outcome, sorted by port id as
+// LoadAll's, so that all of their mistakes can be reported. The error is for
+// failures to walk the roots.
+func (l *Loader) LoadEach() ([]Loaded, error) {
+	out := []Loaded{}
+	ids := map[string]string{}  // file -> id
+	seen := map[string]string{} // id -> root
+	err := l.walk(func(root, dir, variant string) error {
+		ids[filepath.Join(dir, manifestName(variant))] = ID(dir, variant)
+		port, err := l.load(root, dir, variant)
+		if port != nil {
+			if r, ok := seen[port.ID]; ok && err == nil {
+				err = fmt.Errorf("port %s is found under both %s and %s", port.ID, r, root)
 			}
-			return nil, fmt.Errorf("stat %s: %w", dir, err)
+			seen[port.ID] = root
+		}
+		out = append(out, Loaded{File: filepath.Join(dir, manifestName(variant)), Port: port, Err: err})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return ids[out[i].File] < ids[out[j].File] })
+	return out, nil
+}
+
+// walk calls fn with the directory and variant of every manifest under the
+// roots (see LoadAll).
+func (l *Loader) walk(fn func(root, dir, variant string) error) error {
+	for _, pattern := range l.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("ignore pattern %q: %w", pattern, err)
 		}
+	}
 
-		p, err := Load(dir)
+	for _, root := range l.Roots {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p != root && ignored(root, p, l.Ignore) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			variant, ok := variantOf(d.Name())
+			if !ok {
+				return nil
+			}
+			return fn(root, filepath.Dir(p), variant)
+		})
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("scan %s: %w", root, err)
 		}
-		ports = append(ports, p)
 	}
+	return nil
+}
 
-	sort.Slice(ports, func(i, j int) bool { return ports[i].Dir < ports[j].Dir })
-	return ports, nil
+func ignored(root, dir string, ignore []string) bool {
+	name := filepath.Base(dir)
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range ignore {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
 }
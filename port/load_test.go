@@ -1,6 +1,7 @@
 package port_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,11 +29,16 @@ build:
 `
 
 func writePort(t *testing.T, dir, manifest string) {
+	t.Helper()
+	writeManifest(t, dir, port.Filename, manifest)
+}
+
+func writeManifest(t *testing.T, dir, name, manifest string) {
 	t.Helper()
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		t.Fatal(err)
 	}
-	if err := os.WriteFile(filepath.Join(dir, port.Filename), []byte(manifest), 0o644); err != nil {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(manifest), 0o644); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -122,14 +128,114 @@ func TestLoadAll(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ports, err := port.LoadAll(root)
+	ports, err := port.LoadAll([]string{root}, nil)
 	if err != nil {
 		t.Fatalf("load all: %v", err)
 	}
 	if len(ports) != 2 {
 		t.Fatalf("loaded %d ports, want 2", len(ports))
 	}
-	if ports[0].Dir >= ports[1].Dir {
-		t.Errorf("ports not sorted by dir: %q, %q", ports[0].Dir, ports[1].Dir)
+	if ports[0].ID >= ports[1].ID {
+		t.Errorf("ports not sorted by id: %q, %q", ports[0].ID, ports[1].ID)
+	}
+}
+
+func TestLoadEach(t *testing.T) {
+	// Invalid and undecodable manifests do not stop the others from loading.
+	root := t.TempDir()
+	writePort(t, filepath.Join(root, "a"), sample)
+	writePort(t, filepath.Join(root, "b"), "build:\n  repo: x\n  tags: [y]\n")
+	writePort(t, filepath.Join(root, "c"), "source: [\n")
+
+	loaded, err := (&port.Loader{Roots: []string{root}}).LoadEach()
+	if err != nil {
+		t.Fatalf("load each: %v", err)
+	}
+	if len(loaded) != 3 {
+		t.Fatalf("loaded %d manifests, want 3", len(loaded))
+	}
+	if a := loaded[0]; a.Err != nil || a.Port == nil || a.File != filepath.Join(root, "a", port.Filename) {
+		t.Errorf("a = %+v", a)
+	}
+	var field *port.FieldError
+	if b := loaded[1]; b.Port == nil || !errors.As(b.Err, &field) || strings.Join(field.Path, ".") != "source.kind" {
+		t.Errorf("b = %+v, want the invalid port with its source.kind error", b)
+	}
+	var decode *port.DecodeError
+	if c := loaded[2]; c.Port != nil || !errors.As(c.Err, &decode) || decode.File != c.File {
+		t.Errorf("c = %+v, want a decode error of its manifest", c)
+	}
+}
+
+func TestLoadAllNested(t *testing.T) {
+	root := t.TempDir()
+	other := t.TempDir()
+	writePort(t, filepath.Join(root, "lang", "golang"), sample)
+	writePort(t, filepath.Join(root, "lang", "golang", "tools"), sample) // a port inside a port
+	writeManifest(t, filepath.Join(root, "lang", "python"), "port.alpine.yaml", sample)
+	writeManifest(t, filepath.Join(root, "lang", "python"), "port.debian.yaml", sample)
+	writeManifest(t, filepath.Join(root, "lang", "python"), "port.yml", sample) // not a manifest
+	writePort(t, filepath.Join(root, ".git", "x"), sample)
+	writePort(t, filepath.Join(root, "archive", "old"), sample)
+	writePort(t, filepath.Join(root, "lang", "wip-rust"), sample)
+	writePort(t, filepath.Join(other, "tool"), sample)
+
+	ports, err := port.LoadAll([]string{root, other}, []string{"archive", "lang/wip-*"})
+	if err != nil {
+		t.Fatalf("load all: %v", err)
+	}
+
+	got := map[string]*port.Port{}
+	for _, p := range ports {
+		got[p.ID] = p
+	}
+	want := []string{
+		filepath.Join(root, "lang", "golang"),
+		filepath.Join(root, "lang", "golang", "tools"),
+		filepath.Join(root, "lang", "python") + ":alpine",
+		filepath.Join(root, "lang", "python") + ":debian",
+		filepath.Join(other, "tool"),
+	}
+	if len(ports) != len(want) {
+		t.Fatalf("loaded %v, want %v", got, want)
+	}
+	for _, id := range want {
+		if got[id] == nil {
+			t.Errorf("port %q not loaded", id)
+		}
+	}
+
+	alpine := got[filepath.Join(root, "lang", "python")+":alpine"]
+	if alpine.Dir != filepath.Join(root, "lang", "python") || alpine.Name != "python-alpine" {
+		t.Errorf("variant dir = %q, name = %q", alpine.Dir, alpine.Name)
+	}
+	if alpine.File != filepath.Join(alpine.Dir, "port.alpine.yaml") || port.ManifestPath(alpine.ID) != alpine.File {
+		t.Errorf("variant file = %q", alpine.File)
+	}
+
+	p, err := port.LoadID(alpine.ID)
+	if err != nil {
+		t.Fatalf("load id: %v", err)
+	}
+	if p.ID != alpine.ID || p.Dir != alpine.Dir {
+		t.Errorf("loaded id %q dir %q", p.ID, p.Dir)
+	}
+
+	// The same port under two roots is ambiguous.
+	if _, err := port.LoadAll([]string{other, other}, nil); err == nil {
+		t.Error("expected error for a port found twice")
+	}
+}
+
+func TestLoadTest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "x")
+	writePort(t, dir, sample+"test:\n  - run: [go, version]\n")
+
+	p, err := port.Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !strings.Contains(string(p.Test.Params), "go, version") {
+		t.Errorf("test params = %q", p.Test.Params)
 	}
 }
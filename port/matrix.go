@@ -0,0 +1,109 @@
+package port
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Matrix expands one port into several node families that share its
+// Dockerfile and context: a family per combination of the values of each key,
+// e.g. {"variant": ["alpine", "bookworm"]}. The values are available to the
+// select mapping and the build.tags templates through the matrix template
+// function, and to the build as build args (see MatrixArg).
+type Matrix map[string][]string
+
+var matrixKey = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Validate reports whether the matrix is well formed. Its errors are
+// *FieldError.
+func (m Matrix) Validate() error {
+	for _, k := range m.keys() {
+		if !matrixKey.MatchString(k) {
+			return fieldError([]string{"matrix", k}, "matrix key %q must be lower-case letters, digits and dashes", k)
+		}
+		if arg := MatrixArg(k); arg == "BASE" || arg == "BASE_TAG" {
+			return fieldError([]string{"matrix", k}, "matrix key %q is reserved", k)
+		}
+		vs := m[k]
+		if len(vs) == 0 {
+			return fieldError([]string{"matrix", k}, "matrix.%s has no values", k)
+		}
+		seen := map[string]bool{}
+		for _, v := range vs {
+			if seen[v] {
+				return fieldError([]string{"matrix", k}, "matrix.%s has %q twice", k, v)
+			}
+			seen[v] = true
+		}
+	}
+	return nil
+}
+
+func (m Matrix) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Combinations returns every combination of the matrix values, in the order
+// of the keys sorted and the values as declared, the last key varying
+// fastest. An empty matrix has a single, empty combination.
+func (m Matrix) Combinations() []map[string]string {
+	out := []map[string]string{{}}
+	for _, k := range m.keys() {
+		next := make([]map[string]string, 0, len(out)*len(m[k]))
+		for _, c := range out {
+			for _, v := range m[k] {
+				d := make(map[string]string, len(c)+1)
+				for ck, cv := range c {
+					d[ck] = cv
+				}
+				d[k] = v
+				next = append(next, d)
+			}
+		}
+		out = next
+	}
+	return out
+}
+
+// MatrixArg returns the build arg a matrix key is passed as: the key
+// upper-cased, with dashes replaced by underscores ("distro-version" is
+// DISTRO_VERSION).
+func MatrixArg(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// MatrixFuncs returns the template functions that expose a combination of
+// matrix values: {{matrix "variant"}} is the value of key "variant".
+func MatrixFuncs(values map[string]string) template.FuncMap {
+	return template.FuncMap{
+		"matrix": func(key string) (string, error) {
+			v, ok := values[key]
+			if !ok {
+				return "", fmt.Errorf("no matrix key %q", key)
+			}
+			return v, nil
+		},
+	}
+}
+
+// RenderMatrix renders the text/template s with a combination of matrix
+// values (see MatrixFuncs).
+func RenderMatrix(s string, values map[string]string) (string, error) {
+	t, err := template.New("").Funcs(MatrixFuncs(values)).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, nil); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,55 @@
+package port_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lesomnus/clade/port"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	m := port.Matrix{
+		"variant":        {"alpine", "bookworm"},
+		"distro-version": {"3.20", "3.21"},
+	}
+	got := m.Combinations()
+	want := []map[string]string{
+		{"distro-version": "3.20", "variant": "alpine"},
+		{"distro-version": "3.20", "variant": "bookworm"},
+		{"distro-version": "3.21", "variant": "alpine"},
+		{"distro-version": "3.21", "variant": "bookworm"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := (port.Matrix{}).Combinations(); len(got) != 1 || len(got[0]) != 0 {
+		t.Errorf("empty matrix: got %v, want one empty combination", got)
+	}
+	if got := port.MatrixArg("distro-version"); got != "DISTRO_VERSION" {
+		t.Errorf("arg = %q", got)
+	}
+}
+
+func TestMatrixValidate(t *testing.T) {
+	for _, m := range []port.Matrix{
+		{"Variant": {"a"}},
+		{"base-tag": {"a"}},
+		{"variant": {}},
+		{"variant": {"a", "a"}},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%v: expected error", m)
+		}
+	}
+}
+
+func TestRenderMatrix(t *testing.T) {
+	got, err := port.RenderMatrix(`pre-release: "{{matrix "variant"}}"`, map[string]string{"variant": "alpine"})
+	if err != nil || got != `pre-release: "alpine"` {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := port.RenderMatrix(`{{matrix "nope"}}`, map[string]string{"variant": "alpine"}); err == nil {
+		t.Error("expected error for an unknown key")
+	}
+}
@@ -0,0 +1,147 @@
+package port
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// DefaultsFilename is the file in a ports directory whose fields are merged
+// into every port at or below that directory.
+const DefaultsFilename = "_defaults.yaml"
+
+// defaultable are the top-level fields defaults may set. A port's source and
+// name are its own; they are inherited only through extends.
+var defaultable = map[string]bool{
+	"select":    true,
+	"compare":   true,
+	"build":     true,
+	"test":      true,
+	"deprecate": true,
+}
+
+// CheckDefaults reports whether doc only sets fields defaults may set.
+func CheckDefaults(doc map[string]any) error {
+	for k := range doc {
+		if !defaultable[k] {
+			return fmt.Errorf("field %q cannot be defaulted", k)
+		}
+	}
+	return nil
+}
+
+// merge deep-merges over onto base and returns the result; neither is
+// modified. Mappings are merged key by key, except that two mappings with a
+// different "kind" are different strategies, so over replaces base. Anything
+// else, lists included, is replaced: a port's compare chain or build.tags
+// replace the defaults' rather than extend them.
+func merge(base, over map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		b, ok1 := out[k].(map[string]any)
+		o, ok2 := v.(map[string]any)
+		if ok1 && ok2 && sameKind(b, o) {
+			out[k] = merge(b, o)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func sameKind(a, b map[string]any) bool {
+	ka, ok1 := a["kind"]
+	kb, ok2 := b["kind"]
+	return !ok1 || !ok2 || ka == kb
+}
+
+// readDoc reads a YAML mapping. It returns the raw bytes too, so a manifest
+// that needs no merging is decoded as written.
+func readDoc(p string) (map[string]any, []byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", p, err)
+	}
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, &DecodeError{File: p, Err: err}
+	}
+	return doc, data, nil
+}
+
+// DecodeError is a manifest, _defaults.yaml or extended manifest that is not
+// a YAML mapping. Err is the decoder's, which locates the mistake in File.
+type DecodeError struct {
+	File string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s: %v", e.File, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// dirDefaults returns the _defaults.yaml documents that apply to dir, from
+// root's down to dir's own, and their paths. Only dir's is read when dir is not
+// under root.
+func dirDefaults(root, dir string) ([]map[string]any, []string, error) {
+	dirs := []string{dir}
+	if rel, ok := under(root, dir); ok {
+		dirs = []string{root}
+		d := root
+		for _, e := range strings.Split(rel, "/") {
+			if e == "." {
+				continue
+			}
+			d = filepath.Join(d, e)
+			dirs = append(dirs, d)
+		}
+	}
+
+	out := []map[string]any{}
+	paths := []string{}
+	for _, d := range dirs {
+		p := filepath.Join(d, DefaultsFilename)
+		doc, _, err := readDoc(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := CheckDefaults(doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		out = append(out, doc)
+		paths = append(paths, p)
+	}
+	return out, paths, nil
+}
+
+// under returns the slash-separated path of dir relative to root, if dir is
+// root or below it.
+func under(root, dir string) (string, bool) {
+	if root == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,165 @@
+package port_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/clade/port"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, root, port.DefaultsFilename, `build:
+  platforms: [linux/amd64]
+  cache-to: type=gha
+  tags: ["{{.Major}}.{{.Minor}}"]
+`)
+	writeManifest(t, filepath.Join(root, "lang"), port.DefaultsFilename, `build:
+  platforms: [linux/amd64, linux/arm64]
+`)
+	writePort(t, filepath.Join(root, "lang", "golang"), `source:
+  kind: container
+  repo: docker.io/library/golang
+select:
+  kind: semver
+build:
+  repo: me/golang
+  cache-to: type=registry
+`)
+
+	l := &port.Loader{
+		Roots:    []string{root},
+		Defaults: map[string]any{"select": map[string]any{"kind": "semver", "last-major": 2}},
+	}
+	ports, err := l.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 1 {
+		t.Fatalf("loaded %d ports, want 1", len(ports))
+	}
+	p := ports[0]
+
+	var build struct {
+		Platforms []string `yaml:"platforms"`
+		CacheTo   string   `yaml:"cache-to"`
+	}
+	if err := yaml.Unmarshal(p.Build.Params, &build); err != nil {
+		t.Fatal(err)
+	}
+	// The nearest defaults win, and the port's own fields win over all.
+	if strings.Join(build.Platforms, ",") != "linux/amd64,linux/arm64" || build.CacheTo != "type=registry" {
+		t.Errorf("build = %+v", build)
+	}
+	if len(p.Build.Tags) != 1 || p.Build.Tags[0] != "{{.Major}}.{{.Minor}}" {
+		t.Errorf("tags = %v", p.Build.Tags)
+	}
+	if !strings.Contains(string(p.Select.Params), "last-major: 2") {
+		t.Errorf("select = %s", p.Select.Params)
+	}
+	files := strings.Join(p.Files, ",")
+	want := strings.Join([]string{
+		filepath.Join(root, "lang", "golang", port.Filename),
+		filepath.Join(root, "lang", port.DefaultsFilename),
+		filepath.Join(root, port.DefaultsFilename),
+	}, ",")
+	if files != want {
+		t.Errorf("files = %s, want %s", files, want)
+	}
+
+	// The same port is loaded by id with the same defaults.
+	q, err := l.LoadID(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(q.Manifest) != string(p.Manifest) {
+		t.Errorf("manifest by id:\n%s\nwant:\n%s", q.Manifest, p.Manifest)
+	}
+
+	// Defaults cannot give every port one source.
+	l.Defaults = map[string]any{"source": map[string]any{"kind": "http"}}
+	if _, err := l.LoadAll(); err == nil {
+		t.Error("expected error for a defaulted source")
+	}
+}
+
+func TestLoadDefaultsKind(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, root, port.DefaultsFilename, "select:\n  kind: semver\n  last-major: 2\n")
+	writePort(t, filepath.Join(root, "x"), `source:
+  kind: container
+  repo: up/x
+select:
+  kind: regex
+  pattern: ^v
+build:
+  repo: me/x
+  tags: [a]
+`)
+
+	ports, err := port.LoadAll([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A select of another kind replaces the defaults' rather than merging.
+	if s := string(ports[0].Select.Params); strings.Contains(s, "last-major") {
+		t.Errorf("select = %s", s)
+	}
+}
+
+func TestLoadExtends(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, filepath.Join(root, "python"), "port.alpine.yaml", `name: py
+source:
+  kind: container
+  repo: docker.io/library/python
+select:
+  kind: semver
+  pre-release: alpine
+build:
+  repo: me/python
+  tags: ["{{.Major}}.{{.Minor}}-alpine"]
+  platforms: [linux/amd64]
+`)
+	writeManifest(t, filepath.Join(root, "python"), "port.debian.yaml", `extends: .:alpine
+select:
+  pre-release: bookworm
+build:
+  tags: ["{{.Major}}.{{.Minor}}-bookworm"]
+`)
+	writePort(t, filepath.Join(root, "tool"), "extends: ../python:debian\nbuild:\n  repo: me/tool\n")
+
+	ports, err := port.LoadAll([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	by_id := map[string]*port.Port{}
+	for _, p := range ports {
+		by_id[p.ID] = p
+	}
+
+	debian := by_id[filepath.Join(root, "python")+":debian"]
+	if debian.Name != "python-debian" || debian.Source.Repo != "docker.io/library/python" || debian.Build.Repo != "me/python" {
+		t.Errorf("debian = %+v", debian)
+	}
+	if !strings.Contains(string(debian.Build.Params), "linux/amd64") || debian.Build.Tags[0] != "{{.Major}}.{{.Minor}}-bookworm" {
+		t.Errorf("debian build = %s", debian.Build.Params)
+	}
+	if !strings.Contains(string(debian.Select.Params), "bookworm") {
+		t.Errorf("debian select = %s", debian.Select.Params)
+	}
+
+	tool := by_id[filepath.Join(root, "tool")]
+	if tool.Build.Repo != "me/tool" || tool.Build.Tags[0] != "{{.Major}}.{{.Minor}}-bookworm" {
+		t.Errorf("tool build = %+v", tool.Build)
+	}
+
+	// A cycle is an error, not a hang.
+	writePort(t, filepath.Join(root, "a"), "extends: ../b\n")
+	writePort(t, filepath.Join(root, "b"), "extends: ../a\n")
+	if _, err := port.Load(filepath.Join(root, "a")); err == nil || !strings.Contains(err.Error(), "extends it back") {
+		t.Errorf("cycle: err = %v", err)
+	}
+}
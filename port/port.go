@@ -6,6 +6,15 @@
 //	  dev-golang/
 //	    Dockerfile
 //	    port.yaml
+//	  lang/
+//	    python/
+//	      Dockerfile
+//	      port.alpine.yaml
+//	      port.debian.yaml
+//
+// Ports are found at any depth below a ports root. A directory may hold several
+// variants, "port.<variant>.yaml", which share its Dockerfile and context but
+// are otherwise separate ports.
 //
 // port.yaml declares the upstream source to track, how its versions are
 // selected, how the built image is named and pushed, and (optionally) how
@@ -27,23 +36,52 @@ package port
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/goccy/go-yaml"
 )
 
 // Port is a single buildable image definition.
 type Port struct {
-	// Dir is the directory that holds the Dockerfile, context and port.yaml.
+	// Dir is the directory that holds the Dockerfile, context and manifest.
 	// It is set on load and is not read from the YAML document.
 	Dir string `yaml:"-"`
+	// ID identifies the port in the graph: Dir, suffixed with ":<variant>" for
+	// a variant manifest (see ID). It is set on load.
+	ID string `yaml:"-"`
+	// File is the path of the manifest the port was loaded from.
+	File string `yaml:"-"`
+	// Manifest is the effective manifest: File merged with the defaults and
+	// the port it extends. It is set on load.
+	Manifest []byte `yaml:"-"`
+	// Files are the files merged into Manifest, by precedence: File, the
+	// manifests it extends, then the _defaults.yaml files from its directory
+	// up. It is set on load.
+	Files []string `yaml:"-"`
+
+	// Extends names another port, relative to Dir, whose fields this port
+	// inherits (all but its name); this port's own fields take precedence.
+	Extends string `yaml:"extends"`
 
-	// Name is a display name for the port. It defaults to the directory name
-	// (filled in by Load) when omitted.
+	// Name is a display name for the port. It defaults to the directory name,
+	// suffixed with "-<variant>" for a variant (filled in by Load) when omitted.
 	Name    string        `yaml:"name"`
+	Matrix  Matrix        `yaml:"matrix"`
 	Source  Source        `yaml:"source"`
 	Select  Select        `yaml:"select"`
 	Compare []CompareSpec `yaml:"compare"`
 	Build   Build         `yaml:"build"`
+	Test    Test          `yaml:"test"`
+	// Deprecate opts the port into tracking version lines that fall out of
+	// selection. Empty Mode leaves dropped lines untouched.
+	Deprecate Deprecate `yaml:"deprecate"`
+}
+
+// Deprecate declares how the last image of a dropped version line is marked.
+type Deprecate struct {
+	// Mode is "tag" (copy each of the image's tags to "<tag>-eol") or
+	// "annotate" (add an end-of-life annotation to the image's manifest).
+	Mode string `yaml:"mode"`
 }
 
 // Source declares where the upstream versions to track come from. Kind selects
@@ -148,6 +186,19 @@ func (s *Select) UnmarshalYAML(b []byte) error {
 	return nil
 }
 
+// Test is the smoke-test list run against a freshly built image before it is
+// pushed. It is kept as raw YAML and decoded by the smoke package.
+type Test struct {
+	// Params is the raw YAML of the whole test list; empty when absent.
+	Params []byte
+}
+
+// UnmarshalYAML implements goccy/go-yaml's BytesUnmarshaler.
+func (t *Test) UnmarshalYAML(b []byte) error {
+	t.Params = b
+	return nil
+}
+
 // CompareSpec is one entry of a port's compare chain: a strategy kind plus its
 // raw params. The chain is tried in order with fallback (see package compare).
 // An empty list means the per-source-kind default is used.
@@ -172,31 +223,55 @@ func (c *CompareSpec) UnmarshalYAML(b []byte) error {
 	return nil
 }
 
-// Validate reports whether the port is well formed.
+// FieldError is a Validate error about the field at Path of the manifest, as
+// keys and list indexes (e.g. "build", "tags", "0"), so it can be located.
+type FieldError struct {
+	Path    []string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func fieldError(path []string, format string, args ...any) error {
+	return &FieldError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validate reports whether the port is well formed. Its errors are
+// *FieldError.
 func (p *Port) Validate() error {
 	switch {
 	case p.Source.Kind == "":
-		return fmt.Errorf("source.kind is required")
+		return fieldError([]string{"source", "kind"}, "source.kind is required")
 	case p.Source.Kind == "container" && p.Source.Repo == "":
-		return fmt.Errorf("source.repo is required for kind \"container\"")
+		return fieldError([]string{"source", "repo"}, "source.repo is required for kind \"container\"")
 	case p.Source.Kind == "http" && p.Source.Url == "":
-		return fmt.Errorf("source.url is required for kind \"http\"")
+		return fieldError([]string{"source", "url"}, "source.url is required for kind \"http\"")
 	case p.Select.Kind == "":
-		return fmt.Errorf("select.kind is required")
+		return fieldError([]string{"select", "kind"}, "select.kind is required")
 	case p.Build.Repo == "":
-		return fmt.Errorf("build.repo is required")
+		return fieldError([]string{"build", "repo"}, "build.repo is required")
 	case len(p.Build.Tags) == 0:
-		return fmt.Errorf("build.tags is required")
+		return fieldError([]string{"build", "tags"}, "build.tags is required")
 	}
 	for i, t := range p.Build.Tags {
 		if t == "" {
-			return fmt.Errorf("build.tags[%d] is empty", i)
+			return fieldError([]string{"build", "tags", strconv.Itoa(i)}, "build.tags[%d] is empty", i)
 		}
 	}
+	if err := p.Matrix.Validate(); err != nil {
+		return err
+	}
 	for i, c := range p.Compare {
 		if c.Kind == "" {
-			return fmt.Errorf("compare[%d].kind is required", i)
+			return fieldError([]string{"compare", strconv.Itoa(i), "kind"}, "compare[%d].kind is required", i)
 		}
 	}
+	switch p.Deprecate.Mode {
+	case "", "tag", "annotate":
+	default:
+		return fieldError([]string{"deprecate", "mode"}, "deprecate.mode must be \"tag\" or \"annotate\", got %q", p.Deprecate.Mode)
+	}
 	return nil
 }
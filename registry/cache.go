@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -127,6 +128,32 @@ func (c *MemCache) Set(key string, val []byte, ttl time.Duration) {
 	c.entries[key] = memEntry{val: val, expiresAt: exp}
 }
 
+// Remove deletes the entry for key. It reports whether an entry was present.
+func (c *MemCache) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	return ok
+}
+
+// RemovePrefix deletes every entry whose key starts with prefix, e.g. KeyTags
+// to list every repository anew, and reports how many were removed.
+func (c *MemCache) RemovePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
 // fileEntry is the on-disk representation of a cached value. Key is stored so
 // the management tooling can recover what an entry caches; the file is named by
 // the key's hash (keys contain '/' and ':', which are awkward in filenames).
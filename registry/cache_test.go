@@ -45,6 +45,22 @@ func TestMemCacheExpiry(t *testing.T) {
 	}
 }
 
+func TestMemCacheRemove(t *testing.T) {
+	mc := NewMemCache()
+	for _, key := range []string{KeyTags + "a", KeyTags + "b", KeyStat + "a:1"} {
+		mc.Set(key, []byte("v"), 0)
+	}
+	if n := mc.RemovePrefix(KeyTags); n != 2 {
+		t.Errorf("removed %d, want 2", n)
+	}
+	if _, ok := mc.Get(KeyTags + "a"); ok {
+		t.Error("tag listing survived RemovePrefix")
+	}
+	if !mc.Remove(KeyStat+"a:1") || mc.Remove(KeyStat+"a:1") {
+		t.Error("Remove should report the entry once")
+	}
+}
+
 func TestCachedServesFromCache(t *testing.T) {
 	fake := NewFake()
 	fake.Set("reg.io/x:1", &ImageInfo{Digest: "sha256:a"})
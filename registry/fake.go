@@ -67,6 +67,51 @@ func (f *Fake) Stat(_ context.Context, ref string) (*ImageInfo, error) {
 	return &clone, nil
 }
 
+// Copy implements Writer.
+func (f *Fake) Copy(_ context.Context, src, dst string) error {
+	info, err := f.Stat(context.Background(), src)
+	if err != nil {
+		return err
+	}
+	f.Set(dst, info)
+	return nil
+}
+
+// Delete implements Writer.
+func (f *Fake) Delete(_ context.Context, ref string) error {
+	repo, tag := splitRef(ref)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.repos[repo][tag]; !ok {
+		return ErrNotExist
+	}
+	delete(f.repos[repo], tag)
+	return nil
+}
+
+// Annotate implements Writer. The fake adds the annotations to the recorded
+// info and, as a registry would, gives the tag a new digest.
+func (f *Fake) Annotate(ctx context.Context, ref string, annotations map[string]string) error {
+	info, err := f.Stat(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	next := *info
+	next.Annotations = map[string]string{}
+	for k, v := range info.Annotations {
+		next.Annotations[k] = v
+	}
+	for k, v := range annotations {
+		next.Annotations[k] = v
+	}
+	next.Digest = info.Digest + "+annotated"
+	f.Set(ref, &next)
+	return nil
+}
+
 // splitRef splits "repo:tag" into its parts. The tag is the substring after the
 // last colon that follows the last slash, so registry ports (e.g.
 // "localhost:5000/x:tag") are handled correctly. Returns an empty tag if none.
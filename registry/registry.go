@@ -1,6 +1,7 @@
-// Package registry abstracts read access to a container image registry behind
-// a narrow interface so that the concrete client (go-containerregistry), the
-// metadata cache and the test fake are interchangeable.
+// Package registry abstracts access to a container image registry behind
+// narrow interfaces so that the concrete client (go-containerregistry), the
+// metadata cache and the test fake are interchangeable. Reads go through
+// Registry; the few mutations clade performs go through Writer.
 //
 // Querying image metadata consumes registry rate limits, so callers are
 // expected to wrap a Registry with a cache (see WithCache).
@@ -26,6 +27,12 @@ type ImageInfo struct {
 	Created time.Time `json:"created"`
 	// Labels are the image config labels.
 	Labels map[string]string `json:"labels,omitempty"`
+	// Platforms lists the platforms the reference provides, "os/arch[/variant]":
+	// every entry of an image index (attestation manifests excluded), or the
+	// single platform of a plain image.
+	Platforms []string `json:"platforms,omitempty"`
+	// Annotations are the annotations of the manifest (or index) itself.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Registry provides read-only access to image metadata.
@@ -36,3 +43,18 @@ type Registry interface {
 	// ErrNotExist if the image is absent.
 	Stat(ctx context.Context, ref string) (*ImageInfo, error)
 }
+
+// Writer mutates tags in a registry. It is separate from Registry so read-only
+// decorators (e.g. the cache) need not implement it; Remote and Fake do.
+type Writer interface {
+	// Copy points the tag dst ("repo:tag") at the manifest src ("repo:tag")
+	// refers to. Both must be in the same repository; no blobs are copied.
+	Copy(ctx context.Context, src, dst string) error
+	// Delete removes the tag ref ("repo:tag"). It returns ErrNotExist if the
+	// tag is absent. Not every registry supports deleting a tag.
+	Delete(ctx context.Context, ref string) error
+	// Annotate rewrites the manifest (or index) ref ("repo:tag") points to with
+	// annotations added, and points ref at the result. This changes the digest
+	// of ref; other tags of the old manifest are left as they are.
+	Annotate(ctx context.Context, ref string, annotations map[string]string) error
+}
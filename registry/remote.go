@@ -8,6 +8,8 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	v1remote "github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
@@ -105,14 +107,130 @@ func (r *Remote) Stat(ctx context.Context, ref string) (*ImageInfo, error) {
 		return nil, fmt.Errorf("read config of %q: %w", ref, err)
 	}
 
+	var (
+		platforms   []string
+		annotations map[string]string
+	)
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, fmt.Errorf("resolve index %q: %w", ref, err)
+		}
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("read index of %q: %w", ref, err)
+		}
+		annotations = manifest.Annotations
+		for _, m := range manifest.Manifests {
+			// buildx stores attestations as "unknown/unknown" entries.
+			if m.Platform == nil || m.Platform.OS == "unknown" {
+				continue
+			}
+			platforms = append(platforms, m.Platform.String())
+		}
+	} else {
+		if p := cfg.Platform(); p != nil && p.OS != "" {
+			platforms = []string{p.String()}
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("read manifest of %q: %w", ref, err)
+		}
+		annotations = manifest.Annotations
+	}
+
 	return &ImageInfo{
-		Ref:     ref,
-		Digest:  desc.Digest.String(),
-		Created: cfg.Created.Time,
-		Labels:  cfg.Config.Labels,
+		Ref:         ref,
+		Digest:      desc.Digest.String(),
+		Created:     cfg.Created.Time,
+		Labels:      cfg.Config.Labels,
+		Platforms:   platforms,
+		Annotations: annotations,
 	}, nil
 }
 
+// Copy implements Writer.
+func (r *Remote) Copy(ctx context.Context, src, dst string) error {
+	from, err := name.ParseReference(src, r.nameOpts()...)
+	if err != nil {
+		return fmt.Errorf("parse reference %q: %w", src, err)
+	}
+	to, err := name.NewTag(dst, r.nameOpts()...)
+	if err != nil {
+		return fmt.Errorf("parse tag %q: %w", dst, err)
+	}
+	if from.Context() != to.Context() {
+		return fmt.Errorf("copy %q to %q: not in the same repository", src, dst)
+	}
+
+	desc, err := v1remote.Get(from, r.callOpts(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrNotExist
+		}
+		return fmt.Errorf("get %q: %w", src, err)
+	}
+	if err := v1remote.Tag(to, desc, r.callOpts(ctx)...); err != nil {
+		return fmt.Errorf("tag %q: %w", dst, err)
+	}
+	return nil
+}
+
+// Delete implements Writer. The tag itself is deleted (not the manifest it
+// points to, which other tags may share).
+func (r *Remote) Delete(ctx context.Context, ref string) error {
+	tag, err := name.NewTag(ref, r.nameOpts()...)
+	if err != nil {
+		return fmt.Errorf("parse tag %q: %w", ref, err)
+	}
+	if err := v1remote.Delete(tag, r.callOpts(ctx)...); err != nil {
+		if isNotFound(err) {
+			return ErrNotExist
+		}
+		return fmt.Errorf("delete %q: %w", ref, err)
+	}
+	return nil
+}
+
+// Annotate implements Writer. Only the top-level manifest is rewritten; the
+// layers and (for an index) the child manifests are referenced as they are.
+func (r *Remote) Annotate(ctx context.Context, ref string, annotations map[string]string) error {
+	tag, err := name.NewTag(ref, r.nameOpts()...)
+	if err != nil {
+		return fmt.Errorf("parse tag %q: %w", ref, err)
+	}
+
+	desc, err := v1remote.Get(tag, r.callOpts(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrNotExist
+		}
+		return fmt.Errorf("get %q: %w", ref, err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return fmt.Errorf("resolve index %q: %w", ref, err)
+		}
+		idx = mutate.Annotations(idx, annotations).(v1.ImageIndex)
+		if err := v1remote.WriteIndex(tag, idx, r.callOpts(ctx)...); err != nil {
+			return fmt.Errorf("write %q: %w", ref, err)
+		}
+		return nil
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return fmt.Errorf("resolve image %q: %w", ref, err)
+	}
+	img = mutate.Annotations(img, annotations).(v1.Image)
+	if err := v1remote.Write(tag, img, r.callOpts(ctx)...); err != nil {
+		return fmt.Errorf("write %q: %w", ref, err)
+	}
+	return nil
+}
+
 func isNotFound(err error) bool {
 	var terr *transport.Error
 	if errors.As(err, &terr) {
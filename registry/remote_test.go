@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	ggcrreg "github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
@@ -84,3 +85,136 @@ func TestRemoteAgainstInMemoryRegistry(t *testing.T) {
 		t.Errorf("stat absent err = %v, want ErrNotExist", err)
 	}
 }
+
+func TestRemoteIndexPlatforms(t *testing.T) {
+	srv := httptest.NewServer(ggcrreg.New())
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	var idx v1.ImageIndex = empty.Index
+	for _, p := range []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "unknown", Architecture: "unknown"}, // attestation manifest
+	} {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &p},
+		})
+	}
+
+	ref := host + "/team/multi:1.0.0"
+	reference, err := name.ParseReference(ref, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(reference, idx); err != nil {
+		t.Fatalf("push index: %v", err)
+	}
+
+	info, err := creg.NewRemote(creg.WithInsecure(true)).Stat(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	want := []string{"linux/amd64", "linux/arm64/v8"}
+	if strings.Join(info.Platforms, ",") != strings.Join(want, ",") {
+		t.Errorf("platforms = %v, want %v", info.Platforms, want)
+	}
+}
+
+func TestRemoteCopyDelete(t *testing.T) {
+	srv := httptest.NewServer(ggcrreg.New())
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	repo := host + "/team/app"
+	staging, err := name.NewTag(repo+":1-clade-x", name.Insecure)
+	if err != nil {
+		t.Fatalf("parse tag: %v", err)
+	}
+	if err := remote.Write(staging, img); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	want_digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+
+	r := creg.NewRemote(creg.WithInsecure(true))
+	ctx := context.Background()
+
+	if err := r.Copy(ctx, repo+":1-clade-x", repo+":1"); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if err := r.Delete(ctx, repo+":1-clade-x"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	info, err := r.Stat(ctx, repo+":1")
+	if err != nil {
+		t.Fatalf("stat copy: %v", err)
+	}
+	if info.Digest != want_digest.String() {
+		t.Errorf("digest = %q, want %q", info.Digest, want_digest.String())
+	}
+	if _, err := r.Stat(ctx, repo+":1-clade-x"); !errors.Is(err, creg.ErrNotExist) {
+		t.Errorf("staging tag after delete: %v", err)
+	}
+	if err := r.Delete(ctx, repo+":1-clade-x"); !errors.Is(err, creg.ErrNotExist) {
+		t.Errorf("second delete = %v, want ErrNotExist", err)
+	}
+	if err := r.Copy(ctx, repo+":1", host+"/other:1"); err == nil {
+		t.Error("expected error copying across repositories")
+	}
+}
+
+func TestRemoteAnnotate(t *testing.T) {
+	srv := httptest.NewServer(ggcrreg.New())
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	ref := host + "/team/app:18"
+	tag, err := name.NewTag(ref, name.Insecure)
+	if err != nil {
+		t.Fatalf("parse tag: %v", err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	r := creg.NewRemote(creg.WithInsecure(true))
+	ctx := context.Background()
+
+	before, err := r.Stat(ctx, ref)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if err := r.Annotate(ctx, ref, map[string]string{"dev.clade.eol": "2026-10-01"}); err != nil {
+		t.Fatalf("annotate: %v", err)
+	}
+	after, err := r.Stat(ctx, ref)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if after.Annotations["dev.clade.eol"] != "2026-10-01" {
+		t.Errorf("annotations = %v", after.Annotations)
+	}
+	if after.Digest == before.Digest {
+		t.Error("digest unchanged after annotating")
+	}
+	if err := r.Annotate(ctx, host+"/team/app:nope", nil); !errors.Is(err, creg.ErrNotExist) {
+		t.Errorf("annotate missing = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,284 @@
+// Package scaffold creates new ports. It suggests a select mapping from the
+// tags an upstream repository has, previews the tags the port would push, and
+// writes the port directory: a port.yaml, a Dockerfile built on the upstream
+// and a .dockerignore.
+package scaffold
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/lesomnus/clade/graph"
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/tag"
+)
+
+// Suggestion is a select mapping suggested for an upstream's tags, together
+// with the build tag templates that go with it.
+type Suggestion struct {
+	// Kind is the select kind, "semver" or "calver".
+	Kind string
+	// LastMajor, LastMinor and PreRelease configure a semver selection.
+	LastMajor  int
+	LastMinor  int
+	PreRelease string
+	// Layout and Last configure a calver selection.
+	Layout string
+	Last   int
+
+	// Tags are the suggested build.tags templates, canonical first.
+	Tags []string
+	// PreReleases are the semver pre-releases the upstream tags carry, such as
+	// "alpine", most common first.
+	PreReleases []string
+}
+
+// layouts are the calendar layouts tried, most specific first.
+var layouts = []string{"YYYY.0M.0D", "YYYY.0M", "YY.0M", "YYYYMMDD"}
+
+// Suggest inspects the tags of an upstream repository and suggests how to
+// select among them. Versions with pre-release are tracked when it is not
+// empty, as in "1.22.3-alpine"; it must be one the tags carry.
+//
+// Calendar tags, such as Ubuntu's "24.04", parse as semver too, so calver is
+// suggested when a layout explains most of the tags semver does.
+func Suggest(tags []string, pre_release string) (*Suggestion, error) {
+	s := &Suggestion{PreRelease: pre_release}
+
+	pre_counts := map[string]int{}
+	majors := map[uint64]bool{}
+	semvers := 0
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease() != "" {
+			pre_counts[v.Prerelease()]++
+		}
+		if v.Prerelease() == pre_release {
+			semvers++
+			majors[v.Major()] = true
+		}
+	}
+	s.PreReleases = byCount(pre_counts)
+	if pre_release != "" && semvers == 0 {
+		return nil, fmt.Errorf("no tag has the pre-release %q; they have %s", pre_release, oneOf(s.PreReleases))
+	}
+
+	if pre_release == "" {
+		for _, layout := range layouts {
+			n := calverCount(tags, layout)
+			if n > 0 && n*2 > semvers {
+				s.Kind, s.Layout, s.Last = "calver", layout, 2
+				s.Tags = []string{"{{.Version}}"}
+				return s, nil
+			}
+		}
+	}
+	if semvers == 0 {
+		return nil, errors.New("no tag is a semantic or calendar version")
+	}
+
+	s.Kind = "semver"
+	if len(majors) > 2 {
+		// Many major lines, as Node.js has: the newest minor of the latest two.
+		s.LastMajor, s.LastMinor = 2, 1
+	} else {
+		// Few major lines, as Go has: the latest two minors of the newest.
+		s.LastMajor, s.LastMinor = 1, 2
+	}
+	suffix := ""
+	if pre_release != "" {
+		suffix = "-" + pre_release
+	}
+	s.Tags = []string{
+		"{{.Major}}.{{.Minor}}.{{.Patch}}" + suffix,
+		"{{.Major}}.{{.Minor}}" + suffix,
+	}
+	return s, nil
+}
+
+// calverCount counts the tags that are plausible dates in layout.
+func calverCount(tags []string, layout string) int {
+	sel, err := tag.New("calver", []byte("layout: "+strconv.Quote(layout)))
+	if err != nil {
+		return 0
+	}
+	matched, err := sel.Select(tags)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, m := range matched {
+		cv, ok := m.Data.(*tag.CalVer)
+		if !ok {
+			continue
+		}
+		year, _ := strconv.Atoi(cv.Year)
+		if len(cv.Year) == 2 {
+			year += 2000
+		}
+		if year < 2010 {
+			continue
+		}
+		if month, err := strconv.Atoi(cv.Month); err != nil || month < 1 || month > 12 {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func byCount(counts map[string]int) []string {
+	out := make([]string, 0, len(counts))
+	for k := range counts {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if counts[out[i]] != counts[out[j]] {
+			return counts[out[i]] > counts[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+func oneOf(vs []string) string {
+	if len(vs) == 0 {
+		return "none"
+	}
+	if len(vs) > 8 {
+		return strings.Join(vs[:8], ", ") + ", ..."
+	}
+	return strings.Join(vs, ", ")
+}
+
+// Select returns the select mapping of s as YAML, kind first.
+func (s *Suggestion) Select() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "kind: %s\n", s.Kind)
+	switch s.Kind {
+	case "calver":
+		fmt.Fprintf(&b, "layout: %s\n", strconv.Quote(s.Layout))
+		fmt.Fprintf(&b, "last: %d\n", s.Last)
+	default:
+		fmt.Fprintf(&b, "last-major: %d\n", s.LastMajor)
+		fmt.Fprintf(&b, "last-minor: %d\n", s.LastMinor)
+		if s.PreRelease != "" {
+			fmt.Fprintf(&b, "pre-release: %s\n", s.PreRelease)
+		}
+	}
+	return b.String()
+}
+
+// Target is an upstream tag the port would build on and the tags the image
+// built on it would be pushed as.
+type Target struct {
+	Upstream string
+	Tags     []string
+}
+
+// Preview selects among tags as p does and renders its build tags for each
+// selected version. p is the port a new one loads as (see New), so the
+// preview shows the tags it would push with the defaults applied.
+func Preview(p *port.Port, tags []string) ([]Target, error) {
+	f, err := graph.NewFamily(p, nil)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := f.Selector.Select(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Target, 0, len(matched))
+	for _, m := range matched {
+		target := Target{Upstream: m.Tag}
+		if target.Tags, err = f.Tags(m); err != nil {
+			return nil, err
+		}
+		out = append(out, target)
+	}
+	return out, nil
+}
+
+// New returns the files of a new port in dir that builds the container source
+// on repo into build, selecting as s suggests, by name, and the port they load
+// as under l. The suggested build.tags are written only when the defaults
+// that apply in dir give none, so as not to override them.
+func New(l *port.Loader, dir, source, build string, s *Suggestion) (map[string][]byte, *port.Port, error) {
+	files := Files(source, build, s, false)
+	if p, err := l.LoadData(dir, files[port.Filename]); err == nil && len(p.Build.Tags) > 0 {
+		return files, p, nil
+	}
+	files = Files(source, build, s, true)
+	p, err := l.LoadData(dir, files[port.Filename])
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, p, nil
+}
+
+// Files returns the files of a new port that builds the container source on
+// repo into build, selecting as s suggests, by name. The suggested build.tags
+// are written when with_tags is set.
+func Files(source, build string, s *Suggestion, with_tags bool) map[string][]byte {
+	var b strings.Builder
+	b.WriteString("source:\n  kind: container\n")
+	fmt.Fprintf(&b, "  repo: %s\n", source)
+	b.WriteString("select:\n")
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(s.Select(), "\n"), "\n") {
+		b.WriteString("  " + line)
+	}
+	b.WriteString("\nbuild:\n")
+	fmt.Fprintf(&b, "  repo: %s\n", build)
+	if with_tags {
+		b.WriteString("  tags:\n")
+		for _, t := range s.Tags {
+			fmt.Fprintf(&b, "    - %s\n", strconv.Quote(t))
+		}
+	}
+
+	return map[string][]byte{
+		port.Filename: []byte(b.String()),
+		"Dockerfile":  []byte("ARG BASE\nFROM ${BASE}\n"),
+		// The manifests are not part of the image.
+		".dockerignore": []byte("port.yaml\nport.*.yaml\n_defaults.yaml\n"),
+	}
+}
+
+// Create writes files into dir, creating it. It fails without writing any
+// file if one of them exists.
+func Create(dir string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("%s already exists", p)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), files[name], 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
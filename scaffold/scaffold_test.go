@@ -0,0 +1,133 @@
+package scaffold_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/port"
+	"github.com/lesomnus/clade/scaffold"
+)
+
+var golang = []string{
+	"1.21.0", "1.21.5", "1.22.0", "1.22.3", "1.22.3-alpine", "1.22.3-bookworm", "1.22-alpine",
+	"1.21.5-alpine", "latest", "alpine",
+}
+
+// preview previews the tags a port selecting as s suggests would push.
+func preview(t *testing.T, s *scaffold.Suggestion, tags []string) ([]scaffold.Target, error) {
+	t.Helper()
+	_, p, err := scaffold.New(&port.Loader{}, t.TempDir(), "docker.io/library/golang", "ghcr.io/me/golang", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scaffold.Preview(p, tags)
+}
+
+func TestSuggestSemver(t *testing.T) {
+	s, err := scaffold.Suggest(golang, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Kind != "semver" || s.LastMajor != 1 || s.LastMinor != 2 {
+		t.Errorf("suggestion = %+v", s)
+	}
+	if got := strings.Join(s.PreReleases, ","); got != "alpine,bookworm" {
+		t.Errorf("pre-releases = %s", got)
+	}
+
+	targets, err := preview(t, s, golang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].Upstream != "1.22.3" || strings.Join(targets[0].Tags, ",") != "1.22.3,1.22" {
+		t.Errorf("targets = %+v", targets)
+	}
+
+	s, err = scaffold.Suggest(golang, "alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err = preview(t, s, golang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || strings.Join(targets[0].Tags, ",") != "1.22.3-alpine,1.22-alpine" || targets[1].Upstream != "1.21.5-alpine" {
+		t.Errorf("alpine targets = %+v", targets)
+	}
+
+	if _, err := scaffold.Suggest(golang, "slim"); err == nil || !strings.Contains(err.Error(), "alpine, bookworm") {
+		t.Errorf("unknown pre-release: err = %v", err)
+	}
+}
+
+func TestSuggestMajors(t *testing.T) {
+	s, err := scaffold.Suggest([]string{"18.20.4", "20.15.1", "20.16.0", "22.4.0", "22.5.1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.LastMajor != 2 || s.LastMinor != 1 {
+		t.Errorf("suggestion = %+v", s)
+	}
+}
+
+func TestSuggestCalver(t *testing.T) {
+	tags := []string{"20.04", "22.04", "24.04", "24.10", "jammy", "noble-20240904"}
+	s, err := scaffold.Suggest(tags, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Kind != "calver" || s.Layout != "YY.0M" {
+		t.Fatalf("suggestion = %+v", s)
+	}
+	targets, err := preview(t, s, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[0].Upstream != "24.10" || targets[0].Tags[0] != "24.10" {
+		t.Errorf("targets = %+v", targets)
+	}
+
+	if _, err := scaffold.Suggest([]string{"latest", "stable"}, ""); err == nil {
+		t.Error("expected error for unversioned tags")
+	}
+}
+
+func TestCreate(t *testing.T) {
+	s, err := scaffold.Suggest(golang, "alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "golang")
+	files := scaffold.Files("docker.io/library/golang", "ghcr.io/me/golang", s, true)
+	if err := scaffold.Create(dir, files); err != nil {
+		t.Fatal(err)
+	}
+
+	// The manifest loads as the suggestion describes.
+	p, err := port.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Source.Repo != "docker.io/library/golang" || p.Build.Repo != "ghcr.io/me/golang" || p.Select.Kind != "semver" {
+		t.Errorf("port = %+v", p)
+	}
+	if strings.Join(p.Build.Tags, ",") != "{{.Major}}.{{.Minor}}.{{.Patch}}-alpine,{{.Major}}.{{.Minor}}-alpine" {
+		t.Errorf("tags = %v", p.Build.Tags)
+	}
+	if !strings.Contains(string(p.Select.Params), "pre-release: alpine") {
+		t.Errorf("select = %s", p.Select.Params)
+	}
+
+	// An existing port is not overwritten.
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scaffold.Create(dir, files); err == nil {
+		t.Error("expected error for an existing port")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "Dockerfile")); string(data) != "FROM mine\n" {
+		t.Errorf("Dockerfile = %q", data)
+	}
+}
@@ -0,0 +1,83 @@
+package sign
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	Register("cosign", newCosign)
+}
+
+// cosign signs by running the cosign CLI, so everything it supports (keyless
+// signing through Fulcio and Rekor, KMS keys, hardware tokens) is available.
+// Without a key, signing is keyless.
+type cosign struct {
+	opts Options
+}
+
+func newCosign(opts Options) (Signer, error) {
+	if opts.Bin == "" {
+		opts.Bin = "cosign"
+	}
+	return &cosign{opts: opts}, nil
+}
+
+func (c *cosign) args(sub string) []string {
+	args := []string{sub, "--yes"}
+	if c.opts.Key != "" {
+		args = append(args, "--key", c.opts.Key)
+	}
+	if c.opts.Insecure {
+		args = append(args, "--allow-insecure-registry")
+	}
+	return append(args, c.opts.Args...)
+}
+
+// Sign implements Signer.
+func (c *cosign) Sign(ctx context.Context, ref string) error {
+	return c.run(ctx, append(c.args("sign"), ref))
+}
+
+// Attest implements Signer. The predicate is handed over in a temporary file.
+func (c *cosign) Attest(ctx context.Context, ref string, predicateType string, predicate any) error {
+	b, err := marshalPredicate(predicate)
+	if err != nil {
+		return err
+	}
+
+	path := "predicate.json"
+	if !c.opts.DryRun {
+		f, err := os.CreateTemp("", "clade-predicate-*.json")
+		if err != nil {
+			return fmt.Errorf("create predicate file: %w", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			return fmt.Errorf("write predicate file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("write predicate file: %w", err)
+		}
+		path = f.Name()
+	}
+	return c.run(ctx, append(c.args("attest"), "--type", predicateType, "--predicate", path, ref))
+}
+
+func (c *cosign) run(ctx context.Context, args []string) error {
+	if c.opts.DryRun {
+		fmt.Fprintln(c.opts.Stdout, c.opts.Bin+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, c.opts.Bin, args...)
+	cmd.Stdout, cmd.Stderr = c.opts.Stdout, c.opts.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", c.opts.Bin, args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package sign
+
+import "context"
+
+// Fake is a Signer for tests. It records every signed and attested reference.
+type Fake struct {
+	Signed   []string
+	Attested []FakeAttestation
+}
+
+// FakeAttestation is one recorded Attest.
+type FakeAttestation struct {
+	Ref           string
+	PredicateType string
+	Predicate     any
+}
+
+// Sign implements Signer.
+func (f *Fake) Sign(_ context.Context, ref string) error {
+	f.Signed = append(f.Signed, ref)
+	return nil
+}
+
+// Attest implements Signer.
+func (f *Fake) Attest(_ context.Context, ref string, predicateType string, predicate any) error {
+	f.Attested = append(f.Attested, FakeAttestation{Ref: ref, PredicateType: predicateType, Predicate: predicate})
+	return nil
+}
@@ -0,0 +1,286 @@
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func init() {
+	Register("key", newKeySigner)
+}
+
+// Media types and annotations of cosign's signature and attestation images.
+const (
+	SimpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	DSSEMediaType          types.MediaType = "application/vnd.dsse.envelope.v1+json"
+
+	SignatureAnnotation     = "dev.cosignproject.cosign/signature"
+	PredicateTypeAnnotation = "predicateType"
+
+	// InTotoPayloadType is the DSSE payload type of an in-toto statement.
+	InTotoPayloadType = "application/vnd.in-toto+json"
+)
+
+// keySigner signs in-process with a private key and writes the signature and
+// attestation images itself:
+//
+//	<repo>:sha256-<hex>.sig  one simple-signing payload layer per signature
+//	<repo>:sha256-<hex>.att  one DSSE envelope layer per attestation
+//
+// Layers are appended to an existing image under the tag, as cosign does, so
+// earlier signatures (e.g. from another key) are kept.
+type keySigner struct {
+	key  crypto.Signer
+	opts Options
+}
+
+func newKeySigner(opts Options) (Signer, error) {
+	if opts.Key == "" {
+		return nil, fmt.Errorf("sign: kind key requires a key file")
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = io.Discard
+	}
+	if opts.DryRun {
+		return &keySigner{opts: opts}, nil
+	}
+
+	data, err := os.ReadFile(opts.Key)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	key, err := LoadPrivateKey(data, []byte(os.Getenv("COSIGN_PASSWORD")))
+	if err != nil {
+		return nil, fmt.Errorf("load key %s: %w", opts.Key, err)
+	}
+	return &keySigner{key: key, opts: opts}, nil
+}
+
+// simpleSigning is the payload cosign signs for an image signature.
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+// Sign implements Signer.
+func (s *keySigner) Sign(ctx context.Context, ref string) error {
+	if s.opts.DryRun {
+		fmt.Fprintf(s.opts.Stdout, "sign %s\n", ref)
+		return nil
+	}
+
+	d, err := s.parse(ref)
+	if err != nil {
+		return err
+	}
+
+	var p simpleSigning
+	p.Critical.Identity.DockerReference = d.Context().Name()
+	p.Critical.Image.DockerManifestDigest = d.DigestStr()
+	p.Critical.Type = "cosign container image signature"
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encode payload: %w", err)
+	}
+
+	sig, err := s.sign(payload)
+	if err != nil {
+		return err
+	}
+	layer := static.NewLayer(payload, SimpleSigningMediaType)
+	annotations := map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+	if err := s.attach(ctx, d, "sig", layer, annotations); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.opts.Stdout, "signed %s\n", d)
+	return nil
+}
+
+// envelope is a DSSE envelope.
+type envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []signature `json:"signatures"`
+}
+
+type signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Attest implements Signer.
+func (s *keySigner) Attest(ctx context.Context, ref string, predicateType string, predicate any) error {
+	if s.opts.DryRun {
+		fmt.Fprintf(s.opts.Stdout, "attest %s %s\n", ref, predicateType)
+		return nil
+	}
+
+	d, err := s.parse(ref)
+	if err != nil {
+		return err
+	}
+	st, err := NewStatement(ref, predicateType, predicate)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("encode statement: %w", err)
+	}
+
+	sig, err := s.sign(PAE(InTotoPayloadType, payload))
+	if err != nil {
+		return err
+	}
+	env, err := json.Marshal(envelope{
+		PayloadType: InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []signature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+	if err != nil {
+		return fmt.Errorf("encode envelope: %w", err)
+	}
+
+	layer := static.NewLayer(env, DSSEMediaType)
+	annotations := map[string]string{PredicateTypeAnnotation: predicateType}
+	if err := s.attach(ctx, d, "att", layer, annotations); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.opts.Stdout, "attested %s (%s)\n", d, predicateType)
+	return nil
+}
+
+// PAE is the DSSE pre-authentication encoding, the bytes an envelope's
+// signature covers.
+func PAE(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
+
+func (s *keySigner) sign(msg []byte) ([]byte, error) {
+	var (
+		sig []byte
+		err error
+	)
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		sig, err = s.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(msg)
+		sig, err = s.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	return sig, nil
+}
+
+func (s *keySigner) parse(ref string) (name.Digest, error) {
+	var opts []name.Option
+	if s.opts.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	d, err := name.NewDigest(ref, opts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("parse digest reference %q: %w", ref, err)
+	}
+	return d, nil
+}
+
+// attach appends layer to the image tagged "sha256-<hex>.<suffix>" in the
+// image's repository, creating it if absent.
+func (s *keySigner) attach(ctx context.Context, d name.Digest, suffix string, layer v1.Layer, annotations map[string]string) error {
+	tag := d.Context().Tag(strings.Replace(d.DigestStr(), ":", "-", 1) + "." + suffix)
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+
+	base, err := remote.Image(tag, opts...)
+	if err != nil {
+		var terr *transport.Error
+		if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("get %s: %w", tag, err)
+		}
+		base = mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	}
+
+	img, err := mutate.Append(base, mutate.Addendum{Layer: layer, Annotations: annotations})
+	if err != nil {
+		return fmt.Errorf("append layer: %w", err)
+	}
+	if err := remote.Write(tag, img, opts...); err != nil {
+		return fmt.Errorf("push %s: %w", tag, err)
+	}
+	return nil
+}
+
+// LoadPrivateKey decodes a PEM private key: a cosign key pair's
+// "ENCRYPTED SIGSTORE PRIVATE KEY" (or the older "ENCRYPTED COSIGN PRIVATE
+// KEY"), decrypted with password, or an unencrypted PKCS#8, SEC 1 or PKCS#1
+// key. ECDSA, RSA and Ed25519 keys are supported.
+func LoadPrivateKey(data []byte, password []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		var err error
+		if der, err = decrypt(block.Bytes, password); err != nil {
+			return nil, err
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
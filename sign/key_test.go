@@ -0,0 +1,272 @@
+package sign_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrreg "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/lesomnus/clade/sign"
+)
+
+// pushRandom pushes a random image to an in-process registry and returns its
+// digest reference.
+func pushRandom(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(ggcrreg.New())
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(host+"/team/app:1", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host + "/team/app@" + d.String()
+}
+
+func writeKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cosign.key")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fetchLayer returns the single layer of the image tagged tag, with its
+// annotations.
+func fetchLayer(t *testing.T, tag string) ([]byte, map[string]string) {
+	t.Helper()
+	ref, err := name.NewTag(tag, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remote.Image(ref)
+	if err != nil {
+		t.Fatalf("get %s: %v", tag, err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Layers) != 1 {
+		t.Fatalf("%s: %d layers, want 1", tag, len(m.Layers))
+	}
+	layer, err := img.LayerByDigest(m.Layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, m.Layers[0].Annotations
+}
+
+func verify(t *testing.T, pub *ecdsa.PublicKey, msg []byte, sig64 string) {
+	t.Helper()
+	sig, err := base64.StdEncoding.DecodeString(sig64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(msg)
+	if !ecdsa.VerifyASN1(pub, sum[:], sig) {
+		t.Error("signature does not verify")
+	}
+}
+
+func TestKeySigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := pushRandom(t)
+	repo, digest, _ := strings.Cut(ref, "@")
+	hex := strings.TrimPrefix(digest, "sha256:")
+
+	s, err := sign.New("key", sign.Options{Key: writeKey(t, key), Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := s.Sign(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	payload, ann := fetchLayer(t, repo+":sha256-"+hex+".sig")
+	verify(t, &key.PublicKey, payload, ann[sign.SignatureAnnotation])
+
+	var p struct {
+		Critical struct {
+			Identity struct {
+				DockerReference string `json:"docker-reference"`
+			} `json:"identity"`
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Critical.Image.DockerManifestDigest != digest || p.Critical.Identity.DockerReference != repo {
+		t.Errorf("payload = %s", payload)
+	}
+
+	predicate := map[string]string{"base": "up:1"}
+	if err := s.Attest(ctx, ref, "https://example.com/p", predicate); err != nil {
+		t.Fatal(err)
+	}
+	env, ann := fetchLayer(t, repo+":sha256-"+hex+".att")
+	if ann[sign.PredicateTypeAnnotation] != "https://example.com/p" {
+		t.Errorf("annotations = %v", ann)
+	}
+
+	var e struct {
+		PayloadType string `json:"payloadType"`
+		Payload     []byte `json:"payload"`
+		Signatures  []struct {
+			Sig string `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(env, &e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Signatures) != 1 {
+		t.Fatalf("envelope = %s", env)
+	}
+	verify(t, &key.PublicKey, sign.PAE(e.PayloadType, e.Payload), e.Signatures[0].Sig)
+
+	var st sign.Statement
+	if err := json.Unmarshal(e.Payload, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Subject[0].Name != repo || st.Subject[0].Digest["sha256"] != hex {
+		t.Errorf("subject = %+v", st.Subject)
+	}
+	if got := st.Predicate.(map[string]any)["base"]; got != "up:1" {
+		t.Errorf("predicate = %v", st.Predicate)
+	}
+
+	// Signing again appends to the existing signature image.
+	if err := s.Sign(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := remote.Image(mustTag(t, repo+":sha256-"+hex+".sig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := sig.Manifest(); len(m.Layers) != 2 {
+		t.Errorf("layers after re-signing = %d, want 2", len(m.Layers))
+	}
+}
+
+func mustTag(t *testing.T, s string) name.Tag {
+	t.Helper()
+	tag, err := name.NewTag(s, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func TestLoadEncryptedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seal the key the way `cosign generate-key-pair` does.
+	salt, nonce := make([]byte, 32), [24]byte{}
+	rand.Read(salt)
+	rand.Read(nonce[:])
+	secret, err := scrypt.Key([]byte("pw"), salt, 1<<10, 8, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var k [32]byte
+	copy(k[:], secret)
+	body, err := json.Marshal(map[string]any{
+		"kdf":        map[string]any{"name": "scrypt", "params": map[string]int{"N": 1 << 10, "r": 8, "p": 1}, "salt": salt},
+		"cipher":     map[string]any{"name": "nacl/secretbox", "nonce": nonce[:]},
+		"ciphertext": secretbox.Seal(nil, der, &nonce, &k),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: body})
+
+	got, err := sign.LoadPrivateKey(data, []byte("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.(*ecdsa.PrivateKey).Equal(key) {
+		t.Error("decrypted key differs")
+	}
+	if _, err := sign.LoadPrivateKey(data, []byte("wrong")); err == nil {
+		t.Error("expected error for a wrong password")
+	}
+}
+
+func TestCosignDryRun(t *testing.T) {
+	var out strings.Builder
+	s, err := sign.New("cosign", sign.Options{Key: "k8s://ns/key", DryRun: true, Stdout: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := "ghcr.io/me/app@sha256:" + strings.Repeat("a", 64)
+	if err := s.Sign(context.Background(), ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Attest(context.Background(), ref, "https://slsa.dev/provenance/v1", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "cosign sign --yes --key k8s://ns/key " + ref + "\n" +
+		"cosign attest --yes --key k8s://ns/key --type https://slsa.dev/provenance/v1 --predicate predicate.json " + ref + "\n"
+	if out.String() != want {
+		t.Errorf("dry run\n got: %q\nwant: %q", out.String(), want)
+	}
+}
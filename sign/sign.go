@@ -0,0 +1,108 @@
+// Package sign signs pushed images and attaches in-toto attestations to them,
+// in the layout cosign uses, so `cosign verify` and `cosign verify-attestation`
+// accept what clade produces. Each signing strategy registers itself by kind;
+// `key` signs in-process with a key file and `cosign` hands off to the cosign
+// CLI (which also covers keyless signing).
+package sign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Options configure a Signer. Not every kind uses every field.
+type Options struct {
+	// Key is the signing key: a file path for kind key, and anything cosign's
+	// --key accepts for kind cosign (empty there means keyless).
+	Key string
+	// Bin is the cosign binary for kind cosign (default "cosign").
+	Bin string
+	// Args are extra arguments passed to every cosign invocation.
+	Args []string
+	// Insecure allows plain-HTTP registries.
+	Insecure bool
+
+	// DryRun prints what would be signed instead of signing.
+	DryRun bool
+	// Stdout receives dry-run output and command output.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Signer signs images by digest. ref is "repo@sha256:..."; signatures and
+// attestations are stored next to the image in its repository.
+type Signer interface {
+	// Sign attaches a signature of the image.
+	Sign(ctx context.Context, ref string) error
+	// Attest attaches a signed in-toto statement with the given predicate
+	// about the image.
+	Attest(ctx context.Context, ref string, predicateType string, predicate any) error
+}
+
+// Factory constructs a Signer.
+type Factory func(opts Options) (Signer, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a signing strategy available under kind. It panics on a
+// duplicate registration and is intended to be called from init.
+func Register(kind string, f Factory) {
+	if _, dup := factories[kind]; dup {
+		panic(fmt.Sprintf("sign: kind %q already registered", kind))
+	}
+	factories[kind] = f
+}
+
+// New constructs the Signer registered under kind.
+func New(kind string, opts Options) (Signer, error) {
+	f, ok := factories[kind]
+	if !ok {
+		return nil, fmt.Errorf("sign: unknown kind %q", kind)
+	}
+	return f(opts)
+}
+
+// Statement is an in-toto statement about a single image.
+type Statement struct {
+	Type          string    `json:"_type"`
+	PredicateType string    `json:"predicateType"`
+	Subject       []Subject `json:"subject"`
+	Predicate     any       `json:"predicate"`
+}
+
+// Subject identifies an artifact by name and digest.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// StatementType is the in-toto statement version cosign emits.
+const StatementType = "https://in-toto.io/Statement/v0.1"
+
+// NewStatement returns the statement attesting predicate about ref.
+func NewStatement(ref string, predicateType string, predicate any) (*Statement, error) {
+	d, err := name.NewDigest(ref)
+	if err != nil {
+		return nil, fmt.Errorf("parse digest reference %q: %w", ref, err)
+	}
+	algo, hex, _ := strings.Cut(d.DigestStr(), ":")
+	return &Statement{
+		Type:          StatementType,
+		PredicateType: predicateType,
+		Subject:       []Subject{{Name: d.Context().Name(), Digest: map[string]string{algo: hex}}},
+		Predicate:     predicate,
+	}, nil
+}
+
+func marshalPredicate(predicate any) ([]byte, error) {
+	b, err := json.Marshal(predicate)
+	if err != nil {
+		return nil, fmt.Errorf("encode predicate: %w", err)
+	}
+	return b, nil
+}
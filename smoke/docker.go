@@ -0,0 +1,114 @@
+package smoke
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/lesomnus/clade/builder"
+)
+
+// Docker runs commands with `docker run --rm`, overriding the image's
+// entrypoint so the step's argv runs as-is. Env and Stat need no shell in the
+// image, so they work on distroless and scratch images too.
+type Docker struct {
+	// Bin is the docker binary (default "docker"), or a CLI compatible with
+	// it such as podman.
+	Bin string
+	// DryRun prints each command to Stdout instead of running it.
+	DryRun bool
+	Stdout io.Writer
+}
+
+func (d Docker) argv(image string, argv []string) []string {
+	args := []string{"run", "--rm", "--entrypoint", argv[0], image}
+	return append(args, argv[1:]...)
+}
+
+func (d Docker) bin() string {
+	if d.Bin == "" {
+		return "docker"
+	}
+	return d.Bin
+}
+
+// Run implements Runner.
+func (d Docker) Run(ctx context.Context, image string, argv []string) (Result, error) {
+	if len(argv) == 0 {
+		return Result{}, fmt.Errorf("empty command")
+	}
+	return d.exec(ctx, d.argv(image, argv), nil)
+}
+
+// Env implements Runner, reading the environment from the image config.
+func (d Docker) Env(ctx context.Context, image string) (Result, error) {
+	return d.exec(ctx, []string{"image", "inspect", "--format", "{{range .Config.Env}}{{println .}}{{end}}", image}, nil)
+}
+
+// Stat implements Runner. It copies path out of a container created, but
+// never started, from the image, and removes the container again.
+func (d Docker) Stat(ctx context.Context, image string, path string) (Result, error) {
+	if d.DryRun {
+		for _, args := range [][]string{{"create", image, "true"}, {"cp", "<container>:" + path, "-"}, {"rm", "<container>"}} {
+			fmt.Fprintln(d.Stdout, builder.ShellCommand(d.bin(), args))
+		}
+		return Result{Skipped: true}, nil
+	}
+
+	var id bytes.Buffer
+	res, err := d.exec(ctx, []string{"create", image, "true"}, &id)
+	if err != nil {
+		return Result{}, err
+	}
+	if res.ExitCode != 0 {
+		return Result{}, fmt.Errorf("create a container of %s: %s", image, res.Output)
+	}
+	container := strings.TrimSpace(id.String())
+	defer d.exec(context.WithoutCancel(ctx), []string{"rm", container}, nil)
+
+	// The archive written to stdout is not needed, only whether it could be.
+	return d.exec(ctx, []string{"cp", container + ":" + path, "-"}, io.Discard)
+}
+
+// exec runs bin with args. The output of the result is the combined stdout and
+// stderr, or only stderr when stdout is given.
+func (d Docker) exec(ctx context.Context, args []string, stdout io.Writer) (Result, error) {
+	bin := d.bin()
+	if d.DryRun {
+		fmt.Fprintln(d.Stdout, builder.ShellCommand(bin, args))
+		return Result{Skipped: true}, nil
+	}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	err := cmd.Run()
+
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return Result{Output: out.String()}, nil
+	case errors.As(err, &exit):
+		return Result{Output: out.String(), ExitCode: exit.ExitCode()}, nil
+	default:
+		return Result{}, fmt.Errorf("%s %s: %w", bin, strings.Join(args, " "), err)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
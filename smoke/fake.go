@@ -0,0 +1,37 @@
+package smoke
+
+import (
+	"context"
+	"strings"
+)
+
+// Fake is a Runner for tests. It answers each command from Results, keyed by
+// the space-joined argv (an unknown command succeeds with no output), and
+// records every call. Env is recorded as the argv "env" and Stat as
+// "stat <path>".
+type Fake struct {
+	Results map[string]Result
+	Calls   []FakeCall
+}
+
+// FakeCall is one recorded Run.
+type FakeCall struct {
+	Image string
+	Argv  []string
+}
+
+// Run implements Runner.
+func (f *Fake) Run(_ context.Context, image string, argv []string) (Result, error) {
+	f.Calls = append(f.Calls, FakeCall{Image: image, Argv: argv})
+	return f.Results[strings.Join(argv, " ")], nil
+}
+
+// Env implements Runner.
+func (f *Fake) Env(ctx context.Context, image string) (Result, error) {
+	return f.Run(ctx, image, []string{"env"})
+}
+
+// Stat implements Runner.
+func (f *Fake) Stat(ctx context.Context, image string, path string) (Result, error) {
+	return f.Run(ctx, image, []string{"stat", path})
+}
@@ -0,0 +1,319 @@
+// Package smoke runs a port's smoke tests against a freshly built image, so a
+// broken image is caught before it is pushed and its floating tags overwrite a
+// working one.
+//
+// Tests are declared under `test` in port.yaml as a list of steps. Each step is
+// one assertion, evaluated by running a command inside the image, or, for file
+// and env steps, by inspecting the image without running anything in it:
+//
+//	test:
+//	  - name: go runs
+//	    run: [go, version]
+//	    stdout: ["^go version go1\\."]
+//	  - file: /usr/local/go/bin/go
+//	  - env: { GOPATH: /go }
+//	  - structure: tests.yaml   # a container-structure-test file
+//
+// The command runner is an interface so the docker invocation can be faked.
+package smoke
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/lesomnus/clade/builder"
+)
+
+// Step is one smoke-test assertion. Exactly one of Run, File or Env is set once
+// a suite is parsed (a Structure step is expanded into such steps).
+type Step struct {
+	// Name describes the step in errors; a default is derived when empty.
+	Name string `yaml:"name"`
+
+	// Run is a command to run in the image. It must exit with ExitCode, and
+	// its combined output must match every Stdout regular expression.
+	Run      []string `yaml:"run"`
+	ExitCode int      `yaml:"exit-code"`
+	Stdout   []string `yaml:"stdout"`
+
+	// File is a path that must exist in the image (or must not, when Absent).
+	File   string `yaml:"file"`
+	Absent bool   `yaml:"absent"`
+
+	// Env are environment variables the image must define with these values.
+	Env map[string]string `yaml:"env"`
+
+	// Structure is a container-structure-test YAML file, relative to the port
+	// directory, whose command, file-existence and env tests are added.
+	Structure string `yaml:"structure"`
+}
+
+// StepSchema is the JSON Schema of a step as written in a port's test list.
+const StepSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "description": "describes the step in errors"},
+		"run": {"type": "array", "items": {"type": "string"}, "minItems": 1, "description": "command to run in the image"},
+		"exit-code": {"type": "integer", "description": "exit code run must exit with (default 0)"},
+		"stdout": {"type": "array", "items": {"type": "string"}, "description": "regular expressions the output must match"},
+		"file": {"type": "string", "description": "path that must exist in the image"},
+		"absent": {"type": "boolean", "description": "file must not exist instead"},
+		"env": {"type": "object", "additionalProperties": {"type": ["string", "number", "boolean"]}, "description": "environment variables the image must define"},
+		"structure": {"type": "string", "description": "container-structure-test file, relative to the port"}
+	},
+	"additionalProperties": false
+}`
+
+// Suite is a parsed list of steps.
+type Suite []Step
+
+// Parse decodes the raw `test` list of a port. dir is the port directory that
+// Structure files resolve against.
+func Parse(params []byte, dir string) (Suite, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+
+	var steps []Step
+	if err := yaml.Unmarshal(params, &steps); err != nil {
+		return nil, fmt.Errorf("decode test: %w", err)
+	}
+
+	suite := Suite{}
+	for i, s := range steps {
+		if s.Structure != "" {
+			more, err := loadStructure(filepath.Join(dir, s.Structure))
+			if err != nil {
+				return nil, fmt.Errorf("test[%d]: %w", i, err)
+			}
+			suite = append(suite, more...)
+			continue
+		}
+
+		n := 0
+		for _, set := range []bool{len(s.Run) > 0, s.File != "", len(s.Env) > 0} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return nil, fmt.Errorf("test[%d]: exactly one of run, file, env or structure is required", i)
+		}
+		for _, re := range s.Stdout {
+			if _, err := regexp.Compile(re); err != nil {
+				return nil, fmt.Errorf("test[%d]: stdout: %w", i, err)
+			}
+		}
+		suite = append(suite, s)
+	}
+	return suite, nil
+}
+
+// Result is the outcome of one command run in an image.
+type Result struct {
+	// Output is the combined stdout and stderr.
+	Output   string
+	ExitCode int
+	// Skipped is set by a runner that only prints the command (a dry run);
+	// the step's assertions are not evaluated.
+	Skipped bool
+}
+
+// Runner runs a command inside an image. A non-zero exit is reported through
+// Result.ExitCode; the error is for failures to run at all.
+type Runner interface {
+	Run(ctx context.Context, image string, argv []string) (Result, error)
+	// Env reports the environment of the image config, one KEY=VALUE per line
+	// of the output.
+	Env(ctx context.Context, image string) (Result, error)
+	// Stat reports whether path exists in the image's filesystem: the exit
+	// code is zero when it does.
+	Stat(ctx context.Context, image string, path string) (Result, error)
+}
+
+// Logged runs commands through r and writes each of them, with its output and
+// a non-zero exit code, to w, e.g. a node's build log.
+func Logged(r Runner, w io.Writer) Runner {
+	return logged{r: r, w: w}
+}
+
+type logged struct {
+	r Runner
+	w io.Writer
+}
+
+func (l logged) Run(ctx context.Context, image string, argv []string) (Result, error) {
+	if len(argv) == 0 {
+		return l.r.Run(ctx, image, argv)
+	}
+	return l.log(image, builder.ShellCommand(argv[0], argv[1:]), func() (Result, error) {
+		return l.r.Run(ctx, image, argv)
+	})
+}
+
+func (l logged) Env(ctx context.Context, image string) (Result, error) {
+	return l.log(image, "env of the image config", func() (Result, error) {
+		return l.r.Env(ctx, image)
+	})
+}
+
+func (l logged) Stat(ctx context.Context, image string, path string) (Result, error) {
+	return l.log(image, "stat "+path, func() (Result, error) {
+		return l.r.Stat(ctx, image, path)
+	})
+}
+
+func (l logged) log(image string, what string, run func() (Result, error)) (Result, error) {
+	fmt.Fprintf(l.w, "+ test %s: %s\n", image, what)
+	res, err := run()
+	if err != nil || res.Skipped {
+		return res, err
+	}
+	io.WriteString(l.w, res.Output)
+	if res.Output != "" && !strings.HasSuffix(res.Output, "\n") {
+		io.WriteString(l.w, "\n")
+	}
+	if res.ExitCode != 0 {
+		fmt.Fprintf(l.w, "exit code %d\n", res.ExitCode)
+	}
+	return res, nil
+}
+
+// Run evaluates every step against image, stopping at the first failure.
+func (s Suite) Run(ctx context.Context, r Runner, image string) error {
+	for i, step := range s {
+		if err := step.run(ctx, r, image); err != nil {
+			return fmt.Errorf("test[%d] %s: %w", i, step.name(), err)
+		}
+	}
+	return nil
+}
+
+func (s Step) name() string {
+	switch {
+	case s.Name != "":
+		return s.Name
+	case len(s.Run) > 0:
+		return strings.Join(s.Run, " ")
+	case s.File != "":
+		return "file " + s.File
+	default:
+		return "env"
+	}
+}
+
+func (s Step) run(ctx context.Context, r Runner, image string) error {
+	switch {
+	case s.File != "":
+		res, err := r.Stat(ctx, image, s.File)
+		if err != nil || res.Skipped {
+			return err
+		}
+		if exists := res.ExitCode == 0; exists == s.Absent {
+			if s.Absent {
+				return fmt.Errorf("%s exists", s.File)
+			}
+			return fmt.Errorf("%s does not exist", s.File)
+		}
+		return nil
+
+	case len(s.Env) > 0:
+		res, err := r.Env(ctx, image)
+		if err != nil || res.Skipped {
+			return err
+		}
+		if res.ExitCode != 0 {
+			return fmt.Errorf("inspect exited with %d: %s", res.ExitCode, res.Output)
+		}
+		env := map[string]string{}
+		for _, line := range strings.Split(res.Output, "\n") {
+			if k, v, ok := strings.Cut(line, "="); ok {
+				env[k] = v
+			}
+		}
+		for _, k := range sortedKeys(s.Env) {
+			if got, ok := env[k]; !ok || got != s.Env[k] {
+				return fmt.Errorf("%s = %q, want %q", k, got, s.Env[k])
+			}
+		}
+		return nil
+
+	default:
+		res, err := r.Run(ctx, image, s.Run)
+		if err != nil || res.Skipped {
+			return err
+		}
+		if res.ExitCode != s.ExitCode {
+			return fmt.Errorf("exited with %d, want %d: %s", res.ExitCode, s.ExitCode, res.Output)
+		}
+		for _, re := range s.Stdout {
+			if !regexp.MustCompile(re).MatchString(res.Output) {
+				return fmt.Errorf("output does not match %q: %s", re, res.Output)
+			}
+		}
+		return nil
+	}
+}
+
+// structureFile is the subset of the container-structure-test schema that
+// maps onto steps.
+type structureFile struct {
+	CommandTests []struct {
+		Name           string   `yaml:"name"`
+		Command        string   `yaml:"command"`
+		Args           []string `yaml:"args"`
+		ExpectedOutput []string `yaml:"expectedOutput"`
+		ExitCode       int      `yaml:"exitCode"`
+	} `yaml:"commandTests"`
+	FileExistenceTests []struct {
+		Name        string `yaml:"name"`
+		Path        string `yaml:"path"`
+		ShouldExist *bool  `yaml:"shouldExist"`
+	} `yaml:"fileExistenceTests"`
+	MetadataTest struct {
+		EnvVars []struct {
+			Key   string `yaml:"key"`
+			Value string `yaml:"value"`
+		} `yaml:"envVars"`
+	} `yaml:"metadataTest"`
+}
+
+func loadStructure(path string) (Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var f structureFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	suite := Suite{}
+	for _, t := range f.CommandTests {
+		suite = append(suite, Step{
+			Name:     t.Name,
+			Run:      append([]string{t.Command}, t.Args...),
+			ExitCode: t.ExitCode,
+			Stdout:   t.ExpectedOutput,
+		})
+	}
+	for _, t := range f.FileExistenceTests {
+		absent := t.ShouldExist != nil && !*t.ShouldExist
+		suite = append(suite, Step{Name: t.Name, File: t.Path, Absent: absent})
+	}
+	if vars := f.MetadataTest.EnvVars; len(vars) > 0 {
+		env := map[string]string{}
+		for _, v := range vars {
+			env[v.Key] = v.Value
+		}
+		suite = append(suite, Step{Name: "metadata env", Env: env})
+	}
+	return suite, nil
+}
@@ -0,0 +1,175 @@
+package smoke_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/smoke"
+)
+
+const steps = `
+- name: go runs
+  run: [go, version]
+  stdout: ["^go version go1\\."]
+- file: /usr/local/go/bin/go
+- file: /root/.cache
+  absent: true
+- env: { GOPATH: /go }
+`
+
+func mustParse(t *testing.T, params, dir string) smoke.Suite {
+	t.Helper()
+	s, err := smoke.Parse([]byte(params), dir)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return s
+}
+
+func TestRun(t *testing.T) {
+	suite := mustParse(t, steps, ".")
+	if len(suite) != 4 {
+		t.Fatalf("steps = %d, want 4", len(suite))
+	}
+
+	r := &smoke.Fake{Results: map[string]smoke.Result{
+		"go version":        {Output: "go version go1.24.0 linux/amd64\n"},
+		"stat /root/.cache": {ExitCode: 1},
+		"env":               {Output: "PATH=/usr/bin\nGOPATH=/go\n"},
+	}}
+	if err := suite.Run(context.Background(), r, "me.io/x:1"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(r.Calls) != 4 || r.Calls[0].Image != "me.io/x:1" {
+		t.Errorf("calls = %+v", r.Calls)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	cases := []struct {
+		name    string
+		results map[string]smoke.Result
+		want    string
+	}{
+		{"exit code", map[string]smoke.Result{"go version": {ExitCode: 127, Output: "not found"}}, "exited with 127"},
+		{"output", map[string]smoke.Result{"go version": {Output: "gccgo"}}, "does not match"},
+		{"missing file", map[string]smoke.Result{
+			"go version":                {Output: "go version go1.24.0"},
+			"stat /usr/local/go/bin/go": {ExitCode: 1},
+		}, "does not exist"},
+		{"present file", map[string]smoke.Result{
+			"go version": {Output: "go version go1.24.0"},
+		}, "/root/.cache exists"},
+		{"env", map[string]smoke.Result{
+			"go version":        {Output: "go version go1.24.0"},
+			"stat /root/.cache": {ExitCode: 1},
+			"env":               {Output: "GOPATH=/home/go\n"},
+		}, `GOPATH = "/home/go"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mustParse(t, steps, ".").Run(context.Background(), &smoke.Fake{Results: tc.results}, "x:1")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	dir := t.TempDir()
+	cst := `schemaVersion: 2.0.0
+commandTests:
+  - name: node
+    command: node
+    args: [--version]
+    expectedOutput: ["v22\\."]
+fileExistenceTests:
+  - name: no npm cache
+    path: /root/.npm
+    shouldExist: false
+metadataTest:
+  envVars:
+    - key: NODE_ENV
+      value: production
+`
+	if err := os.WriteFile(filepath.Join(dir, "tests.yaml"), []byte(cst), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	suite := mustParse(t, "- structure: tests.yaml\n", dir)
+	if len(suite) != 3 {
+		t.Fatalf("steps = %+v, want 3", suite)
+	}
+	if got := strings.Join(suite[0].Run, " "); got != "node --version" {
+		t.Errorf("command = %q", got)
+	}
+	if suite[1].File != "/root/.npm" || !suite[1].Absent {
+		t.Errorf("file step = %+v", suite[1])
+	}
+	if suite[2].Env["NODE_ENV"] != "production" {
+		t.Errorf("env step = %+v", suite[2])
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, params := range []string{
+		"- name: nothing\n",
+		"- run: [x]\n  file: /y\n",
+		"- run: [x]\n  stdout: [\"(\"]\n",
+		"- structure: missing.yaml\n",
+	} {
+		if _, err := smoke.Parse([]byte(params), t.TempDir()); err == nil {
+			t.Errorf("expected error for %q", params)
+		}
+	}
+}
+
+func TestDockerDryRun(t *testing.T) {
+	var out strings.Builder
+	d := smoke.Docker{DryRun: true, Stdout: &out}
+	res, err := d.Run(context.Background(), "me/x:1", []string{"sh", "-c", "echo $HOME"})
+	if err != nil || !res.Skipped {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if want := "docker run --rm --entrypoint sh me/x:1 -c 'echo $HOME'\n"; out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestDockerDryRunInspects(t *testing.T) {
+	// File and env steps run nothing in the image, so they also pass on
+	// images without a shell.
+	var out strings.Builder
+	d := smoke.Docker{Bin: "podman", DryRun: true, Stdout: &out}
+	if res, err := d.Env(context.Background(), "me/x:1"); err != nil || !res.Skipped {
+		t.Fatalf("env: res = %+v, err = %v", res, err)
+	}
+	if res, err := d.Stat(context.Background(), "me/x:1", "/bin/x"); err != nil || !res.Skipped {
+		t.Fatalf("stat: res = %+v, err = %v", res, err)
+	}
+	want := strings.Join([]string{
+		"podman image inspect --format '{{range .Config.Env}}{{println .}}{{end}}' me/x:1",
+		"podman create me/x:1 true",
+		"podman cp '<container>:/bin/x' -",
+		"podman rm '<container>'",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestLogged(t *testing.T) {
+	var log strings.Builder
+	f := &smoke.Fake{Results: map[string]smoke.Result{"false": {Output: "nope", ExitCode: 1}}}
+	r := smoke.Logged(f, &log)
+	if res, _ := r.Run(context.Background(), "me/x:1", []string{"false"}); res.ExitCode != 1 {
+		t.Errorf("exit code = %d", res.ExitCode)
+	}
+	if want := "+ test me/x:1: false\nnope\nexit code 1\n"; log.String() != want {
+		t.Errorf("log = %q, want %q", log.String(), want)
+	}
+}
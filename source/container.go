@@ -9,6 +9,12 @@ import (
 
 func init() {
 	Register("container", newContainer)
+	RegisterSchema("container", `{
+		"properties": {
+			"repo": {"type": "string", "description": "upstream OCI repository whose tags are the versions"}
+		},
+		"required": ["repo"]
+	}`)
 }
 
 // containerConfig is the config for the container source.
@@ -13,6 +13,12 @@ import (
 
 func init() {
 	Register("http", newHTTP)
+	RegisterSchema("http", `{
+		"properties": {
+			"url": {"type": "string", "description": "endpoint whose body is a bare version"}
+		},
+		"required": ["url"]
+	}`)
 }
 
 // httpConfig is the config for the http source.
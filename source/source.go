@@ -6,6 +6,7 @@ package source
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
@@ -36,6 +37,37 @@ func Register(kind string, f Factory) {
 	registry[kind] = f
 }
 
+var schemas = map[string]json.RawMessage{}
+
+// RegisterSchema declares the JSON Schema of the mapping kind is configured
+// with, which `clade lint` validates ports against and exports for editors. It
+// describes the kind's own fields; the linter adds kind itself. It panics on a
+// duplicate or malformed schema and is intended to be called from init, next
+// to Register.
+func RegisterSchema(kind string, schema string) {
+	if _, dup := schemas[kind]; dup {
+		panic(fmt.Sprintf("source: schema of kind %q already registered", kind))
+	}
+	if !json.Valid([]byte(schema)) {
+		panic(fmt.Sprintf("source: schema of kind %q is not valid JSON", kind))
+	}
+	schemas[kind] = json.RawMessage(schema)
+}
+
+// Schemas returns the JSON Schema of every registered kind. A kind that
+// registered none accepts any field.
+func Schemas() map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(registry))
+	for kind := range registry {
+		s, ok := schemas[kind]
+		if !ok {
+			s = json.RawMessage(`{"type":"object"}`)
+		}
+		out[kind] = s
+	}
+	return out
+}
+
 // New constructs the Source registered under kind, decoding params.
 func New(kind string, params []byte, deps Deps) (Source, error) {
 	f, ok := registry[kind]
@@ -12,6 +12,33 @@ import (
 
 func init() {
 	Register("calver", newCalver)
+	RegisterSchema("calver", `{
+		"$defs": {
+			"predicate": {
+				"type": "object",
+				"properties": {
+					"in": {"type": "array", "items": {"type": "integer"}, "description": "keep only these values"},
+					"mod": {"type": "array", "items": {"type": "integer"}, "minItems": 2, "maxItems": 2, "description": "[divisor, remainder]"}
+				},
+				"additionalProperties": false
+			}
+		},
+		"properties": {
+			"layout": {"type": "string", "description": "how each version is parsed, e.g. \"YY.0M\""},
+			"where": {
+				"type": "object",
+				"properties": {
+					"year": {"$ref": "#/$defs/predicate"},
+					"month": {"$ref": "#/$defs/predicate"},
+					"day": {"$ref": "#/$defs/predicate"},
+					"micro": {"$ref": "#/$defs/predicate"}
+				},
+				"additionalProperties": false
+			},
+			"last": {"type": "integer", "minimum": 0, "description": "keep the newest N versions (0 = all)"}
+		},
+		"required": ["layout"]
+	}`)
 }
 
 // calverConfig is the target spec for the calver strategy.
@@ -283,16 +310,30 @@ func atoiStrict(s string) (int, bool) {
 // Select parses each tag with the layout, drops those failing the where
 // predicates, then keeps the newest last versions.
 func (s *calverSelector) Select(tags []string) ([]Matched, error) {
+	return s.sel(tags, func(string, string, string) {}), nil
+}
+
+// Trace implements Tracer.
+func (s *calverSelector) Trace(tags []string) ([]Matched, []Verdict, error) {
+	dropped := map[string]Verdict{}
+	matched := s.sel(tags, func(t, step, detail string) {
+		dropped[t] = Verdict{Tag: t, Step: step, Detail: detail}
+	})
+	return matched, verdicts(tags, matched, dropped), nil
+}
+
+// sel selects among tags, calling drop with the step that dropped each tag
+// that is not selected.
+func (s *calverSelector) sel(tags []string, drop func(tag, step, detail string)) []Matched {
 	var versions []*CalVer
 	for _, t := range tags {
 		cv := s.parse(t)
 		if cv == nil {
+			drop(t, StepParse, "does not match the layout")
 			continue // ignore tags that do not match the layout
 		}
-		if !s.where.Where.Year.allows(cv.year) ||
-			!s.where.Where.Month.allows(cv.month) ||
-			!s.where.Where.Day.allows(cv.day) ||
-			!s.where.Where.Micro.allows(cv.micro) {
+		if failed := s.failed(cv); failed != "" {
+			drop(t, StepWhere, failed+" does not satisfy where")
 			continue
 		}
 		versions = append(versions, cv)
@@ -300,6 +341,9 @@ func (s *calverSelector) Select(tags []string) ([]Matched, error) {
 
 	sort.Slice(versions, func(i, j int) bool { return versions[j].less(versions[i]) })
 	if s.last > 0 && len(versions) > s.last {
+		for _, cv := range versions[s.last:] {
+			drop(cv.Version, StepLast, fmt.Sprintf("not among the newest %d", s.last))
+		}
 		versions = versions[:s.last]
 	}
 
@@ -307,5 +351,21 @@ func (s *calverSelector) Select(tags []string) ([]Matched, error) {
 	for _, cv := range versions {
 		out = append(out, Matched{Tag: cv.Version, Data: cv})
 	}
-	return out, nil
+	return out
+}
+
+// failed names the first component of cv that fails its where predicate, or
+// returns "" if none does.
+func (s *calverSelector) failed(cv *CalVer) string {
+	switch {
+	case !s.where.Where.Year.allows(cv.year):
+		return "year " + strconv.Itoa(cv.year)
+	case !s.where.Where.Month.allows(cv.month):
+		return "month " + strconv.Itoa(cv.month)
+	case !s.where.Where.Day.allows(cv.day):
+		return "day " + strconv.Itoa(cv.day)
+	case !s.where.Where.Micro.allows(cv.micro):
+		return "micro " + strconv.Itoa(cv.micro)
+	}
+	return ""
 }
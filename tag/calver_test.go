@@ -90,3 +90,27 @@ func TestCalverFullYearAndDay(t *testing.T) {
 		t.Errorf("selected = %v, want %v", got, want)
 	}
 }
+
+func TestCalverTrace(t *testing.T) {
+	s, err := tag.New("calver", []byte("kind: calver\nlayout: \"YY.0M\"\nwhere:\n  month: { in: [4] }\nlast: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, verdicts, err := tag.Trace(s, []string{"22.04", "23.10", "24.04", "noble"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range verdicts {
+		got = append(got, v.Tag+" "+v.Step+": "+v.Detail)
+	}
+	want := []string{
+		"22.04 last: not among the newest 1",
+		"23.10 where: month 10 does not satisfy where",
+		"24.04 : ",
+		"noble unparsable: does not match the layout",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("verdicts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
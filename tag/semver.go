@@ -10,6 +10,13 @@ import (
 
 func init() {
 	Register("semver", newSemver)
+	RegisterSchema("semver", `{
+		"properties": {
+			"last-major": {"type": "integer", "minimum": 0, "description": "keep the latest N major lines (0 = all)"},
+			"last-minor": {"type": "integer", "minimum": 0, "description": "keep the latest N minor lines per major (0 = all)"},
+			"pre-release": {"type": "string", "description": "only tags with this exact pre-release"}
+		}
+	}`)
 }
 
 // semverConfig is the target spec for the semver strategy.
@@ -52,20 +59,45 @@ type semverTag struct {
 // Select keeps, for the latest lastMajor major lines, the latest lastMinor
 // minor lines, each represented by its newest patch.
 func (s *semverSelector) Select(tags []string) ([]Matched, error) {
+	return s.sel(tags, func(string, string, string) {}), nil
+}
+
+// Trace implements Tracer.
+func (s *semverSelector) Trace(tags []string) ([]Matched, []Verdict, error) {
+	dropped := map[string]Verdict{}
+	matched := s.sel(tags, func(t, step, detail string) {
+		dropped[t] = Verdict{Tag: t, Step: step, Detail: detail}
+	})
+	return matched, verdicts(tags, matched, dropped), nil
+}
+
+// sel selects among tags, calling drop with the step that dropped each tag
+// that is not selected.
+func (s *semverSelector) sel(tags []string, drop func(tag, step, detail string)) []Matched {
 	// Collapse to the newest version per (major, minor) line.
 	lines := map[[2]uint64]semverTag{}
 	for _, t := range tags {
 		v, err := semver.NewVersion(t)
 		if err != nil {
+			drop(t, StepParse, "not a semantic version")
 			continue // ignore tags that are not semver
 		}
 		if v.Prerelease() != s.preRelease {
+			drop(t, StepPreRelease, fmt.Sprintf("pre-release %q, want %q", v.Prerelease(), s.preRelease))
 			continue // keep only the exact pre-release ("" = none)
 		}
 
 		key := [2]uint64{v.Major(), v.Minor()}
-		if cur, ok := lines[key]; !ok || v.GreaterThan(cur.version) {
+		cur, ok := lines[key]
+		if !ok || v.GreaterThan(cur.version) {
+			if ok {
+				drop(cur.tag, StepCollapsed, fmt.Sprintf("%s is newer", t))
+			}
 			lines[key] = semverTag{tag: t, version: v}
+		} else if v.Equal(cur.version) {
+			drop(t, StepCollapsed, fmt.Sprintf("%s is the same version", cur.tag))
+		} else {
+			drop(t, StepCollapsed, fmt.Sprintf("%s is newer", cur.tag))
 		}
 	}
 
@@ -82,6 +114,11 @@ func (s *semverSelector) Select(tags []string) ([]Matched, error) {
 	}
 	sort.Slice(majors, func(i, j int) bool { return majors[i] > majors[j] })
 	if s.lastMajor > 0 && len(majors) > s.lastMajor {
+		for _, major := range majors[s.lastMajor:] {
+			for _, line := range by_major[major] {
+				drop(line.tag, StepLastMajor, fmt.Sprintf("major %d is not among the latest %d", major, s.lastMajor))
+			}
+		}
 		majors = majors[:s.lastMajor]
 	}
 
@@ -90,11 +127,14 @@ func (s *semverSelector) Select(tags []string) ([]Matched, error) {
 		group := by_major[major]
 		sort.Slice(group, func(i, j int) bool { return group[i].version.GreaterThan(group[j].version) })
 		if s.lastMinor > 0 && len(group) > s.lastMinor {
+			for _, line := range group[s.lastMinor:] {
+				drop(line.tag, StepLastMinor, fmt.Sprintf("minor %d.%d is not among the latest %d of major %d", major, line.version.Minor(), s.lastMinor, major))
+			}
 			group = group[:s.lastMinor]
 		}
 		for _, line := range group {
 			out = append(out, Matched{Tag: line.tag, Data: line.version})
 		}
 	}
-	return out, nil
+	return out
 }
@@ -93,3 +93,37 @@ func TestSemverDataRendersTemplate(t *testing.T) {
 		t.Errorf("rendered = %q, want %q", sb.String(), "1.22.3-alpine")
 	}
 }
+
+func TestSemverTrace(t *testing.T) {
+	s, err := tag.New("semver", []byte("kind: semver\nlast-major: 1\nlast-minor: 1\npre-release: alpine\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []string{"latest", "1.24.0", "1.23.1-alpine", "1.23.2-alpine", "1.22.9-alpine", "0.9.0-alpine"}
+	matched, verdicts, err := tag.Trace(s, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tagsOf(matched); strings.Join(got, ",") != "1.23.2-alpine" {
+		t.Errorf("selected = %v", got)
+	}
+
+	var got []string
+	for _, v := range verdicts {
+		got = append(got, v.Tag+" "+v.Step+": "+v.Detail)
+		if v.Selected != (v.Tag == "1.23.2-alpine") {
+			t.Errorf("%s selected = %v", v.Tag, v.Selected)
+		}
+	}
+	want := []string{
+		"latest unparsable: not a semantic version",
+		`1.24.0 pre-release: pre-release "", want "alpine"`,
+		"1.23.1-alpine collapsed: 1.23.2-alpine is newer",
+		"1.23.2-alpine : ",
+		"1.22.9-alpine last-minor: minor 1.22 is not among the latest 1 of major 1",
+		"0.9.0-alpine last-major: major 0 is not among the latest 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("verdicts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
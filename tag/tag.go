@@ -4,7 +4,10 @@
 // port.yaml.
 package tag
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // Matched is a selected upstream tag together with the data used to render the
 // build tag template. For the semver strategy, Data is a *semver.Version, whose
@@ -19,6 +22,77 @@ type Selector interface {
 	Select(tags []string) ([]Matched, error)
 }
 
+// Steps of a selection that drop a candidate tag, as a Verdict reports them.
+const (
+	StepParse      = "unparsable"  // the tag is not a version of the kind
+	StepPreRelease = "pre-release" // semver: the pre-release is not the one tracked
+	StepCollapsed  = "collapsed"   // semver: a newer patch of the minor line is kept
+	StepLastMajor  = "last-major"  // semver: the major line is older than last-major
+	StepLastMinor  = "last-minor"  // semver: the minor line is older than last-minor
+	StepWhere      = "where"       // calver: a where predicate failed
+	StepLast       = "last"        // calver: older than the newest last versions
+)
+
+// Verdict is what a selection made of one candidate tag.
+type Verdict struct {
+	Tag string `json:"tag"`
+	// Selected is set when the tag is among the matched ones.
+	Selected bool `json:"selected"`
+	// Step is the step that dropped the tag, one of the Step constants; empty
+	// when it was selected, or when the selector does not trace.
+	Step string `json:"step,omitempty"`
+	// Detail explains the verdict, e.g. "1.22.3 is newer".
+	Detail string `json:"detail,omitempty"`
+}
+
+// Tracer is implemented by a Selector that can explain its selection. Trace
+// selects as Select does and returns a verdict for every candidate, in the
+// order of tags.
+type Tracer interface {
+	Trace(tags []string) ([]Matched, []Verdict, error)
+}
+
+// Trace selects among tags with s, explaining the verdict of each tag when s
+// is a Tracer. Otherwise the verdicts only tell which tags were selected.
+func Trace(s Selector, tags []string) ([]Matched, []Verdict, error) {
+	if t, ok := s.(Tracer); ok {
+		return t.Trace(tags)
+	}
+	matched, err := s.Select(tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := map[string]bool{}
+	for _, m := range matched {
+		selected[m.Tag] = true
+	}
+	verdicts := make([]Verdict, len(tags))
+	for i, t := range tags {
+		verdicts[i] = Verdict{Tag: t, Selected: selected[t]}
+	}
+	return matched, verdicts, nil
+}
+
+// verdicts returns the verdict of every tag, in order, from the steps that
+// dropped some of them: dropped maps a tag to its verdict.
+func verdicts(tags []string, matched []Matched, dropped map[string]Verdict) []Verdict {
+	selected := map[string]bool{}
+	for _, m := range matched {
+		selected[m.Tag] = true
+	}
+	out := make([]Verdict, len(tags))
+	for i, t := range tags {
+		if selected[t] {
+			out[i] = Verdict{Tag: t, Selected: true}
+		} else if v, ok := dropped[t]; ok {
+			out[i] = v
+		} else {
+			out[i] = Verdict{Tag: t}
+		}
+	}
+	return out
+}
+
 // Factory builds a Selector from the raw YAML of a target spec.
 type Factory func(params []byte) (Selector, error)
 
@@ -33,6 +107,37 @@ func Register(kind string, f Factory) {
 	registry[kind] = f
 }
 
+var schemas = map[string]json.RawMessage{}
+
+// RegisterSchema declares the JSON Schema of the mapping kind is configured
+// with, which `clade lint` validates ports against and exports for editors. It
+// describes the kind's own fields; the linter adds kind itself. It panics on a
+// duplicate or malformed schema and is intended to be called from init, next
+// to Register.
+func RegisterSchema(kind string, schema string) {
+	if _, dup := schemas[kind]; dup {
+		panic(fmt.Sprintf("tag: schema of kind %q already registered", kind))
+	}
+	if !json.Valid([]byte(schema)) {
+		panic(fmt.Sprintf("tag: schema of kind %q is not valid JSON", kind))
+	}
+	schemas[kind] = json.RawMessage(schema)
+}
+
+// Schemas returns the JSON Schema of every registered kind. A kind that
+// registered none accepts any field.
+func Schemas() map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(registry))
+	for kind := range registry {
+		s, ok := schemas[kind]
+		if !ok {
+			s = json.RawMessage(`{"type":"object"}`)
+		}
+		out[kind] = s
+	}
+	return out
+}
+
 // New constructs the Selector registered under kind, decoding params.
 func New(kind string, params []byte) (Selector, error) {
 	f, ok := registry[kind]
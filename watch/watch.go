@@ -0,0 +1,346 @@
+// Package watch runs clade as a daemon: a cycle (compute the graph, build what
+// is outdated) runs on a schedule or when a registry notifies a push, and its
+// health, readiness and Prometheus metrics are served over HTTP.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lesomnus/clade/watch/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule tells when the cycle after one started at a given time runs.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every schedules cycles a fixed interval apart.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Cron parses a standard five-field cron expression, such as "*/15 * * * *",
+// or a descriptor such as "@hourly".
+func Cron(expr string) (Schedule, error) {
+	s, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parse cron %q: %w", expr, err)
+	}
+	return s, nil
+}
+
+// Outcome is what a cycle found and did.
+type Outcome struct {
+	// Nodes is the size of the graph; Outdated how many of its nodes were.
+	Nodes    int
+	Outdated int
+	// Built, Failed and Skipped count the outdated nodes by the result of
+	// their build. A node is skipped when a node it is built on failed.
+	Built   int
+	Failed  int
+	Skipped int
+}
+
+// Request is the work of a triggered cycle.
+type Request struct {
+	// Pushes are pushes to registries. The ports built on the pushed
+	// repositories, and their descendants, are recomputed and their outdated
+	// nodes built.
+	Pushes []webhook.Event
+	// Nodes are ids of nodes to build, whether outdated or not.
+	Nodes []string
+}
+
+func (r *Request) empty() bool {
+	return len(r.Pushes) == 0 && len(r.Nodes) == 0
+}
+
+// add merges o into r, leaving out what r has already.
+func (r *Request) add(o Request) {
+	for _, e := range o.Pushes {
+		if !slices.Contains(r.Pushes, e) {
+			r.Pushes = append(r.Pushes, e)
+		}
+	}
+	for _, id := range o.Nodes {
+		if !slices.Contains(r.Nodes, id) {
+			r.Nodes = append(r.Nodes, id)
+		}
+	}
+}
+
+// Cycle computes the graph and builds the outdated nodes, or does the work of
+// req when it is not nil. A scheduled cycle is given none. Its context is not
+// cancelled on shutdown, so builds in flight finish.
+type Cycle func(ctx context.Context, req *Request) (Outcome, error)
+
+// Daemon runs a Cycle on a Schedule, and a targeted one on every Trigger.
+type Daemon struct {
+	// Schedule may be nil to run cycles on triggers only.
+	Schedule Schedule
+	Cycle    Cycle
+	Logger   *slog.Logger
+
+	metricsOnce sync.Once
+	metrics     *Metrics
+
+	wakeOnce sync.Once
+	wake     chan struct{}
+
+	mu       sync.Mutex
+	ready    bool
+	draining bool
+	pending  Request
+}
+
+// Metrics returns the Prometheus metrics of d.
+func (d *Daemon) Metrics() *Metrics {
+	d.metricsOnce.Do(func() { d.metrics = NewMetrics() })
+	return d.metrics
+}
+
+// Run runs a cycle at once and then on the schedule until ctx is done, and a
+// cycle for the requests triggered in between. A cycle in flight when
+// ctx is done runs to its end before Run returns.
+//
+// Without a schedule, no cycle runs until a trigger, and the daemon is ready
+// from the start.
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.Cycle == nil {
+		return errors.New("watch: a cycle is required")
+	}
+	l := d.logger()
+	defer func() {
+		d.mu.Lock()
+		d.draining = true
+		d.mu.Unlock()
+	}()
+
+	cycle_ctx := context.WithoutCancel(ctx)
+	var next time.Time
+	if d.Schedule == nil {
+		d.mu.Lock()
+		d.ready = true
+		d.mu.Unlock()
+	} else {
+		next = time.Now()
+	}
+
+	for {
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if d.Schedule != nil {
+			timer = time.NewTimer(time.Until(next))
+			tick = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-tick:
+			timer = nil
+			// The full cycle covers the pushes so far.
+			d.mu.Lock()
+			d.pending.Pushes = nil
+			d.mu.Unlock()
+
+			started := time.Now()
+			d.runCycle(cycle_ctx, started, nil)
+			next = d.Schedule.Next(started)
+			if !next.After(time.Now()) {
+				// The cycle overran its slot; skip to the next one ahead.
+				next = d.Schedule.Next(time.Now())
+			}
+			l.Info("next cycle", slog.Time("at", next))
+
+		case <-d.wakeup():
+			d.mu.Lock()
+			req := d.pending
+			d.pending = Request{}
+			d.mu.Unlock()
+			if !req.empty() {
+				d.runCycle(cycle_ctx, time.Now(), &req)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Trigger queues a cycle for req. Requests triggered while a cycle runs are
+// coalesced into the one after it.
+func (d *Daemon) Trigger(req Request) {
+	if req.empty() {
+		return
+	}
+	d.mu.Lock()
+	d.pending.add(req)
+	d.mu.Unlock()
+
+	select {
+	case d.wakeup() <- struct{}{}:
+	default:
+		// A wake-up is already queued.
+	}
+}
+
+func (d *Daemon) wakeup() chan struct{} {
+	d.wakeOnce.Do(func() { d.wake = make(chan struct{}, 1) })
+	return d.wake
+}
+
+func (d *Daemon) runCycle(ctx context.Context, started time.Time, req *Request) {
+	l := d.logger()
+	m := d.Metrics()
+
+	kind := "scheduled"
+	if req != nil {
+		kind = "triggered"
+		l = l.With(slog.Int("pushes", len(req.Pushes)), slog.Int("nodes", len(req.Nodes)))
+	}
+	l.Info("cycle started", slog.String("kind", kind))
+	out, err := d.Cycle(ctx, req)
+	elapsed := time.Since(started)
+
+	m.cycleSeconds.Observe(elapsed.Seconds())
+	if req == nil {
+		// A triggered cycle sees a part of the graph only.
+		m.nodes.Set(float64(out.Nodes))
+		m.outdated.Set(float64(out.Outdated))
+	}
+	m.builds.WithLabelValues("succeeded").Add(float64(out.Built))
+	m.builds.WithLabelValues("failed").Add(float64(out.Failed))
+	m.builds.WithLabelValues("skipped").Add(float64(out.Skipped))
+
+	attrs := []any{
+		slog.Duration("took", elapsed),
+		slog.Int("outdated", out.Outdated),
+		slog.Int("built", out.Built),
+		slog.Int("failed", out.Failed),
+		slog.Int("skipped", out.Skipped),
+	}
+	if err != nil {
+		m.cycles.WithLabelValues(kind, "error").Inc()
+		l.Error("cycle failed", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	m.cycles.WithLabelValues(kind, "ok").Inc()
+	m.lastSuccess.Set(float64(time.Now().Unix()))
+	l.Info("cycle finished", attrs...)
+
+	d.mu.Lock()
+	d.ready = true
+	d.mu.Unlock()
+}
+
+func (d *Daemon) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return d.Logger
+}
+
+// Handler serves:
+//
+//	/healthz  200 while the daemon runs
+//	/readyz   200 once a cycle succeeded (at once without a schedule), 503
+//	          before and while shutting down
+//	/metrics  the Prometheus metrics
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		ready, draining := d.ready, d.draining
+		d.mu.Unlock()
+		switch {
+		case draining:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		case !ready:
+			http.Error(w, "no cycle succeeded yet", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(d.Metrics().Registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// Metrics are the Prometheus metrics of a Daemon, in a registry of their own.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	cycles       *prometheus.CounterVec
+	cycleSeconds prometheus.Histogram
+	nodes        prometheus.Gauge
+	outdated     prometheus.Gauge
+	builds       *prometheus.CounterVec
+	lastSuccess  prometheus.Gauge
+	webhooks     *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		cycles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clade_watch_cycles_total",
+			Help: "Cycles run, by kind (scheduled, triggered) and result (ok, error).",
+		}, []string{"kind", "result"}),
+		cycleSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "clade_watch_cycle_duration_seconds",
+			Help:    "Duration of a cycle, builds included.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		nodes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "clade_watch_nodes",
+			Help: "Nodes in the graph of the last cycle.",
+		}),
+		outdated: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "clade_watch_outdated_nodes",
+			Help: "Outdated nodes found by the last cycle.",
+		}),
+		builds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clade_watch_builds_total",
+			Help: "Builds of outdated nodes, by result (succeeded, failed, skipped).",
+		}, []string{"result"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "clade_watch_last_success_timestamp_seconds",
+			Help: "Unix time the last successful cycle finished.",
+		}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clade_watch_webhooks_total",
+			Help: "Webhook requests received, by provider and result (accepted, unauthorized, invalid).",
+		}, []string{"provider", "result"}),
+	}
+	m.Registry.MustRegister(
+		m.cycles, m.cycleSeconds, m.nodes, m.outdated, m.builds, m.lastSuccess, m.webhooks,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveWebhook counts a webhook request of provider by its result; it is a
+// webhook.Handler's Observe.
+func (m *Metrics) ObserveWebhook(provider, result string) {
+	m.webhooks.WithLabelValues(provider, result).Inc()
+}
@@ -0,0 +1,178 @@
+package watch_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lesomnus/clade/watch"
+	"github.com/lesomnus/clade/watch/webhook"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestDaemon(t *testing.T) {
+	var runs atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	d := &watch.Daemon{
+		Schedule: watch.Every(time.Millisecond),
+		Cycle: func(ctx context.Context, req *watch.Request) (watch.Outcome, error) {
+			switch runs.Add(1) {
+			case 1:
+				return watch.Outcome{}, errors.New("registry down")
+			case 2:
+				return watch.Outcome{Nodes: 5, Outdated: 2, Built: 1, Failed: 1}, nil
+			case 3:
+				close(started)
+				<-release
+				if ctx.Err() != nil {
+					t.Error("the cycle in flight was cancelled")
+				}
+			}
+			return watch.Outcome{Nodes: 5}, nil
+		},
+	}
+	h := d.Handler()
+	if code, _ := get(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before a cycle = %d", code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	<-started
+	if code, _ := get(t, h, "/readyz"); code != http.StatusOK {
+		t.Errorf("readyz after a successful cycle = %d", code)
+	}
+	if code, _ := get(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("healthz = %d", code)
+	}
+
+	// Shutting down waits for the cycle in flight.
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Run returned before the cycle in flight finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := runs.Load(); n != 3 {
+		t.Errorf("cycles = %d, want 3", n)
+	}
+	if code, _ := get(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz after shutdown = %d", code)
+	}
+
+	_, metrics := get(t, h, "/metrics")
+	for _, want := range []string{
+		`clade_watch_cycles_total{kind="scheduled",result="error"} 1`,
+		`clade_watch_cycles_total{kind="scheduled",result="ok"} 2`,
+		`clade_watch_builds_total{result="failed"} 1`,
+		`clade_watch_builds_total{result="succeeded"} 1`,
+		"clade_watch_nodes 5",
+		"clade_watch_outdated_nodes 0",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
+
+func TestDaemonTrigger(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cycles := make(chan *watch.Request, 4)
+	var runs atomic.Int32
+	d := &watch.Daemon{
+		Cycle: func(ctx context.Context, req *watch.Request) (watch.Outcome, error) {
+			if req == nil {
+				t.Error("a full cycle ran without a schedule")
+			}
+			if runs.Add(1) == 1 {
+				close(started)
+				<-release
+			}
+			cycles <- req
+			return watch.Outcome{Outdated: 1, Built: 1}, nil
+		},
+	}
+	h := d.Handler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	a := webhook.Event{Repo: "docker.io/library/golang", Tag: "1.22"}
+	b := webhook.Event{Repo: "ghcr.io/me/base", Tag: "1"}
+	d.Trigger(watch.Request{Pushes: []webhook.Event{a}})
+	<-started
+	if code, _ := get(t, h, "/readyz"); code != http.StatusOK {
+		t.Errorf("readyz without a schedule = %d", code)
+	}
+
+	// Pushes during a cycle are coalesced into the next.
+	d.Trigger(watch.Request{Pushes: []webhook.Event{b}})
+	d.Trigger(watch.Request{Pushes: []webhook.Event{a, b}, Nodes: []string{"ghcr.io/me/x:1"}})
+	d.Trigger(watch.Request{})
+	close(release)
+	if got := <-cycles; !slices.Equal(got.Pushes, []webhook.Event{a}) || len(got.Nodes) != 0 {
+		t.Errorf("first cycle = %+v", got)
+	}
+	if got := <-cycles; !slices.Equal(got.Pushes, []webhook.Event{b, a}) || !slices.Equal(got.Nodes, []string{"ghcr.io/me/x:1"}) {
+		t.Errorf("second cycle = %+v", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-cycles:
+		t.Errorf("unexpected cycle for %v", got)
+	default:
+	}
+
+	d.Metrics().ObserveWebhook("github", "accepted")
+	_, metrics := get(t, h, "/metrics")
+	for _, want := range []string{
+		`clade_watch_cycles_total{kind="triggered",result="ok"} 2`,
+		`clade_watch_builds_total{result="succeeded"} 2`,
+		`clade_watch_webhooks_total{provider="github",result="accepted"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+}
+
+func TestCron(t *testing.T) {
+	s, err := watch.Cron("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 10, 7, 0, 0, time.UTC)
+	if next := s.Next(at); !next.Equal(time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)) {
+		t.Errorf("next = %v", next)
+	}
+	if _, err := watch.Cron("every minute"); err == nil {
+		t.Error("expected error for a bad expression")
+	}
+}
@@ -0,0 +1,316 @@
+// Package webhook receives the push notifications of container registries:
+// Docker Hub, GitHub Packages (ghcr.io), Harbor and the CNCF distribution
+// registry's notifications. Each provider is served on a path of its own, as
+// its payload carries no reliable mark of where it came from.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Event is a push of a tag to a repository.
+type Event struct {
+	// Repo is the repository with its registry, e.g. "ghcr.io/me/golang".
+	Repo string `json:"repo"`
+	Tag  string `json:"tag,omitempty"`
+}
+
+// Parser decodes the push events of a provider's payload; events of other
+// kinds, such as deletions, are left out.
+type Parser func(header http.Header, body []byte) ([]Event, error)
+
+var parsers = map[string]Parser{
+	"dockerhub":    parseDockerHub,
+	"github":       parseGitHub,
+	"harbor":       parseHarbor,
+	"distribution": parseDistribution,
+}
+
+// Providers returns the names of the supported providers, the last path
+// segment each is served on.
+func Providers() []string {
+	out := make([]string, 0, len(parsers))
+	for k := range parsers {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Parse decodes the push events of a payload of provider.
+func Parse(provider string, header http.Header, body []byte) ([]Event, error) {
+	p, ok := parsers[provider]
+	if !ok {
+		return nil, fmt.Errorf("webhook: unknown provider %q", provider)
+	}
+	return p(header, body)
+}
+
+// SameRepo reports whether a and b name the same repository, so that
+// "golang", "docker.io/library/golang" and "index.docker.io/library/golang"
+// are one.
+func SameRepo(a, b string) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// Normalize returns the canonical name of a repository, or repo itself if it
+// is not a valid name.
+func Normalize(repo string) string {
+	r, err := name.NewRepository(repo, name.WeakValidation)
+	if err != nil {
+		return repo
+	}
+	return r.Name()
+}
+
+func parseDockerHub(_ http.Header, body []byte) ([]Event, error) {
+	var p struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode docker hub payload: %w", err)
+	}
+	if p.Repository.RepoName == "" {
+		return nil, fmt.Errorf("docker hub payload has no repository")
+	}
+	return []Event{{Repo: "docker.io/" + p.Repository.RepoName, Tag: p.PushData.Tag}}, nil
+}
+
+// parseGitHub decodes the "package" and "registry_package" events of a
+// published container package.
+func parseGitHub(header http.Header, body []byte) ([]Event, error) {
+	switch e := header.Get("X-GitHub-Event"); e {
+	case "ping":
+		return nil, nil
+	case "", "package", "registry_package":
+	default:
+		return nil, nil
+	}
+
+	type version struct {
+		PackageURL        string `json:"package_url"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name string `json:"name"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	}
+	type pkg struct {
+		Name           string  `json:"name"`
+		Namespace      string  `json:"namespace"`
+		PackageType    string  `json:"package_type"`
+		PackageVersion version `json:"package_version"`
+	}
+	var p struct {
+		Action          string `json:"action"`
+		Package         *pkg   `json:"package"`
+		RegistryPackage *pkg   `json:"registry_package"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode github payload: %w", err)
+	}
+	pk := p.RegistryPackage
+	if pk == nil {
+		pk = p.Package
+	}
+	if pk == nil || p.Action != "published" || !strings.EqualFold(pk.PackageType, "container") {
+		return nil, nil
+	}
+
+	tag := pk.PackageVersion.ContainerMetadata.Tag.Name
+	if u := pk.PackageVersion.PackageURL; u != "" {
+		// e.g. "ghcr.io/me/golang:1.22"
+		repo, t := splitRef(u)
+		if tag == "" {
+			tag = t
+		}
+		return []Event{{Repo: repo, Tag: tag}}, nil
+	}
+	if pk.Namespace == "" || pk.Name == "" {
+		return nil, fmt.Errorf("github payload has no package name")
+	}
+	return []Event{{Repo: "ghcr.io/" + strings.ToLower(pk.Namespace) + "/" + pk.Name, Tag: tag}}, nil
+}
+
+func parseHarbor(_ http.Header, body []byte) ([]Event, error) {
+	var p struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode harbor payload: %w", err)
+	}
+	if p.Type != "PUSH_ARTIFACT" && p.Type != "pushImage" {
+		return nil, nil
+	}
+	out := []Event{}
+	for _, r := range p.EventData.Resources {
+		// e.g. "harbor.example.com/library/golang:1.22"
+		repo, tag := splitRef(r.ResourceURL)
+		if r.Tag != "" {
+			tag = r.Tag
+		}
+		out = append(out, Event{Repo: repo, Tag: tag})
+	}
+	return out, nil
+}
+
+// parseDistribution decodes a notification envelope of the CNCF distribution
+// registry, which batches events of every action.
+func parseDistribution(_ http.Header, body []byte) ([]Event, error) {
+	var p struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("decode distribution payload: %w", err)
+	}
+	out := []Event{}
+	for _, e := range p.Events {
+		// Pushes of blobs and untagged manifests precede the tag's.
+		if e.Action != "push" || e.Target.Tag == "" {
+			continue
+		}
+		repo := e.Target.Repository
+		if e.Request.Host != "" {
+			repo = e.Request.Host + "/" + repo
+		}
+		out = append(out, Event{Repo: repo, Tag: e.Target.Tag})
+	}
+	return out, nil
+}
+
+// splitRef splits "repo:tag" at the tag's colon, not a registry port's.
+func splitRef(ref string) (repo, tag string) {
+	ref = strings.TrimPrefix(strings.TrimPrefix(ref, "https://"), "http://")
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// maxBody bounds the payloads read.
+const maxBody = 1 << 20
+
+// Handler serves the providers' webhooks on POST <prefix>/<provider>.
+type Handler struct {
+	// Secret authenticates the payloads. GitHub signs them with it
+	// (X-Hub-Signature-256); the others must send it as the Authorization
+	// header, bare or as a bearer token, or as the token query parameter,
+	// which is all Docker Hub can send. Without a secret every payload is
+	// refused, as anyone could trigger builds.
+	Secret string
+	// OnEvents is called with the push events of every accepted payload.
+	OnEvents func(provider string, events []Event)
+	// Observe, when set, is told the result of every request: "accepted",
+	// "unauthorized" or "invalid".
+	Observe func(provider, result string)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a webhook payload", http.StatusMethodNotAllowed)
+		return
+	}
+	provider := path.Base(r.URL.Path)
+	if _, ok := parsers[provider]; !ok {
+		http.Error(w, fmt.Sprintf("unknown provider %q; one of %s", provider, strings.Join(Providers(), ", ")), http.StatusNotFound)
+		return
+	}
+	observe := func(result string) {
+		if h.Observe != nil {
+			h.Observe(provider, result)
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		observe("invalid")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Secret == "" {
+		observe("unauthorized")
+		http.Error(w, "no webhook secret is configured; payloads are not accepted", http.StatusForbidden)
+		return
+	}
+	if !h.authorized(provider, r, body) {
+		observe("unauthorized")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	events, err := Parse(provider, r.Header, body)
+	if err != nil {
+		observe("invalid")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	observe("accepted")
+	if len(events) > 0 && h.OnEvents != nil {
+		h.OnEvents(provider, events)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "%d push events\n", len(events))
+}
+
+func (h *Handler) authorized(provider string, r *http.Request, body []byte) bool {
+	if provider == "github" {
+		sig, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return false
+		}
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+
+	for _, v := range []string{
+		r.Header.Get("Authorization"),
+		strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+		r.URL.Query().Get("token"),
+	} {
+		if v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(h.Secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package webhook_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lesomnus/clade/watch/webhook"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		provider string
+		header   http.Header
+		body     string
+		want     []webhook.Event
+	}{
+		{
+			provider: "dockerhub",
+			body:     `{"push_data": {"tag": "1.22"}, "repository": {"repo_name": "me/golang"}}`,
+			want:     []webhook.Event{{Repo: "docker.io/me/golang", Tag: "1.22"}},
+		},
+		{
+			provider: "github",
+			header:   http.Header{"X-Github-Event": {"package"}},
+			body: `{"action": "published", "package": {"name": "golang", "namespace": "Me", "package_type": "CONTAINER",
+				"package_version": {"package_url": "ghcr.io/me/golang:1.22", "container_metadata": {"tag": {"name": "1.22"}}}}}`,
+			want: []webhook.Event{{Repo: "ghcr.io/me/golang", Tag: "1.22"}},
+		},
+		{
+			provider: "github",
+			header:   http.Header{"X-Github-Event": {"registry_package"}},
+			body: `{"action": "published", "registry_package": {"name": "golang", "namespace": "Me", "package_type": "container",
+				"package_version": {"container_metadata": {"tag": {"name": "1.22"}}}}}`,
+			want: []webhook.Event{{Repo: "ghcr.io/me/golang", Tag: "1.22"}},
+		},
+		{
+			provider: "github",
+			header:   http.Header{"X-Github-Event": {"package"}},
+			body:     `{"action": "published", "package": {"name": "lib", "namespace": "me", "package_type": "npm"}}`,
+			want:     nil,
+		},
+		{
+			provider: "harbor",
+			body: `{"type": "PUSH_ARTIFACT", "event_data": {"resources": [
+				{"tag": "1.22", "resource_url": "harbor.example.com:8443/library/golang:1.22"}]}}`,
+			want: []webhook.Event{{Repo: "harbor.example.com:8443/library/golang", Tag: "1.22"}},
+		},
+		{
+			provider: "harbor",
+			body:     `{"type": "DELETE_ARTIFACT", "event_data": {"resources": [{"resource_url": "h/x:1"}]}}`,
+			want:     nil,
+		},
+		{
+			provider: "distribution",
+			body: `{"events": [
+				{"action": "push", "target": {"repository": "me/golang"}, "request": {"host": "registry.local:5000"}},
+				{"action": "push", "target": {"repository": "me/golang", "tag": "1.22"}, "request": {"host": "registry.local:5000"}},
+				{"action": "pull", "target": {"repository": "me/golang", "tag": "1.21"}, "request": {"host": "registry.local:5000"}}]}`,
+			want: []webhook.Event{{Repo: "registry.local:5000/me/golang", Tag: "1.22"}},
+		},
+	}
+	for _, tc := range tcs {
+		got, err := webhook.Parse(tc.provider, tc.header, []byte(tc.body))
+		if err != nil {
+			t.Errorf("%s: %v", tc.provider, err)
+			continue
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && !slices.Equal(got, tc.want)) {
+			t.Errorf("%s: events = %v, want %v", tc.provider, got, tc.want)
+		}
+	}
+
+	if _, err := webhook.Parse("quay", nil, []byte("{}")); err == nil {
+		t.Error("expected error for an unknown provider")
+	}
+	if _, err := webhook.Parse("dockerhub", nil, []byte("{")); err == nil {
+		t.Error("expected error for a malformed payload")
+	}
+}
+
+func TestSameRepo(t *testing.T) {
+	if !webhook.SameRepo("golang", "docker.io/library/golang") {
+		t.Error("golang is docker.io/library/golang")
+	}
+	if !webhook.SameRepo("index.docker.io/me/golang", "docker.io/me/golang") {
+		t.Error("index.docker.io is docker.io")
+	}
+	if webhook.SameRepo("ghcr.io/me/golang", "docker.io/me/golang") {
+		t.Error("registries differ")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var got []webhook.Event
+	var results []string
+	h := &webhook.Handler{
+		Secret:   "s3cret",
+		OnEvents: func(provider string, events []webhook.Event) { got = append(got, events...) },
+		Observe:  func(provider, result string) { results = append(results, provider+":"+result) },
+	}
+	post := func(target string, header http.Header, body string) int {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		for k, vs := range header {
+			r.Header[k] = vs
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	hub := `{"push_data": {"tag": "1"}, "repository": {"repo_name": "me/x"}}`
+	if code := post("/webhook/dockerhub", nil, hub); code != http.StatusUnauthorized {
+		t.Errorf("without the token = %d", code)
+	}
+	if code := post("/webhook/dockerhub?token=s3cret", nil, hub); code != http.StatusAccepted {
+		t.Errorf("with the token = %d", code)
+	}
+	if code := post("/webhook/distribution", http.Header{"Authorization": {"Bearer s3cret"}}, `{"events": []}`); code != http.StatusAccepted {
+		t.Errorf("with a bearer token = %d", code)
+	}
+	if code := post("/webhook/harbor", http.Header{"Authorization": {"s3cret"}}, "{"); code != http.StatusBadRequest {
+		t.Errorf("malformed payload = %d", code)
+	}
+	if code := post("/webhook/quay", nil, "{}"); code != http.StatusNotFound {
+		t.Errorf("unknown provider = %d", code)
+	}
+
+	body := `{"action": "published", "package": {"name": "x", "namespace": "me", "package_type": "container",
+		"package_version": {"package_url": "ghcr.io/me/x:2"}}}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if code := post("/webhook/github", http.Header{"X-Hub-Signature-256": {sig}, "X-Github-Event": {"package"}}, body); code != http.StatusAccepted {
+		t.Errorf("signed = %d", code)
+	}
+	if code := post("/webhook/github", http.Header{"X-Hub-Signature-256": {sig}}, body+" "); code != http.StatusUnauthorized {
+		t.Errorf("signature of another body = %d", code)
+	}
+
+	want := []webhook.Event{{Repo: "docker.io/me/x", Tag: "1"}, {Repo: "ghcr.io/me/x", Tag: "2"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	want_results := []string{
+		"dockerhub:unauthorized", "dockerhub:accepted", "distribution:accepted",
+		"harbor:invalid", "github:accepted", "github:unauthorized",
+	}
+	if !slices.Equal(results, want_results) {
+		t.Errorf("results = %v, want %v", results, want_results)
+	}
+}
+
+func TestHandlerWithoutSecret(t *testing.T) {
+	// Without a secret, no payload can trigger work, authenticated or not.
+	var results []string
+	h := &webhook.Handler{
+		OnEvents: func(provider string, events []webhook.Event) { t.Errorf("events accepted: %v", events) },
+		Observe:  func(provider, result string) { results = append(results, provider+":"+result) },
+	}
+	hub := `{"push_data": {"tag": "1"}, "repository": {"repo_name": "me/x"}}`
+	for _, target := range []string{"/webhook/dockerhub", "/webhook/dockerhub?token="} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(hub)))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s = %d, want %d", target, rec.Code, http.StatusForbidden)
+		}
+	}
+	if want := []string{"dockerhub:unauthorized", "dockerhub:unauthorized"}; !slices.Equal(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}